@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+)
+
+const adminUsage = `Usage:
+  eventctl admin snapshot [-out FILE]   выгрузить все события в NDJSON
+  eventctl admin purge -yes             удалить все события на сервере
+  eventctl admin keygen -tenant T -scopes ingest,query [-name N]
+                                        сгенерировать API-ключ для файла ключей сервера
+`
+
+func runAdmin(c *client, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, adminUsage)
+		return fmt.Errorf("missing admin action")
+	}
+
+	switch args[0] {
+	case "snapshot":
+		fs := flag.NewFlagSet("admin snapshot", flag.ExitOnError)
+		out := fs.String("out", "", "файл для выгрузки (по умолчанию stdout)")
+		fs.Parse(args[1:])
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return c.Snapshot(w)
+
+	case "purge":
+		fs := flag.NewFlagSet("admin purge", flag.ExitOnError)
+		yes := fs.Bool("yes", false, "подтвердить удаление всех событий")
+		fs.Parse(args[1:])
+
+		if !*yes {
+			return fmt.Errorf("purge removes all events; pass -yes to confirm")
+		}
+		n, err := c.Purge()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("purged %d events\n", n)
+		return nil
+
+	case "keygen":
+		fs := flag.NewFlagSet("admin keygen", flag.ExitOnError)
+		name := fs.String("name", "", "описание ключа")
+		tenant := fs.String("tenant", "", "тенант ключа")
+		scopes := fs.String("scopes", "ingest,query", "права через запятую: ingest, query, admin")
+		fs.Parse(args[1:])
+
+		var list []auth.Scope
+		for _, s := range strings.Split(*scopes, ",") {
+			list = append(list, auth.Scope(strings.TrimSpace(s)))
+		}
+		// Генерация локальная: запись ключа добавляется в API_KEYS_FILE сервера,
+		// токен выдаётся клиенту и больше нигде не сохраняется
+		key, token, err := auth.NewToken(*name, *tenant, list)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "token (shown once): %s\n", token)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(key)
+
+	default:
+		fmt.Fprint(os.Stderr, adminUsage)
+		return fmt.Errorf("unknown admin action %q", args[0])
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// client - тонкая обёртка над HTTP API сервера
+type client struct {
+	baseURL string
+	http    *http.Client
+	// stream - клиент без общего таймаута для долгих SSE-соединений
+	stream *http.Client
+}
+
+// newClient: apiKey, если не пуст, передаётся в каждом запросе
+func newClient(baseURL, apiKey string) *client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if apiKey != "" {
+		transport = &apiKeyTransport{key: apiKey, next: transport}
+	}
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		stream:  &http.Client{Transport: transport},
+	}
+}
+
+// apiKeyTransport добавляет API-ключ в заголовок Authorization
+type apiKeyTransport struct {
+	key  string
+	next http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.key)
+	return t.next.RoundTrip(req)
+}
+
+// SendEvent отправляет одно событие и возвращает присвоенный ID
+func (c *client) SendEvent(event models.Event) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.http.Post(c.baseURL+"/events", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp)
+	}
+
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return result["id"], nil
+}
+
+// GetAggregated запрашивает агрегат по фильтрам; nil - данных нет
+func (c *client) GetAggregated(userID, eventType string, from, to time.Time) (*models.AggregatedData, error) {
+	q := url.Values{}
+	if userID != "" {
+		q.Set("user_id", userID)
+	}
+	if eventType != "" {
+		q.Set("type", eventType)
+	}
+	if !from.IsZero() {
+		q.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.Format(time.RFC3339))
+	}
+
+	var result struct {
+		models.AggregatedData
+		Message string `json:"message"`
+	}
+	if err := c.getJSON("/aggregated?"+q.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if result.Message != "" {
+		return nil, nil
+	}
+	return &result.AggregatedData, nil
+}
+
+// GetAllAggregated запрашивает все агрегации по фильтрам, проходя по всем
+// страницам /aggregated/all
+func (c *client) GetAllAggregated(eventType string, from, to time.Time) ([]models.AggregatedData, error) {
+	q := url.Values{}
+	if eventType != "" {
+		q.Set("type", eventType)
+	}
+	if !from.IsZero() {
+		q.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.Format(time.RFC3339))
+	}
+	q.Set("limit", "1000")
+
+	var result []models.AggregatedData
+	for {
+		var page struct {
+			Items      []models.AggregatedData `json:"items"`
+			NextCursor string                  `json:"next_cursor"`
+		}
+		if err := c.getJSON("/aggregated/all?"+q.Encode(), &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page.Items...)
+		if page.NextCursor == "" {
+			return result, nil
+		}
+		q.Set("cursor", page.NextCursor)
+	}
+}
+
+// Snapshot копирует NDJSON-выгрузку всех событий в w
+func (c *client) Snapshot(w io.Writer) error {
+	resp, err := c.http.Get(c.baseURL + "/admin/snapshot")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Purge удаляет все события на сервере
+func (c *client) Purge() (int, error) {
+	resp, err := c.http.Post(c.baseURL+"/admin/purge", "application/json", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp)
+	}
+
+	var result map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+	return result["purged"], nil
+}
+
+// sseMessage - одно сообщение из потока /stream
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+// Stream читает /stream с параметрами query и вызывает fn для каждого сообщения,
+// пока поток не оборвётся или не будет отменён ctx. lastID передаётся как
+// Last-Event-ID для возобновления.
+func (c *client) Stream(ctx context.Context, query url.Values, lastID string, fn func(sseMessage) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/stream?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	var msg sseMessage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if msg.Data != nil {
+				if err := fn(msg); err != nil {
+					return err
+				}
+			}
+			msg = sseMessage{}
+		case strings.HasPrefix(line, ":"):
+			// комментарий (heartbeat)
+		case strings.HasPrefix(line, "id: "):
+			msg.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.Data = append(msg.Data, strings.TrimPrefix(line, "data: ")...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+func (c *client) getJSON(path string, v interface{}) error {
+	resp, err := c.http.Get(c.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// responseError: тело в формате problem+json разворачивается в detail и
+// ошибки полей
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var p problem.Problem
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), problem.ContentType) && json.Unmarshal(msg, &p) == nil {
+		text := p.Error()
+		for _, fe := range p.Errors {
+			text += fmt.Sprintf("\n  %s: %s", fe.Field, fe.Message)
+		}
+		return fmt.Errorf("server returned %s (%s): %s", resp.Status, p.Code, text)
+	}
+	return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestReadEvents(t *testing.T) {
+	input := `{"user_id":"user-1","type":"click","value":1}
+
+{"user_id":"user-2","type":"view","value":2.5}
+`
+	events, err := readEvents(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[1].UserID != "user-2" || events[1].Value != 2.5 {
+		t.Errorf("Unexpected second event: %+v", events[1])
+	}
+
+	if _, err := readEvents(strings.NewReader("{broken\n")); err == nil {
+		t.Error("Expected error for malformed line")
+	}
+}
+
+func TestWriteAggregates_CSV(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := []models.AggregatedData{
+		{UserID: "user-1", EventType: "click", Count: 2, TotalValue: 3, AvgValue: 1.5, MinValue: 1, MaxValue: 2, StartTime: ts, EndTime: ts},
+	}
+
+	var buf bytes.Buffer
+	if err := writeAggregates(&buf, "csv", data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected header and 1 row, got %d lines", len(lines))
+	}
+	if lines[1] != "user-1,click,2,3.00,1.50,1.00,2.00,2024-01-01T00:00:00Z,2024-01-01T00:00:00Z" {
+		t.Errorf("Unexpected row: %s", lines[1])
+	}
+
+	if err := writeAggregates(&buf, "xml", data); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,64 @@
+// cmd/eventctl/main.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `eventctl - клиент командной строки для event-aggregator
+
+Usage:
+  eventctl [-server URL] [-api-key KEY] <command> [flags]
+
+Commands:
+  send     отправить события (из флагов, файла или NDJSON из stdin)
+  query    запросить агрегаты (/aggregated или /aggregated/all)
+  tail     следить за потоком событий или агрегатов (/stream)
+  admin    административные действия: snapshot, purge, keygen
+
+Run "eventctl <command> -h" for command flags.
+`
+
+func main() {
+	fs := flag.NewFlagSet("eventctl", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	defaultServer := os.Getenv("EVENTCTL_SERVER")
+	if defaultServer == "" {
+		defaultServer = "http://localhost:8080"
+	}
+	serverURL := fs.String("server", defaultServer, "базовый URL сервера (или EVENTCTL_SERVER)")
+	apiKey := fs.String("api-key", os.Getenv("EVENTCTL_API_KEY"), "API-ключ (или EVENTCTL_API_KEY)")
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := newClient(*serverURL, *apiKey)
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+
+	var err error
+	switch cmd {
+	case "send":
+		err = runSend(c, args)
+	case "query":
+		err = runQuery(c, args)
+	case "tail":
+		err = runTail(c, args)
+	case "admin":
+		err = runAdmin(c, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eventctl %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var aggregateColumns = []string{
+	"user_id", "event_type", "count", "total_value", "avg_value",
+	"min_value", "max_value", "start_time", "end_time",
+}
+
+// writeAggregates печатает агрегаты в формате table, json или csv
+func writeAggregates(w io.Writer, format string, data []models.AggregatedData) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(aggregateColumns)
+		for _, d := range data {
+			cw.Write(aggregateRow(d))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, col := range aggregateColumns {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, col)
+		}
+		fmt.Fprintln(tw)
+		for _, d := range data {
+			for i, v := range aggregateRow(d) {
+				if i > 0 {
+					fmt.Fprint(tw, "\t")
+				}
+				fmt.Fprint(tw, v)
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q (want table, json or csv)", format)
+	}
+}
+
+func aggregateRow(d models.AggregatedData) []string {
+	return []string{
+		d.UserID,
+		d.EventType,
+		strconv.FormatInt(d.Count, 10),
+		strconv.FormatFloat(d.TotalValue, 'f', 2, 64),
+		strconv.FormatFloat(d.AvgValue, 'f', 2, 64),
+		strconv.FormatFloat(d.MinValue, 'f', 2, 64),
+		strconv.FormatFloat(d.MaxValue, 'f', 2, 64),
+		d.StartTime.Format(time.RFC3339),
+		d.EndTime.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func runQuery(c *client, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	all := fs.Bool("all", false, "запросить все агрегации (/aggregated/all)")
+	userID := fs.String("user", "", "фильтр по user_id")
+	eventType := fs.String("type", "", "фильтр по типу события")
+	fromStr := fs.String("from", "", "начало интервала в RFC3339")
+	toStr := fs.String("to", "", "конец интервала в RFC3339")
+	output := fs.String("output", "table", "формат вывода: table, json, csv")
+	fs.Parse(args)
+
+	from, err := parseTimeFlag("from", *fromStr)
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeFlag("to", *toStr)
+	if err != nil {
+		return err
+	}
+
+	var data []models.AggregatedData
+	if *all {
+		result, err := c.GetAllAggregated(*eventType, from, to)
+		if err != nil {
+			return err
+		}
+		sortAggregates(result)
+		data = result
+	} else {
+		result, err := c.GetAggregated(*userID, *eventType, from, to)
+		if err != nil {
+			return err
+		}
+		if result != nil {
+			data = append(data, *result)
+		}
+	}
+
+	return writeAggregates(os.Stdout, *output, data)
+}
+
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// sortAggregates упорядочивает агрегаты по user_id и типу для стабильного вывода
+func sortAggregates(data []models.AggregatedData) {
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].UserID != data[j].UserID {
+			return data[i].UserID < data[j].UserID
+		}
+		return data[i].EventType < data[j].EventType
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func runSend(c *client, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	userID := fs.String("user", "", "user_id события")
+	eventType := fs.String("type", "", "тип события")
+	value := fs.Float64("value", 0, "значение события")
+	id := fs.String("id", "", "ID события (по умолчанию генерирует сервер)")
+	ts := fs.String("timestamp", "", "время события в RFC3339 (по умолчанию текущее)")
+	file := fs.String("file", "", `NDJSON-файл с событиями, "-" - читать из stdin`)
+	var attrs attrFlag
+	fs.Var(&attrs, "attr", "атрибут события name=value (можно повторять)")
+	fs.Parse(args)
+
+	var events []models.Event
+	if *file != "" {
+		var r io.Reader = os.Stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		var err error
+		if events, err = readEvents(r); err != nil {
+			return err
+		}
+	} else {
+		if *userID == "" || *eventType == "" {
+			return fmt.Errorf("-user and -type are required (or use -file)")
+		}
+
+		event := models.Event{ID: *id, Type: *eventType, UserID: *userID, Value: *value, Attributes: attrs}
+		if *ts != "" {
+			t, err := time.Parse(time.RFC3339, *ts)
+			if err != nil {
+				return fmt.Errorf("invalid -timestamp: %w", err)
+			}
+			event.Timestamp = t
+		}
+		events = append(events, event)
+	}
+
+	failed := 0
+	for i, e := range events {
+		eventID, err := c.SendEvent(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "event %d: %v\n", i+1, err)
+			failed++
+			continue
+		}
+		fmt.Println(eventID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, len(events))
+	}
+	return nil
+}
+
+// readEvents читает события в формате NDJSON, пропуская пустые строки
+func readEvents(r io.Reader) ([]models.Event, error) {
+	var events []models.Event
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var e models.Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// runTail подписывается на /stream и печатает события или изменившиеся агрегаты.
+// При обрыве соединения переподключается, продолжая с последнего события.
+func runTail(c *client, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	userID := fs.String("user", "", "фильтр по user_id")
+	eventType := fs.String("type", "", "фильтр по типу события")
+	var attrs attrFlag
+	fs.Var(&attrs, "attr", "фильтр по атрибуту name=value (только с -events, можно повторять)")
+	events := fs.Bool("events", false, "печатать сырые события вместо агрегатов")
+	interval := fs.Duration("interval", 2*time.Second, "интервал обновления агрегатов")
+	output := fs.String("output", "table", "формат вывода агрегатов: table, json, csv")
+	fs.Parse(args)
+
+	q := url.Values{}
+	if *userID != "" {
+		q.Set("user_id", *userID)
+	}
+	if *eventType != "" {
+		q.Set("type", *eventType)
+	}
+	for k, v := range attrs {
+		q.Set("attr."+k, v)
+	}
+	if *events {
+		q.Set("mode", "events")
+	} else {
+		q.Set("mode", "aggregates")
+		q.Set("interval", interval.String())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	seen := make(map[string]int64)
+	lastID := ""
+	for {
+		err := c.Stream(ctx, q, lastID, func(msg sseMessage) error {
+			if msg.ID != "" {
+				lastID = msg.ID
+			}
+			switch msg.Event {
+			case "event":
+				var e models.Event
+				if err := json.Unmarshal(msg.Data, &e); err != nil {
+					return err
+				}
+				return enc.Encode(e)
+			case "aggregates":
+				var data []models.AggregatedData
+				if err := json.Unmarshal(msg.Data, &data); err != nil {
+					return err
+				}
+				var changed []models.AggregatedData
+				for _, d := range data {
+					key := d.UserID + ":" + d.EventType
+					if seen[key] != d.Count {
+						seen[key] = d.Count
+						changed = append(changed, d)
+					}
+				}
+				if len(changed) == 0 {
+					return nil
+				}
+				return writeAggregates(os.Stdout, *output, changed)
+			case "error":
+				fmt.Fprintf(os.Stderr, "server: %s\n", msg.Data)
+			}
+			return nil
+		})
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "stream interrupted: %v; reconnecting\n", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// attrFlag - повторяемый флаг вида -attr name=value
+type attrFlag map[string]string
+
+func (a *attrFlag) String() string {
+	return fmt.Sprint(map[string]string(*a))
+}
+
+func (a *attrFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	if *a == nil {
+		*a = make(attrFlag)
+	}
+	(*a)[name] = value
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// typeDistribution выбирает тип события с заданными весами
+type typeDistribution struct {
+	types      []string
+	cumulative []float64
+}
+
+// parseTypes разбирает спецификацию вида "click:0.6,view:0.3,purchase:0.1";
+// вес можно опустить, тогда он равен 1
+func parseTypes(spec string) (*typeDistribution, error) {
+	d := &typeDistribution{}
+	total := 0.0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weightStr, hasWeight := strings.Cut(part, ":")
+		weight := 1.0
+		if hasWeight {
+			w, err := strconv.ParseFloat(weightStr, 64)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("invalid weight for type %q: %q", name, weightStr)
+			}
+			weight = w
+		}
+
+		total += weight
+		d.types = append(d.types, name)
+		d.cumulative = append(d.cumulative, total)
+	}
+
+	if len(d.types) == 0 {
+		return nil, fmt.Errorf("no event types in %q", spec)
+	}
+	for i := range d.cumulative {
+		d.cumulative[i] /= total
+	}
+	return d, nil
+}
+
+func (d *typeDistribution) Sample(r *rand.Rand) string {
+	x := r.Float64()
+	for i, c := range d.cumulative {
+		if x < c {
+			return d.types[i]
+		}
+	}
+	return d.types[len(d.types)-1]
+}
+
+// valueDistribution генерирует значения событий
+type valueDistribution func(r *rand.Rand) float64
+
+// parseValues разбирает спецификацию распределения значений:
+// const:V, uniform:MIN:MAX, normal:MEAN:STDDEV, exp:MEAN
+func parseValues(spec string) (valueDistribution, error) {
+	parts := strings.Split(spec, ":")
+	params := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %q in %q", p, spec)
+		}
+		params = append(params, v)
+	}
+
+	need := map[string]int{"const": 1, "uniform": 2, "normal": 2, "exp": 1}
+	n, ok := need[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown value distribution %q (want const, uniform, normal or exp)", parts[0])
+	}
+	if len(params) != n {
+		return nil, fmt.Errorf("distribution %q expects %d parameters, got %d", parts[0], n, len(params))
+	}
+
+	switch parts[0] {
+	case "const":
+		return func(*rand.Rand) float64 { return params[0] }, nil
+	case "uniform":
+		lo, hi := params[0], params[1]
+		return func(r *rand.Rand) float64 { return lo + r.Float64()*(hi-lo) }, nil
+	case "normal":
+		mean, stddev := params[0], params[1]
+		return func(r *rand.Rand) float64 { return mean + r.NormFloat64()*stddev }, nil
+	default:
+		mean := params[0]
+		return func(r *rand.Rand) float64 { return math.Round(r.ExpFloat64()*mean*100) / 100 }, nil
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseTypes(t *testing.T) {
+	d, err := parseTypes("click:3,view:1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[d.Sample(r)]++
+	}
+	if counts["click"] < 7000 || counts["click"] > 8000 {
+		t.Errorf("Expected ~75%% clicks, got %d of 10000", counts["click"])
+	}
+
+	for _, spec := range []string{"", "click:abc", "click:-1"} {
+		if _, err := parseTypes(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	c, err := parseValues("const:5")
+	if err != nil || c(r) != 5 {
+		t.Fatalf("Expected const 5, got err=%v", err)
+	}
+
+	u, err := parseValues("uniform:10:20")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if v := u(r); v < 10 || v >= 20 {
+			t.Fatalf("Value %f out of range", v)
+		}
+	}
+
+	for _, spec := range []string{"poisson:1", "uniform:1", "normal:a:b"} {
+		if _, err := parseValues(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	lat := make([]time.Duration, 100)
+	for i := range lat {
+		lat[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	if p := percentile(lat, 50); p != 50*time.Millisecond {
+		t.Errorf("Expected p50 50ms, got %v", p)
+	}
+	if p := percentile(lat, 99); p != 99*time.Millisecond {
+		t.Errorf("Expected p99 99ms, got %v", p)
+	}
+	if p := percentile(nil, 99); p != 0 {
+		t.Errorf("Expected 0 for empty input, got %v", p)
+	}
+}
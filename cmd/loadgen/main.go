@@ -0,0 +1,200 @@
+// cmd/loadgen/main.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+	"github.com/bashkirian/event-aggregator/pkg/server"
+)
+
+type config struct {
+	target      string
+	rate        float64
+	duration    time.Duration
+	concurrency int
+	users       int
+	types       *typeDistribution
+	values      valueDistribution
+	queryRatio  float64
+}
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "URL работающего сервера")
+	inProcess := flag.Bool("in-process", false, "поднять сервер в этом же процессе вместо -target")
+	rate := flag.Float64("rate", 1000, "целевое число запросов в секунду (0 - без ограничения)")
+	duration := flag.Duration("duration", 10*time.Second, "длительность прогона")
+	concurrency := flag.Int("concurrency", 16, "число параллельных воркеров")
+	users := flag.Int("users", 1000, "число различных user_id")
+	typesSpec := flag.String("types", "click:0.6,view:0.3,purchase:0.1", "распределение типов событий")
+	valuesSpec := flag.String("values", "uniform:0:100", "распределение значений: const:V, uniform:MIN:MAX, normal:MEAN:STDDEV, exp:MEAN")
+	queryRatio := flag.Float64("query-ratio", 0, "доля запросов /aggregated среди всех запросов (0..1)")
+	flag.Parse()
+
+	types, err := parseTypes(*typesSpec)
+	if err != nil {
+		log.Fatalf("invalid -types: %v", err)
+	}
+	values, err := parseValues(*valuesSpec)
+	if err != nil {
+		log.Fatalf("invalid -values: %v", err)
+	}
+	if *concurrency < 1 || *users < 1 || *queryRatio < 0 || *queryRatio > 1 {
+		log.Fatal("-concurrency and -users must be positive, -query-ratio must be in [0, 1]")
+	}
+
+	cfg := config{
+		target:      strings.TrimRight(*target, "/"),
+		rate:        *rate,
+		duration:    *duration,
+		concurrency: *concurrency,
+		users:       *users,
+		types:       types,
+		values:      values,
+		queryRatio:  *queryRatio,
+	}
+
+	if *inProcess {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		// Логи сервера на каждый запрос искажают замеры
+		log.SetOutput(io.Discard)
+		srv := server.NewServer("0")
+		go srv.Serve(ln)
+		defer srv.Shutdown(context.Background())
+		cfg.target = "http://" + ln.Addr().String()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rec := newRecorder()
+	elapsed := run(ctx, cfg, rec)
+	rec.Report(os.Stdout, elapsed)
+}
+
+// run генерирует нагрузку с заданным темпом и возвращает фактическую длительность
+func run(ctx context.Context, cfg config, rec *recorder) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.concurrency,
+			MaxIdleConnsPerHost: cfg.concurrency,
+		},
+	}
+
+	jobs := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for range jobs {
+				if cfg.queryRatio > 0 && r.Float64() < cfg.queryRatio {
+					start := time.Now()
+					err := query(httpClient, cfg, r)
+					rec.Record("query", time.Since(start), err)
+					continue
+				}
+				start := time.Now()
+				err := send(httpClient, cfg, r)
+				rec.Record("ingest", time.Since(start), err)
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	start := time.Now()
+	sent := 0
+dispatch:
+	for {
+		due := 1
+		if cfg.rate > 0 {
+			due = int(cfg.rate*time.Since(start).Seconds()) - sent
+		}
+		for ; due > 0; due-- {
+			select {
+			case jobs <- struct{}{}:
+				sent++
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			break dispatch
+		default:
+		}
+		if cfg.rate > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	return time.Since(start)
+}
+
+func send(c *http.Client, cfg config, r *rand.Rand) error {
+	event := models.Event{
+		Type:      cfg.types.Sample(r),
+		UserID:    fmt.Sprintf("user-%d", r.Intn(cfg.users)),
+		Value:     cfg.values(r),
+		Timestamp: time.Now(),
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Post(cfg.target+"/events", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func query(c *http.Client, cfg config, r *rand.Rand) error {
+	q := url.Values{}
+	q.Set("user_id", fmt.Sprintf("user-%d", r.Intn(cfg.users)))
+	q.Set("type", cfg.types.Sample(r))
+
+	resp, err := c.Get(cfg.target + "/aggregated?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
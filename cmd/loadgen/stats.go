@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recorder собирает задержки и ошибки по видам операций
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+func (r *recorder) Record(op string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors[op]++
+		return
+	}
+	r.latencies[op] = append(r.latencies[op], d)
+}
+
+// percentile возвращает p-й перцентиль (0..100) из отсортированного среза
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+// Report печатает итоговую статистику за прогон длительностью elapsed
+func (r *recorder) Report(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ops := make(map[string]bool)
+	for op := range r.latencies {
+		ops[op] = true
+	}
+	for op := range r.errors {
+		ops[op] = true
+	}
+	names := make([]string, 0, len(ops))
+	for op := range ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "duration: %v\n", elapsed.Round(time.Millisecond))
+	for _, op := range names {
+		lat := r.latencies[op]
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+
+		ok, failed := len(lat), r.errors[op]
+		total := ok + failed
+		errRate := 0.0
+		if total > 0 {
+			errRate = float64(failed) / float64(total) * 100
+		}
+
+		fmt.Fprintf(w, "%s: requests=%d ok=%d errors=%d (%.2f%%) throughput=%.1f/s\n",
+			op, total, ok, failed, errRate, float64(ok)/elapsed.Seconds())
+		if ok > 0 {
+			fmt.Fprintf(w, "  latency p50=%v p90=%v p99=%v max=%v\n",
+				percentile(lat, 50), percentile(lat, 90), percentile(lat, 99), lat[ok-1])
+		}
+	}
+}
@@ -4,11 +4,22 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/yourusername/event-aggregator/pkg/server"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/ratelimit"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/internal/source"
+	"github.com/bashkirian/event-aggregator/internal/statsd"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/internal/tail"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+	"github.com/bashkirian/event-aggregator/pkg/server"
 )
 
 func main() {
@@ -17,7 +28,104 @@ func main() {
 		port = "8080"
 	}
 
-	srv := server.NewServer(port)
+	cfg := server.Config{
+		Port:          port,
+		GRPCPort:      os.Getenv("GRPC_PORT"),
+		StatsDAddr:    os.Getenv("STATSD_ADDR"),
+		StatsDTCPAddr: os.Getenv("STATSD_TCP_ADDR"),
+		ArchivePath:   os.Getenv("ARCHIVE_PATH"),
+		ReplayDir:     os.Getenv("REPLAY_DIR"),
+		Tail: tail.Config{
+			Path:           os.Getenv("TAIL_PATH"),
+			Pattern:        os.Getenv("TAIL_PATTERN"),
+			Format:         os.Getenv("TAIL_FORMAT"),
+			OffsetsFile:    os.Getenv("TAIL_OFFSETS_FILE"),
+			QuarantineFile: os.Getenv("TAIL_QUARANTINE_FILE"),
+		},
+	}
+	if path := os.Getenv("STATSD_MAPPING"); path != "" {
+		mapping, err := statsd.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load StatsD mapping: %v", err)
+		}
+		cfg.StatsD = mapping
+	}
+
+	store, newStorage, err := storage.Factory(os.Getenv("STORAGE_ENGINE"), os.Getenv("STORAGE_PATH"))
+	if err != nil {
+		log.Fatalf("Invalid STORAGE_ENGINE: %v", err)
+	}
+	cfg.Storage, cfg.NewStorage = store, newStorage
+
+	if v := os.Getenv("DEADLETTER_MAX_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid DEADLETTER_MAX_ENTRIES: %v", err)
+		}
+		cfg.DeadLetterMaxEntries = n
+	}
+	if v := os.Getenv("DEADLETTER_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid DEADLETTER_MAX_AGE: %v", err)
+		}
+		cfg.DeadLetterMaxAge = d
+	}
+
+	if path := os.Getenv("TENANTS_CONFIG"); path != "" {
+		// Политики, заданные через /admin/tenants, сохраняются в этот же файл
+		tenants, err := tenant.LoadManager(path)
+		if err != nil {
+			log.Fatalf("Failed to load tenants config: %v", err)
+		}
+		cfg.Tenants = tenants
+	}
+
+	if path := os.Getenv("RATE_LIMIT_CONFIG"); path != "" {
+		limits, err := ratelimit.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load rate limit config: %v", err)
+		}
+		cfg.RateLimit = limits
+	}
+
+	if path := os.Getenv("SCHEMAS_FILE"); path != "" {
+		schemas, err := schema.LoadRegistry(path)
+		if err != nil {
+			log.Fatalf("Failed to load schemas: %v", err)
+		}
+		cfg.Schemas = schemas
+	}
+
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		keys, err := auth.LoadKeyStore(path)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		if len(keys.List()) == 0 {
+			log.Printf("API key file %s has no keys: all requests will be rejected until keys are added", path)
+		}
+		cfg.APIKeys = keys
+	}
+
+	if url := os.Getenv("NATS_URL"); url != "" {
+		subject := os.Getenv("NATS_SUBJECT")
+		if subject == "" {
+			subject = "events"
+		}
+		src, err := source.DialNATS(source.NATSConfig{URL: url, Subject: subject, Queue: os.Getenv("NATS_QUEUE")})
+		if err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+		}
+		cfg.Sources = map[string]source.Source{"nats": src}
+	}
+
+	srv := server.NewServerWithConfig(cfg)
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
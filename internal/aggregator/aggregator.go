@@ -2,20 +2,43 @@ package aggregator
 
 import (
     "context"
+    "io"
     "log"
+    "slices"
+    "sort"
+    "sync"
     "time"
 	"fmt"
 	
+    "github.com/bashkirian/event-aggregator/internal/schema"
     "github.com/bashkirian/event-aggregator/internal/storage"
+    "github.com/bashkirian/event-aggregator/internal/tenant"
     "github.com/bashkirian/event-aggregator/pkg/models"
 )
 
 type Aggregator struct {
+    // storageMu защищает замену хранилища (SwapStorage); чтение и запись
+    // событий берут его на чтение
+    storageMu  sync.RWMutex
     storage    storage.Storage
     eventChan  chan models.Event
     bufferSize int
+
+    mu        sync.RWMutex
+    listeners []*listener
+
+    // tenants - политики тенантов (квоты и срок хранения); nil - без ограничений
+    tenants *tenant.Manager
+    // schemas - схемы типов событий; nil - события не проверяются
+    schemas *schema.Registry
 }
 
+// retentionInterval - период удаления событий с истёкшим сроком хранения
+const retentionInterval = time.Minute
+
+// maxBatch - наибольшее число событий из очереди, сохраняемых за раз
+const maxBatch = 256
+
 func New(storage storage.Storage, bufferSize int) *Aggregator {
     return &Aggregator{
         storage:    storage,
@@ -24,13 +47,31 @@ func New(storage storage.Storage, bufferSize int) *Aggregator {
     }
 }
 
+// SetTenants включает политики тенантов; вызывается до Start
+func (a *Aggregator) SetTenants(m *tenant.Manager) {
+    a.tenants = m
+}
+
+// SetSchemas включает проверку событий по схемам их типов; вызывается до Start
+func (a *Aggregator) SetSchemas(r *schema.Registry) {
+    a.schemas = r
+}
+
+// Tenants возвращает политики тенантов (nil, если не заданы)
+func (a *Aggregator) Tenants() *tenant.Manager {
+    return a.tenants
+}
+
 // Start запускает обработку событий
 func (a *Aggregator) Start(ctx context.Context) {
+    if a.tenants != nil {
+        go a.retentionLoop(ctx)
+    }
     go func() {
         for {
             select {
             case event := <-a.eventChan:
-                a.processEvent(event)
+                a.processEvents(a.drain(event))
             case <-ctx.Done():
                 log.Println("Aggregator stopping...")
                 return
@@ -39,28 +80,283 @@ func (a *Aggregator) Start(ctx context.Context) {
     }()
 }
 
-// ProcessEvent добавляет событие в очередь
+// ProcessEvent добавляет событие в очередь. Событие, не соответствующее схеме
+// своего типа, отклоняется с *schema.ValidationError, событие сверх квоты
+// тенанта - с tenant.ErrQuotaExceeded; события, ещё стоящие в очереди, в квоте
+// хранения не учитываются.
 func (a *Aggregator) ProcessEvent(event models.Event) error {
+    if err := a.schemas.Validate(event); err != nil {
+        return err
+    }
+    if a.tenants != nil {
+        // Count в SQLite - запрос к базе, поэтому только при лимите хранения
+        var stored int64
+        if a.tenants.Policy(event.Tenant).MaxEvents > 0 {
+            stored = a.currentStorage().Count(event.Tenant)
+        }
+        if err := a.tenants.Admit(event.Tenant, stored); err != nil {
+            return err
+        }
+    }
     select {
     case a.eventChan <- event:
         return nil
     case <-time.After(5 * time.Second):
+        if a.tenants != nil {
+            // Событие не принято и не должно расходовать квоту
+            a.tenants.Release(event.Tenant)
+        }
         return fmt.Errorf("timeout adding event to queue")
     }
 }
 
-func (a *Aggregator) processEvent(event models.Event) {
-    a.storage.AddEvent(event)
-    log.Printf("Processed event: %s, user: %s, type: %s, value: %.2f",
-        event.ID, event.UserID, event.Type, event.Value)
+// listener - обработчик OnEvent; указатель позволяет снять его
+type listener struct {
+    fn func(models.Event)
+}
+
+// OnEvent регистрирует обработчик, вызываемый после сохранения каждого события.
+// Обработчик вызывается в горутине агрегатора и не должен блокироваться.
+// Возвращённая функция снимает обработчик.
+func (a *Aggregator) OnEvent(fn func(models.Event)) (remove func()) {
+    l := &listener{fn: fn}
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.listeners = append(a.listeners, l)
+    return func() {
+        a.mu.Lock()
+        defer a.mu.Unlock()
+        a.listeners = slices.DeleteFunc(a.listeners, func(other *listener) bool { return other == l })
+    }
+}
+
+// drain дополняет first событиями, уже ждущими в очереди, не более maxBatch
+func (a *Aggregator) drain(first models.Event) []models.Event {
+    batch := []models.Event{first}
+    for len(batch) < maxBatch {
+        select {
+        case event := <-a.eventChan:
+            batch = append(batch, event)
+        default:
+            return batch
+        }
+    }
+    return batch
+}
+
+// processEvents сохраняет события; storage.BatchStorage получает их одним вызовом
+func (a *Aggregator) processEvents(events []models.Event) {
+    a.storageMu.RLock()
+    defer a.storageMu.RUnlock()
+
+    if batch, ok := a.storage.(storage.BatchStorage); ok {
+        batch.AddEvents(events)
+    } else {
+        for _, event := range events {
+            a.storage.AddEvent(event)
+        }
+    }
+
+    a.mu.RLock()
+    defer a.mu.RUnlock()
+    for _, event := range events {
+        log.Printf("Processed event: %s, user: %s, type: %s, value: %.2f",
+            event.ID, event.UserID, event.Type, event.Value)
+        for _, l := range a.listeners {
+            l.fn(event)
+        }
+    }
 }
 
-// GetAggregatedData возвращает агрегированные данные
+// GetAggregatedData возвращает агрегированные данные тенанта по умолчанию
 func (a *Aggregator) GetAggregatedData(userID, eventType string, from, to time.Time) *models.AggregatedData {
-    return a.storage.GetAggregated(userID, eventType, from, to)
+    return a.Tenant("").GetAggregatedData(userID, eventType, from, to)
 }
 
-// GetAllAggregatedData возвращает все агрегации
+// GetAllAggregatedData возвращает все агрегации тенанта по умолчанию
 func (a *Aggregator) GetAllAggregatedData() []models.AggregatedData {
-    return a.storage.GetAllAggregated()
+    return a.Tenant("").GetAllAggregatedData()
+}
+
+// TenantView - запросы агрегатов в пределах одного тенанта
+type TenantView struct {
+    aggregator *Aggregator
+    tenant     string
+}
+
+// Tenant возвращает представление данных тенанта
+func (a *Aggregator) Tenant(tenant string) TenantView {
+    return TenantView{aggregator: a, tenant: tenant}
+}
+
+func (v TenantView) GetAggregatedData(userID, eventType string, from, to time.Time) *models.AggregatedData {
+    return v.aggregator.currentStorage().GetAggregated(v.tenant, userID, eventType, from, to)
+}
+
+func (v TenantView) GetAllAggregatedData() []models.AggregatedData {
+    return v.aggregator.currentStorage().GetAllAggregated(v.tenant)
+}
+
+// Scan обходит события тенанта, прошедшие filter (см. storage.Storage.Scan)
+func (v TenantView) Scan(filter storage.GroupFilter, fn func(models.Event) bool) {
+    v.aggregator.currentStorage().Scan(v.tenant, filter, fn)
+}
+
+// GetEvent возвращает сырое событие тенанта по ID
+func (v TenantView) GetEvent(id string) (models.Event, bool) {
+    return v.aggregator.currentStorage().GetEvent(v.tenant, id)
+}
+
+// SearchEvents возвращает страницу сырых событий тенанта
+func (v TenantView) SearchEvents(q storage.EventQuery) (storage.EventPage, error) {
+    return v.aggregator.currentStorage().SearchEvents(v.tenant, q)
+}
+
+// Purge удаляет все события тенанта и возвращает их количество
+func (v TenantView) Purge() int {
+    n := v.aggregator.currentStorage().Delete(v.tenant, time.Time{})
+    log.Printf("Purged %d events of tenant %q", n, v.tenant)
+    return n
+}
+
+// TenantStats - объём данных, политика и счётчики приёма тенанта
+type TenantStats struct {
+    storage.TenantStats
+    Policy tenant.Policy `json:"policy"`
+    Usage  tenant.Usage  `json:"usage"`
+}
+
+// TenantStats возвращает статистику по всем тенантам с данными или политикой
+func (a *Aggregator) TenantStats() []TenantStats {
+    stored := a.currentStorage().Stats()
+    byTenant := make(map[string]storage.TenantStats, len(stored))
+    for _, st := range stored {
+        byTenant[st.Tenant] = st
+    }
+    if a.tenants != nil {
+        for name := range a.tenants.Policies() {
+            if _, ok := byTenant[name]; !ok {
+                byTenant[name] = storage.TenantStats{Tenant: name}
+            }
+        }
+    }
+
+    result := make([]TenantStats, 0, len(byTenant))
+    for _, st := range byTenant {
+        result = append(result, a.tenantStats(st))
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Tenant < result[j].Tenant })
+    return result
+}
+
+// Stats возвращает статистику тенанта
+func (v TenantView) Stats() TenantStats {
+    for _, st := range v.aggregator.currentStorage().Stats() {
+        if st.Tenant == v.tenant {
+            return v.aggregator.tenantStats(st)
+        }
+    }
+    return v.aggregator.tenantStats(storage.TenantStats{Tenant: v.tenant})
+}
+
+func (a *Aggregator) tenantStats(st storage.TenantStats) TenantStats {
+    result := TenantStats{TenantStats: st}
+    if a.tenants != nil {
+        result.Policy = a.tenants.Policy(st.Tenant)
+        result.Usage = a.tenants.Usage(st.Tenant)
+    }
+    return result
+}
+
+// ApplyRetention удаляет события старше срока хранения своих тенантов и
+// возвращает количество удалённых событий по тенантам
+func (a *Aggregator) ApplyRetention(now time.Time) map[string]int {
+    removed := make(map[string]int)
+    if a.tenants == nil {
+        return removed
+    }
+    store := a.currentStorage()
+    for _, st := range store.Stats() {
+        retention := time.Duration(a.tenants.Policy(st.Tenant).Retention)
+        if retention <= 0 || !st.Oldest.Before(now.Add(-retention)) {
+            continue
+        }
+        if n := store.Delete(st.Tenant, now.Add(-retention)); n > 0 {
+            removed[st.Tenant] = n
+            log.Printf("Retention: removed %d events of tenant %q older than %v", n, st.Tenant, retention)
+        }
+    }
+    return removed
+}
+
+func (a *Aggregator) retentionLoop(ctx context.Context) {
+    ticker := time.NewTicker(retentionInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case now := <-ticker.C:
+            a.ApplyRetention(now)
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Storage возвращает текущее хранилище
+func (a *Aggregator) Storage() storage.Storage {
+    return a.currentStorage()
+}
+
+// Snapshot возвращает копию всех сырых событий из хранилища
+func (a *Aggregator) Snapshot() []models.Event {
+    return a.currentStorage().Snapshot()
+}
+
+// Purge очищает хранилище и возвращает количество удалённых событий
+func (a *Aggregator) Purge() int {
+    n := a.currentStorage().Purge()
+    log.Printf("Purged %d events", n)
+    return n
+}
+
+// SwapStorage заменяет хранилище на результат build. На время build обработка
+// событий приостановлена, поэтому build видит окончательное состояние текущего
+// хранилища и ни одно событие не теряется между чтением и заменой. Заменённое
+// хранилище закрывается, если держит ресурсы; build может вернуть текущее
+// хранилище, дополнив его.
+func (a *Aggregator) SwapStorage(build func(current storage.Storage) (storage.Storage, error)) error {
+    a.storageMu.Lock()
+    defer a.storageMu.Unlock()
+
+    prev := a.storage
+    next, err := build(prev)
+    if err != nil {
+        return err
+    }
+    a.storage = next
+    log.Println("Storage swapped")
+    if c, ok := prev.(io.Closer); ok && prev != next {
+        if err := c.Close(); err != nil {
+            log.Printf("Failed to close replaced storage: %v", err)
+        }
+    }
+    return nil
+}
+
+// Close закрывает хранилище, если оно держит ресурсы (например, базу
+// SQLite); вызывается после остановки обработки событий
+func (a *Aggregator) Close() error {
+    a.storageMu.Lock()
+    defer a.storageMu.Unlock()
+
+    if c, ok := a.storage.(io.Closer); ok {
+        return c.Close()
+    }
+    return nil
+}
+
+func (a *Aggregator) currentStorage() storage.Storage {
+    a.storageMu.RLock()
+    defer a.storageMu.RUnlock()
+    return a.storage
 }
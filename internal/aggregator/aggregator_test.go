@@ -2,10 +2,17 @@ package aggregator
 
 import (
     "context"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "sync/atomic"
     "testing"
     "time"
 
     "github.com/bashkirian/event-aggregator/internal/storage"
+    "github.com/bashkirian/event-aggregator/internal/tenant"
     "github.com/bashkirian/event-aggregator/pkg/models"
 )
 
@@ -112,3 +119,175 @@ func TestAggregator_GetAllAggregatedData(t *testing.T) {
         t.Errorf("Expected 3 aggregations, got %d", len(results))
     }
 }
+
+func BenchmarkAggregator_ProcessEvent(b *testing.B) {
+    log.SetOutput(io.Discard)
+    defer log.SetOutput(os.Stderr)
+
+    store := storage.NewInMemoryStorage()
+    agg := New(store, 1000)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    agg.Start(ctx)
+
+    now := time.Now()
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := agg.ProcessEvent(models.Event{ID: "e", Type: "click", UserID: "user-1", Value: 1, Timestamp: now}); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkAggregator_GetAggregatedData(b *testing.B) {
+    store := storage.NewInMemoryStorage()
+    agg := New(store, 1)
+
+    now := time.Now()
+    for i := 0; i < 100000; i++ {
+        store.AddEvent(models.Event{ID: "e", Type: "click", UserID: fmt.Sprintf("user-%d", i%1000), Value: 1, Timestamp: now})
+    }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        agg.GetAggregatedData("user-42", "click", time.Time{}, time.Time{})
+    }
+}
+
+func TestAggregator_TenantQuotaAndRetention(t *testing.T) {
+    agg := New(storage.NewInMemoryStorage(), 10)
+    agg.SetTenants(tenant.NewManager(tenant.Config{
+        Tenants: map[string]tenant.Policy{
+            "acme": {MaxEvents: 2, Retention: tenant.Duration(24 * time.Hour)},
+        },
+    }))
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    agg.Start(ctx)
+
+    now := time.Now()
+    for i, ts := range []time.Time{now.Add(-48 * time.Hour), now} {
+        e := models.Event{ID: fmt.Sprint(i), Tenant: "acme", Type: "click", UserID: "user-1", Value: 1, Timestamp: ts}
+        if err := agg.ProcessEvent(e); err != nil {
+            t.Fatalf("Failed to process event: %v", err)
+        }
+    }
+    time.Sleep(100 * time.Millisecond)
+
+    err := agg.ProcessEvent(models.Event{ID: "x", Tenant: "acme", Type: "click", UserID: "user-1", Timestamp: now})
+    if !errors.Is(err, tenant.ErrQuotaExceeded) {
+        t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+    }
+    // Квота другого тенанта не затронута
+    if err := agg.ProcessEvent(models.Event{ID: "y", Tenant: "globex", Type: "click", UserID: "user-1", Timestamp: now}); err != nil {
+        t.Errorf("Unexpected error: %v", err)
+    }
+
+    if removed := agg.ApplyRetention(now); removed["acme"] != 1 || len(removed) != 1 {
+        t.Errorf("Unexpected retention result: %v", removed)
+    }
+    st := agg.Tenant("acme").Stats()
+    if st.Events != 1 || st.Usage.Accepted != 2 || st.Usage.Rejected != 1 || st.Policy.MaxEvents != 2 {
+        t.Errorf("Unexpected tenant stats: %+v", st)
+    }
+}
+
+// countingStorage считает вызовы Count
+type countingStorage struct {
+    *storage.InMemoryStorage
+    counts atomic.Int64
+}
+
+func (s *countingStorage) Count(tenant string) int64 {
+    s.counts.Add(1)
+    return s.InMemoryStorage.Count(tenant)
+}
+
+func TestAggregator_CountOnlyWithMaxEvents(t *testing.T) {
+    store := &countingStorage{InMemoryStorage: storage.NewInMemoryStorage()}
+    agg := New(store, 10)
+    agg.SetTenants(tenant.NewManager(tenant.Config{
+        Tenants: map[string]tenant.Policy{"acme": {MaxEvents: 10}},
+    }))
+
+    agg.ProcessEvent(models.Event{ID: "1", Tenant: "globex", Type: "click", UserID: "user-1", Timestamp: time.Now()})
+    if n := store.counts.Load(); n != 0 {
+        t.Errorf("Expected no Count calls without max_events, got %d", n)
+    }
+    agg.ProcessEvent(models.Event{ID: "2", Tenant: "acme", Type: "click", UserID: "user-1", Timestamp: time.Now()})
+    if n := store.counts.Load(); n != 1 {
+        t.Errorf("Expected 1 Count call with max_events, got %d", n)
+    }
+}
+
+// batchStorage запоминает размеры пачек, переданных AddEvents
+type batchStorage struct {
+    *storage.InMemoryStorage
+    batches chan int
+}
+
+func (s batchStorage) AddEvents(events []models.Event) {
+    for _, e := range events {
+        s.AddEvent(e)
+    }
+    s.batches <- len(events)
+}
+
+func TestAggregator_BatchesEvents(t *testing.T) {
+    store := batchStorage{storage.NewInMemoryStorage(), make(chan int, 100)}
+    agg := New(store, 100)
+
+    // События накапливаются в очереди до запуска и сохраняются одной пачкой
+    for i := 0; i < 50; i++ {
+        if err := agg.ProcessEvent(models.Event{ID: fmt.Sprint(i), Type: "click", UserID: "user-1", Value: 1, Timestamp: time.Now()}); err != nil {
+            t.Fatalf("Failed to process event: %v", err)
+        }
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    agg.Start(ctx)
+
+    select {
+    case n := <-store.batches:
+        if n != 50 {
+            t.Errorf("Expected one batch of 50 events, got %d", n)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Expected batch to be stored")
+    }
+    if err := agg.Close(); err != nil {
+        t.Errorf("Expected Close without error, got %v", err)
+    }
+}
+
+
+// closingStorage отмечает вызов Close
+type closingStorage struct {
+    *storage.InMemoryStorage
+    closed bool
+}
+
+func (s *closingStorage) Close() error {
+    s.closed = true
+    return nil
+}
+
+func TestAggregator_SwapStorageClosesReplaced(t *testing.T) {
+    old := &closingStorage{InMemoryStorage: storage.NewInMemoryStorage()}
+    agg := New(old, 10)
+
+    // Хранилище, возвращённое без замены, не закрывается
+    agg.SwapStorage(func(current storage.Storage) (storage.Storage, error) { return current, nil })
+    if old.closed {
+        t.Error("Expected kept storage to stay open")
+    }
+
+    agg.SwapStorage(func(storage.Storage) (storage.Storage, error) { return storage.NewInMemoryStorage(), nil })
+    if !old.closed {
+        t.Error("Expected replaced storage to be closed")
+    }
+}
@@ -0,0 +1,127 @@
+package aggregator
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Period - интервал времени, границы включаются
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Shift возвращает период, сдвинутый на offset назад
+func (p Period) Shift(offset time.Duration) Period {
+	return Period{From: p.From.Add(-offset), To: p.To.Add(-offset)}
+}
+
+// Delta - изменение метрики относительно прошлого периода
+type Delta struct {
+	Absolute float64 `json:"absolute"`
+	// Percent - изменение в процентах; nil, если в прошлом периоде метрика
+	// равна нулю
+	Percent *float64 `json:"percent"`
+}
+
+func delta(current, previous float64) Delta {
+	d := Delta{Absolute: current - previous}
+	if previous != 0 {
+		pct := d.Absolute / abs(previous) * 100
+		d.Percent = &pct
+	}
+	return d
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Deltas - изменения метрик группы. Отсутствие событий в одном из периодов
+// считается нулевыми count и total; avg, min и max в этом случае не
+// сравниваются.
+type Deltas struct {
+	Count Delta  `json:"count"`
+	Total Delta  `json:"total_value"`
+	Avg   *Delta `json:"avg_value,omitempty"`
+	Min   *Delta `json:"min_value,omitempty"`
+	Max   *Delta `json:"max_value,omitempty"`
+}
+
+// Comparison - метрики группы за период и за такой же период со сдвигом
+type Comparison struct {
+	UserID    string                 `json:"user_id"`
+	EventType string                 `json:"event_type"`
+	Current   *models.AggregatedData `json:"current"`
+	Previous  *models.AggregatedData `json:"previous"`
+	Delta     Deltas                 `json:"delta"`
+}
+
+func compare(userID, eventType string, current, previous *models.AggregatedData) Comparison {
+	c := Comparison{UserID: userID, EventType: eventType, Current: current, Previous: previous}
+	var cur, prev models.AggregatedData
+	if current != nil {
+		cur = *current
+	}
+	if previous != nil {
+		prev = *previous
+	}
+	c.Delta.Count = delta(float64(cur.Count), float64(prev.Count))
+	c.Delta.Total = delta(cur.TotalValue, prev.TotalValue)
+	if current != nil && previous != nil {
+		avg, lo, hi := delta(cur.AvgValue, prev.AvgValue), delta(cur.MinValue, prev.MinValue), delta(cur.MaxValue, prev.MaxValue)
+		c.Delta.Avg, c.Delta.Min, c.Delta.Max = &avg, &lo, &hi
+	}
+	return c
+}
+
+// Compare сравнивает агрегат по user_id и типу (пустые - любые) за период
+// current с тем же агрегатом за период, сдвинутый на offset назад
+func (v TenantView) Compare(userID, eventType string, current Period, offset time.Duration) Comparison {
+	previous := current.Shift(offset)
+	return compare(userID, eventType,
+		v.GetAggregatedData(userID, eventType, current.From, current.To),
+		v.GetAggregatedData(userID, eventType, previous.From, previous.To))
+}
+
+// CompareAll сравнивает агрегаты каждой пары (user_id, type), прошедшей
+// filter, за период current и за период со сдвигом offset. В результат
+// попадают группы с событиями хотя бы в одном из периодов; порядок - по
+// user_id, затем по типу.
+func (v TenantView) CompareAll(filter storage.GroupFilter, current Period, offset time.Duration) []Comparison {
+	store := v.aggregator.currentStorage()
+	previous := current.Shift(offset)
+
+	type key struct{ userID, eventType string }
+	type pair struct{ current, previous *models.AggregatedData }
+	groups := make(map[key]*pair)
+	collect := func(p Period, set func(*pair, *models.AggregatedData)) {
+		filter.From, filter.To = p.From, p.To
+		for _, d := range store.GetGroupedAggregated(v.tenant, filter) {
+			k := key{d.UserID, d.EventType}
+			if groups[k] == nil {
+				groups[k] = &pair{}
+			}
+			set(groups[k], &d)
+		}
+	}
+	collect(current, func(p *pair, d *models.AggregatedData) { p.current = d })
+	collect(previous, func(p *pair, d *models.AggregatedData) { p.previous = d })
+
+	result := make([]Comparison, 0, len(groups))
+	for k, p := range groups {
+		result = append(result, compare(k.userID, k.eventType, p.current, p.previous))
+	}
+	slices.SortFunc(result, func(a, b Comparison) int {
+		return cmp.Or(strings.Compare(a.UserID, b.UserID), strings.Compare(a.EventType, b.EventType))
+	})
+	return result
+}
@@ -0,0 +1,59 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestTenantView_Compare(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	agg := New(store, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agg.Start(ctx)
+
+	week := 7 * 24 * time.Hour
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	for _, e := range []models.Event{
+		// прошлая неделя
+		{Type: "purchase", UserID: "user-1", Value: 100, Timestamp: start.Add(-week + time.Hour)},
+		{Type: "purchase", UserID: "user-2", Value: 40, Timestamp: start.Add(-week + time.Hour)},
+		// эта неделя
+		{Type: "purchase", UserID: "user-1", Value: 60, Timestamp: start.Add(time.Hour)},
+		{Type: "purchase", UserID: "user-1", Value: 90, Timestamp: start.Add(2 * time.Hour)},
+		{Type: "purchase", UserID: "user-3", Value: 10, Timestamp: start.Add(time.Hour)},
+	} {
+		agg.ProcessEvent(e)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	view := agg.Tenant("")
+	current := Period{From: start, To: start.Add(week - time.Nanosecond)}
+
+	c := view.Compare("user-1", "purchase", current, week)
+	if c.Current.TotalValue != 150 || c.Previous.TotalValue != 100 {
+		t.Fatalf("Unexpected periods: %+v %+v", c.Current, c.Previous)
+	}
+	if c.Delta.Total.Absolute != 50 || c.Delta.Total.Percent == nil || *c.Delta.Total.Percent != 50 {
+		t.Errorf("Expected total +50 (+50%%), got %+v", c.Delta.Total)
+	}
+	if c.Delta.Count.Absolute != 1 || c.Delta.Avg == nil || c.Delta.Avg.Absolute != -25 {
+		t.Errorf("Unexpected deltas: %+v", c.Delta)
+	}
+
+	all := view.CompareAll(storage.GroupFilter{EventType: "purchase"}, current, week)
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 groups, got %+v", all)
+	}
+	gone, added := all[1], all[2]
+	if gone.UserID != "user-2" || gone.Current != nil || gone.Delta.Count.Absolute != -1 || *gone.Delta.Count.Percent != -100 || gone.Delta.Avg != nil {
+		t.Errorf("Unexpected comparison for user-2: %+v", gone)
+	}
+	if added.UserID != "user-3" || added.Previous != nil || added.Delta.Total.Percent != nil {
+		t.Errorf("Expected no percent for new group user-3, got %+v", added)
+	}
+}
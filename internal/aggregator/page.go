@@ -0,0 +1,168 @@
+package aggregator
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Поля сортировки агрегатов
+const (
+	SortKey   = "key" // user_id, затем тип события
+	SortCount = "count"
+	SortTotal = "total"
+	SortAvg   = "avg"
+	SortMin   = "min"
+	SortMax   = "max"
+)
+
+// SortFields - допустимые поля сортировки
+var SortFields = []string{SortKey, SortCount, SortTotal, SortAvg, SortMin, SortMax}
+
+// ErrInvalidCursor - курсор повреждён или выдан для другой сортировки
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageQuery - запрос страницы агрегатов
+type PageQuery struct {
+	Filter storage.GroupFilter
+	// SortBy - одно из SortFields; пустое - SortKey
+	SortBy string
+	Desc   bool
+	// Limit - размер страницы; <= 0 - все агрегаты
+	Limit int
+	// Cursor - NextCursor предыдущей страницы; пустой - первая страница
+	Cursor string
+}
+
+// Page - страница агрегатов
+type Page struct {
+	Items []models.AggregatedData `json:"items"`
+	// Total - количество агрегатов, прошедших фильтр, на всех страницах
+	Total int `json:"total"`
+	// NextCursor - курсор следующей страницы; пустой на последней
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor - позиция последнего агрегата страницы. Страницы листаются по
+// значению сортировки и ключу группы, а не по смещению, поэтому новые группы
+// не сдвигают уже просмотренные.
+type cursor struct {
+	SortBy    string  `json:"s"`
+	Desc      bool    `json:"d,omitempty"`
+	Value     float64 `json:"v,omitempty"`
+	UserID    string  `json:"u"`
+	EventType string  `json:"t"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// position - место агрегата в порядке сортировки
+type position struct {
+	value     float64
+	userID    string
+	eventType string
+}
+
+func positionOf(d models.AggregatedData, field string) position {
+	return position{value: metricValue(d, field), userID: d.UserID, eventType: d.EventType}
+}
+
+// metricValue - значение метрики агрегата; для SortKey - 0
+func metricValue(d models.AggregatedData, metric string) float64 {
+	switch metric {
+	case SortCount:
+		return float64(d.Count)
+	case SortTotal:
+		return d.TotalValue
+	case SortAvg:
+		return d.AvgValue
+	case SortMin:
+		return d.MinValue
+	case SortMax:
+		return d.MaxValue
+	}
+	return 0
+}
+
+// compare упорядочивает по значению поля, при равенстве - по ключу группы
+// по возрастанию; при сортировке по ключу desc обращает и его
+func (p position) compare(o position, field string, desc bool) int {
+	if c := cmp.Compare(p.value, o.value); c != 0 {
+		if desc {
+			return -c
+		}
+		return c
+	}
+	c := cmp.Or(strings.Compare(p.userID, o.userID), strings.Compare(p.eventType, o.eventType))
+	if desc && field == SortKey {
+		return -c
+	}
+	return c
+}
+
+// ListAggregated возвращает страницу агрегатов тенанта с фильтрацией и
+// сортировкой
+func (v TenantView) ListAggregated(q PageQuery) (Page, error) {
+	if q.SortBy == "" {
+		q.SortBy = SortKey
+	}
+	if !slices.Contains(SortFields, q.SortBy) {
+		return Page{}, errors.New("unknown sort field " + q.SortBy)
+	}
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		if c.SortBy != q.SortBy || c.Desc != q.Desc {
+			return Page{}, ErrInvalidCursor
+		}
+		after = &c
+	}
+
+	data := v.aggregator.currentStorage().GetGroupedAggregated(v.tenant, q.Filter)
+	slices.SortFunc(data, func(a, b models.AggregatedData) int {
+		return positionOf(a, q.SortBy).compare(positionOf(b, q.SortBy), q.SortBy, q.Desc)
+	})
+
+	page := Page{Items: data, Total: len(data)}
+	if after != nil {
+		last := position{value: after.Value, userID: after.UserID, eventType: after.EventType}
+		i := sort.Search(len(data), func(i int) bool {
+			return positionOf(data[i], q.SortBy).compare(last, q.SortBy, q.Desc) > 0
+		})
+		page.Items = data[i:]
+	}
+	if q.Limit > 0 && len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		p := positionOf(page.Items[q.Limit-1], q.SortBy)
+		page.NextCursor = cursor{
+			SortBy:    q.SortBy,
+			Desc:      q.Desc,
+			Value:     p.value,
+			UserID:    p.userID,
+			EventType: p.eventType,
+		}.encode()
+	}
+	return page, nil
+}
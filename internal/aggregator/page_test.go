@@ -0,0 +1,71 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestTenantView_ListAggregated(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	agg := New(store, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agg.Start(ctx)
+
+	now := time.Now()
+	// Одинаковый count у user-a и user-b: порядок при равенстве - по ключу
+	for _, e := range []models.Event{
+		{Type: "click", UserID: "user-b", Value: 5, Timestamp: now},
+		{Type: "click", UserID: "user-a", Value: 1, Timestamp: now},
+		{Type: "click", UserID: "user-c", Value: 2, Timestamp: now},
+		{Type: "click", UserID: "user-c", Value: 2, Timestamp: now},
+		{Type: "view", UserID: "user-a", Value: 9, Timestamp: now},
+	} {
+		agg.ProcessEvent(e)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	view := agg.Tenant("")
+	q := PageQuery{SortBy: SortCount, Desc: true, Limit: 2}
+	var keys []string
+	for {
+		page, err := view.ListAggregated(q)
+		if err != nil {
+			t.Fatalf("ListAggregated failed: %v", err)
+		}
+		if page.Total != 4 {
+			t.Errorf("Expected total 4, got %d", page.Total)
+		}
+		for _, d := range page.Items {
+			keys = append(keys, d.UserID+":"+d.EventType)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []string{"user-c:click", "user-a:click", "user-a:view", "user-b:click"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, keys)
+			break
+		}
+	}
+
+	page, _ := view.ListAggregated(PageQuery{SortBy: SortKey, Desc: true, Limit: 1})
+	if page.Items[0].UserID != "user-c" {
+		t.Errorf("Expected user-c first by key desc, got %+v", page.Items)
+	}
+
+	if _, err := view.ListAggregated(PageQuery{SortBy: SortMax, Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for cursor of another sort, got %v", err)
+	}
+}
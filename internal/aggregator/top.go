@@ -0,0 +1,56 @@
+package aggregator
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/internal/topk"
+)
+
+// Metrics - метрики, по которым строится рейтинг
+var Metrics = []string{SortCount, SortTotal, SortAvg, SortMin, SortMax}
+
+// TopQuery - запрос рейтинга значений измерения по метрике
+type TopQuery struct {
+	By     storage.Dimension
+	Metric string
+	K      int
+	Filter storage.GroupFilter
+	// Bottom - k наименьших значений метрики вместо наибольших
+	Bottom bool
+}
+
+// TopEntry - место в рейтинге
+type TopEntry struct {
+	Rank  int     `json:"rank"`
+	Value float64 `json:"value"`
+	storage.Group
+}
+
+// Top возвращает k значений измерения с наибольшей (Bottom - наименьшей)
+// метрикой. Агрегаты по измерению берёт Storage.Rollup (для user_id и type
+// без границ времени - из поддерживаемых агрегатов групп, иначе за один
+// проход по событиям), из них куча размера k отбирает рейтинг; при равной
+// метрике выше меньший ключ.
+func (v TenantView) Top(q TopQuery) ([]TopEntry, error) {
+	if !slices.Contains(Metrics, q.Metric) {
+		return nil, fmt.Errorf("unknown metric %q", q.Metric)
+	}
+
+	top := topk.New(q.K, func(a, b TopEntry) bool {
+		if a.Value != b.Value {
+			return (a.Value < b.Value) != q.Bottom
+		}
+		return a.Key > b.Key
+	})
+	for _, g := range v.aggregator.currentStorage().Rollup(v.tenant, q.By, q.Filter) {
+		top.Push(TopEntry{Value: metricValue(g.AggregatedData, q.Metric), Group: g})
+	}
+
+	entries := top.Sorted()
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+	return entries, nil
+}
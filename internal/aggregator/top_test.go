@@ -0,0 +1,61 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestTenantView_Top(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	agg := New(store, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agg.Start(ctx)
+
+	now := time.Now()
+	for _, e := range []models.Event{
+		{Type: "purchase", UserID: "user-a", Value: 50, Timestamp: now},
+		{Type: "purchase", UserID: "user-b", Value: 20, Timestamp: now},
+		{Type: "purchase", UserID: "user-b", Value: 30, Timestamp: now},
+		{Type: "purchase", UserID: "user-c", Value: 80, Timestamp: now},
+		{Type: "purchase", UserID: "user-d", Value: 5, Timestamp: now.Add(-48 * time.Hour)},
+		{Type: "view", UserID: "user-d", Value: 1000, Timestamp: now},
+	} {
+		agg.ProcessEvent(e)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	view := agg.Tenant("")
+	top, err := view.Top(TopQuery{
+		By:     storage.DimensionUser,
+		Metric: SortTotal,
+		K:      3,
+		Filter: storage.GroupFilter{EventType: "purchase", From: now.Add(-24 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("Top failed: %v", err)
+	}
+	// user-a и user-b набрали по 50: при равенстве выше меньший ключ
+	want := []string{"user-c", "user-a", "user-b"}
+	if len(top) != len(want) {
+		t.Fatalf("Expected %v, got %+v", want, top)
+	}
+	for i, e := range top {
+		if e.Key != want[i] || e.Rank != i+1 {
+			t.Errorf("Expected %s at rank %d, got %+v", want[i], i+1, e)
+		}
+	}
+
+	bottom, _ := view.Top(TopQuery{By: storage.DimensionType, Metric: SortCount, K: 1, Bottom: true})
+	if len(bottom) != 1 || bottom[0].Key != "view" || bottom[0].Value != 1 {
+		t.Errorf("Expected view as least frequent type, got %+v", bottom)
+	}
+
+	if _, err := view.Top(TopQuery{By: storage.DimensionUser, Metric: SortKey, K: 1}); err == nil {
+		t.Error("Expected error for non-metric sort field")
+	}
+}
@@ -0,0 +1,316 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// receiver - тестовый получатель webhook, отвечающий кодами из statuses по очереди
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		status := http.StatusOK
+		if len(rc.requests) < len(rc.statuses) {
+			status = rc.statuses[len(rc.requests)]
+		}
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		rc.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+func setupEngine(t *testing.T) (*Engine, *aggregator.Aggregator) {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	engine := NewEngine(agg, NewDispatcher(DispatcherConfig{Backoff: 10 * time.Millisecond, MaxAttempts: 3, AllowLoopback: true}), 100)
+	engine.SetInterval(10 * time.Millisecond)
+	agg.OnEvent(engine.Observe)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+	engine.Start(ctx)
+	return engine, agg
+}
+
+func waitForDelivery(t *testing.T, e *Engine, ruleID string, status string) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if ds := e.Deliveries(ruleID); len(ds) > 0 && ds[0].Status == status {
+			return ds[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("No %s delivery for rule %s: %+v", status, ruleID, e.Deliveries(ruleID))
+	return Delivery{}
+}
+
+func TestRule_Validate(t *testing.T) {
+	valid := Rule{EventType: "purchase", Metric: MetricSum, Operator: ">", Threshold: 10,
+		Window: Duration(time.Minute), WebhookURL: "http://example.com/hook"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, mutate := range map[string]func(*Rule){
+		"no type":     func(r *Rule) { r.EventType = "" },
+		"bad metric":  func(r *Rule) { r.Metric = "p99" },
+		"bad op":      func(r *Rule) { r.Operator = "==" },
+		"zero window": func(r *Rule) { r.Window = 0 },
+		"bad url":     func(r *Rule) { r.WebhookURL = "/relative" },
+	} {
+		r := valid
+		mutate(&r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	var r Rule
+	if err := json.Unmarshal([]byte(`{"window":"10m"}`), &r); err != nil || time.Duration(r.Window) != 10*time.Minute {
+		t.Errorf("Unexpected window parsing: %v, %v", r.Window, err)
+	}
+}
+
+func TestEngine_FiresSignedWebhook(t *testing.T) {
+	rc := newReceiver(t)
+	engine, agg := setupEngine(t)
+
+	rule, err := engine.AddRule(Rule{
+		Name: "big spender", EventType: "purchase", Metric: MetricSum, PerUser: true,
+		Operator: ">", Threshold: 100, Window: Duration(time.Minute),
+		WebhookURL: rc.URL, Secret: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if rule.Secret != "" {
+		t.Error("Secret must not be returned")
+	}
+
+	now := time.Now()
+	agg.ProcessEvent(models.Event{ID: "1", Type: "purchase", UserID: "u1", Value: 60, Timestamp: now})
+	agg.ProcessEvent(models.Event{ID: "2", Type: "purchase", UserID: "u2", Value: 60, Timestamp: now})
+	agg.ProcessEvent(models.Event{ID: "3", Type: "purchase", UserID: "u1", Value: 60, Timestamp: now})
+
+	d := waitForDelivery(t, engine, rule.ID, StatusDelivered)
+	if d.Attempts != 1 || d.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected delivery: %+v", d)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.requests) != 1 {
+		t.Fatalf("Expected 1 webhook call (u2 is under threshold), got %d", len(rc.requests))
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+	if got := req.Header.Get(SignatureHeader); got != Sign("s3cret", body) {
+		t.Errorf("Bad signature %q", got)
+	}
+	if req.Header.Get(DeliveryHeader) != d.ID {
+		t.Errorf("Expected delivery id %s, got %s", d.ID, req.Header.Get(DeliveryHeader))
+	}
+
+	var p Payload
+	json.Unmarshal(body, &p)
+	if p.RuleID != rule.ID || p.UserID != "u1" || p.Value != 120 {
+		t.Errorf("Unexpected payload: %+v", p)
+	}
+}
+
+func TestEngine_Cooldown(t *testing.T) {
+	rc := newReceiver(t)
+	engine, agg := setupEngine(t)
+
+	rule, _ := engine.AddRule(Rule{EventType: "error", Metric: MetricCount, Operator: ">=",
+		Threshold: 1, Window: Duration(time.Minute), WebhookURL: rc.URL})
+
+	for i := 0; i < 5; i++ {
+		agg.ProcessEvent(models.Event{Type: "error", UserID: "svc", Value: 1, Timestamp: time.Now()})
+	}
+	waitForDelivery(t, engine, rule.ID, StatusDelivered)
+	time.Sleep(100 * time.Millisecond)
+
+	if n := rc.count(); n != 1 {
+		t.Errorf("Expected a single webhook within cooldown, got %d", n)
+	}
+}
+
+func TestEngine_FiresWhenQuiet(t *testing.T) {
+	rc := newReceiver(t)
+	engine, agg := setupEngine(t)
+
+	// Окно заполняется событиями, принятыми до создания правила
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		agg.ProcessEvent(models.Event{Type: "purchase", UserID: "u1", Value: 1, Timestamp: now})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	rule, err := engine.AddRule(Rule{EventType: "purchase", Metric: MetricCount, Operator: "<",
+		Threshold: 3, Window: Duration(300 * time.Millisecond), WebhookURL: rc.URL})
+	if err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := rc.count(); n != 0 {
+		t.Fatalf("Expected no webhook while the window has 3 events, got %d", n)
+	}
+
+	// Без новых событий окно пустеет, и правило срабатывает по таймеру
+	d := waitForDelivery(t, engine, rule.ID, StatusDelivered)
+	if d.Payload.Value >= 3 {
+		t.Errorf("Unexpected payload: %+v", d.Payload)
+	}
+}
+
+func TestEngine_RejectsLoopbackWebhook(t *testing.T) {
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	engine := NewEngine(agg, NewDispatcher(DispatcherConfig{}), 100)
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := engine.AddRule(Rule{EventType: "x", Metric: MetricCount, Operator: ">",
+			Window: Duration(time.Minute), WebhookURL: u})
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: expected ErrForbiddenAddress, got %v", u, err)
+		}
+	}
+	if _, err := engine.AddRule(Rule{EventType: "x", Metric: MetricCount, Operator: ">",
+		Window: Duration(time.Minute), WebhookURL: "https://hooks.example.com/x"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDispatcher_ForbiddenAddress(t *testing.T) {
+	rc := newReceiver(t)
+	d := NewDispatcher(DispatcherConfig{Backoff: time.Millisecond, MaxAttempts: 3})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 1)
+
+	// Адрес проверяется при соединении, даже если правило его пропустило
+	d.Enqueue(Rule{ID: "r1", WebhookURL: rc.URL}, Payload{RuleID: "r1"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && d.Deliveries("r1")[0].Status == StatusPending {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := d.Deliveries("r1")[0]; got.Status != StatusFailed || got.Attempts != 1 || rc.count() != 0 {
+		t.Errorf("Expected a single refused attempt, got %+v", got)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var w window
+	base := time.Unix(1000, 0)
+	w.add(int64(time.Second), base, 5)
+	w.add(int64(time.Second), base.Add(2*time.Second), 1)
+	w.add(int64(time.Second), base.Add(500*time.Millisecond), 9)
+
+	agg := w.aggregate()
+	if agg.Count != 3 || agg.TotalValue != 15 || agg.MinValue != 1 || agg.MaxValue != 9 {
+		t.Errorf("Unexpected aggregate: %+v", agg)
+	}
+
+	w.expire(int64(time.Second), base.Add(time.Second).UnixNano())
+	if agg := w.aggregate(); agg == nil || agg.Count != 1 || agg.TotalValue != 1 {
+		t.Errorf("Expected only the last event after expiry, got %+v", agg)
+	}
+	w.expire(int64(time.Second), base.Add(10*time.Second).UnixNano())
+	if agg := w.aggregate(); agg != nil {
+		t.Errorf("Expected empty window, got %+v", agg)
+	}
+}
+
+func TestDispatcher_Retries(t *testing.T) {
+	rc := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK)
+	d := NewDispatcher(DispatcherConfig{Backoff: 10 * time.Millisecond, MaxAttempts: 3, AllowLoopback: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 1)
+
+	d.Enqueue(Rule{ID: "r1", WebhookURL: rc.URL}, Payload{RuleID: "r1"})
+
+	var got Delivery
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got = d.Deliveries("r1")[0]; got.Status != StatusPending {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.Status != StatusDelivered || got.Attempts != 3 {
+		t.Errorf("Expected delivery on third attempt, got %+v", got)
+	}
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	bad := newReceiver(t, http.StatusBadRequest)
+
+	d := NewDispatcher(DispatcherConfig{Backoff: time.Millisecond, MaxAttempts: 3, AllowLoopback: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, 2)
+
+	d.Enqueue(Rule{ID: "5xx", WebhookURL: srv.URL}, Payload{})
+	d.Enqueue(Rule{ID: "4xx", WebhookURL: bad.URL}, Payload{})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if d.Deliveries("5xx")[0].Status == StatusFailed && d.Deliveries("4xx")[0].Status == StatusFailed {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := d.Deliveries("5xx")[0]; got.Status != StatusFailed || got.Attempts != 3 || calls.Load() != 3 {
+		t.Errorf("Expected 3 failed attempts, got %+v (calls=%d)", got, calls.Load())
+	}
+	if got := d.Deliveries("4xx")[0]; got.Status != StatusFailed || got.Attempts != 1 {
+		t.Errorf("Expected no retry on 400, got %+v", got)
+	}
+}
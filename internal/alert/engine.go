@@ -0,0 +1,312 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+	"github.com/google/uuid"
+)
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+// Querier - источник агрегатов тенантов для оценки правил (реализуется aggregator.Aggregator)
+type Querier interface {
+	Tenant(tenant string) aggregator.TenantView
+}
+
+// DefaultInterval - период оценки всех правил по умолчанию
+const DefaultInterval = time.Second
+
+// Engine хранит правила и скользящие окна их групп. Окно группы
+// обновляется при поступлении события и сразу проверяется; раз в interval
+// проверяются окна всех правил, поэтому правила вида "меньше N событий"
+// срабатывают и когда событий нет.
+type Engine struct {
+	querier    Querier
+	dispatcher *Dispatcher
+	events     chan models.Event
+	interval   time.Duration
+
+	mu     sync.RWMutex
+	rules  map[string]Rule
+	states map[string]*ruleState
+	// lastFired - время последнего срабатывания по ключу правило+пользователь
+	lastFired map[string]time.Time
+}
+
+func NewEngine(q Querier, d *Dispatcher, bufferSize int) *Engine {
+	return &Engine{
+		querier:    q,
+		dispatcher: d,
+		events:     make(chan models.Event, bufferSize),
+		interval:   DefaultInterval,
+		rules:      make(map[string]Rule),
+		states:     make(map[string]*ruleState),
+		lastFired:  make(map[string]time.Time),
+	}
+}
+
+// SetInterval задаёт период оценки всех правил; вызывается до Start
+func (e *Engine) SetInterval(d time.Duration) {
+	e.interval = d
+}
+
+// Start запускает оценку правил и доставку уведомлений до отмены ctx
+func (e *Engine) Start(ctx context.Context) {
+	e.dispatcher.Start(ctx, 4)
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case event := <-e.events:
+				e.observe(event, time.Now())
+			case now := <-ticker.C:
+				e.tick(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Observe принимает обработанное событие; подписывается через Aggregator.OnEvent.
+// Не блокирует агрегатор: при переполнении очереди событие пропускается.
+func (e *Engine) Observe(event models.Event) {
+	select {
+	case e.events <- event:
+	default:
+		log.Printf("Alert engine queue is full, skipping event %s", event.ID)
+	}
+}
+
+// Rules возвращает правила в порядке создания (без секретов)
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make([]Rule, 0, len(e.rules))
+	for _, r := range e.rules {
+		result = append(result, r.redacted())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+func (e *Engine) GetRule(id string) (Rule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	r, ok := e.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	return r.redacted(), nil
+}
+
+// validate проверяет правило и адрес его webhook
+func (e *Engine) validate(r *Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	return e.dispatcher.CheckURL(r.WebhookURL)
+}
+
+// AddRule проверяет и сохраняет правило, присваивая ему ID. Окна правила
+// заполняются событиями из хранилища за последний Window.
+func (e *Engine) AddRule(r Rule) (Rule, error) {
+	if err := e.validate(&r); err != nil {
+		return Rule{}, err
+	}
+	r.ID = uuid.New().String()
+	r.CreatedAt = time.Now()
+
+	e.mu.Lock()
+	e.rules[r.ID] = r
+	e.states[r.ID] = e.backfill(r, r.CreatedAt)
+	e.mu.Unlock()
+
+	log.Printf("Alert rule %s created: %s(%s) %s %g over %s",
+		r.ID, r.Metric, r.EventType, r.Operator, r.Threshold, time.Duration(r.Window))
+	return r.redacted(), nil
+}
+
+// UpdateRule заменяет правило id; пустой Secret сохраняет прежний ключ
+func (e *Engine) UpdateRule(id string, r Rule) (Rule, error) {
+	if err := e.validate(&r); err != nil {
+		return Rule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	old, ok := e.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	r.ID = id
+	r.CreatedAt = old.CreatedAt
+	if r.Secret == "" {
+		r.Secret = old.Secret
+	}
+	e.rules[id] = r
+	e.states[id] = e.backfill(r, time.Now())
+	e.resetCooldown(id)
+	return r.redacted(), nil
+}
+
+func (e *Engine) DeleteRule(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.rules[id]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(e.rules, id)
+	delete(e.states, id)
+	e.resetCooldown(id)
+	return nil
+}
+
+// Deliveries возвращает журнал доставок; ruleID "" - по всем правилам
+func (e *Engine) Deliveries(ruleID string) []Delivery {
+	return e.dispatcher.Deliveries(ruleID)
+}
+
+// backfill строит окна правила по событиям хранилища; вызывается под e.mu,
+// чтобы движок не учёл событие и из хранилища, и из очереди дважды
+func (e *Engine) backfill(r Rule, now time.Time) *ruleState {
+	st := newRuleState(r)
+	st.backfilled = make(map[string]struct{})
+	filter := storage.GroupFilter{EventType: r.EventType, From: now.Add(-time.Duration(r.Window))}
+	e.querier.Tenant(r.Tenant).Scan(filter, func(event models.Event) bool {
+		st.add(&r, event)
+		st.backfilled[event.ID] = struct{}{}
+		return true
+	})
+	return st
+}
+
+// firing - группа правила, метрика которой перешла порог
+type firing struct {
+	rule   Rule
+	userID string
+	value  float64
+}
+
+// check сдвигает окно группы key к now и сравнивает метрику с порогом;
+// вызывается под e.mu
+func (e *Engine) check(r Rule, st *ruleState, key string, now time.Time) (firing, bool) {
+	w := st.groups[key]
+	w.expire(st.width, now.Add(-time.Duration(r.Window)).UnixNano())
+	v := r.value(w.aggregate())
+	return firing{rule: r, userID: key, value: v}, r.exceeded(v)
+}
+
+// observe учитывает событие в окнах подходящих правил и проверяет их
+func (e *Engine) observe(event models.Event, now time.Time) {
+	var fired []firing
+	e.mu.Lock()
+	for id, r := range e.rules {
+		if r.EventType != event.Type || r.Tenant != event.Tenant {
+			continue
+		}
+		st := e.states[id]
+		if _, ok := st.backfilled[event.ID]; ok {
+			// Уже учтено при создании правила
+			delete(st.backfilled, event.ID)
+			continue
+		}
+		if f, ok := e.check(r, st, st.add(&r, event), now); ok {
+			fired = append(fired, f)
+		}
+	}
+	e.mu.Unlock()
+	e.fire(fired, now)
+}
+
+// tick проверяет окна всех правил. Группа пользователя, в окне которой не
+// осталось событий, проверяется последний раз и удаляется.
+func (e *Engine) tick(now time.Time) {
+	var fired []firing
+	e.mu.Lock()
+	idle := len(e.events) == 0
+	for id, r := range e.rules {
+		st := e.states[id]
+		if idle {
+			// Событий, загруженных при создании правила, в очереди больше нет
+			st.backfilled = nil
+		}
+		for key, w := range st.groups {
+			if f, ok := e.check(r, st, key, now); ok {
+				fired = append(fired, f)
+			}
+			if r.PerUser && len(w.buckets) == 0 {
+				delete(st.groups, key)
+			}
+		}
+	}
+	e.mu.Unlock()
+	e.fire(fired, now)
+}
+
+// fire отправляет уведомления по группам, для которых истёк cooldown
+func (e *Engine) fire(fired []firing, now time.Time) {
+	for _, f := range fired {
+		r := f.rule
+		if !e.acquire(r, f.userID, now) {
+			continue
+		}
+		e.dispatcher.Enqueue(r, Payload{
+			RuleID:      r.ID,
+			RuleName:    r.Name,
+			Tenant:      r.Tenant,
+			EventType:   r.EventType,
+			UserID:      f.userID,
+			Metric:      r.Metric,
+			Operator:    r.Operator,
+			Threshold:   r.Threshold,
+			Value:       f.value,
+			Window:      r.Window,
+			TriggeredAt: now,
+		})
+	}
+}
+
+// acquire отмечает срабатывание, если для группы истёк cooldown
+func (e *Engine) acquire(r Rule, userID string, now time.Time) bool {
+	key := r.ID + "\x00" + userID
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.rules[r.ID]; !ok {
+		// правило удалили во время оценки
+		return false
+	}
+	if last, ok := e.lastFired[key]; ok && now.Sub(last) < r.cooldown() {
+		return false
+	}
+	e.lastFired[key] = now
+	return true
+}
+
+// resetCooldown забывает срабатывания правила; вызывается под e.mu
+func (e *Engine) resetCooldown(id string) {
+	prefix := id + "\x00"
+	for key := range e.lastFired {
+		if strings.HasPrefix(key, prefix) {
+			delete(e.lastFired, key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Метрики, по которым можно задать порог
+const (
+	MetricCount = "count"
+	MetricSum   = "sum"
+	MetricAvg   = "avg"
+	MetricMin   = "min"
+	MetricMax   = "max"
+)
+
+// Duration - time.Duration, которая в JSON записывается строкой ("10m")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule - правило вида "sum(value) событий purchase по пользователю за 10m > 1000"
+type Rule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Tenant - правило оценивается только по событиям этого тенанта
+	Tenant    string `json:"tenant,omitempty"`
+	EventType string `json:"event_type"`
+	Metric    string `json:"metric"`
+	// PerUser - оценивать правило отдельно для каждого user_id
+	PerUser   bool     `json:"per_user"`
+	Window    Duration `json:"window"`
+	Operator  string   `json:"operator"`
+	Threshold float64  `json:"threshold"`
+	// Cooldown - минимальный интервал между срабатываниями для одной группы;
+	// по умолчанию равен Window
+	Cooldown   Duration `json:"cooldown,omitempty"`
+	WebhookURL string   `json:"webhook_url"`
+	// Secret - ключ HMAC-подписи тела запроса; в ответах API не возвращается
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate проверяет правило перед сохранением
+func (r *Rule) Validate() error {
+	if r.EventType == "" {
+		return fmt.Errorf("event_type is required")
+	}
+	switch r.Metric {
+	case MetricCount, MetricSum, MetricAvg, MetricMin, MetricMax:
+	default:
+		return fmt.Errorf("metric must be one of count, sum, avg, min, max")
+	}
+	switch r.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("operator must be one of >, >=, <, <=")
+	}
+	if r.Window <= 0 {
+		return fmt.Errorf("window must be positive")
+	}
+	if r.Cooldown < 0 {
+		return fmt.Errorf("cooldown must not be negative")
+	}
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// redacted возвращает копию правила без секрета для ответов API
+func (r Rule) redacted() Rule {
+	r.Secret = ""
+	return r
+}
+
+// cooldown возвращает интервал подавления повторных срабатываний
+func (r *Rule) cooldown() time.Duration {
+	if r.Cooldown > 0 {
+		return time.Duration(r.Cooldown)
+	}
+	return time.Duration(r.Window)
+}
+
+// value извлекает из агрегата метрику правила; nil-агрегат - это ноль событий
+func (r *Rule) value(agg *models.AggregatedData) float64 {
+	if agg == nil {
+		return 0
+	}
+	switch r.Metric {
+	case MetricCount:
+		return float64(agg.Count)
+	case MetricSum:
+		return agg.TotalValue
+	case MetricAvg:
+		return agg.AvgValue
+	case MetricMin:
+		return agg.MinValue
+	default:
+		return agg.MaxValue
+	}
+}
+
+func (r *Rule) exceeded(v float64) bool {
+	switch r.Operator {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	default:
+		return v <= r.Threshold
+	}
+}
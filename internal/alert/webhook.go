@@ -0,0 +1,328 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Заголовки исходящего webhook-запроса
+const (
+	SignatureHeader = "X-Aggregator-Signature"
+	DeliveryHeader  = "X-Aggregator-Delivery"
+)
+
+// Статусы доставки
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Payload - тело webhook-запроса о срабатывании правила
+type Payload struct {
+	RuleID      string    `json:"rule_id"`
+	RuleName    string    `json:"rule_name"`
+	Tenant      string    `json:"tenant,omitempty"`
+	EventType   string    `json:"event_type"`
+	UserID      string    `json:"user_id,omitempty"`
+	Metric      string    `json:"metric"`
+	Operator    string    `json:"operator"`
+	Threshold   float64   `json:"threshold"`
+	Value       float64   `json:"value"`
+	Window      Duration  `json:"window"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Delivery - запись журнала доставки
+type Delivery struct {
+	ID          string    `json:"id"`
+	RuleID      string    `json:"rule_id"`
+	URL         string    `json:"url"`
+	Payload     Payload   `json:"payload"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+// ErrForbiddenAddress - webhook указывает на адрес, куда запросы не отправляются
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// forbiddenIP - адреса, на которые webhook не отправляются: loopback,
+// link-local (в том числе метаданные облака 169.254.169.254), unspecified и
+// multicast
+func forbiddenIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// Sign возвращает значение заголовка подписи: "sha256=" + hex(HMAC-SHA256(secret, body))
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher отправляет webhook-запросы с повторами и ведёт журнал доставок
+type Dispatcher struct {
+	client        *http.Client
+	allowLoopback bool
+	maxAttempts   int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	logSize       int
+
+	queue chan job
+
+	mu  sync.Mutex
+	log []*Delivery
+}
+
+type job struct {
+	delivery *Delivery
+	secret   string
+}
+
+// DispatcherConfig - параметры доставки; нулевые значения заменяются значениями по умолчанию
+type DispatcherConfig struct {
+	Timeout     time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	LogSize     int
+	QueueSize   int
+	// AllowLoopback разрешает webhook на loopback и link-local адреса
+	// (тесты и локальная отладка)
+	AllowLoopback bool
+}
+
+func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.LogSize == 0 {
+		cfg.LogSize = 1000
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 1000
+	}
+
+	// Адрес проверяется при каждом соединении, уже после разрешения имени,
+	// в том числе при редиректах
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.AllowLoopback {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			if ap, err := netip.ParseAddrPort(address); err == nil && forbiddenIP(ap.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		client:        &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		allowLoopback: cfg.AllowLoopback,
+		maxAttempts:   cfg.MaxAttempts,
+		backoff:       cfg.Backoff,
+		maxBackoff:    cfg.MaxBackoff,
+		logSize:       cfg.LogSize,
+		queue:         make(chan job, cfg.QueueSize),
+	}
+}
+
+// CheckURL отклоняет webhook на localhost и запрещённые IP-адреса. Имена
+// хостов проверяются при соединении, после разрешения.
+func (d *Dispatcher) CheckURL(raw string) error {
+	if d.allowLoopback {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Start запускает workers доставки до отмены ctx
+func (d *Dispatcher) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Enqueue ставит уведомление в очередь на доставку и возвращает ID доставки
+func (d *Dispatcher) Enqueue(rule Rule, p Payload) string {
+	delivery := &Delivery{
+		ID:        uuid.New().String(),
+		RuleID:    rule.ID,
+		URL:       rule.WebhookURL,
+		Payload:   p,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+	d.record(delivery)
+
+	select {
+	case d.queue <- job{delivery: delivery, secret: rule.Secret}:
+	default:
+		d.finish(delivery, StatusFailed, 0, "delivery queue is full")
+	}
+	return delivery.ID
+}
+
+// Deliveries возвращает журнал доставок (новые первыми); ruleID "" - все правила
+func (d *Dispatcher) Deliveries(ruleID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]Delivery, 0)
+	for i := len(d.log) - 1; i >= 0; i-- {
+		if ruleID == "" || d.log[i].RuleID == ruleID {
+			result = append(result, *d.log[i])
+		}
+	}
+	return result
+}
+
+func (d *Dispatcher) record(delivery *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.log) >= d.logSize {
+		d.log = d.log[1:]
+	}
+	d.log = append(d.log, delivery)
+}
+
+func (d *Dispatcher) finish(delivery *Delivery, status string, code int, errMsg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.Status = status
+	delivery.StatusCode = code
+	delivery.LastError = errMsg
+	if status != StatusPending {
+		delivery.CompletedAt = time.Now()
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	body, err := json.Marshal(j.delivery.Payload)
+	if err != nil {
+		d.finish(j.delivery, StatusFailed, 0, err.Error())
+		return
+	}
+
+	backoff := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		d.mu.Lock()
+		j.delivery.Attempts = attempt
+		d.mu.Unlock()
+
+		code, err := d.post(ctx, j, body)
+		switch {
+		case errors.Is(err, ErrForbiddenAddress):
+			// Повтор не поможет
+			d.finish(j.delivery, StatusFailed, 0, err.Error())
+			return
+		case err == nil && code < 300:
+			d.finish(j.delivery, StatusDelivered, code, "")
+			return
+		case err == nil && code < 500 && code != http.StatusTooManyRequests:
+			// 4xx кроме 429 - повтор не поможет
+			d.finish(j.delivery, StatusFailed, code, fmt.Sprintf("webhook returned %d", code))
+			return
+		case err == nil:
+			d.finish(j.delivery, StatusPending, code, fmt.Sprintf("webhook returned %d", code))
+		default:
+			d.finish(j.delivery, StatusPending, 0, err.Error())
+		}
+
+		if attempt == d.maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			d.finish(j.delivery, StatusFailed, j.delivery.StatusCode, "dispatcher stopped")
+			return
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+
+	d.mu.Lock()
+	code, lastErr := j.delivery.StatusCode, j.delivery.LastError
+	d.mu.Unlock()
+	d.finish(j.delivery, StatusFailed, code, lastErr)
+	log.Printf("Webhook delivery %s for rule %s failed after %d attempts: %s",
+		j.delivery.ID, j.delivery.RuleID, d.maxAttempts, lastErr)
+}
+
+func (d *Dispatcher) post(ctx context.Context, j job, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, j.delivery.ID)
+	if j.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(j.secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
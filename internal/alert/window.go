@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// windowBuckets - число корзин в окне правила: окно сдвигается шагом
+// Window/windowBuckets и может захватывать события на одну корзину старше
+// Window
+const windowBuckets = 60
+
+// bucket - агрегаты событий группы с timestamp в [start, start+width)
+type bucket struct {
+	start    int64
+	count    int64
+	sum      float64
+	min, max float64
+}
+
+// window - скользящее окно группы правила: корзины по возрастанию start
+type window struct {
+	buckets []bucket
+}
+
+func (w *window) add(width int64, ts time.Time, v float64) {
+	t := ts.UnixNano()
+	start := t - t%width
+	if t < 0 && t%width != 0 {
+		start -= width
+	}
+	// События приходят почти по порядку времени - ищем корзину с конца
+	i := len(w.buckets)
+	for i > 0 && w.buckets[i-1].start > start {
+		i--
+	}
+	if i > 0 && w.buckets[i-1].start == start {
+		b := &w.buckets[i-1]
+		b.count++
+		b.sum += v
+		b.min = min(b.min, v)
+		b.max = max(b.max, v)
+		return
+	}
+	w.buckets = append(w.buckets, bucket{})
+	copy(w.buckets[i+1:], w.buckets[i:])
+	w.buckets[i] = bucket{start: start, count: 1, sum: v, min: v, max: v}
+}
+
+// expire удаляет корзины, целиком лежащие до from
+func (w *window) expire(width, from int64) {
+	n := 0
+	for n < len(w.buckets) && w.buckets[n].start+width <= from {
+		n++
+	}
+	if n > 0 {
+		w.buckets = append(w.buckets[:0], w.buckets[n:]...)
+	}
+}
+
+// aggregate - агрегат событий окна; nil - событий нет
+func (w *window) aggregate() *models.AggregatedData {
+	if len(w.buckets) == 0 {
+		return nil
+	}
+	agg := &models.AggregatedData{MinValue: w.buckets[0].min, MaxValue: w.buckets[0].max}
+	for _, b := range w.buckets {
+		agg.Count += b.count
+		agg.TotalValue += b.sum
+		agg.MinValue = min(agg.MinValue, b.min)
+		agg.MaxValue = max(agg.MaxValue, b.max)
+	}
+	agg.AvgValue = agg.TotalValue / float64(agg.Count)
+	return agg
+}
+
+// ruleState - окна групп правила; группа - user_id для PerUser, иначе ""
+type ruleState struct {
+	width  int64
+	groups map[string]*window
+	// backfilled - ID событий, загруженных из хранилища при создании
+	// правила: они же могут ещё лежать в очереди движка
+	backfilled map[string]struct{}
+}
+
+func newRuleState(r Rule) *ruleState {
+	st := &ruleState{
+		width:  max(int64(r.Window)/windowBuckets, 1),
+		groups: make(map[string]*window),
+	}
+	if !r.PerUser {
+		// Общая группа существует всегда: правило "меньше N" должно
+		// срабатывать и при полном отсутствии событий
+		st.groups[""] = &window{}
+	}
+	return st
+}
+
+// group - ключ группы события
+func (r *Rule) group(event models.Event) string {
+	if r.PerUser {
+		return event.UserID
+	}
+	return ""
+}
+
+func (st *ruleState) add(r *Rule, event models.Event) string {
+	key := r.group(event)
+	w := st.groups[key]
+	if w == nil {
+		w = &window{}
+		st.groups[key] = w
+	}
+	w.add(st.width, event.Timestamp, event.Value)
+	return key
+}
@@ -0,0 +1,300 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func setupAggregator(t *testing.T) *aggregator.Aggregator {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+	return agg
+}
+
+func writeArchive(t *testing.T, path string, events []models.Event, extra ...string) {
+	t.Helper()
+	w, err := OpenWriter(path)
+	if err != nil {
+		t.Fatalf("OpenWriter failed: %v", err)
+	}
+	for _, e := range events {
+		w.Write(e)
+	}
+	w.Close()
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	defer f.Close()
+	for _, line := range extra {
+		f.WriteString(line + "\n")
+	}
+}
+
+func waitForJob(t *testing.T, r *Replayer, id string) Progress {
+	t.Helper()
+	j, err := r.Job(id)
+	if err != nil {
+		t.Fatalf("Job failed: %v", err)
+	}
+	select {
+	case <-j.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Replay did not finish")
+	}
+	return j.Progress()
+}
+
+func TestReplay_RangeDuplicatesAndSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "events.ndjson"), []models.Event{
+		{ID: "1", Type: "click", UserID: "u1", Value: 1, Timestamp: base},
+		{ID: "2", Type: "click", UserID: "u1", Value: 2, Timestamp: base.Add(time.Hour)},
+		{ID: "2", Type: "click", UserID: "u1", Value: 2, Timestamp: base.Add(time.Hour)},
+		{ID: "3", Type: "click", UserID: "u1", Value: 4, Timestamp: base.Add(48 * time.Hour)},
+	}, "garbage", `{"type":"click"}`)
+
+	agg := setupAggregator(t)
+	// Рабочее хранилище: событие "2" (есть в архиве) и "live" (нет в архиве)
+	agg.ProcessEvent(models.Event{ID: "2", Type: "click", UserID: "u1", Value: 2, Timestamp: base.Add(time.Hour)})
+	agg.ProcessEvent(models.Event{ID: "live", Type: "click", UserID: "u1", Value: 100, Timestamp: base.Add(72 * time.Hour)})
+	time.Sleep(50 * time.Millisecond)
+
+	r := NewReplayer(agg, dir, "events.ndjson")
+	p, err := r.Start(context.Background(), Request{To: base.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	p = waitForJob(t, r, p.ID)
+
+	if p.State != StateCompleted || p.Loaded != 2 || p.Duplicates != 1 || p.OutOfRange != 1 || p.Malformed != 2 {
+		t.Errorf("Unexpected progress: %+v", p)
+	}
+	if p.Percent != 100 {
+		t.Errorf("Expected 100%% progress, got %v", p.Percent)
+	}
+
+	j, _ := r.Job(p.ID)
+	preview, err := j.Aggregated("")
+	if err != nil || len(preview) != 1 || preview[0].TotalValue != 3 {
+		t.Errorf("Unexpected preview: %+v, %v", preview, err)
+	}
+
+	p, err = r.Swap(p.ID)
+	if err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if !p.Swapped || p.Merged != 1 {
+		t.Errorf("Unexpected progress after swap: %+v", p)
+	}
+	data := agg.GetAggregatedData("u1", "click", time.Time{}, time.Time{})
+	if data == nil || data.Count != 3 || data.TotalValue != 103 {
+		t.Errorf("Unexpected aggregate after swap: %+v", data)
+	}
+
+	if _, err := r.Swap(p.ID); !errors.Is(err, ErrNotSwappable) {
+		t.Errorf("Expected ErrNotSwappable on second swap, got %v", err)
+	}
+}
+
+func TestReplay_SameIDInTwoTenants(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "events.ndjson"), []models.Event{
+		{ID: "1", Tenant: "acme", Type: "click", UserID: "u1", Value: 1, Timestamp: base},
+		{ID: "1", Tenant: "beta", Type: "click", UserID: "u1", Value: 2, Timestamp: base},
+	})
+
+	agg := setupAggregator(t)
+	// "live" у обоих тенантов нет в архиве; "1" тенанта acme - есть
+	agg.ProcessEvent(models.Event{ID: "1", Tenant: "acme", Type: "click", UserID: "u1", Value: 1, Timestamp: base})
+	agg.ProcessEvent(models.Event{ID: "live", Tenant: "acme", Type: "click", UserID: "u1", Value: 10, Timestamp: base.Add(time.Hour)})
+	agg.ProcessEvent(models.Event{ID: "live", Tenant: "beta", Type: "click", UserID: "u1", Value: 20, Timestamp: base.Add(time.Hour)})
+	time.Sleep(50 * time.Millisecond)
+
+	r := NewReplayer(agg, dir, "events.ndjson")
+	p, err := r.Start(context.Background(), Request{Swap: true})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	p = waitForJob(t, r, p.ID)
+	if p.Loaded != 2 || p.Duplicates != 0 {
+		t.Errorf("Expected 2 loaded events without duplicates, got %+v", p)
+	}
+	if !p.Swapped || p.Merged != 2 {
+		t.Errorf("Expected 2 merged live events, got %+v", p)
+	}
+
+	for tenant, want := range map[string]float64{"acme": 11, "beta": 22} {
+		data := agg.Tenant(tenant).GetAggregatedData("u1", "click", time.Time{}, time.Time{})
+		if data == nil || data.Count != 2 || data.TotalValue != want {
+			t.Errorf("Expected 2 events totalling %v for %s, got %+v", want, tenant, data)
+		}
+	}
+}
+
+// ingestingStorage вызывает during, когда replay копирует рабочее хранилище
+type ingestingStorage struct {
+	*storage.InMemoryStorage
+	during func()
+}
+
+func (s *ingestingStorage) Snapshot() []models.Event {
+	events := s.InMemoryStorage.Snapshot()
+	if s.during != nil {
+		s.during()
+		s.during = nil
+	}
+	return events
+}
+
+func TestReplay_SwapIngestsDuringCopy(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "events.ndjson"), []models.Event{
+		{ID: "1", Type: "click", UserID: "u1", Value: 1, Timestamp: base},
+	})
+
+	live := &ingestingStorage{InMemoryStorage: storage.NewInMemoryStorage()}
+	agg := aggregator.New(live, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agg.Start(ctx)
+	agg.ProcessEvent(models.Event{ID: "before", Type: "click", UserID: "u1", Value: 10, Timestamp: base})
+	time.Sleep(50 * time.Millisecond)
+
+	// Приём не останавливается на время копирования: событие сохраняется
+	// в рабочее хранилище и переносится в новое при замене
+	live.during = func() {
+		agg.ProcessEvent(models.Event{ID: "during", Type: "click", UserID: "u1", Value: 100, Timestamp: base})
+		deadline := time.Now().Add(time.Second)
+		for live.Count("") < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if live.Count("") < 2 {
+			t.Error("Expected ingestion to continue while live storage is copied")
+		}
+	}
+
+	r := NewReplayer(agg, dir, "events.ndjson")
+	p, err := r.Start(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	waitForJob(t, r, p.ID)
+	p, err = r.Swap(p.ID)
+	if err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if p.Merged != 2 {
+		t.Errorf("Expected 2 merged live events, got %+v", p)
+	}
+	data := agg.GetAggregatedData("u1", "click", time.Time{}, time.Time{})
+	if data == nil || data.Count != 3 || data.TotalValue != 111 {
+		t.Errorf("Unexpected aggregate after swap: %+v", data)
+	}
+}
+
+func TestReplay_SwapMergesIntoSQLite(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "events.ndjson"), []models.Event{
+		{ID: "1", Type: "click", UserID: "u1", Value: 1, Timestamp: base},
+		{ID: "2", Type: "click", UserID: "u1", Value: 2, Timestamp: base.Add(time.Hour)},
+	})
+
+	dbPath := filepath.Join(t.TempDir(), "events.db")
+	live, newStorage, err := storage.Factory(storage.EngineSQLite, dbPath)
+	if err != nil {
+		t.Fatalf("Factory failed: %v", err)
+	}
+	agg := aggregator.New(live, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agg.Start(ctx)
+	defer agg.Close()
+	agg.ProcessEvent(models.Event{ID: "2", Type: "click", UserID: "u1", Value: 2, Timestamp: base.Add(time.Hour)})
+	agg.ProcessEvent(models.Event{ID: "live", Type: "click", UserID: "u1", Value: 100, Timestamp: base.Add(72 * time.Hour)})
+	time.Sleep(50 * time.Millisecond)
+
+	r := NewReplayer(agg, dir, "events.ndjson")
+	r.SetNewStorage(newStorage)
+	p, err := r.Start(context.Background(), Request{Swap: true})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	p = waitForJob(t, r, p.ID)
+	if !p.Swapped || p.Restored != 1 || p.Merged != 0 {
+		t.Errorf("Unexpected progress after swap: %+v", p)
+	}
+
+	// Рабочая база не заменена, временная база replay удалена
+	if temps, _ := filepath.Glob(dbPath + ".replay-*"); len(temps) != 0 {
+		t.Errorf("Expected replay database to be removed, got %v", temps)
+	}
+	data := agg.GetAggregatedData("u1", "click", time.Time{}, time.Time{})
+	if data == nil || data.Count != 3 || data.TotalValue != 103 {
+		t.Errorf("Unexpected aggregate after swap: %+v", data)
+	}
+	if _, ok := live.GetEvent("", "1"); !ok {
+		t.Error("Expected restored event in live database")
+	}
+}
+
+func TestReplay_DirectoryWithGzipAndAutoSwap(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "old"), 0o755)
+	writeArchive(t, filepath.Join(dir, "old", "a.ndjson"), []models.Event{
+		{ID: "a", Type: "view", UserID: "u1", Value: 1, Timestamp: base},
+	})
+
+	f, _ := os.Create(filepath.Join(dir, "old", "b.ndjson.gz"))
+	gz := gzip.NewWriter(f)
+	json.NewEncoder(gz).Encode(models.Event{ID: "b", Type: "view", UserID: "u1", Value: 2, Timestamp: base})
+	gz.Close()
+	f.Close()
+	os.WriteFile(filepath.Join(dir, "old", "notes.txt"), []byte("ignored"), 0o644)
+
+	agg := setupAggregator(t)
+	r := NewReplayer(agg, dir, "")
+	p, err := r.Start(context.Background(), Request{Path: "old", Swap: true})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	p = waitForJob(t, r, p.ID)
+
+	if p.Files != 2 || p.Loaded != 2 || !p.Swapped {
+		t.Errorf("Unexpected progress: %+v", p)
+	}
+	if data := agg.GetAggregatedData("u1", "view", time.Time{}, time.Time{}); data == nil || data.TotalValue != 3 {
+		t.Errorf("Unexpected aggregate: %+v", data)
+	}
+}
+
+func TestReplay_InvalidRequests(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReplayer(setupAggregator(t), dir, "events.ndjson")
+
+	if _, err := r.Start(context.Background(), Request{Path: "../etc/passwd"}); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Expected ErrInvalidPath, got %v", err)
+	}
+	if _, err := r.Start(context.Background(), Request{}); err == nil {
+		t.Error("Expected error for missing archive")
+	}
+	if _, err := r.Start(context.Background(), Request{From: base, To: base.Add(-time.Hour)}); err == nil {
+		t.Error("Expected error for inverted range")
+	}
+	if _, err := r.Job("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
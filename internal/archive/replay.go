@@ -0,0 +1,509 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var (
+	ErrReplayRunning = errors.New("replay is already running")
+	ErrJobNotFound   = errors.New("replay job not found")
+	ErrInvalidPath   = errors.New("path must be relative to the archive directory")
+	ErrNotSwappable  = errors.New("only a completed, not yet swapped replay can be swapped")
+)
+
+// Состояния задачи
+const (
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+// maxJobs - сколько последних задач хранится для просмотра
+const maxJobs = 20
+
+// Request - параметры replay. Path - файл или каталог внутри каталога архива
+// (пусто - основной журнал); From/To ограничивают время событий (включительно).
+type Request struct {
+	Path string    `json:"path,omitempty"`
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+	// Swap - по завершении заменить рабочее хранилище восстановленным
+	Swap bool `json:"swap,omitempty"`
+}
+
+// Progress - состояние задачи replay
+type Progress struct {
+	ID         string  `json:"id"`
+	Request    Request `json:"request"`
+	State      string  `json:"state"`
+	Files      int     `json:"files"`
+	BytesTotal int64   `json:"bytes_total"`
+	BytesRead  int64   `json:"bytes_read"`
+	Percent    float64 `json:"percent"`
+	Lines      int64   `json:"lines"`
+	Loaded     int64   `json:"loaded"`
+	OutOfRange int64   `json:"out_of_range"`
+	Duplicates int64   `json:"duplicates"`
+	Malformed  int64   `json:"malformed"`
+	// Merged - события рабочего хранилища, которых не было в архиве и которые
+	// перенесены в новое хранилище при замене
+	Merged int64 `json:"merged"`
+	// Restored - события архива, которых не было в рабочем хранилище и
+	// которые дописаны в него при замене (рабочая база SQLite не заменяется)
+	Restored   int64     `json:"restored"`
+	Swapped    bool      `json:"swapped"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Replayer запускает задачи восстановления хранилища из архива. Одновременно
+// выполняется не более одной задачи.
+type Replayer struct {
+	aggregator  *aggregator.Aggregator
+	dir         string
+	defaultFile string
+	newStorage  func() (storage.Storage, error)
+
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	order []string
+}
+
+// NewReplayer: dir - каталог архивов, defaultFile - основной журнал (относительно dir)
+func NewReplayer(agg *aggregator.Aggregator, dir, defaultFile string) *Replayer {
+	return &Replayer{
+		aggregator:  agg,
+		dir:         dir,
+		defaultFile: defaultFile,
+		newStorage:  func() (storage.Storage, error) { return storage.NewShardedStorage(storage.DefaultShards), nil },
+		jobs:        make(map[string]*Job),
+	}
+}
+
+// SetNewStorage задаёт конструктор хранилища, в которое загружается архив
+// (по умолчанию - storage.EngineMemory)
+func (r *Replayer) SetNewStorage(newStorage func() (storage.Storage, error)) {
+	r.newStorage = newStorage
+}
+
+// Job - задача replay
+type Job struct {
+	mu       sync.Mutex
+	progress Progress
+	storage  storage.Storage
+	ids      map[eventKey]struct{}
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// eventKey - ID события в пределах тенанта: клиенты разных тенантов
+// задают ID независимо
+type eventKey struct {
+	tenant string
+	id     string
+}
+
+// Start проверяет запрос и запускает задачу в фоне; задача завершается при отмене ctx
+func (r *Replayer) Start(ctx context.Context, req Request) (Progress, error) {
+	if !req.From.IsZero() && !req.To.IsZero() && req.To.Before(req.From) {
+		return Progress{}, errors.New("to must not be before from")
+	}
+	files, total, err := r.resolve(req.Path)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, j := range r.jobs {
+		if j.Progress().State == StateRunning {
+			return Progress{}, ErrReplayRunning
+		}
+	}
+
+	store, err := r.newStorage()
+	if err != nil {
+		return Progress{}, fmt.Errorf("create replay storage: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	job := &Job{
+		progress: Progress{
+			ID:         uuid.New().String(),
+			Request:    req,
+			State:      StateRunning,
+			Files:      len(files),
+			BytesTotal: total,
+			StartedAt:  time.Now(),
+		},
+		storage: store,
+		ids:     make(map[eventKey]struct{}),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	r.jobs[job.progress.ID] = job
+	r.order = append(r.order, job.progress.ID)
+	if len(r.order) > maxJobs {
+		// Выполняется не больше одной задачи, и это новая
+		evicted := r.jobs[r.order[0]]
+		evicted.mu.Lock()
+		evicted.release()
+		evicted.mu.Unlock()
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	go r.run(ctx, job, files)
+	log.Printf("Replay %s started: %d files, %d bytes", job.progress.ID, len(files), total)
+	return job.Progress(), nil
+}
+
+// Jobs возвращает состояние задач от новых к старым
+func (r *Replayer) Jobs() []Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]Progress, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		result = append(result, r.jobs[r.order[i]].Progress())
+	}
+	return result
+}
+
+func (r *Replayer) Job(id string) (*Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// Swap заменяет рабочее хранилище результатом завершённой задачи. События
+// рабочего хранилища, которых нет в архиве (по тенанту и ID), переносятся в новое;
+// хранилище storage.Merger вместо этого дописывает в себя события архива.
+func (r *Replayer) Swap(id string) (Progress, error) {
+	j, err := r.Job(id)
+	if err != nil {
+		return Progress{}, err
+	}
+	if err := j.swap(r.aggregator); err != nil {
+		return j.Progress(), err
+	}
+	return j.Progress(), nil
+}
+
+// Progress возвращает копию текущего состояния задачи
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p := j.progress
+	if p.BytesTotal > 0 {
+		p.Percent = float64(p.BytesRead) * 100 / float64(p.BytesTotal)
+	}
+	return p
+}
+
+// Aggregated возвращает агрегаты тенанта в восстановленном хранилище (до замены)
+func (j *Job) Aggregated(tenant string) ([]models.AggregatedData, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.progress.State != StateCompleted || j.progress.Swapped {
+		return nil, ErrNotSwappable
+	}
+	return j.storage.GetAllAggregated(tenant), nil
+}
+
+// Cancel останавливает выполняющуюся задачу и дожидается её завершения
+func (j *Job) Cancel() {
+	j.cancel()
+	<-j.done
+}
+
+// resolve возвращает файлы для чтения и их общий размер
+func (r *Replayer) resolve(path string) ([]string, int64, error) {
+	if path == "" {
+		path = r.defaultFile
+	} else if !filepath.IsLocal(path) {
+		return nil, 0, ErrInvalidPath
+	}
+	full := filepath.Join(r.dir, path)
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.IsDir() {
+		return []string{full}, info.Size(), nil
+	}
+
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, 0, err
+	}
+	var files []string
+	var total int64
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !isArchiveFile(name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, filepath.Join(full, name))
+		total += info.Size()
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return nil, 0, fmt.Errorf("no archive files in %s", path)
+	}
+	return files, total, nil
+}
+
+func isArchiveFile(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.HasSuffix(name, ".ndjson") || strings.HasSuffix(name, ".jsonl")
+}
+
+func (r *Replayer) run(ctx context.Context, j *Job, files []string) {
+	defer close(j.done)
+
+	err := func() error {
+		for _, file := range files {
+			if err := j.load(ctx, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+
+	j.mu.Lock()
+	j.progress.FinishedAt = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		j.progress.State = StateCanceled
+	case err != nil:
+		j.progress.State = StateFailed
+		j.progress.Error = err.Error()
+	default:
+		j.progress.State = StateCompleted
+	}
+	state := j.progress.State
+	if state != StateCompleted {
+		j.release()
+	}
+	j.mu.Unlock()
+	log.Printf("Replay %s %s", j.progress.ID, state)
+
+	if state == StateCompleted && j.progress.Request.Swap {
+		if err := j.swap(r.aggregator); err != nil {
+			log.Printf("Replay %s: swap failed: %v", j.progress.ID, err)
+		}
+	}
+}
+
+// countingReader считает прочитанные байты файла (до распаковки)
+type countingReader struct {
+	r   io.Reader
+	job *Job
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.job.mu.Lock()
+	c.job.progress.BytesRead += int64(n)
+	c.job.mu.Unlock()
+	return n, err
+}
+
+func (j *Job) load(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = &countingReader{r: f, job: j}
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	req := j.progress.Request
+	br := bufio.NewReader(src)
+	for n := 0; ; n++ {
+		if n%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line, err := br.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			j.handleLine(line, req)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+}
+
+func (j *Job) handleLine(line []byte, req Request) {
+	var event models.Event
+	err := json.Unmarshal(line, &event)
+	if err == nil {
+		err = ingest.Prepare(&event)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Lines++
+
+	switch {
+	case err != nil:
+		j.progress.Malformed++
+	case (!req.From.IsZero() && event.Timestamp.Before(req.From)) ||
+		(!req.To.IsZero() && event.Timestamp.After(req.To)):
+		j.progress.OutOfRange++
+	default:
+		key := eventKey{event.Tenant, event.ID}
+		if _, dup := j.ids[key]; dup {
+			// источники с доставкой "как минимум один раз" могут записать событие дважды
+			j.progress.Duplicates++
+			return
+		}
+		j.ids[key] = struct{}{}
+		j.storage.AddEvent(event)
+		j.progress.Loaded++
+	}
+}
+
+func (j *Job) swap(agg *aggregator.Aggregator) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.progress.State != StateCompleted || j.progress.Swapped {
+		return ErrNotSwappable
+	}
+
+	// Рабочее хранилище копируется без остановки приёма; под блокировкой
+	// переносятся только события, принятые за время копирования
+	live := agg.Storage()
+	var (
+		addedMu sync.Mutex
+		added   []models.Event
+		carried map[eventKey]struct{}
+	)
+	if _, ok := live.(storage.Merger); !ok {
+		remove := agg.OnEvent(func(e models.Event) {
+			addedMu.Lock()
+			added = append(added, e)
+			addedMu.Unlock()
+		})
+		defer remove()
+		carried = j.carry(live.Snapshot())
+	}
+
+	inPlace := false
+	err := agg.SwapStorage(func(current storage.Storage) (storage.Storage, error) {
+		if m, ok := current.(storage.Merger); ok {
+			// Рабочая база остаётся: в неё дописываются события архива
+			n, err := m.Merge(j.storage)
+			if err != nil {
+				return nil, err
+			}
+			j.progress.Restored = n
+			inPlace = true
+			return current, nil
+		}
+		if current != live {
+			// Хранилище заменили за время копирования
+			j.carry(current.Snapshot())
+			return j.storage, nil
+		}
+		addedMu.Lock()
+		defer addedMu.Unlock()
+		for _, e := range added {
+			key := eventKey{e.Tenant, e.ID}
+			if _, ok := carried[key]; ok {
+				continue
+			}
+			if _, ok := j.ids[key]; !ok {
+				j.storage.AddEvent(e)
+				j.progress.Merged++
+			}
+		}
+		return j.storage, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	j.progress.Swapped = true
+	if inPlace {
+		j.release()
+		log.Printf("Replay %s merged into live storage: %d of %d archived events restored",
+			j.progress.ID, j.progress.Restored, j.progress.Loaded)
+		return nil
+	}
+	j.storage = nil
+	j.ids = nil
+	log.Printf("Replay %s swapped in: %d events from archive, %d merged from live storage",
+		j.progress.ID, j.progress.Loaded, j.progress.Merged)
+	return nil
+}
+
+// carry переносит в хранилище задачи события рабочего хранилища, которых
+// нет в архиве, и возвращает ключи просмотренных событий
+func (j *Job) carry(events []models.Event) map[eventKey]struct{} {
+	seen := make(map[eventKey]struct{}, len(events))
+	for _, e := range events {
+		key := eventKey{e.Tenant, e.ID}
+		seen[key] = struct{}{}
+		if _, ok := j.ids[key]; !ok {
+			j.storage.AddEvent(e)
+			j.progress.Merged++
+		}
+	}
+	return seen
+}
+
+// release освобождает хранилище задачи, которое уже не станет рабочим
+// (временная база SQLite удаляется); вызывается под j.mu
+func (j *Job) release() {
+	if c, ok := j.storage.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Replay %s: close storage: %v", j.progress.ID, err)
+		}
+	}
+	j.storage = nil
+	j.ids = nil
+}
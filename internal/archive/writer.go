@@ -0,0 +1,58 @@
+// Package archive ведёт журнал принятых событий в формате NDJSON и
+// восстанавливает по нему хранилище (replay/backfill).
+package archive
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Writer дописывает каждое обработанное событие строкой NDJSON в файл.
+// Подключается через Aggregator.OnEvent; каждая строка пишется одним вызовом
+// write, поэтому файл можно читать, пока в него идёт запись.
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenWriter открывает (или создаёт) файл журнала для дозаписи
+func OpenWriter(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: f}, nil
+}
+
+// Write записывает событие; ошибки записи логируются и не останавливают приём
+func (w *Writer) Write(event models.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("archive: marshal event %s: %v", event.ID, err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return
+	}
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		log.Printf("archive: write event %s: %v", event.ID, err)
+	}
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
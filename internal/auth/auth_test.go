@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyStore_CreateAuthenticateRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatalf("LoadKeyStore failed: %v", err)
+	}
+
+	key, token, err := store.Create("ingest", "acme", []Scope{ScopeIngest})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, "eak_"+key.ID+"_") || key.Hash != "" {
+		t.Errorf("Unexpected key %+v / token %q", key, token)
+	}
+
+	// Токен не хранится в файле, только его хэш
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), token) || !strings.Contains(string(data), HashToken(token)) {
+		t.Errorf("Key file must contain only the token hash: %s", data)
+	}
+
+	reloaded, err := LoadKeyStore(path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	got, ok := reloaded.Authenticate(token)
+	if !ok || got.Tenant != "acme" || !got.Has(ScopeIngest) || got.Has(ScopeQuery) {
+		t.Errorf("Unexpected authenticated key: %+v, %v", got, ok)
+	}
+	if _, ok := reloaded.Authenticate(token + "x"); ok {
+		t.Error("Expected tampered token to be rejected")
+	}
+	if _, ok := reloaded.Authenticate("garbage"); ok {
+		t.Error("Expected malformed token to be rejected")
+	}
+
+	if err := reloaded.Revoke(key.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, ok := reloaded.Authenticate(token); ok {
+		t.Error("Expected revoked token to be rejected")
+	}
+	if err := reloaded.Revoke(key.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, _, err := reloaded.Create("bad", "", []Scope{"write"}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestAuthenticator_Require(t *testing.T) {
+	store := NewKeyStore()
+	_, queryToken, _ := store.Create("q", "acme", []Scope{ScopeQuery})
+	_, adminToken, _ := store.Create("a", "ops", []Scope{ScopeAdmin})
+
+	var tenant string
+	h := NewAuthenticator(store).Require(ScopeQuery, func(w http.ResponseWriter, r *http.Request) {
+		tenant = TenantFromContext(r.Context())
+	})
+
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		status int
+		tenant string
+	}{
+		{"missing", func(r *http.Request) {}, http.StatusUnauthorized, ""},
+		{"invalid", func(r *http.Request) { r.Header.Set("Authorization", "Bearer eak_00_00") }, http.StatusUnauthorized, ""},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+queryToken) }, http.StatusOK, "acme"},
+		{"header", func(r *http.Request) { r.Header.Set("X-API-Key", queryToken) }, http.StatusOK, "acme"},
+		{"admin implies query", func(r *http.Request) { r.Header.Set("X-API-Key", adminToken) }, http.StatusOK, "ops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant = ""
+			req := httptest.NewRequest(http.MethodGet, "/aggregated", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			h(w, req)
+			if w.Code != tt.status || tenant != tt.tenant {
+				t.Errorf("Expected %d/%q, got %d/%q", tt.status, tt.tenant, w.Code, tenant)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate header")
+			}
+		})
+	}
+
+	// Ключ в URL принимается только для потоков
+	ingest := NewAuthenticator(store).Require(ScopeIngest, func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodPost, "/events?api_key="+queryToken, nil)
+	w := httptest.NewRecorder()
+	ingest(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	stream := NewAuthenticator(store).RequireStream(ScopeIngest, func(w http.ResponseWriter, r *http.Request) {})
+	w = httptest.NewRecorder()
+	stream(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+
+	if got := RedactURL(req.URL); got != "/events?api_key=REDACTED" {
+		t.Errorf("Expected redacted URL, got %s", got)
+	}
+
+	// nil Authenticator - аутентификация отключена
+	var disabled *Authenticator
+	called := false
+	disabled.Require(ScopeAdmin, func(w http.ResponseWriter, r *http.Request) { called = true })(httptest.NewRecorder(), req)
+	if !called {
+		t.Error("Expected disabled authenticator to pass requests through")
+	}
+}
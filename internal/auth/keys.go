@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope - право, которое даёт ключ
+type Scope string
+
+const (
+	// ScopeIngest - отправка событий
+	ScopeIngest Scope = "ingest"
+	// ScopeQuery - чтение агрегатов и потоков
+	ScopeQuery Scope = "query"
+	// ScopeAdmin - административные операции; включает все остальные права
+	ScopeAdmin Scope = "admin"
+)
+
+// tokenPrefix отличает ключи сервиса от прочих секретов (удобно для сканеров утечек)
+const tokenPrefix = "eak_"
+
+var (
+	ErrKeyNotFound  = errors.New("api key not found")
+	ErrInvalidScope = errors.New("scope must be one of ingest, query, admin")
+)
+
+// Key - API-ключ. Сам токен не хранится: только SHA-256 от него.
+type Key struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name,omitempty"`
+	Tenant string  `json:"tenant"`
+	Scopes []Scope `json:"scopes"`
+	// Hash - hex(SHA-256) полного токена; не отдаётся в List
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Has сообщает, разрешает ли ключ действие со scope
+func (k Key) Has(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func validateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if s != ScopeIngest && s != ScopeQuery && s != ScopeAdmin {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, s)
+		}
+	}
+	return nil
+}
+
+// HashToken возвращает хэш токена в том виде, в каком он хранится в Key.Hash
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken генерирует ключ и его токен. Токен имеет вид eak_<id>_<secret> и
+// показывается только один раз.
+func NewToken(name, tenant string, scopes []Scope) (Key, string, error) {
+	if err := validateScopes(scopes); err != nil {
+		return Key{}, "", err
+	}
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, "", err
+	}
+
+	key := Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Tenant:    tenant,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+	token := tokenPrefix + key.ID + "_" + hex.EncodeToString(secret)
+	key.Hash = HashToken(token)
+	return key, token, nil
+}
+
+// KeyStore - набор API-ключей. Если задан файл, изменения сохраняются в него.
+type KeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]Key
+}
+
+// NewKeyStore создаёт пустое хранилище ключей без файла
+func NewKeyStore() *KeyStore {
+	return &KeyStore{keys: make(map[string]Key)}
+}
+
+// LoadKeyStore читает ключи из JSON-файла (массив Key с хэшами). Отсутствующий
+// файл - пустое хранилище; он будет создан при добавлении первого ключа.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	s := NewKeyStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, k := range keys {
+		if k.ID == "" || len(k.Hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s: key %d: id and sha256 hash are required", path, i)
+		}
+		if err := validateScopes(k.Scopes); err != nil {
+			return nil, fmt.Errorf("%s: key %s: %w", path, k.ID, err)
+		}
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+// Create генерирует новый ключ и возвращает его вместе с токеном
+func (s *KeyStore) Create(name, tenant string, scopes []Scope) (Key, string, error) {
+	key, token, err := NewToken(name, tenant, scopes)
+	if err != nil {
+		return Key{}, "", err
+	}
+	if err := s.Add(key); err != nil {
+		return Key{}, "", err
+	}
+	key.Hash = ""
+	return key, token, nil
+}
+
+// Add добавляет готовый ключ (например, из конфигурации)
+func (s *KeyStore) Add(key Key) error {
+	if err := validateScopes(key.Scopes); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.ID)
+		return err
+	}
+	return nil
+}
+
+// Revoke удаляет ключ; запросы с ним сразу перестают проходить
+func (s *KeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	if err := s.save(); err != nil {
+		s.keys[id] = key
+		return err
+	}
+	return nil
+}
+
+// List возвращает ключи без хэшей, упорядоченные по времени создания
+func (s *KeyStore) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		k.Hash = ""
+		result = append(result, k)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Authenticate находит ключ по токену
+func (s *KeyStore) Authenticate(token string) (Key, bool) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return Key{}, false
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return Key{}, false
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[id]
+	s.mu.RUnlock()
+	if !ok {
+		return Key{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(key.Hash)) != 1 {
+		return Key{}, false
+	}
+	return key, true
+}
+
+// save атомарно перезаписывает файл ключей; вызывается под s.mu
+func (s *KeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
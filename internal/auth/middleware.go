@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+)
+
+type contextKey struct{}
+
+// WithKey возвращает контекст с ключом, которым аутентифицирован запрос
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext возвращает ключ запроса; ok = false, если аутентификация отключена
+func FromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
+
+// TenantFromContext возвращает тенант ключа запроса ("" - тенант по умолчанию)
+func TenantFromContext(ctx context.Context) string {
+	key, _ := FromContext(ctx)
+	return key.Tenant
+}
+
+// Allowed сообщает, разрешено ли запросу действие со scope. Без аутентификации
+// разрешено всё.
+func Allowed(ctx context.Context, scope Scope) bool {
+	key, ok := FromContext(ctx)
+	return !ok || key.Has(scope)
+}
+
+// Authenticator проверяет API-ключи запросов. nil *Authenticator пропускает все
+// запросы (аутентификация отключена).
+type Authenticator struct {
+	keys *KeyStore
+}
+
+func NewAuthenticator(keys *KeyStore) *Authenticator {
+	return &Authenticator{keys: keys}
+}
+
+// QueryParam - параметр URL с API-ключом; принимается только RequireStream
+const QueryParam = "api_key"
+
+// Require пропускает к next только запросы с действующим ключом, у которого
+// есть scope. Токен берётся из заголовка Authorization: Bearer или X-API-Key.
+func (a *Authenticator) Require(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return a.require(scope, false, next)
+}
+
+// RequireStream - Require, который принимает ключ и в параметре api_key:
+// браузерные EventSource и WebSocket не умеют задавать заголовки. Ключ в URL
+// попадает в журналы прокси и историю браузера, поэтому только для потоков.
+func (a *Authenticator) RequireStream(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return a.require(scope, true, next)
+}
+
+func (a *Authenticator) require(scope Scope, allowQuery bool, next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := tokenFromRequest(r, allowQuery)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="event-aggregator"`)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "API key required")
+			return
+		}
+		key, ok := a.keys.Authenticate(token)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="event-aggregator", error="invalid_token"`)
+			problem.Error(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "invalid API key")
+			return
+		}
+		if !key.Has(scope) {
+			problem.Error(w, r, http.StatusForbidden, problem.CodeForbidden, "API key lacks scope "+string(scope))
+			return
+		}
+		next(w, r.WithContext(WithKey(r.Context(), key)))
+	}
+}
+
+func tokenFromRequest(r *http.Request, allowQuery bool) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if token := r.Header.Get("X-API-Key"); token != "" {
+		return token
+	}
+	if allowQuery {
+		return r.URL.Query().Get(QueryParam)
+	}
+	return ""
+}
+
+// RedactURL возвращает путь и параметры запроса для журнала, заменяя
+// значение api_key
+func RedactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	q := u.Query()
+	if q.Has(QueryParam) {
+		q.Set(QueryParam, "REDACTED")
+	}
+	return u.Path + "?" + q.Encode()
+}
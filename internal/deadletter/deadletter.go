@@ -0,0 +1,313 @@
+// Package deadletter хранит события, которые не удалось принять, для диагностики
+// и повторной обработки.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Причины попадания в очередь
+const (
+	// KindRejected - событие не удалось разобрать или оно не прошло валидацию
+	KindRejected = "rejected"
+	// KindFailed - корректное событие не принято агрегатором (например, очередь переполнена)
+	KindFailed = "failed"
+)
+
+// MaxPayloadSize - сколько байт исходных данных хранится в записи; более
+// длинные данные обрезаются, и такую запись нельзя обработать повторно
+const MaxPayloadSize = 8 * 1024
+
+var (
+	ErrNotFound  = errors.New("dead letter not found")
+	ErrTruncated = errors.New("payload was truncated and cannot be replayed")
+)
+
+// Entry - событие, которое не удалось принять
+type Entry struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	// Tenant - тенант отправителя (по API-ключу); при повторной обработке
+	// событие принимается от его имени, поле tenant в Payload не учитывается
+	Tenant string `json:"tenant,omitempty"`
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+	// Payload - исходные данные в том виде, в котором они пришли (не
+	// длиннее MaxPayloadSize)
+	Payload string `json:"payload"`
+	// Truncated - Payload обрезан, Size - исходный размер данных
+	Truncated  bool      `json:"truncated,omitempty"`
+	Size       int       `json:"size"`
+	ReceivedAt time.Time `json:"received_at"`
+	Replays    int       `json:"replays,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Filter - отбор записей; пустые поля не ограничивают выборку
+type Filter struct {
+	Source string
+	Kind   string
+}
+
+func (f Filter) match(e *Entry) bool {
+	return (f.Source == "" || e.Source == f.Source) && (f.Kind == "" || e.Kind == f.Kind)
+}
+
+// Processor принимает событие при повторной обработке (реализуется aggregator.Aggregator)
+type Processor interface {
+	ProcessEvent(event models.Event) error
+}
+
+// Store - очередь недоставленных событий в памяти с ограничением по числу
+// записей и возрасту. Методы безопасны для nil-указателя (очередь отключена).
+type Store struct {
+	maxEntries int
+	maxAge     time.Duration
+
+	mu      sync.Mutex
+	entries []*Entry // от старых к новым
+	// dropped - записи, вытесненные ограничениями хранения
+	dropped uint64
+}
+
+// NewStore создаёт очередь; maxEntries <= 0 и maxAge <= 0 - без ограничения
+func NewStore(maxEntries int, maxAge time.Duration) *Store {
+	return &Store{maxEntries: maxEntries, maxAge: maxAge}
+}
+
+// Add сохраняет событие тенанта tenant; payload копируется, но не больше
+// MaxPayloadSize байт
+func (s *Store) Add(source, tenant, kind string, reason error, payload []byte) {
+	if s == nil {
+		return
+	}
+	entry := &Entry{
+		ID:         uuid.New().String(),
+		Source:     source,
+		Tenant:     tenant,
+		Kind:       kind,
+		Reason:     reason.Error(),
+		Size:       len(payload),
+		ReceivedAt: time.Now(),
+	}
+	if len(payload) > MaxPayloadSize {
+		payload, entry.Truncated = payload[:MaxPayloadSize], true
+	}
+	entry.Payload = string(payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	s.pruneLocked(entry.ReceivedAt)
+}
+
+// AddEvent сохраняет уже разобранное событие (для протоколов, где исходные байты недоступны)
+func (s *Store) AddEvent(source, kind string, reason error, event models.Event) {
+	if s == nil {
+		return
+	}
+	payload, _ := json.Marshal(event)
+	s.Add(source, event.Tenant, kind, reason, payload)
+}
+
+// List возвращает записи от новых к старым; limit <= 0 - все
+func (s *Store) List(f Filter, limit int) []Entry {
+	result := make([]Entry, 0)
+	if s == nil {
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if f.match(s.entries[i]) {
+			result = append(result, *s.entries[i])
+		}
+	}
+	return result
+}
+
+func (s *Store) Get(id string) (Entry, error) {
+	if s == nil {
+		return Entry{}, ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.indexLocked(id); i >= 0 {
+		return *s.entries[i], nil
+	}
+	return Entry{}, ErrNotFound
+}
+
+func (s *Store) Delete(id string) error {
+	if s == nil {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexLocked(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return nil
+}
+
+// Purge удаляет все записи, подходящие под фильтр, и возвращает их число
+func (s *Store) Purge(f Filter) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.entries[:0]
+	for _, e := range s.entries {
+		if !f.match(e) {
+			kept = append(kept, e)
+		}
+	}
+	n := len(s.entries) - len(kept)
+	clear(s.entries[len(kept):])
+	s.entries = kept
+	return n
+}
+
+// Replay повторно обрабатывает запись: разбирает payload как событие
+// тенанта записи и передаёт его p. При успехе запись удаляется, при ошибке - остаётся с LastError.
+func (s *Store) Replay(id string, p Processor) error {
+	if s == nil {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	i := s.indexLocked(id)
+	if i < 0 {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	entry := s.entries[i]
+	payload, tenant, truncated := entry.Payload, entry.Tenant, entry.Truncated
+	s.mu.Unlock()
+
+	err := ErrTruncated
+	if !truncated {
+		err = replay(payload, tenant, p)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		if i := s.indexLocked(id); i >= 0 {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+		}
+		return nil
+	}
+	entry.Replays++
+	entry.LastError = err.Error()
+	return err
+}
+
+// ReplayAll повторно обрабатывает все записи под фильтром (от старых к новым)
+func (s *Store) ReplayAll(f Filter, p Processor) (replayed, failed int) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	var ids []string
+	for _, e := range s.entries {
+		if f.match(e) {
+			ids = append(ids, e.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		switch err := s.Replay(id, p); {
+		case err == nil:
+			replayed++
+		case !errors.Is(err, ErrNotFound):
+			failed++
+		}
+	}
+	return replayed, failed
+}
+
+// Stats - размер очереди по источникам и число вытесненных записей
+type Stats struct {
+	Total    int            `json:"total"`
+	BySource map[string]int `json:"by_source"`
+	Dropped  uint64         `json:"dropped"`
+}
+
+func (s *Store) Stats() Stats {
+	stats := Stats{BySource: make(map[string]int)}
+	if s == nil {
+		return stats
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+
+	stats.Total = len(s.entries)
+	stats.Dropped = s.dropped
+	for _, e := range s.entries {
+		stats.BySource[e.Source]++
+	}
+	return stats
+}
+
+func replay(payload, tenant string, p Processor) error {
+	var event models.Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return fmt.Errorf("payload is not a valid event: %w", err)
+	}
+	event.Tenant = tenant
+	if err := ingest.Prepare(&event); err != nil {
+		return err
+	}
+	return p.ProcessEvent(event)
+}
+
+// pruneLocked применяет ограничения хранения; вызывается под s.mu
+func (s *Store) pruneLocked(now time.Time) {
+	n := 0
+	if s.maxAge > 0 {
+		for n < len(s.entries) && now.Sub(s.entries[n].ReceivedAt) > s.maxAge {
+			n++
+		}
+	}
+	if s.maxEntries > 0 && len(s.entries)-n > s.maxEntries {
+		n = len(s.entries) - s.maxEntries
+	}
+	if n == 0 {
+		return
+	}
+	s.dropped += uint64(n)
+	clear(s.entries[:n])
+	s.entries = s.entries[n:]
+}
+
+func (s *Store) indexLocked(id string) int {
+	for i, e := range s.entries {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,137 @@
+package deadletter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+type recorder struct {
+	events []models.Event
+	err    error
+}
+
+func (r *recorder) ProcessEvent(event models.Event) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestStore_Retention(t *testing.T) {
+	s := NewStore(2, 0)
+	s.Add("http", "", KindRejected, errors.New("bad"), []byte("1"))
+	s.Add("http", "", KindRejected, errors.New("bad"), []byte("2"))
+	s.Add("grpc", "", KindFailed, errors.New("timeout"), []byte("3"))
+
+	entries := s.List(Filter{}, 0)
+	if len(entries) != 2 || entries[0].Payload != "3" || entries[1].Payload != "2" {
+		t.Errorf("Expected two newest entries, got %+v", entries)
+	}
+	if stats := s.Stats(); stats.Dropped != 1 || stats.BySource["grpc"] != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	s = NewStore(0, time.Minute)
+	s.Add("http", "", KindRejected, errors.New("bad"), nil)
+	s.entries[0].ReceivedAt = time.Now().Add(-2 * time.Minute)
+	s.Add("http", "", KindRejected, errors.New("bad"), nil)
+	if n := len(s.List(Filter{}, 0)); n != 1 {
+		t.Errorf("Expected expired entry to be pruned, got %d entries", n)
+	}
+}
+
+func TestStore_FilterAndPurge(t *testing.T) {
+	s := NewStore(0, 0)
+	s.Add("http", "", KindRejected, errors.New("bad"), nil)
+	s.Add("grpc", "", KindRejected, errors.New("bad"), nil)
+	s.Add("grpc", "", KindFailed, errors.New("timeout"), nil)
+
+	if n := len(s.List(Filter{Source: "grpc"}, 0)); n != 2 {
+		t.Errorf("Expected 2 grpc entries, got %d", n)
+	}
+	if n := len(s.List(Filter{Kind: KindFailed}, 0)); n != 1 {
+		t.Errorf("Expected 1 failed entry, got %d", n)
+	}
+	if n := len(s.List(Filter{}, 1)); n != 1 {
+		t.Errorf("Expected limit to apply, got %d", n)
+	}
+
+	if n := s.Purge(Filter{Source: "grpc"}); n != 2 {
+		t.Errorf("Expected 2 purged, got %d", n)
+	}
+	if entries := s.List(Filter{}, 0); len(entries) != 1 || entries[0].Source != "http" {
+		t.Errorf("Unexpected remaining entries: %+v", entries)
+	}
+}
+
+func TestStore_Replay(t *testing.T) {
+	s := NewStore(0, 0)
+	s.AddEvent("grpc", KindFailed, errors.New("timeout"), models.Event{Type: "click", UserID: "u1", Value: 3})
+	s.Add("http", "", KindRejected, errors.New("bad json"), []byte("{oops"))
+
+	entries := s.List(Filter{}, 0)
+	bad, good := entries[0], entries[1]
+
+	p := &recorder{err: errors.New("queue full")}
+	if err := s.Replay(good.ID, p); err == nil {
+		t.Fatal("Expected replay error")
+	}
+	if e, _ := s.Get(good.ID); e.Replays != 1 || e.LastError != "queue full" {
+		t.Errorf("Expected failed replay to be recorded, got %+v", e)
+	}
+
+	p.err = nil
+	replayed, failed := s.ReplayAll(Filter{}, p)
+	if replayed != 1 || failed != 1 {
+		t.Errorf("Expected 1 replayed and 1 failed, got %d/%d", replayed, failed)
+	}
+	if len(p.events) != 1 || p.events[0].UserID != "u1" || p.events[0].ID == "" {
+		t.Errorf("Unexpected replayed events: %+v", p.events)
+	}
+	if _, err := s.Get(good.ID); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected replayed entry to be removed")
+	}
+	if _, err := s.Get(bad.ID); err != nil {
+		t.Error("Expected invalid entry to stay in the queue")
+	}
+}
+
+func TestStore_ReplayForcesTenant(t *testing.T) {
+	s := NewStore(0, 0)
+	s.Add("http", "acme", KindFailed, errors.New("timeout"), []byte(`{"tenant":"globex","type":"click","user_id":"u1"}`))
+	s.Add("http", "", KindFailed, errors.New("timeout"), []byte(`{"tenant":"globex","type":"click","user_id":"u2"}`))
+
+	p := &recorder{}
+	if replayed, failed := s.ReplayAll(Filter{}, p); replayed != 2 || failed != 0 {
+		t.Fatalf("Expected 2 replayed, got %d/%d", replayed, failed)
+	}
+	if p.events[0].Tenant != "acme" || p.events[1].Tenant != "" {
+		t.Errorf("Expected tenants of entries, got %q and %q", p.events[0].Tenant, p.events[1].Tenant)
+	}
+}
+
+func TestStore_TruncatesPayload(t *testing.T) {
+	s := NewStore(0, 0)
+	s.Add("http", "", KindRejected, errors.New("bad json"), bytes.Repeat([]byte("x"), MaxPayloadSize+100))
+
+	e := s.List(Filter{}, 0)[0]
+	if len(e.Payload) != MaxPayloadSize || !e.Truncated || e.Size != MaxPayloadSize+100 {
+		t.Errorf("Expected truncated payload, got len=%d truncated=%v size=%d", len(e.Payload), e.Truncated, e.Size)
+	}
+	if err := s.Replay(e.ID, &recorder{}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestStore_Nil(t *testing.T) {
+	var s *Store
+	s.Add("http", "", KindRejected, errors.New("bad"), nil)
+	if len(s.List(Filter{}, 0)) != 0 || s.Purge(Filter{}) != 0 {
+		t.Error("Expected nil store to be empty")
+	}
+}
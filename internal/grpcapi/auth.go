@@ -0,0 +1,86 @@
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
+)
+
+// methodScopes - права, необходимые для методов сервиса
+var methodScopes = map[string]auth.Scope{
+	eventpb.EventService_SendEvent_FullMethodName:  auth.ScopeIngest,
+	eventpb.EventService_SendEvents_FullMethodName: auth.ScopeIngest,
+	eventpb.EventService_Query_FullMethodName:      auth.ScopeQuery,
+	eventpb.EventService_Subscribe_FullMethodName:  auth.ScopeQuery,
+}
+
+// reflectionPrefix - методы reflection доступны с любым действующим ключом:
+// они описывают только схему сервиса
+const reflectionPrefix = "/grpc.reflection."
+
+// WithAPIKeys возвращает опции сервера, требующие API-ключ в метаданных
+// authorization ("Bearer <token>") или x-api-key
+func WithAPIKeys(keys *auth.KeyStore) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticate(ctx, keys, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(ss.Context(), keys, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+}
+
+func authenticate(ctx context.Context, keys *auth.KeyStore, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if v := md.Get("authorization"); len(v) > 0 {
+		scheme, t, ok := strings.Cut(v[0], " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(t)
+		}
+	} else if v := md.Get("x-api-key"); len(v) > 0 {
+		token = v[0]
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "API key required")
+	}
+
+	key, ok := keys.Authenticate(token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+	if !key.Has(scope) && !strings.HasPrefix(method, reflectionPrefix) {
+		return nil, status.Errorf(codes.PermissionDenied, "API key lacks scope %s", scope)
+	}
+	return auth.WithKey(ctx, key), nil
+}
+
+// authStream подменяет контекст потока контекстом с ключом
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,78 @@
+package grpcapi
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// timeFromProto - время сообщения; отсутствующее время - нулевое
+func timeFromProto(ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, err
+	}
+	return ts.AsTime(), nil
+}
+
+// timeToProto - нулевое время не передаётся
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func eventFromProto(e *eventpb.Event) (models.Event, error) {
+	ts, err := timeFromProto(e.GetTimestamp())
+	if err != nil {
+		return models.Event{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	return models.Event{
+		ID:         e.GetId(),
+		Tenant:     e.GetTenant(),
+		Type:       e.GetType(),
+		UserID:     e.GetUserId(),
+		Value:      e.GetValue(),
+		Unit:       e.GetUnit(),
+		Timestamp:  ts,
+		Attributes: e.GetAttributes(),
+	}, nil
+}
+
+func eventToProto(e models.Event) *eventpb.Event {
+	return &eventpb.Event{
+		Id:         e.ID,
+		Tenant:     e.Tenant,
+		Type:       e.Type,
+		UserId:     e.UserID,
+		Value:      e.Value,
+		Unit:       e.Unit,
+		Timestamp:  timeToProto(e.Timestamp),
+		Attributes: e.Attributes,
+	}
+}
+
+func aggregatedToProto(d *models.AggregatedData) *eventpb.AggregatedData {
+	if d == nil {
+		return nil
+	}
+	return &eventpb.AggregatedData{
+		Tenant:     d.Tenant,
+		UserId:     d.UserID,
+		EventType:  d.EventType,
+		Count:      d.Count,
+		TotalValue: d.TotalValue,
+		AvgValue:   d.AvgValue,
+		MinValue:   d.MinValue,
+		MaxValue:   d.MaxValue,
+		StartTime:  timeToProto(d.StartTime),
+		EndTime:    timeToProto(d.EndTime),
+	}
+}
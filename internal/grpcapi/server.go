@@ -0,0 +1,68 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/ratelimit"
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
+)
+
+// Server - gRPC-сервер приёма событий, работающий на отдельном от HTTP порту
+type Server struct {
+	grpcServer *grpc.Server
+	service    *Service
+}
+
+func NewServer(agg *aggregator.Aggregator, opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		grpcServer: grpc.NewServer(opts...),
+		service:    NewService(agg),
+	}
+	eventpb.RegisterEventServiceServer(s.grpcServer, s.service)
+	// Описание сервиса для grpcurl и других клиентов без .proto
+	reflection.Register(s.grpcServer)
+	return s
+}
+
+// SetDeadLetters включает сохранение отклонённых событий
+func (s *Server) SetDeadLetters(dl *deadletter.Store) {
+	s.service.SetDeadLetters(dl)
+}
+
+// SetRateLimiter включает ограничение частоты приёма событий
+func (s *Server) SetRateLimiter(l *ratelimit.Limiter) {
+	s.service.SetRateLimiter(l)
+}
+
+// Serve обслуживает соединения на ln до вызова Shutdown
+func (s *Server) Serve(ln net.Listener) error {
+	log.Printf("gRPC server starting on %s", ln.Addr())
+	return s.grpcServer.Serve(ln)
+}
+
+// Shutdown закрывает подписки и дожидается завершения текущих вызовов;
+// по истечении ctx соединения закрываются принудительно
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.service.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,182 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/ratelimit"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/internal/stream"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+const subscribeBuffer = 1024
+
+// maxStreamErrors - число ошибок событий, возвращаемых SendEvents; об
+// остальных отклонённых событиях сообщает только счётчик Rejected
+const maxStreamErrors = 100
+
+// Service реализует eventpb.EventServiceServer поверх агрегатора
+type Service struct {
+	eventpb.UnimplementedEventServiceServer
+
+	aggregator  *aggregator.Aggregator
+	hub         *stream.Hub
+	deadLetters *deadletter.Store
+	limiter     *ratelimit.Limiter
+}
+
+func NewService(agg *aggregator.Aggregator) *Service {
+	s := &Service{
+		aggregator: agg,
+		hub:        stream.NewHub(0, subscribeBuffer),
+	}
+	agg.OnEvent(s.hub.Publish)
+	return s
+}
+
+// SetDeadLetters включает сохранение отклонённых событий
+func (s *Service) SetDeadLetters(dl *deadletter.Store) {
+	s.deadLetters = dl
+}
+
+// SetRateLimiter включает ограничение частоты приёма событий
+func (s *Service) SetRateLimiter(l *ratelimit.Limiter) {
+	s.limiter = l
+}
+
+// Close завершает все активные подписки
+func (s *Service) Close() {
+	s.hub.Close()
+}
+
+func (s *Service) SendEvent(ctx context.Context, req *eventpb.SendEventRequest) (*eventpb.SendEventResponse, error) {
+	event, err := s.ingest(ctx, req.GetEvent())
+	if err != nil {
+		return nil, err
+	}
+	return &eventpb.SendEventResponse{Id: event.ID, Status: "accepted"}, nil
+}
+
+// SendEvents принимает поток событий; ошибки отдельных событий не прерывают поток
+func (s *Service) SendEvents(st grpc.ClientStreamingServer[eventpb.SendEventRequest, eventpb.SendEventsResponse]) error {
+	resp := &eventpb.SendEventsResponse{}
+	for index := int64(0); ; index++ {
+		req, err := st.Recv()
+		if err == io.EOF {
+			return st.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.ingest(st.Context(), req.GetEvent()); err != nil {
+			resp.Rejected++
+			if len(resp.Errors) < maxStreamErrors {
+				resp.Errors = append(resp.Errors, &eventpb.EventError{Index: index, Error: status.Convert(err).Message()})
+			}
+			continue
+		}
+		resp.Accepted++
+	}
+}
+
+func (s *Service) Query(ctx context.Context, req *eventpb.QueryRequest) (*eventpb.QueryResponse, error) {
+	from, err := timeFromProto(req.GetFrom())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid from: %v", err)
+	}
+	to, err := timeFromProto(req.GetTo())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid to: %v", err)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, status.Error(codes.InvalidArgument, "to must not be before from")
+	}
+	data := s.aggregator.Tenant(auth.TenantFromContext(ctx)).GetAggregatedData(req.GetUserId(), req.GetType(), from, to)
+	return &eventpb.QueryResponse{Data: aggregatedToProto(data)}, nil
+}
+
+func (s *Service) Subscribe(req *eventpb.SubscribeRequest, st grpc.ServerStreamingServer[eventpb.StreamEvent]) error {
+	sub, _, err := s.hub.Subscribe(stream.Filter{
+		Tenant:     auth.TenantFromContext(st.Context()),
+		UserID:     req.GetUserId(),
+		Type:       req.GetType(),
+		Attributes: req.GetAttributes(),
+	}, 0)
+	if err != nil {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case msg := <-sub.C():
+			if err := st.Send(&eventpb.StreamEvent{Seq: msg.Seq, Event: eventToProto(msg.Event)}); err != nil {
+				return err
+			}
+		case <-sub.Done():
+			if errors.Is(sub.Err(), stream.ErrSlowConsumer) {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-st.Context().Done():
+			return nil
+		}
+	}
+}
+
+// ingest проверяет событие общей валидацией и лимитами частоты и передаёт
+// его агрегатору; тенант события задаётся по API-ключу
+func (s *Service) ingest(ctx context.Context, msg *eventpb.Event) (models.Event, error) {
+	event, err := eventFromProto(msg)
+	if err != nil {
+		return event, status.Error(codes.InvalidArgument, err.Error())
+	}
+	event.Tenant = auth.TenantFromContext(ctx)
+	original := event
+	if err := ingest.Prepare(&event); err != nil {
+		s.deadLetters.AddEvent("grpc", deadletter.KindRejected, err, original)
+		return event, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if s.limiter != nil {
+		key, _ := auth.FromContext(ctx)
+		req := ratelimit.Request{APIKey: key.ID, UserID: event.UserID}
+		if p, ok := peer.FromContext(ctx); ok {
+			if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+				req.IP = host
+			}
+		}
+		if d := s.limiter.Allow(req); !d.Allowed {
+			return event, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s, retry after %v",
+				d.Dimension, d.RetryAfter.Round(time.Millisecond))
+		}
+	}
+	err = s.aggregator.ProcessEvent(event)
+	if schema.IsValidation(err) {
+		s.deadLetters.AddEvent("grpc", deadletter.KindRejected, err, event)
+		return event, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		return event, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		s.deadLetters.AddEvent("grpc", deadletter.KindFailed, err, event)
+		return event, status.Error(codes.Unavailable, err.Error())
+	}
+	return event, nil
+}
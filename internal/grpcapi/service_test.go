@@ -0,0 +1,235 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
+)
+
+func setupClient(t *testing.T, opts ...grpc.ServerOption) (eventpb.EventServiceClient, *Server) {
+	t.Helper()
+
+	conn, srv := setupConn(t, opts...)
+	return eventpb.NewEventServiceClient(conn), srv
+}
+
+func setupConn(t *testing.T, opts ...grpc.ServerOption) (*grpc.ClientConn, *Server) {
+	t.Helper()
+
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+
+	ln := bufconn.Listen(1024 * 1024)
+	srv := NewServer(agg, opts...)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, srv
+}
+
+func TestService_SendEventAndQuery(t *testing.T) {
+	c, _ := setupClient(t)
+	ctx := context.Background()
+
+	resp, err := c.SendEvent(ctx, &eventpb.SendEventRequest{Event: &eventpb.Event{UserId: "user-1", Type: "click", Value: 10}})
+	if err != nil {
+		t.Fatalf("SendEvent failed: %v", err)
+	}
+	if resp.Id == "" || resp.Status != "accepted" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	q, err := c.Query(ctx, &eventpb.QueryRequest{UserId: "user-1", Type: "click"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if q.Data == nil || q.Data.Count != 1 || q.Data.TotalValue != 10 {
+		t.Errorf("Unexpected query result: %+v", q.Data)
+	}
+
+	q, _ = c.Query(ctx, &eventpb.QueryRequest{UserId: "nobody"})
+	if q.Data != nil {
+		t.Errorf("Expected no data, got %+v", q.Data)
+	}
+}
+
+func TestService_APIKeys(t *testing.T) {
+	keys := auth.NewKeyStore()
+	_, acme, _ := keys.Create("acme", "acme", []auth.Scope{auth.ScopeIngest, auth.ScopeQuery})
+	_, reader, _ := keys.Create("reader", "globex", []auth.Scope{auth.ScopeQuery})
+	c, _ := setupClient(t, WithAPIKeys(keys)...)
+	withKey := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	event := &eventpb.SendEventRequest{Event: &eventpb.Event{UserId: "user-1", Type: "click", Value: 10}}
+
+	if _, err := c.SendEvent(context.Background(), event); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+	if _, err := c.SendEvent(withKey(reader), event); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied, got %v", err)
+	}
+	if _, err := c.SendEvent(withKey(acme), event); err != nil {
+		t.Fatalf("SendEvent failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if q, err := c.Query(withKey(acme), &eventpb.QueryRequest{UserId: "user-1"}); err != nil || q.Data == nil || q.Data.GetTenant() != "acme" {
+		t.Errorf("Unexpected acme query result: %+v, %v", q, err)
+	}
+	if q, err := c.Query(withKey(reader), &eventpb.QueryRequest{UserId: "user-1"}); err != nil || q.Data != nil {
+		t.Errorf("Expected no data for another tenant, got %+v, %v", q, err)
+	}
+}
+
+func TestService_SendEvent_Invalid(t *testing.T) {
+	c, _ := setupClient(t)
+
+	_, err := c.SendEvent(context.Background(), &eventpb.SendEventRequest{Event: &eventpb.Event{Value: 1}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestService_SendEvents(t *testing.T) {
+	c, _ := setupClient(t)
+
+	st, err := c.SendEvents(context.Background())
+	if err != nil {
+		t.Fatalf("SendEvents failed: %v", err)
+	}
+	events := []*eventpb.Event{
+		{UserId: "user-1", Type: "click", Value: 1},
+		{Value: 2},
+		{UserId: "user-2", Type: "view", Value: 3},
+	}
+	for _, e := range events {
+		if err := st.Send(&eventpb.SendEventRequest{Event: e}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	resp, err := st.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected, got %+v", resp)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Index != 1 {
+		t.Errorf("Expected error for event 1, got %+v", resp.Errors)
+	}
+}
+
+func TestService_SendEvents_ErrorLimit(t *testing.T) {
+	c, _ := setupClient(t)
+
+	st, err := c.SendEvents(context.Background())
+	if err != nil {
+		t.Fatalf("SendEvents failed: %v", err)
+	}
+	for i := 0; i < maxStreamErrors+50; i++ {
+		if err := st.Send(&eventpb.SendEventRequest{Event: &eventpb.Event{Value: 1}}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	resp, err := st.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv failed: %v", err)
+	}
+	if resp.Rejected != maxStreamErrors+50 {
+		t.Errorf("Expected %d rejected, got %d", maxStreamErrors+50, resp.Rejected)
+	}
+	if len(resp.Errors) != maxStreamErrors {
+		t.Errorf("Expected %d errors, got %d", maxStreamErrors, len(resp.Errors))
+	}
+}
+
+func TestService_Subscribe(t *testing.T) {
+	c, srv := setupClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := c.Subscribe(ctx, &eventpb.SubscribeRequest{Type: "purchase"})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// Ждём регистрации подписки на сервере
+	time.Sleep(100 * time.Millisecond)
+
+	c.SendEvent(ctx, &eventpb.SendEventRequest{Event: &eventpb.Event{UserId: "user-1", Type: "click"}})
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.SendEvent(ctx, &eventpb.SendEventRequest{Event: &eventpb.Event{Id: "p1", UserId: "user-1", Type: "purchase", Timestamp: timestamppb.New(ts)}})
+
+	msg, err := st.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if msg.GetEvent().GetId() != "p1" || !msg.GetEvent().GetTimestamp().AsTime().Equal(ts) {
+		t.Errorf("Expected event p1 at %v, got %+v", ts, msg.Event)
+	}
+
+	// Остановка сервера завершает подписку
+	srv.Shutdown(ctx)
+	if _, err := st.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable after shutdown, got %v", err)
+	}
+}
+
+func TestService_Reflection(t *testing.T) {
+	conn, _ := setupConn(t)
+
+	st, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo failed: %v", err)
+	}
+	if err := st.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	resp, err := st.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+
+	found := false
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		found = found || svc.GetName() == eventpb.EventService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("Expected %s in reflection, got %v", eventpb.EventService_ServiceDesc.ServiceName, resp)
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/problem"
+)
+
+// DeadLettersHandler - просмотр и повторная обработка недоставленных событий
+type DeadLettersHandler struct {
+	store     *deadletter.Store
+	processor deadletter.Processor
+}
+
+func NewDeadLettersHandler(store *deadletter.Store, p deadletter.Processor) *DeadLettersHandler {
+	return &DeadLettersHandler{store: store, processor: p}
+}
+
+func deadLetterFilter(query *params) deadletter.Filter {
+	return deadletter.Filter{
+		Source: query.get("source"),
+		Kind:   query.oneOf("kind", "", deadletter.KindRejected, deadletter.KindFailed),
+	}
+}
+
+// GET /admin/deadletters?source=&kind=&limit= - записи от новых к старым
+func (h *DeadLettersHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	query := newParams(r)
+	limit := query.int("limit", 100, 0, 0)
+	filter := deadLetterFilter(query)
+	if !query.ok(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"stats":   h.store.Stats(),
+		"entries": h.store.List(filter, limit),
+	})
+}
+
+// /admin/deadletters/{id} - GET запись, DELETE удалить
+func (h *DeadLettersHandler) HandleEntry(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := h.store.Get(id)
+		if err != nil {
+			notFound(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+	case http.MethodDelete:
+		if err := h.store.Delete(id); err != nil {
+			notFound(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// POST /admin/deadletters/{id}/replay - повторно обработать запись
+func (h *DeadLettersHandler) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	err := h.store.Replay(r.PathValue("id"), h.processor)
+	switch {
+	case errors.Is(err, deadletter.ErrNotFound):
+		notFound(w, r, err)
+	case err != nil:
+		problem.Error(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidEvent, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "replayed"})
+	}
+}
+
+// POST /admin/deadletters/replay?source=&kind= - повторно обработать все подходящие записи
+func (h *DeadLettersHandler) HandleReplayAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	query := newParams(r)
+	filter := deadLetterFilter(query)
+	if !query.ok(w, r) {
+		return
+	}
+
+	replayed, failed := h.store.ReplayAll(filter, h.processor)
+	writeJSON(w, http.StatusOK, map[string]int{"replayed": replayed, "failed": failed})
+}
+
+// POST /admin/deadletters/purge?source=&kind= - удалить подходящие записи
+func (h *DeadLettersHandler) HandlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	query := newParams(r)
+	filter := deadLetterFilter(query)
+	if !query.ok(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"purged": h.store.Purge(filter)})
+}
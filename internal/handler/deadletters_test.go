@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestDeadLettersHandler(t *testing.T) {
+	h := setupHandler()
+	store := deadletter.NewStore(0, 0)
+	h.SetDeadLetters(store)
+	dlq := NewDeadLettersHandler(store, h.aggregator)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", h.HandlePostEvent)
+	mux.HandleFunc("/admin/deadletters", dlq.HandleList)
+	mux.HandleFunc("/admin/deadletters/{id}", dlq.HandleEntry)
+	mux.HandleFunc("/admin/deadletters/{id}/replay", dlq.HandleReplay)
+	mux.HandleFunc("/admin/deadletters/replay", dlq.HandleReplayAll)
+	mux.HandleFunc("/admin/deadletters/purge", dlq.HandlePurge)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Некорректные события попадают в очередь с исходным телом
+	doJSON(t, http.MethodPost, srv.URL+"/events", `{"type":`)
+	doJSON(t, http.MethodPost, srv.URL+"/events", `{"type":"click"}`)
+
+	var list struct {
+		Stats   deadletter.Stats   `json:"stats"`
+		Entries []deadletter.Entry `json:"entries"`
+	}
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/admin/deadletters?source=http", "").Body).Decode(&list)
+	if list.Stats.Total != 2 || len(list.Entries) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %+v", list)
+	}
+	if list.Entries[0].Payload != `{"type":"click"}` || list.Entries[0].Kind != deadletter.KindRejected {
+		t.Errorf("Unexpected entry: %+v", list.Entries[0])
+	}
+
+	// Невалидное событие не проходит повторно
+	resp := doJSON(t, http.MethodPost, srv.URL+"/admin/deadletters/"+list.Entries[0].ID+"/replay", "")
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", resp.StatusCode)
+	}
+
+	store.AddEvent("grpc", deadletter.KindFailed, errors.New("timeout"), models.Event{Type: "click", UserID: "u1"})
+	var result map[string]int
+	json.NewDecoder(doJSON(t, http.MethodPost, srv.URL+"/admin/deadletters/replay?kind=failed", "").Body).Decode(&result)
+	if result["replayed"] != 1 || result["failed"] != 0 {
+		t.Errorf("Unexpected replay result: %v", result)
+	}
+
+	if resp := doJSON(t, http.MethodDelete, srv.URL+"/admin/deadletters/"+list.Entries[1].ID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/deadletters/"+list.Entries[1].ID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	json.NewDecoder(doJSON(t, http.MethodPost, srv.URL+"/admin/deadletters/purge", "").Body).Decode(&result)
+	if result["purged"] != 1 {
+		t.Errorf("Expected 1 purged, got %v", result)
+	}
+
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/deadletters?limit=x", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+}
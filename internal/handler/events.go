@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+)
+
+// GET /events/{id} - получить сырое событие по ID
+func (h *Handler) HandleGetEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	event, ok := h.aggregator.Tenant(auth.TenantFromContext(r.Context())).GetEvent(id)
+	if !ok {
+		notFound(w, r, fmt.Errorf("event %q not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, event)
+}
+
+// GET /events - поиск сырых событий
+// (?user_id=&type=&from=&to=&attributes.<name>=&min_value=&max_value=&order=&limit=&cursor=)
+func (h *Handler) HandleSearchEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	query := newParams(r)
+	var q storage.EventQuery
+	q.UserID = query.get("user_id")
+	q.EventType = query.get("type")
+	q.From, q.To = query.timeRange("from", "to")
+	q.MinValue, q.MaxValue = query.float("min_value"), query.float("max_value")
+	if q.MinValue != nil && q.MaxValue != nil && *q.MinValue > *q.MaxValue {
+		query.fail("min_value", "range", "must not be greater than max_value")
+	}
+	for name := range query.query {
+		if attr, ok := strings.CutPrefix(name, "attributes."); ok && attr != "" {
+			if q.Attributes == nil {
+				q.Attributes = make(map[string]string)
+			}
+			q.Attributes[attr] = query.get(name)
+		}
+	}
+	q.Asc = query.oneOf("order", "desc", "asc", "desc") == "asc"
+	q.Limit = query.int("limit", defaultPageLimit, 1, maxPageLimit)
+	q.Cursor = query.get("cursor")
+	if !query.ok(w, r) {
+		return
+	}
+
+	page, err := h.aggregator.Tenant(auth.TenantFromContext(r.Context())).SearchEvents(q)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		query.fail("cursor", "invalid", "is malformed")
+		query.ok(w, r)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
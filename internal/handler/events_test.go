@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestHandler_Events(t *testing.T) {
+	h := setupHandler()
+	for _, e := range []models.Event{
+		{ID: "e1", Type: "purchase", UserID: "user-1", Value: 10, Timestamp: time.Now(), Attributes: map[string]string{"country": "DE"}},
+		{ID: "e2", Type: "purchase", UserID: "user-1", Value: 99, Timestamp: time.Now(), Attributes: map[string]string{"country": "FR"}},
+		{ID: "e3", Type: "view", UserID: "user-1", Value: 1, Timestamp: time.Now()},
+	} {
+		h.aggregator.ProcessEvent(e)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodGet, "/events/e2", nil)
+	req.SetPathValue("id", "e2")
+	w := httptest.NewRecorder()
+	h.HandleGetEvent(w, req)
+	var event models.Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if w.Code != http.StatusOK || event.Value != 99 {
+		t.Errorf("Expected e2, got %d %+v", w.Code, event)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/nope", nil)
+	req.SetPathValue("id", "nope")
+	w = httptest.NewRecorder()
+	h.HandleGetEvent(w, req)
+	if p := decodeProblem(t, w); w.Code != http.StatusNotFound || p.Code != problem.CodeNotFound {
+		t.Errorf("Expected not_found, got %d %+v", w.Code, p)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events?user_id=user-1&type=purchase&attributes.country=DE&min_value=5", nil)
+	w = httptest.NewRecorder()
+	h.HandleSearchEvents(w, req)
+	var page storage.EventPage
+	json.NewDecoder(w.Body).Decode(&page)
+	if w.Code != http.StatusOK || len(page.Events) != 1 || page.Events[0].ID != "e1" {
+		t.Errorf("Expected only e1, got %d %+v", w.Code, page)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events?limit=1", nil)
+	w = httptest.NewRecorder()
+	h.HandleSearchEvents(w, req)
+	json.NewDecoder(w.Body).Decode(&page)
+	if len(page.Events) != 1 || page.Events[0].ID != "e3" || page.NextCursor == "" {
+		t.Errorf("Expected newest event e3 with a cursor, got %+v", page)
+	}
+
+	for _, query := range []string{"min_value=x", "min_value=5&max_value=1", "cursor=!", "order=random"} {
+		req := httptest.NewRequest(http.MethodGet, "/events?"+query, nil)
+		w := httptest.NewRecorder()
+		h.HandleSearchEvents(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -2,51 +2,146 @@ package handler
 
 import (
     "encoding/json"
+    "errors"
+    "io"
     "net/http"
-    "time"
 
-    "github.com/google/uuid"
     "github.com/bashkirian/event-aggregator/internal/aggregator"
+    "github.com/bashkirian/event-aggregator/internal/auth"
+    "github.com/bashkirian/event-aggregator/internal/deadletter"
+    "github.com/bashkirian/event-aggregator/internal/ingest"
+    "github.com/bashkirian/event-aggregator/internal/problem"
+    "github.com/bashkirian/event-aggregator/internal/ratelimit"
+    "github.com/bashkirian/event-aggregator/internal/schema"
+    "github.com/bashkirian/event-aggregator/internal/storage"
+    "github.com/bashkirian/event-aggregator/internal/stream"
+    "github.com/bashkirian/event-aggregator/internal/tenant"
     "github.com/bashkirian/event-aggregator/pkg/models"
 )
 
+const (
+    streamHistorySize = 10000
+    streamBufferSize  = 256
+    // maxEventBodySize - предельный размер тела POST /events
+    maxEventBodySize = 64 * 1024
+)
+
 type Handler struct {
-    aggregator *aggregator.Aggregator
+    aggregator  *aggregator.Aggregator
+    hub         *stream.Hub
+    deadLetters *deadletter.Store
+    limiter     *ratelimit.Limiter
 }
 
 func New(agg *aggregator.Aggregator) *Handler {
-    return &Handler{aggregator: agg}
+    h := &Handler{
+        aggregator: agg,
+        hub:        stream.NewHub(streamHistorySize, streamBufferSize),
+    }
+    agg.OnEvent(h.hub.Publish)
+    return h
+}
+
+// SetDeadLetters включает сохранение отклонённых событий (HTTP и WebSocket)
+func (h *Handler) SetDeadLetters(dl *deadletter.Store) {
+    h.deadLetters = dl
+}
+
+// SetRateLimiter включает ограничение частоты приёма событий (HTTP и WebSocket)
+func (h *Handler) SetRateLimiter(l *ratelimit.Limiter) {
+    h.limiter = l
+}
+
+// allow проверяет лимиты частоты для события запроса r
+func (h *Handler) allow(r *http.Request, event models.Event) ratelimit.Decision {
+    return h.limiter.Allow(h.limitRequest(r, event.UserID))
+}
+
+// limitRequest - отправитель запроса r и user_id события для ограничителя
+func (h *Handler) limitRequest(r *http.Request, userID string) ratelimit.Request {
+    if h.limiter == nil {
+        return ratelimit.Request{}
+    }
+    key, _ := auth.FromContext(r.Context())
+    return ratelimit.Request{
+        APIKey: key.ID,
+        IP:     ratelimit.ClientIP(r, h.limiter.TrustProxy()),
+        UserID: userID,
+    }
+}
+
+// Close завершает все открытые потоки (/stream)
+func (h *Handler) Close() {
+    h.hub.Close()
 }
 
 // POST /events - отправить событие
 func (h *Handler) HandlePostEvent(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        methodNotAllowed(w, r)
+        return
+    }
+
+    // Лимиты ключа и IP - до чтения тела, чтобы поток некорректных запросов
+    // тоже ограничивался и не вытеснял записи из очереди недоставленных
+    limitReq := h.limitRequest(r, "")
+    decision := h.limiter.AllowSender(limitReq)
+    ratelimit.SetHeaders(w, decision)
+    if !decision.Allowed {
+        rateLimited(w, r, decision)
         return
     }
 
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventBodySize))
+    if err != nil {
+        invalidBody(w, r, err)
+        return
+    }
+
+    // Тенант определяется ключом, а не телом запроса
+    owner := auth.TenantFromContext(r.Context())
+
     var event models.Event
-    if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    if err := json.Unmarshal(body, &event); err != nil {
+        h.deadLetters.Add("http", owner, deadletter.KindRejected, err, body)
+        invalidBody(w, r, err)
         return
     }
+    event.Tenant = owner
 
-    // Валидация
-    if event.UserID == "" || event.Type == "" {
-        http.Error(w, "user_id and type are required", http.StatusBadRequest)
+    // Валидация; ID и timestamp генерируются, если не указаны
+    if err := ingest.Prepare(&event); err != nil {
+        h.deadLetters.Add("http", owner, deadletter.KindRejected, err, body)
+        problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidEvent, err.Error(), missingFields(event)...)
         return
     }
 
-    // Генерируем ID и timestamp если не указаны
-    if event.ID == "" {
-        event.ID = uuid.New().String()
+    limitReq.UserID = event.UserID
+    user := h.limiter.AllowUser(limitReq)
+    // В заголовках - самое строгое из двух решений
+    if user.Limit > 0 && (decision.Limit == 0 || !user.Allowed || user.Remaining < decision.Remaining) {
+        ratelimit.SetHeaders(w, user)
     }
-    if event.Timestamp.IsZero() {
-        event.Timestamp = time.Now()
+    if !user.Allowed {
+        rateLimited(w, r, user)
+        return
     }
 
-    if err := h.aggregator.ProcessEvent(event); err != nil {
-        http.Error(w, "Failed to process event", http.StatusInternalServerError)
+    err = h.aggregator.ProcessEvent(event)
+    var verr *schema.ValidationError
+    if errors.As(err, &verr) {
+        h.deadLetters.AddEvent("http", deadletter.KindRejected, err, event)
+        schemaViolation(w, r, verr)
+        return
+    }
+    if errors.Is(err, tenant.ErrQuotaExceeded) {
+        // Клиент повторит отправку сам, в dead-letter не сохраняем
+        problem.Error(w, r, http.StatusTooManyRequests, problem.CodeQuotaExceeded, err.Error())
+        return
+    }
+    if err != nil {
+        h.deadLetters.AddEvent("http", deadletter.KindFailed, err, event)
+        internalError(w, r, "failed to process event")
         return
     }
 
@@ -59,25 +154,28 @@ func (h *Handler) HandlePostEvent(w http.ResponseWriter, r *http.Request) {
 }
 
 // GET /aggregated - получить агрегированные данные
+// (?compare=previous|7d - сравнить с периодом, сдвинутым назад)
 func (h *Handler) HandleGetAggregated(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        methodNotAllowed(w, r)
         return
     }
 
-    query := r.URL.Query()
-    userID := query.Get("user_id")
-    eventType := query.Get("type")
-
-    var from, to time.Time
-    if fromStr := query.Get("from"); fromStr != "" {
-        from, _ = time.Parse(time.RFC3339, fromStr)
-    }
-    if toStr := query.Get("to"); toStr != "" {
-        to, _ = time.Parse(time.RFC3339, toStr)
+    query := newParams(r)
+    userID := query.get("user_id")
+    eventType := query.get("type")
+    from, to := query.timeRange("from", "to")
+    offset := query.offset("compare", from, to)
+    if !query.ok(w, r) {
+        return
     }
 
-    data := h.aggregator.GetAggregatedData(userID, eventType, from, to)
+    view := h.aggregator.Tenant(auth.TenantFromContext(r.Context()))
+    if offset > 0 {
+        writeJSON(w, http.StatusOK, view.Compare(userID, eventType, aggregator.Period{From: from, To: to}, offset))
+        return
+    }
+    data := view.GetAggregatedData(userID, eventType, from, to)
     
     w.Header().Set("Content-Type", "application/json")
     if data == nil {
@@ -87,16 +185,142 @@ func (h *Handler) HandleGetAggregated(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(data)
 }
 
-// GET /aggregated/all - получить все агрегации
+// Размер страницы /aggregated/all
+const (
+    defaultPageLimit = 100
+    maxPageLimit     = 1000
+)
+
+// GET /aggregated/all - получить агрегации постранично
+// (?type=&user_prefix=&from=&to=&sort=&order=&limit=&cursor=)
 func (h *Handler) HandleGetAllAggregated(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        methodNotAllowed(w, r)
+        return
+    }
+
+    query := newParams(r)
+    var q aggregator.PageQuery
+    q.Filter.EventType = query.get("type")
+    q.Filter.UserPrefix = query.get("user_prefix")
+    q.Filter.From, q.Filter.To = query.timeRange("from", "to")
+    q.SortBy = query.oneOf("sort", aggregator.SortKey, aggregator.SortFields...)
+    q.Desc = query.oneOf("order", "asc", "asc", "desc") == "desc"
+    q.Limit = query.int("limit", defaultPageLimit, 1, maxPageLimit)
+    q.Cursor = query.get("cursor")
+    if !query.ok(w, r) {
         return
     }
 
-    data := h.aggregator.GetAllAggregatedData()
+    page, err := h.aggregator.Tenant(auth.TenantFromContext(r.Context())).ListAggregated(q)
+    if errors.Is(err, aggregator.ErrInvalidCursor) {
+        query.fail("cursor", "invalid", "is malformed or was issued for another sort order")
+        query.ok(w, r)
+        return
+    }
+    if err != nil {
+        badRequest(w, r, err)
+        return
+    }
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(data)
+    json.NewEncoder(w).Encode(page)
+}
+
+// compareResponse - сравнение периодов /aggregated/compare
+type compareResponse struct {
+    Current  aggregator.Period       `json:"current"`
+    Previous aggregator.Period       `json:"previous"`
+    Total    int                     `json:"total"`
+    Items    []aggregator.Comparison `json:"items"`
+}
+
+// GET /aggregated/compare - сравнить агрегаты всех пар (user_id, type) за
+// период from..to с периодом, сдвинутым на compare назад
+// (?from=&to=&compare=previous|7d&type=&user_prefix=&limit=)
+func (h *Handler) HandleCompareAggregated(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        methodNotAllowed(w, r)
+        return
+    }
+
+    query := newParams(r)
+    var filter storage.GroupFilter
+    filter.EventType = query.get("type")
+    filter.UserPrefix = query.get("user_prefix")
+    from, to := query.timeRange("from", "to")
+    if from.IsZero() {
+        query.fail("from", "required", "is required")
+    }
+    if to.IsZero() {
+        query.fail("to", "required", "is required")
+    }
+    if !query.query.Has("compare") {
+        query.fail("compare", "required", "is required")
+    }
+    offset := query.offset("compare", from, to)
+    limit := query.int("limit", defaultPageLimit, 1, maxPageLimit)
+    if !query.ok(w, r) {
+        return
+    }
+
+    current := aggregator.Period{From: from, To: to}
+    items := h.aggregator.Tenant(auth.TenantFromContext(r.Context())).CompareAll(filter, current, offset)
+    resp := compareResponse{Current: current, Previous: current.Shift(offset), Total: len(items), Items: items}
+    if len(items) > limit {
+        resp.Items = items[:limit]
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+// Размер рейтинга /aggregated/top
+const (
+    defaultTopK = 10
+    maxTopK     = 1000
+)
+
+// topResponse - рейтинг /aggregated/top
+type topResponse struct {
+    By     storage.Dimension     `json:"by"`
+    Metric string                `json:"metric"`
+    Items  []aggregator.TopEntry `json:"items"`
+}
+
+// GET /aggregated/top - рейтинг значений измерения по метрике
+// (?by=user_id|type|attributes.<name>&metric=&k=&order=&type=&user_prefix=&from=&to=)
+func (h *Handler) HandleGetTop(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        methodNotAllowed(w, r)
+        return
+    }
+
+    query := newParams(r)
+    var q aggregator.TopQuery
+    if by := query.get("by"); by != "" {
+        d, err := storage.ParseDimension(by)
+        if err != nil {
+            query.fail("by", "enum", "%v", err)
+        }
+        q.By = d
+    } else {
+        q.By = storage.DimensionUser
+    }
+    q.Metric = query.oneOf("metric", aggregator.SortCount, aggregator.Metrics...)
+    q.K = query.int("k", defaultTopK, 1, maxTopK)
+    q.Bottom = query.oneOf("order", "desc", "asc", "desc") == "asc"
+    q.Filter.EventType = query.get("type")
+    q.Filter.UserPrefix = query.get("user_prefix")
+    q.Filter.From, q.Filter.To = query.timeRange("from", "to")
+    if !query.ok(w, r) {
+        return
+    }
+
+    items, err := h.aggregator.Tenant(auth.TenantFromContext(r.Context())).Top(q)
+    if err != nil {
+        badRequest(w, r, err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(topResponse{By: q.By, Metric: q.Metric, Items: items})
 }
 
 // GET /health - healthcheck
@@ -104,3 +328,52 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
+
+// GET /admin/snapshot - выгрузить все сырые события в формате NDJSON
+// (?tenant= - только события одного тенанта)
+func (h *Handler) HandleSnapshot(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        methodNotAllowed(w, r)
+        return
+    }
+
+    query := newParams(r)
+    tenant, filtered := query.get("tenant"), query.query.Has("tenant")
+    if !query.ok(w, r) {
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/x-ndjson")
+    enc := json.NewEncoder(w)
+    for _, e := range h.aggregator.Snapshot() {
+        if filtered && e.Tenant != tenant {
+            continue
+        }
+        if err := enc.Encode(e); err != nil {
+            return
+        }
+    }
+}
+
+// POST /admin/purge - удалить все события (?tenant= - только события одного тенанта)
+func (h *Handler) HandlePurge(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, r)
+        return
+    }
+
+    query := newParams(r)
+    tenant, filtered := query.get("tenant"), query.query.Has("tenant")
+    if !query.ok(w, r) {
+        return
+    }
+
+    var n int
+    if filtered {
+        n = h.aggregator.Tenant(tenant).Purge()
+    } else {
+        n = h.aggregator.Purge()
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]int{"purged": n})
+}
@@ -6,10 +6,14 @@ import (
     "encoding/json"
     "net/http"
     "net/http/httptest"
+    "strings"
     "testing"
     "time"
 
     "github.com/bashkirian/event-aggregator/internal/aggregator"
+    "github.com/bashkirian/event-aggregator/internal/auth"
+    "github.com/bashkirian/event-aggregator/internal/deadletter"
+    "github.com/bashkirian/event-aggregator/internal/ratelimit"
     "github.com/bashkirian/event-aggregator/internal/storage"
     "github.com/bashkirian/event-aggregator/pkg/models"
 )
@@ -85,6 +89,20 @@ func TestHandler_HandlePostEvent_MissingFields(t *testing.T) {
     }
 }
 
+func TestHandler_HandlePostEvent_TooLarge(t *testing.T) {
+    h := setupHandler()
+
+    body := `{"type":"click","user_id":"u1","attributes":{"blob":"` + strings.Repeat("x", maxEventBodySize) + `"}}`
+    req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+    w := httptest.NewRecorder()
+
+    h.HandlePostEvent(w, req)
+
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("Expected status 413, got %d", w.Code)
+    }
+}
+
 func TestHandler_HandleGetAggregated(t *testing.T) {
     h := setupHandler()
     
@@ -145,11 +163,140 @@ func TestHandler_HandleGetAllAggregated(t *testing.T) {
         t.Errorf("Expected status 200, got %d", w.Code)
     }
     
-    var results []models.AggregatedData
-    json.NewDecoder(w.Body).Decode(&results)
+    var page aggregator.Page
+    json.NewDecoder(w.Body).Decode(&page)
     
-    if len(results) != 3 {
-        t.Errorf("Expected 3 results, got %d", len(results))
+    if len(page.Items) != 3 || page.Total != 3 || page.NextCursor != "" {
+        t.Errorf("Expected 3 results on one page, got %+v", page)
+    }
+}
+
+func TestHandler_HandleGetAllAggregated_Pagination(t *testing.T) {
+    h := setupHandler()
+
+    now := time.Now().UTC().Truncate(time.Second)
+    for i, user := range []string{"user-1", "user-2", "user-3", "admin-1"} {
+        for j := 0; j <= i; j++ {
+            h.aggregator.ProcessEvent(models.Event{Type: "click", UserID: user, Value: 10, Timestamp: now})
+        }
+    }
+    h.aggregator.ProcessEvent(models.Event{Type: "view", UserID: "user-1", Value: 1, Timestamp: now.Add(-time.Hour)})
+    time.Sleep(100 * time.Millisecond)
+
+    get := func(query string) aggregator.Page {
+        req := httptest.NewRequest(http.MethodGet, "/aggregated/all?"+query, nil)
+        w := httptest.NewRecorder()
+        h.HandleGetAllAggregated(w, req)
+        if w.Code != http.StatusOK {
+            t.Fatalf("%s: expected status 200, got %d: %s", query, w.Code, w.Body.String())
+        }
+        var page aggregator.Page
+        json.NewDecoder(w.Body).Decode(&page)
+        return page
+    }
+
+    var users []string
+    query := "user_prefix=user-&type=click&sort=count&order=desc&limit=2"
+    page := get(query)
+    for {
+        if page.Total != 3 {
+            t.Errorf("Expected total 3, got %d", page.Total)
+        }
+        for _, d := range page.Items {
+            users = append(users, d.UserID)
+        }
+        if page.NextCursor == "" {
+            break
+        }
+        page = get(query + "&cursor=" + page.NextCursor)
+    }
+    if len(users) != 3 || users[0] != "user-3" || users[1] != "user-2" || users[2] != "user-1" {
+        t.Errorf("Expected users by count desc, got %v", users)
+    }
+
+    page = get("from=" + now.Add(-time.Minute).Format(time.RFC3339))
+    if page.Total != 4 {
+        t.Errorf("Expected hour-old view to be filtered out, got %+v", page)
+    }
+}
+
+func TestHandler_HandleGetAllAggregated_InvalidParams(t *testing.T) {
+    h := setupHandler()
+
+    for _, query := range []string{"sort=median", "order=up", "limit=0", "limit=5000", "cursor=garbage", "cursor=eyJzIjoiY291bnQiLCJ1IjoiIiwidCI6IiJ9"} {
+        req := httptest.NewRequest(http.MethodGet, "/aggregated/all?"+query, nil)
+        w := httptest.NewRecorder()
+        h.HandleGetAllAggregated(w, req)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", query, w.Code)
+        }
+    }
+}
+
+func TestHandler_HandleGetTop(t *testing.T) {
+    h := setupHandler()
+
+    for i, user := range []string{"user-1", "user-2", "user-3"} {
+        h.aggregator.ProcessEvent(models.Event{Type: "purchase", UserID: user, Value: float64(10 * (i + 1)), Timestamp: time.Now()})
+    }
+    time.Sleep(100 * time.Millisecond)
+
+    req := httptest.NewRequest(http.MethodGet, "/aggregated/top?by=user_id&metric=total&k=2&type=purchase", nil)
+    w := httptest.NewRecorder()
+    h.HandleGetTop(w, req)
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+    }
+    var result topResponse
+    json.NewDecoder(w.Body).Decode(&result)
+    if len(result.Items) != 2 || result.Items[0].Key != "user-3" || result.Items[1].Value != 20 {
+        t.Errorf("Unexpected top: %+v", result)
+    }
+
+    for _, query := range []string{"by=country", "metric=median", "k=0", "order=top"} {
+        req := httptest.NewRequest(http.MethodGet, "/aggregated/top?"+query, nil)
+        w := httptest.NewRecorder()
+        h.HandleGetTop(w, req)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", query, w.Code)
+        }
+    }
+}
+
+func TestHandler_CompareAggregated(t *testing.T) {
+    h := setupHandler()
+
+    from := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+    h.aggregator.ProcessEvent(models.Event{Type: "click", UserID: "user-1", Value: 10, Timestamp: from.Add(-time.Hour)})
+    h.aggregator.ProcessEvent(models.Event{Type: "click", UserID: "user-1", Value: 30, Timestamp: from.Add(time.Hour)})
+    time.Sleep(100 * time.Millisecond)
+
+    period := "from=2024-03-02T00:00:00Z&to=2024-03-02T23:59:59Z"
+    req := httptest.NewRequest(http.MethodGet, "/aggregated?user_id=user-1&compare=previous&"+period, nil)
+    w := httptest.NewRecorder()
+    h.HandleGetAggregated(w, req)
+    var c aggregator.Comparison
+    json.NewDecoder(w.Body).Decode(&c)
+    if w.Code != http.StatusOK || c.Delta.Total.Absolute != 20 || *c.Delta.Total.Percent != 200 {
+        t.Errorf("Unexpected comparison: %d %+v", w.Code, c)
+    }
+
+    req = httptest.NewRequest(http.MethodGet, "/aggregated/compare?compare=1d&"+period, nil)
+    w = httptest.NewRecorder()
+    h.HandleCompareAggregated(w, req)
+    var resp compareResponse
+    json.NewDecoder(w.Body).Decode(&resp)
+    if w.Code != http.StatusOK || resp.Total != 1 || !resp.Previous.From.Equal(from.Add(-24*time.Hour)) {
+        t.Errorf("Unexpected compare response: %d %+v", w.Code, resp)
+    }
+
+    for _, query := range []string{"compare=7d", "compare=soon&" + period, "from=2024-03-02T00:00:00Z&to=2024-03-03T00:00:00Z"} {
+        req := httptest.NewRequest(http.MethodGet, "/aggregated/compare?"+query, nil)
+        w := httptest.NewRecorder()
+        h.HandleCompareAggregated(w, req)
+        if w.Code != http.StatusBadRequest {
+            t.Errorf("%s: expected status 400, got %d", query, w.Code)
+        }
     }
 }
 
@@ -172,3 +319,115 @@ func TestHandler_HandleHealth(t *testing.T) {
         t.Errorf("Expected status 'ok', got '%s'", response["status"])
     }
 }
+
+func TestHandler_HandleSnapshotAndPurge(t *testing.T) {
+    h := setupHandler()
+
+    h.aggregator.ProcessEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 10, Timestamp: time.Now()})
+    h.aggregator.ProcessEvent(models.Event{ID: "2", Type: "view", UserID: "user-1", Value: 20, Timestamp: time.Now()})
+
+    time.Sleep(100 * time.Millisecond)
+
+    req := httptest.NewRequest(http.MethodGet, "/admin/snapshot", nil)
+    w := httptest.NewRecorder()
+
+    h.HandleSnapshot(w, req)
+
+    if w.Code != http.StatusOK {
+        t.Fatalf("Expected status 200, got %d", w.Code)
+    }
+
+    dec := json.NewDecoder(w.Body)
+    count := 0
+    for dec.More() {
+        var e models.Event
+        if err := dec.Decode(&e); err != nil {
+            t.Fatalf("Failed to decode snapshot line: %v", err)
+        }
+        count++
+    }
+    if count != 2 {
+        t.Errorf("Expected 2 events in snapshot, got %d", count)
+    }
+
+    req = httptest.NewRequest(http.MethodPost, "/admin/purge", nil)
+    w = httptest.NewRecorder()
+
+    h.HandlePurge(w, req)
+
+    var response map[string]int
+    json.NewDecoder(w.Body).Decode(&response)
+
+    if response["purged"] != 2 {
+        t.Errorf("Expected 2 purged events, got %d", response["purged"])
+    }
+}
+
+func TestHandler_HandlePostEvent_RateLimited(t *testing.T) {
+    h := setupHandler()
+    h.SetRateLimiter(ratelimit.New(ratelimit.Config{UserID: ratelimit.Limit{Rate: 0.1, Burst: 1}}))
+
+    post := func(userID string) *httptest.ResponseRecorder {
+        body, _ := json.Marshal(models.Event{Type: "click", UserID: userID, Value: 1})
+        w := httptest.NewRecorder()
+        h.HandlePostEvent(w, httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(body)))
+        return w
+    }
+
+    if w := post("user-1"); w.Code != http.StatusCreated || w.Header().Get("RateLimit-Remaining") != "0" {
+        t.Fatalf("Expected status 201 with RateLimit headers, got %d %v", w.Code, w.Header())
+    }
+    w := post("user-1")
+    if w.Code != http.StatusTooManyRequests {
+        t.Fatalf("Expected status 429, got %d", w.Code)
+    }
+    if w.Header().Get("Retry-After") != "10" || w.Header().Get("RateLimit-Limit") != "1" {
+        t.Errorf("Unexpected headers: %v", w.Header())
+    }
+    if w := post("user-2"); w.Code != http.StatusCreated {
+        t.Errorf("Expected other user to be accepted, got %d", w.Code)
+    }
+}
+
+func TestHandler_HandlePostEvent_RateLimitedBeforeParsing(t *testing.T) {
+    h := setupHandler()
+    dl := deadletter.NewStore(0, 0)
+    h.SetDeadLetters(dl)
+    h.SetRateLimiter(ratelimit.New(ratelimit.Config{IP: ratelimit.Limit{Rate: 0.1, Burst: 1}}))
+
+    post := func(body string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        h.HandlePostEvent(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body)))
+        return w
+    }
+
+    if w := post("not json"); w.Code != http.StatusBadRequest {
+        t.Fatalf("Expected status 400, got %d", w.Code)
+    }
+    // Некорректные запросы тоже расходуют лимит IP и не попадают в очередь недоставленных
+    if w := post("not json"); w.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected status 429, got %d", w.Code)
+    }
+    if n := len(dl.List(deadletter.Filter{}, 0)); n != 1 {
+        t.Errorf("Expected 1 dead letter, got %d", n)
+    }
+}
+
+func TestHandler_HandlePostEvent_DeadLetterTenant(t *testing.T) {
+    h := setupHandler()
+    dl := deadletter.NewStore(0, 0)
+    h.SetDeadLetters(dl)
+
+    req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"tenant":"globex","type":"click"}`))
+    req = req.WithContext(auth.WithKey(req.Context(), auth.Key{ID: "k1", Tenant: "acme"}))
+    w := httptest.NewRecorder()
+    h.HandlePostEvent(w, req)
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("Expected status 400, got %d", w.Code)
+    }
+
+    entries := dl.List(deadletter.Filter{}, 0)
+    if len(entries) != 1 || entries[0].Tenant != "acme" {
+        t.Errorf("Expected dead letter of tenant acme, got %+v", entries)
+    }
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+)
+
+// KeysHandler - управление API-ключами
+type KeysHandler struct {
+	keys *auth.KeyStore
+}
+
+func NewKeysHandler(keys *auth.KeyStore) *KeysHandler {
+	return &KeysHandler{keys: keys}
+}
+
+// createKeyRequest - тело POST /admin/keys
+type createKeyRequest struct {
+	Name   string       `json:"name"`
+	Tenant string       `json:"tenant"`
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+// createKeyResponse - созданный ключ; token показывается только в этом ответе
+type createKeyResponse struct {
+	auth.Key
+	Token string `json:"token"`
+}
+
+// /admin/keys - GET список ключей (без секретов), POST создать ключ
+func (h *KeysHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.keys.List())
+	case http.MethodPost:
+		var req createKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		key, token, err := h.keys.Create(req.Name, req.Tenant, req.Scopes)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, createKeyResponse{Key: key, Token: token})
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// DELETE /admin/keys/{id} - отозвать ключ
+func (h *KeysHandler) HandleKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, r)
+		return
+	}
+	err := h.keys.Revoke(r.PathValue("id"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		notFound(w, r, err)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+)
+
+func TestKeysHandler_TenantIsolation(t *testing.T) {
+	h := setupHandler()
+	keys := auth.NewKeyStore()
+	authn := auth.NewAuthenticator(keys)
+	_, adminToken, _ := keys.Create("admin", "", []auth.Scope{auth.ScopeAdmin})
+
+	kh := NewKeysHandler(keys)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", authn.Require(auth.ScopeIngest, h.HandlePostEvent))
+	mux.HandleFunc("/aggregated/all", authn.Require(auth.ScopeQuery, h.HandleGetAllAggregated))
+	mux.HandleFunc("/admin/keys", authn.Require(auth.ScopeAdmin, kh.HandleKeys))
+	mux.HandleFunc("/admin/keys/{id}", authn.Require(auth.ScopeAdmin, kh.HandleKey))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	create := func(tenant string) createKeyResponse {
+		t.Helper()
+		resp := do(http.MethodPost, "/admin/keys", adminToken, `{"tenant":"`+tenant+`","scopes":["ingest","query"]}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+		}
+		var created createKeyResponse
+		json.NewDecoder(resp.Body).Decode(&created)
+		return created
+	}
+	acme, globex := create("acme"), create("globex")
+
+	// Тенант в теле события игнорируется - он задаётся ключом
+	for _, k := range []createKeyResponse{acme, globex} {
+		if resp := do(http.MethodPost, "/events", k.Token, `{"tenant":"acme","user_id":"u1","type":"click","value":1}`); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	var page aggregator.Page
+	json.NewDecoder(do(http.MethodGet, "/aggregated/all", globex.Token, "").Body).Decode(&page)
+	if data := page.Items; len(data) != 1 || data[0].Tenant != "globex" || data[0].Count != 1 {
+		t.Errorf("Unexpected globex aggregates: %+v", data)
+	}
+
+	if resp := do(http.MethodGet, "/admin/keys", acme.Token, ""); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", resp.StatusCode)
+	}
+	var list []auth.Key
+	json.NewDecoder(do(http.MethodGet, "/admin/keys", adminToken, "").Body).Decode(&list)
+	if len(list) != 3 || list[1].Hash != "" {
+		t.Errorf("Unexpected key list: %+v", list)
+	}
+
+	if resp := do(http.MethodDelete, "/admin/keys/"+acme.ID, adminToken, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/aggregated/all", acme.Token, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for revoked key, got %d", resp.StatusCode)
+	}
+}
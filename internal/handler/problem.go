@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/ratelimit"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+		fmt.Sprintf("method %s is not allowed", r.Method))
+}
+
+func notFound(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, err.Error())
+}
+
+func conflict(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Error(w, r, http.StatusConflict, problem.CodeConflict, err.Error())
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+}
+
+func rateLimited(w http.ResponseWriter, r *http.Request, d ratelimit.Decision) {
+	problem.Error(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "rate limit exceeded for "+d.Dimension)
+}
+
+func internalError(w http.ResponseWriter, r *http.Request, detail string) {
+	problem.Error(w, r, http.StatusInternalServerError, problem.CodeInternal, detail)
+}
+
+// invalidBody - тело запроса не разбирается как JSON нужной структуры.
+// Для поля неверного типа в ответ попадает путь к нему.
+func invalidBody(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge,
+			fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	var errs []problem.FieldError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		errs = append(errs, problem.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: "must be " + typeErr.Type.String(),
+		})
+	}
+	problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "invalid request body: "+err.Error(), errs...)
+}
+
+// NotFound - ответ на запросы к неизвестным путям
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, http.StatusNotFound, problem.CodeNotFound, "no route for "+r.URL.Path)
+}
+
+// missingFields - ошибки обязательных полей события (см. ingest.Prepare)
+func missingFields(event models.Event) []problem.FieldError {
+	var errs []problem.FieldError
+	if event.UserID == "" {
+		errs = append(errs, problem.FieldError{Field: "user_id", Code: "required", Message: "is required"})
+	}
+	if event.Type == "" {
+		errs = append(errs, problem.FieldError{Field: "type", Code: "required", Message: "is required"})
+	}
+	return errs
+}
+
+// schemaViolation - событие не прошло проверку схемой своего типа
+func schemaViolation(w http.ResponseWriter, r *http.Request, verr *schema.ValidationError) {
+	errs := make([]problem.FieldError, len(verr.Errors))
+	for i, fe := range verr.Errors {
+		errs[i] = problem.FieldError{Field: fe.Field, Code: fe.Code, Message: fe.Message}
+	}
+	p := problem.New(http.StatusBadRequest, problem.CodeSchemaViolation,
+		fmt.Sprintf("event does not match schema %s v%d", verr.EventType, verr.Version), errs...)
+	p.Extensions = map[string]any{"event_type": verr.EventType, "version": verr.Version}
+	problem.Write(w, r, p)
+}
+
+// params разбирает параметры запроса, накапливая ошибки: клиент получает
+// все неверные параметры одним ответом
+type params struct {
+	query url.Values
+	errs  []problem.FieldError
+}
+
+func newParams(r *http.Request) *params {
+	return &params{query: r.URL.Query()}
+}
+
+func (p *params) fail(name, code, format string, args ...any) {
+	p.errs = append(p.errs, problem.FieldError{Field: name, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// get возвращает значение параметра; повторённый параметр - ошибка
+func (p *params) get(name string) string {
+	values := p.query[name]
+	if len(values) > 1 {
+		p.fail(name, "duplicate", "must be given at most once")
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// time - метка времени в RFC 3339; отсутствующий параметр - нулевое время
+func (p *params) time(name string) time.Time {
+	s := p.get(name)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		p.fail(name, "format", "must be an RFC 3339 timestamp, got %q", s)
+	}
+	return t
+}
+
+// timeRange - пара from/to; from не может быть позже to
+func (p *params) timeRange(fromName, toName string) (from, to time.Time) {
+	from, to = p.time(fromName), p.time(toName)
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		p.fail(fromName, "range", "must not be after %s", toName)
+	}
+	return from, to
+}
+
+// int - целое в [min, max]; max <= 0 - без верхней границы
+func (p *params) int(name string, def, min, max int) int {
+	s := p.get(name)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	switch {
+	case err != nil:
+		p.fail(name, "format", "must be an integer, got %q", s)
+		return def
+	case n < min:
+		p.fail(name, "min", "must be >= %d", min)
+		return def
+	case max > 0 && n > max:
+		p.fail(name, "max", "must be <= %d", max)
+		return def
+	}
+	return n
+}
+
+// float - число; отсутствующий параметр - nil
+func (p *params) float(name string) *float64 {
+	s := p.get(name)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.fail(name, "format", "must be a number, got %q", s)
+		return nil
+	}
+	return &f
+}
+
+// duration - длительность вида 10s, не меньше min
+func (p *params) duration(name string, def, min time.Duration) time.Duration {
+	s := p.get(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	switch {
+	case err != nil:
+		p.fail(name, "format", "must be a duration like 10s, got %q", s)
+		return def
+	case d < min:
+		p.fail(name, "min", "must be >= %v", min)
+		return def
+	}
+	return d
+}
+
+// offset - сдвиг периода сравнения: previous (длина периода from..to) или
+// длительность вида 24h, 7d, 2w; отсутствующий параметр - 0
+func (p *params) offset(name string, from, to time.Time) time.Duration {
+	s := p.get(name)
+	if s == "" {
+		return 0
+	}
+	if from.IsZero() || to.IsZero() {
+		p.fail(name, "required", "requires both from and to")
+		return 0
+	}
+	if s == "previous" {
+		// Сдвиг на длину периода; границы включаются, поэтому прошлый период
+		// заканчивается на наносекунду раньше текущего
+		return to.Sub(from) + time.Nanosecond
+	}
+
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	var d time.Duration
+	var err error
+	if unit != 0 {
+		var n int
+		n, err = strconv.Atoi(s[:len(s)-1])
+		d = time.Duration(n) * unit
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		p.fail(name, "format", "must be previous or a positive duration like 24h, 7d, 1w, got %q", s)
+		return 0
+	}
+	return d
+}
+
+// oneOf - одно из допустимых значений; отсутствующий параметр - def
+func (p *params) oneOf(name, def string, values ...string) string {
+	s := p.get(name)
+	if s == "" {
+		return def
+	}
+	if !slices.Contains(values, s) {
+		p.fail(name, "enum", "%q is not one of %s", s, strings.Join(values, ", "))
+		return def
+	}
+	return s
+}
+
+// ok отвечает 400 со всеми ошибками параметров, если они есть
+func (p *params) ok(w http.ResponseWriter, r *http.Request) bool {
+	if len(p.errs) == 0 {
+		return true
+	}
+	problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "invalid query parameters", p.errs...)
+	return false
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Expected Content-Type %s, got %s (body %q)", problem.ContentType, ct, w.Body.String())
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if p.Status != w.Code {
+		t.Errorf("Expected status member %d, got %d", w.Code, p.Status)
+	}
+	return p
+}
+
+func fields(p problem.Problem) []string {
+	result := make([]string, len(p.Errors))
+	for i, fe := range p.Errors {
+		result[i] = fe.Field + ":" + fe.Code
+	}
+	return result
+}
+
+func TestHandler_HandleGetAggregated_InvalidParams(t *testing.T) {
+	h := setupHandler()
+
+	tests := []struct {
+		query  string
+		fields []string
+	}{
+		{"from=yesterday", []string{"from:format"}},
+		{"from=2024-01-01T00:00:00Z&to=2024", []string{"to:format"}},
+		{"from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", []string{"from:range"}},
+		{"user_id=a&user_id=b", []string{"user_id:duplicate"}},
+		{"from=x&to=y", []string{"from:format", "to:format"}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/aggregated?"+tt.query, nil)
+		w := httptest.NewRecorder()
+		h.HandleGetAggregated(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.query, w.Code)
+			continue
+		}
+		p := decodeProblem(t, w)
+		if p.Code != problem.CodeInvalidParameter {
+			t.Errorf("%s: expected code %s, got %s", tt.query, problem.CodeInvalidParameter, p.Code)
+		}
+		if got := fields(p); len(got) != len(tt.fields) || got[0] != tt.fields[0] || got[len(got)-1] != tt.fields[len(tt.fields)-1] {
+			t.Errorf("%s: expected field errors %v, got %v", tt.query, tt.fields, got)
+		}
+	}
+}
+
+func TestHandler_ProblemResponses(t *testing.T) {
+	h := setupHandler()
+
+	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader([]byte(`{"type":"click"}`)))
+	w := httptest.NewRecorder()
+	h.HandlePostEvent(w, req)
+	p := decodeProblem(t, w)
+	if p.Code != problem.CodeInvalidEvent || len(p.Errors) != 1 || p.Errors[0].Field != "user_id" {
+		t.Errorf("Expected missing user_id, got %+v", p)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader([]byte(`{"user_id":"u1","type":"click","value":"high"}`)))
+	w = httptest.NewRecorder()
+	h.HandlePostEvent(w, req)
+	p = decodeProblem(t, w)
+	if p.Code != problem.CodeInvalidBody || len(p.Errors) != 1 || p.Errors[0].Field != "value" {
+		t.Errorf("Expected type error for value, got %+v", p)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/aggregated", nil)
+	w = httptest.NewRecorder()
+	h.HandleGetAggregated(w, req)
+	if p := decodeProblem(t, w); w.Code != http.StatusMethodNotAllowed || p.Code != problem.CodeMethodNotAllowed {
+		t.Errorf("Expected method_not_allowed, got %d %+v", w.Code, p)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nope", nil)
+	w = httptest.NewRecorder()
+	NotFound(w, req)
+	if p := decodeProblem(t, w); w.Code != http.StatusNotFound || p.Instance != "/nope" {
+		t.Errorf("Expected not_found for /nope, got %d %+v", w.Code, p)
+	}
+}
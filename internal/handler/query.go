@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/query"
+)
+
+// queryTimeout ограничивает время выполнения одного запроса POST /query
+const queryTimeout = 30 * time.Second
+
+// queryRequest - тело POST /query
+type queryRequest struct {
+	Query string `json:"query"`
+	// Explain - вернуть план запроса, не выполняя его
+	Explain bool `json:"explain,omitempty"`
+}
+
+// POST /query - выполнить запрос на языке запросов (см. пакет query)
+func (h *Handler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	if req.Query == "" {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "query is required",
+			problem.FieldError{Field: "query", Code: "required", Message: "is required"})
+		return
+	}
+
+	plan, err := query.Compile(req.Query)
+	if err != nil {
+		invalidQuery(w, r, err)
+		return
+	}
+	if req.Explain {
+		writeJSON(w, http.StatusOK, map[string]any{"plan": plan.Explain()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	defer cancel()
+	result, err := plan.Execute(ctx, h.aggregator.Tenant(auth.TenantFromContext(r.Context())))
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "query timed out after "+queryTimeout.String())
+	case err != nil && query.IsUserError(err):
+		invalidQuery(w, r, err)
+	case err != nil:
+		internalError(w, r, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// invalidQuery - ошибка в тексте запроса; position - смещение в байтах
+func invalidQuery(w http.ResponseWriter, r *http.Request, err error) {
+	p := problem.New(http.StatusBadRequest, problem.CodeInvalidQuery, err.Error(),
+		problem.FieldError{Field: "query", Code: "invalid", Message: err.Error()})
+	var syntaxErr *query.SyntaxError
+	var planErr *query.PlanError
+	switch {
+	case errors.As(err, &syntaxErr):
+		p.Extensions = map[string]any{"position": syntaxErr.Pos}
+	case errors.As(err, &planErr):
+		p.Extensions = map[string]any{"position": planErr.Pos}
+	}
+	problem.Write(w, r, p)
+}
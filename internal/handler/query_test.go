@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/query"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestHandler_HandleQuery(t *testing.T) {
+	h := setupHandler()
+	for _, e := range []models.Event{
+		{Type: "purchase", UserID: "user-1", Value: 10, Timestamp: time.Now()},
+		{Type: "purchase", UserID: "user-1", Value: 20, Timestamp: time.Now()},
+		{Type: "purchase", UserID: "user-2", Value: 5, Timestamp: time.Now()},
+	} {
+		h.aggregator.ProcessEvent(e)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader([]byte(body)))
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, req)
+		return w
+	}
+
+	w := post(`{"query":"SELECT user_id, sum(value) AS total GROUP BY user_id ORDER BY total DESC LIMIT 1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result query.Result
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Rows) != 1 || result.Rows[0][0] != "user-1" || result.Rows[0][1] != 30.0 || !result.Truncated {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	w = post(`{"query":"SELECT count(*) WHERE type = 'purchase'","explain":true}`)
+	var explain struct {
+		Plan query.Explain `json:"plan"`
+	}
+	json.NewDecoder(w.Body).Decode(&explain)
+	if explain.Plan.Pushdown.Type != "purchase" {
+		t.Errorf("Expected type pushdown, got %+v", explain.Plan)
+	}
+
+	w = post(`{"query":"SELECT user_id, count(*)"}`)
+	p := decodeProblem(t, w)
+	if w.Code != http.StatusBadRequest || p.Code != problem.CodeInvalidQuery || len(p.Errors) != 1 || p.Errors[0].Field != "query" {
+		t.Errorf("Expected invalid_query, got %d %+v", w.Code, p)
+	}
+
+	if w := post(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty query, got %d", w.Code)
+	}
+}
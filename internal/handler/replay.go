@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bashkirian/event-aggregator/internal/archive"
+)
+
+// ReplayHandler - запуск и контроль восстановления хранилища из архива
+type ReplayHandler struct {
+	replayer *archive.Replayer
+	// ctx ограничивает время жизни задач (отменяется при остановке сервера)
+	ctx context.Context
+}
+
+func NewReplayHandler(ctx context.Context, replayer *archive.Replayer) *ReplayHandler {
+	return &ReplayHandler{replayer: replayer, ctx: ctx}
+}
+
+// /admin/replay - GET список задач, POST запустить задачу
+func (h *ReplayHandler) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.replayer.Jobs())
+	case http.MethodPost:
+		var req archive.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		progress, err := h.replayer.Start(h.ctx, req)
+		if errors.Is(err, archive.ErrReplayRunning) {
+			conflict(w, r, err)
+			return
+		}
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, progress)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// /admin/replay/{id} - GET прогресс, DELETE отменить задачу
+func (h *ReplayHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.replayer.Job(r.PathValue("id"))
+	if err != nil {
+		notFound(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, job.Progress())
+	case http.MethodDelete:
+		job.Cancel()
+		writeJSON(w, http.StatusOK, job.Progress())
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// POST /admin/replay/{id}/swap - заменить рабочее хранилище результатом задачи
+func (h *ReplayHandler) HandleSwap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	progress, err := h.replayer.Swap(r.PathValue("id"))
+	switch {
+	case errors.Is(err, archive.ErrJobNotFound):
+		notFound(w, r, err)
+	case errors.Is(err, archive.ErrNotSwappable):
+		conflict(w, r, err)
+	case err != nil:
+		internalError(w, r, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, progress)
+	}
+}
+
+// GET /admin/replay/{id}/aggregated?tenant= - агрегаты восстановленного хранилища
+// для сравнения с рабочим до замены
+func (h *ReplayHandler) HandleAggregated(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	query := newParams(r)
+	tenant := query.get("tenant")
+	if !query.ok(w, r) {
+		return
+	}
+
+	job, err := h.replayer.Job(r.PathValue("id"))
+	if err != nil {
+		notFound(w, r, err)
+		return
+	}
+	data, err := job.Aggregated(tenant)
+	if err != nil {
+		conflict(w, r, err)
+		return
+	}
+	sortAggregates(data)
+	writeJSON(w, http.StatusOK, data)
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/archive"
+)
+
+func TestReplayHandler(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "events.ndjson"), []byte(
+		`{"id":"1","type":"click","user_id":"u1","value":5,"timestamp":"2024-01-01T00:00:00Z"}`+"\n"), 0o644)
+
+	h := setupHandler()
+	replay := NewReplayHandler(context.Background(), archive.NewReplayer(h.aggregator, dir, "events.ndjson"))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/replay", replay.HandleReplay)
+	mux.HandleFunc("/admin/replay/{id}", replay.HandleJob)
+	mux.HandleFunc("/admin/replay/{id}/swap", replay.HandleSwap)
+	mux.HandleFunc("/admin/replay/{id}/aggregated", replay.HandleAggregated)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/admin/replay", `{"path":"/etc"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/admin/replay", `{"from":"2024-01-01T00:00:00Z"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+	}
+	var progress archive.Progress
+	json.NewDecoder(resp.Body).Decode(&progress)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for progress.State == archive.StateRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/admin/replay/"+progress.ID, "").Body).Decode(&progress)
+	}
+	if progress.State != archive.StateCompleted || progress.Loaded != 1 {
+		t.Fatalf("Unexpected progress: %+v", progress)
+	}
+
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/replay/"+progress.ID+"/aggregated", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/admin/replay/"+progress.ID+"/swap", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/admin/replay/"+progress.ID+"/swap", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409 on second swap, got %d", resp.StatusCode)
+	}
+	if data := h.aggregator.GetAggregatedData("u1", "click", time.Time{}, time.Time{}); data == nil || data.TotalValue != 5 {
+		t.Errorf("Unexpected aggregate after swap: %+v", data)
+	}
+
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/replay/missing", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bashkirian/event-aggregator/internal/alert"
+)
+
+// RulesHandler - CRUD правил оповещений и журнал доставок webhook
+type RulesHandler struct {
+	engine *alert.Engine
+}
+
+func NewRulesHandler(engine *alert.Engine) *RulesHandler {
+	return &RulesHandler{engine: engine}
+}
+
+// /rules - GET список правил, POST создать правило
+func (h *RulesHandler) HandleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.engine.Rules())
+	case http.MethodPost:
+		var rule alert.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		created, err := h.engine.AddRule(rule)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// /rules/{id} - GET, PUT (полная замена), DELETE
+func (h *RulesHandler) HandleRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := h.engine.GetRule(id)
+		if err != nil {
+			notFound(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodPut:
+		var rule alert.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		updated, err := h.engine.UpdateRule(id, rule)
+		if errors.Is(err, alert.ErrRuleNotFound) {
+			notFound(w, r, err)
+			return
+		}
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if err := h.engine.DeleteRule(id); err != nil {
+			notFound(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// GET /deliveries?rule_id= - журнал доставок webhook (новые первыми)
+func (h *RulesHandler) HandleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	query := newParams(r)
+	ruleID := query.get("rule_id")
+	if !query.ok(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.engine.Deliveries(ruleID))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
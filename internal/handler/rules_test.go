@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/alert"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+)
+
+func setupRulesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	engine := alert.NewEngine(agg, alert.NewDispatcher(alert.DispatcherConfig{}), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	engine.Start(ctx)
+
+	h := NewRulesHandler(engine)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules", h.HandleRules)
+	mux.HandleFunc("/rules/{id}", h.HandleRule)
+	mux.HandleFunc("/deliveries", h.HandleDeliveries)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doJSON(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestRulesHandler_CRUD(t *testing.T) {
+	srv := setupRulesServer(t)
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/rules", `{"name":"spend","event_type":"purchase",
+		"metric":"sum","operator":">","threshold":100,"window":"10m","webhook_url":"http://example.com","secret":"k"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	var rule alert.Rule
+	json.NewDecoder(resp.Body).Decode(&rule)
+	if rule.ID == "" || rule.Secret != "" {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+
+	resp = doJSON(t, http.MethodPut, srv.URL+"/rules/"+rule.ID, `{"name":"spend","event_type":"purchase",
+		"metric":"sum","operator":">","threshold":500,"window":"10m","webhook_url":"http://example.com"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/rules/"+rule.ID, "")
+	json.NewDecoder(resp.Body).Decode(&rule)
+	if rule.Threshold != 500 {
+		t.Errorf("Expected updated threshold, got %+v", rule)
+	}
+
+	var rules []alert.Rule
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/rules", "").Body).Decode(&rules)
+	if len(rules) != 1 {
+		t.Errorf("Expected 1 rule, got %d", len(rules))
+	}
+
+	if resp := doJSON(t, http.MethodDelete, srv.URL+"/rules/"+rule.ID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/rules/"+rule.ID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/deliveries", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestRulesHandler_Invalid(t *testing.T) {
+	srv := setupRulesServer(t)
+
+	for _, body := range []string{
+		`not json`,
+		`{"event_type":"x","metric":"sum","operator":">","window":"1m","webhook_url":"ftp://x"}`,
+		`{"event_type":"x","metric":"sum","operator":">","window":"forever","webhook_url":"http://x"}`,
+	} {
+		if resp := doJSON(t, http.MethodPost, srv.URL+"/rules", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	if resp := doJSON(t, http.MethodPut, srv.URL+"/rules/missing",
+		`{"event_type":"x","metric":"sum","operator":">","window":"1m","webhook_url":"http://x"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// SchemasHandler - управление схемами типов событий
+type SchemasHandler struct {
+	registry *schema.Registry
+}
+
+func NewSchemasHandler(registry *schema.Registry) *SchemasHandler {
+	return &SchemasHandler{registry: registry}
+}
+
+// GET /admin/schemas - действующие схемы всех типов
+func (h *SchemasHandler) HandleSchemas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.registry.List())
+}
+
+// /admin/schemas/{type} - GET действующая версия, PUT новая версия, DELETE все версии
+func (h *SchemasHandler) HandleSchema(w http.ResponseWriter, r *http.Request) {
+	eventType := r.PathValue("type")
+
+	switch r.Method {
+	case http.MethodGet:
+		s, err := h.registry.Get(eventType)
+		if err != nil {
+			notFound(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	case http.MethodPut:
+		var s schema.Schema
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		if s.EventType != "" && s.EventType != eventType {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidBody, "event_type does not match the path",
+				problem.FieldError{Field: "event_type", Code: "mismatch", Message: "must equal " + eventType})
+			return
+		}
+		s.EventType = eventType
+		created, err := h.registry.Put(s)
+		if err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	case http.MethodDelete:
+		if err := h.registry.Delete(eventType); err != nil {
+			notFound(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// GET /admin/schemas/{type}/versions - все версии схемы
+func (h *SchemasHandler) HandleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	versions, err := h.registry.Versions(r.PathValue("type"))
+	if err != nil {
+		notFound(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// GET /admin/schemas/{type}/versions/{version} - конкретная версия схемы
+func (h *SchemasHandler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidParameter, "version must be an integer",
+			problem.FieldError{Field: "version", Code: "format", Message: "must be an integer"})
+		return
+	}
+	s, err := h.registry.Version(r.PathValue("type"), version)
+	if err != nil {
+		notFound(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// POST /admin/schemas/{type}/validate - проверить событие по действующей схеме
+// без приёма (тип события берётся из пути)
+func (h *SchemasHandler) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+	s, err := h.registry.Get(r.PathValue("type"))
+	if err != nil {
+		notFound(w, r, err)
+		return
+	}
+
+	var event models.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		invalidBody(w, r, err)
+		return
+	}
+	event.Type = s.EventType
+	if err := ingest.Prepare(&event); err != nil {
+		problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidEvent, err.Error(), missingFields(event)...)
+		return
+	}
+
+	err = s.Validate(event, time.Now())
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"valid": false, "version": verr.Version, "errors": verr.Errors})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"valid": true, "version": s.Version})
+}
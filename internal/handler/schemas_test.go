@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bashkirian/event-aggregator/internal/schema"
+)
+
+func TestSchemasHandler(t *testing.T) {
+	h := setupHandler()
+	registry := schema.NewRegistry()
+	h.aggregator.SetSchemas(registry)
+	sh := NewSchemasHandler(registry)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", h.HandlePostEvent)
+	mux.HandleFunc("/admin/schemas", sh.HandleSchemas)
+	mux.HandleFunc("/admin/schemas/{type}", sh.HandleSchema)
+	mux.HandleFunc("/admin/schemas/{type}/versions", sh.HandleVersions)
+	mux.HandleFunc("/admin/schemas/{type}/versions/{version}", sh.HandleVersion)
+	mux.HandleFunc("/admin/schemas/{type}/validate", sh.HandleValidate)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp := doJSON(t, http.MethodPut, srv.URL+"/admin/schemas/purchase", `{"units":["USD"],"min_value":0}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodPut, srv.URL+"/admin/schemas/purchase", `{"event_type":"click"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for mismatched type, got %d", resp.StatusCode)
+	}
+	doJSON(t, http.MethodPut, srv.URL+"/admin/schemas/purchase", `{"units":["USD","EUR"],"min_value":0}`)
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/events", `{"user_id":"u1","type":"purchase","value":-5,"unit":"GBP"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+	}
+	var body struct {
+		Error   string              `json:"error"`
+		Version int                 `json:"version"`
+		Errors  []schema.FieldError `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Version != 2 || len(body.Errors) != 2 || body.Errors[0].Field != "value" || body.Errors[1].Field != "unit" {
+		t.Errorf("Unexpected validation response: %+v", body)
+	}
+
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/events", `{"user_id":"u1","type":"purchase","value":5,"unit":"EUR"}`); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	var versions []schema.Schema
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/admin/schemas/purchase/versions", "").Body).Decode(&versions)
+	if len(versions) != 2 {
+		t.Errorf("Expected 2 versions, got %d", len(versions))
+	}
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/schemas/purchase/versions/1", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(doJSON(t, http.MethodPost, srv.URL+"/admin/schemas/purchase/validate", `{"user_id":"u1","value":1}`).Body).Decode(&result)
+	if result["valid"] != false {
+		t.Errorf("Expected dry-run validation to fail without unit: %v", result)
+	}
+
+	if resp := doJSON(t, http.MethodDelete, srv.URL+"/admin/schemas/purchase", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodGet, srv.URL+"/admin/schemas/purchase", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/problem"
+	"github.com/bashkirian/event-aggregator/internal/stream"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+const (
+	streamHeartbeat       = 15 * time.Second
+	streamRetry           = 3 * time.Second
+	defaultStreamInterval = 5 * time.Second
+	minStreamInterval     = 100 * time.Millisecond
+)
+
+// GET /stream - поток в формате Server-Sent Events.
+//
+// Параметры: user_id, type, attr.<name>=<value> - фильтры;
+// mode=events (сырые события, по умолчанию) или mode=aggregates
+// (агрегаты раз в interval, например interval=10s).
+// В режиме events поддерживается возобновление по заголовку Last-Event-ID.
+func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internalError(w, r, "streaming unsupported")
+		return
+	}
+
+	query := newParams(r)
+	filter := stream.Filter{
+		Tenant:     auth.TenantFromContext(r.Context()),
+		UserID:     query.get("user_id"),
+		Type:       query.get("type"),
+		Attributes: attributeFilter(query.query),
+	}
+	mode := query.oneOf("mode", "events", "events", "aggregates")
+	interval := query.duration("interval", defaultStreamInterval, minStreamInterval)
+	if mode == "aggregates" && len(filter.Attributes) > 0 {
+		query.fail("mode", "unsupported", "attribute filters are supported only in events mode")
+	}
+	if !query.ok(w, r) {
+		return
+	}
+
+	if mode == "aggregates" {
+		h.streamAggregates(w, r, flusher, filter, interval)
+		return
+	}
+	h.streamEvents(w, r, flusher, filter)
+}
+
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, filter stream.Filter) {
+	var lastID uint64
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid Last-Event-ID",
+				problem.FieldError{Field: "Last-Event-ID", Code: "format", Message: "must be an unsigned integer"})
+			return
+		}
+		lastID = id
+	}
+
+	sub, backlog, err := h.hub.Subscribe(filter, lastID)
+	if err != nil {
+		problem.Error(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "stream is closed")
+		return
+	}
+	defer sub.Close()
+
+	startStream(w)
+	for _, msg := range backlog {
+		if writeSSE(w, msg.Seq, "event", msg.Event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case msg := <-sub.C():
+			if writeSSE(w, msg.Seq, "event", msg.Event) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.Done():
+			if sub.Err() == stream.ErrSlowConsumer {
+				writeSSE(w, 0, "error", map[string]string{"error": sub.Err().Error()})
+				flusher.Flush()
+			}
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) streamAggregates(w http.ResponseWriter, r *http.Request, flusher http.Flusher, filter stream.Filter, interval time.Duration) {
+	startStream(w)
+	flusher.Flush()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Отправляем агрегаты только если они изменились с прошлой отправки
+	var last []byte
+	for {
+		data := h.filteredAggregates(filter)
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(payload, last) {
+			if _, err := fmt.Fprintf(w, "event: aggregates\ndata: %s\n\n", payload); err != nil {
+				return
+			}
+			last = payload
+		} else if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ticker.C:
+		case <-h.hub.Done():
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) filteredAggregates(filter stream.Filter) []models.AggregatedData {
+	if filter.UserID != "" && filter.Type != "" {
+		data := h.aggregator.Tenant(filter.Tenant).GetAggregatedData(filter.UserID, filter.Type, time.Time{}, time.Time{})
+		if data == nil {
+			return []models.AggregatedData{}
+		}
+		return []models.AggregatedData{*data}
+	}
+
+	result := make([]models.AggregatedData, 0)
+	for _, d := range h.aggregator.Tenant(filter.Tenant).GetAllAggregatedData() {
+		if (filter.UserID == "" || d.UserID == filter.UserID) && (filter.Type == "" || d.EventType == filter.Type) {
+			result = append(result, d)
+		}
+	}
+	sortAggregates(result)
+	return result
+}
+
+// sortAggregates упорядочивает агрегаты по user_id и типу события
+func sortAggregates(data []models.AggregatedData) {
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].UserID != data[j].UserID {
+			return data[i].UserID < data[j].UserID
+		}
+		return data[i].EventType < data[j].EventType
+	})
+}
+
+// attributeFilter собирает фильтры по атрибутам из параметров вида attr.country=RU
+func attributeFilter(query map[string][]string) map[string]string {
+	var attrs map[string]string
+	for key, values := range query {
+		name, ok := strings.CutPrefix(key, "attr.")
+		if !ok || name == "" || len(values) == 0 {
+			continue
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[name] = values[0]
+	}
+	return attrs
+}
+
+func startStream(w http.ResponseWriter) {
+	// Поток живёт дольше WriteTimeout сервера - снимаем дедлайн для этого ответа
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+}
+
+func writeSSE(w io.Writer, id uint64, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
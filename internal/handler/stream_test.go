@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// readSSE читает из потока следующее сообщение с данными
+func readSSE(t *testing.T, r *bufio.Reader) (id, event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			data = line[len("data: "):]
+		case line == "" && data != "":
+			return id, event, data
+		}
+	}
+}
+
+func TestHandler_HandleStream_Events(t *testing.T) {
+	h := setupHandler()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?type=click&attr.country=RU")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	h.aggregator.ProcessEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Attributes: map[string]string{"country": "US"}})
+	h.aggregator.ProcessEvent(models.Event{ID: "2", Type: "view", UserID: "user-1", Attributes: map[string]string{"country": "RU"}})
+	h.aggregator.ProcessEvent(models.Event{ID: "3", Type: "click", UserID: "user-1", Attributes: map[string]string{"country": "RU"}})
+
+	id, event, data := readSSE(t, bufio.NewReader(resp.Body))
+	if event != "event" || id != "3" {
+		t.Errorf("Expected event with id 3, got %q id %q", event, id)
+	}
+
+	var e models.Event
+	json.Unmarshal([]byte(data), &e)
+	if e.ID != "3" {
+		t.Errorf("Expected event 3, got %q", e.ID)
+	}
+}
+
+func TestHandler_HandleStream_Resume(t *testing.T) {
+	h := setupHandler()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleStream))
+	defer srv.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		h.aggregator.ProcessEvent(models.Event{ID: id, Type: "click", UserID: "user-1"})
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/stream", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []string{"2", "3"} {
+		if id, _, _ := readSSE(t, r); id != want {
+			t.Errorf("Expected id %s, got %s", want, id)
+		}
+	}
+}
+
+func TestHandler_HandleStream_Aggregates(t *testing.T) {
+	h := setupHandler()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleStream))
+	defer srv.Close()
+
+	h.aggregator.ProcessEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 5, Timestamp: time.Now()})
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := http.Get(srv.URL + "/stream?mode=aggregates&user_id=user-1&interval=100ms")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	_, event, data := readSSE(t, bufio.NewReader(resp.Body))
+	if event != "aggregates" {
+		t.Fatalf("Expected aggregates event, got %q", event)
+	}
+
+	var aggs []models.AggregatedData
+	json.Unmarshal([]byte(data), &aggs)
+	if len(aggs) != 1 || aggs[0].TotalValue != 5 {
+		t.Errorf("Unexpected aggregates: %+v", aggs)
+	}
+}
+
+func TestHandler_HandleStream_InvalidParams(t *testing.T) {
+	h := setupHandler()
+
+	for _, url := range []string{"/stream?mode=bogus", "/stream?mode=aggregates&interval=1ms", "/stream?mode=aggregates&attr.a=b"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+
+		h.HandleStream(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", url, w.Code)
+		}
+	}
+}
+
+func TestHandler_Close_EndsStreams(t *testing.T) {
+	h := setupHandler()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	h.Close()
+
+	done := make(chan struct{})
+	go func() {
+		r := bufio.NewReader(resp.Body)
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected stream to end after Close")
+	}
+}
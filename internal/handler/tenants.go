@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+)
+
+// defaultTenantPath обозначает тенант по умолчанию ("") в пути /admin/tenants/{tenant}
+const defaultTenantPath = "-"
+
+// TenantsHandler - статистика и политики тенантов
+type TenantsHandler struct {
+	aggregator *aggregator.Aggregator
+	tenants    *tenant.Manager
+}
+
+func NewTenantsHandler(agg *aggregator.Aggregator, tenants *tenant.Manager) *TenantsHandler {
+	return &TenantsHandler{aggregator: agg, tenants: tenants}
+}
+
+// GET /stats - статистика тенанта, которому принадлежит API-ключ
+func (h *TenantsHandler) HandleOwnStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.aggregator.Tenant(auth.TenantFromContext(r.Context())).Stats())
+}
+
+// GET /admin/tenants - статистика всех тенантов
+func (h *TenantsHandler) HandleTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.aggregator.TenantStats())
+}
+
+// /admin/tenants/{tenant} - GET статистика, PUT политика тенанта ("-" - тенант по умолчанию)
+func (h *TenantsHandler) HandleTenant(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("tenant")
+	if name == defaultTenantPath {
+		name = ""
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.aggregator.Tenant(name).Stats())
+	case http.MethodPut:
+		var policy tenant.Policy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			invalidBody(w, r, err)
+			return
+		}
+		if err := h.tenants.SetPolicy(name, policy); err != nil {
+			badRequest(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.aggregator.Tenant(name).Stats())
+	default:
+		methodNotAllowed(w, r)
+	}
+}
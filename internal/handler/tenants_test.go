@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+)
+
+func TestTenantsHandler_PolicyAndQuota(t *testing.T) {
+	h := setupHandler()
+	tenants := tenant.NewManager(tenant.Config{})
+	h.aggregator.SetTenants(tenants)
+	th := NewTenantsHandler(h.aggregator, tenants)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", h.HandlePostEvent)
+	mux.HandleFunc("/admin/purge", h.HandlePurge)
+	mux.HandleFunc("/admin/tenants", th.HandleTenants)
+	mux.HandleFunc("/admin/tenants/{tenant}", th.HandleTenant)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if resp := doJSON(t, http.MethodPut, srv.URL+"/admin/tenants/-", `{"max_events":1}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp := doJSON(t, http.MethodPut, srv.URL+"/admin/tenants/-", `{"max_events":-1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+
+	event := `{"user_id":"u1","type":"click","value":1}`
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/events", event); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if resp := doJSON(t, http.MethodPost, srv.URL+"/events", event); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", resp.StatusCode)
+	}
+
+	var stats []aggregator.TenantStats
+	json.NewDecoder(doJSON(t, http.MethodGet, srv.URL+"/admin/tenants", "").Body).Decode(&stats)
+	if len(stats) != 1 || stats[0].Events != 1 || stats[0].Usage.Rejected != 1 || stats[0].Policy.MaxEvents != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/admin/purge?tenant=other", "")
+	var purged map[string]int
+	json.NewDecoder(resp.Body).Decode(&purged)
+	if purged["purged"] != 0 {
+		t.Errorf("Expected other tenant purge to keep default tenant events, got %v", purged)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/admin/tenants/-", "")
+	var st aggregator.TenantStats
+	json.NewDecoder(resp.Body).Decode(&st)
+	if st.Events != 1 || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		t.Errorf("Unexpected tenant stats: %+v", st)
+	}
+}
@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = wsPongWait * 9 / 10
+	wsMaxMessageSize   = 64 * 1024
+	wsSendBuffer       = 256
+	wsMaxSubscriptions = 32
+	// Лимит входящих сообщений на одно соединение
+	wsRateLimit = 100
+	wsRateBurst = 200
+
+	defaultWSInterval = time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsRequest - сообщение от клиента.
+//
+//	{"op":"subscribe","id":"s1","user_id":"u1","type":"click","window":"5m","interval":"1s"}
+//	{"op":"unsubscribe","id":"s1"}
+//	{"op":"event","ref":"r1","event":{"user_id":"u1","type":"click","value":1}}
+type wsRequest struct {
+	Op       string        `json:"op"`
+	Ref      string        `json:"ref,omitempty"`
+	ID       string        `json:"id,omitempty"`
+	UserID   string        `json:"user_id,omitempty"`
+	Type     string        `json:"type,omitempty"`
+	Window   string        `json:"window,omitempty"`
+	Interval string        `json:"interval,omitempty"`
+	Event    *models.Event `json:"event,omitempty"`
+}
+
+// wsResponse - сообщение сервера: subscribed, unsubscribed, aggregate, ack, error
+type wsResponse struct {
+	Op      string                 `json:"op"`
+	Ref     string                 `json:"ref,omitempty"`
+	ID      string                 `json:"id,omitempty"`
+	EventID string                 `json:"event_id,omitempty"`
+	Data    *models.AggregatedData `json:"data,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+	// Errors - ошибки полей события, не прошедшего проверку схемой
+	Errors []schema.FieldError `json:"errors,omitempty"`
+}
+
+// GET /ws - WebSocket API: подписки на агрегаты и отправка событий. Отправка
+// событий требует у ключа права ingest.
+func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту ошибкой
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &wsConn{
+		h:       h,
+		conn:    conn,
+		send:    make(chan wsResponse, wsSendBuffer),
+		limiter: rate.NewLimiter(wsRateLimit, wsRateBurst),
+		subs:    make(map[string]context.CancelFunc),
+		ctx:     ctx,
+		cancel:  cancel,
+		tenant:  auth.TenantFromContext(r.Context()),
+		ingest:  auth.Allowed(r.Context(), auth.ScopeIngest),
+		request: r,
+	}
+
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// wsConn - состояние одного WebSocket-соединения
+type wsConn struct {
+	h       *Handler
+	conn    *websocket.Conn
+	send    chan wsResponse
+	limiter *rate.Limiter
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// tenant и ingest определяются API-ключом при подключении
+	tenant string
+	ingest bool
+	// request - запрос подключения (для лимитов частоты по ключу и IP)
+	request *http.Request
+}
+
+func (c *wsConn) readLoop() {
+	defer c.cancel()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("websocket read error: %v", err)
+			}
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.reply(wsResponse{Op: "error", Error: "invalid message"})
+			continue
+		}
+		if !c.limiter.Allow() {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "rate limit exceeded"})
+			continue
+		}
+		c.handle(req)
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ping.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.cancel()
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.cancel()
+				return
+			}
+		case <-c.h.hub.Done():
+			c.cancel()
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			return
+		case <-c.ctx.Done():
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// reply ставит сообщение в очередь на отправку; медленный клиент отключается
+func (c *wsConn) reply(msg wsResponse) {
+	select {
+	case c.send <- msg:
+	case <-c.ctx.Done():
+	default:
+		log.Printf("websocket send buffer full, closing connection")
+		c.cancel()
+	}
+}
+
+func (c *wsConn) handle(req wsRequest) {
+	switch req.Op {
+	case "subscribe":
+		if err := c.subscribe(req); err != nil {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, ID: req.ID, Error: err.Error()})
+		}
+	case "unsubscribe":
+		c.mu.Lock()
+		cancel, ok := c.subs[req.ID]
+		delete(c.subs, req.ID)
+		c.mu.Unlock()
+		if !ok {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, ID: req.ID, Error: "unknown subscription"})
+			return
+		}
+		cancel()
+		c.reply(wsResponse{Op: "unsubscribed", Ref: req.Ref, ID: req.ID})
+	case "event":
+		if req.Event == nil {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "event is required"})
+			return
+		}
+		if !c.ingest {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "API key lacks scope ingest"})
+			return
+		}
+		event := *req.Event
+		event.Tenant = c.tenant
+		if err := ingest.Prepare(&event); err != nil {
+			c.h.deadLetters.AddEvent("websocket", deadletter.KindRejected, err, *req.Event)
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: err.Error()})
+			return
+		}
+		if !c.h.allow(c.request, event).Allowed {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "rate limit exceeded"})
+			return
+		}
+		err := c.h.aggregator.ProcessEvent(event)
+		var verr *schema.ValidationError
+		if errors.As(err, &verr) {
+			c.h.deadLetters.AddEvent("websocket", deadletter.KindRejected, err, event)
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "event does not match schema", Errors: verr.Errors})
+			return
+		}
+		if errors.Is(err, tenant.ErrQuotaExceeded) {
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: err.Error()})
+			return
+		}
+		if err != nil {
+			c.h.deadLetters.AddEvent("websocket", deadletter.KindFailed, err, event)
+			c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: "failed to process event"})
+			return
+		}
+		c.reply(wsResponse{Op: "ack", Ref: req.Ref, EventID: event.ID})
+	default:
+		c.reply(wsResponse{Op: "error", Ref: req.Ref, Error: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+}
+
+func (c *wsConn) subscribe(req wsRequest) error {
+	if req.ID == "" {
+		return fmt.Errorf("subscription id is required")
+	}
+
+	var window time.Duration
+	if req.Window != "" {
+		d, err := time.ParseDuration(req.Window)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid window %q", req.Window)
+		}
+		window = d
+	}
+	interval := defaultWSInterval
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil || d < minStreamInterval {
+			return fmt.Errorf("invalid interval %q", req.Interval)
+		}
+		interval = d
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subs[req.ID]; ok {
+		return fmt.Errorf("subscription %q already exists", req.ID)
+	}
+	if len(c.subs) >= wsMaxSubscriptions {
+		return fmt.Errorf("too many subscriptions (max %d)", wsMaxSubscriptions)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subs[req.ID] = cancel
+	// Подтверждение уходит раньше первого агрегата подписки
+	c.reply(wsResponse{Op: "subscribed", Ref: req.Ref, ID: req.ID})
+	go c.pushAggregates(ctx, req.ID, req.UserID, req.Type, window, interval)
+	return nil
+}
+
+// pushAggregates периодически отправляет агрегат подписки, если он изменился.
+// window > 0 ограничивает агрегацию последним интервалом времени.
+func (c *wsConn) pushAggregates(ctx context.Context, id, userID, eventType string, window, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		var from time.Time
+		if window > 0 {
+			from = time.Now().Add(-window)
+		}
+		data := c.h.aggregator.Tenant(c.tenant).GetAggregatedData(userID, eventType, from, time.Time{})
+
+		payload, _ := json.Marshal(data)
+		if !bytes.Equal(payload, last) {
+			last = payload
+			c.reply(wsResponse{Op: "aggregate", ID: id, Data: data})
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func dialWS(t *testing.T, h *Handler) (*websocket.Conn, func()) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("Failed to dial websocket: %v", err)
+	}
+	return conn, func() {
+		conn.Close()
+		srv.Close()
+	}
+}
+
+// readWS читает сообщения, пока не встретит сообщение с операцией op
+func readWS(t *testing.T, conn *websocket.Conn, op string) wsResponse {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg wsResponse
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read %q message: %v", op, err)
+		}
+		if msg.Op == op {
+			return msg
+		}
+	}
+}
+
+func TestHandler_WebSocket_SendEvent(t *testing.T) {
+	h := setupHandler()
+	conn, closeFn := dialWS(t, h)
+	defer closeFn()
+
+	conn.WriteJSON(wsRequest{Op: "event", Ref: "r1", Event: &models.Event{UserID: "user-1", Type: "click", Value: 10}})
+
+	ack := readWS(t, conn, "ack")
+	if ack.Ref != "r1" || ack.EventID == "" {
+		t.Errorf("Unexpected ack: %+v", ack)
+	}
+
+	conn.WriteJSON(wsRequest{Op: "event", Ref: "r2", Event: &models.Event{Value: 10}})
+	if msg := readWS(t, conn, "error"); msg.Ref != "r2" {
+		t.Errorf("Expected error for r2, got %+v", msg)
+	}
+}
+
+func TestHandler_WebSocket_Subscribe(t *testing.T) {
+	h := setupHandler()
+	conn, closeFn := dialWS(t, h)
+	defer closeFn()
+
+	conn.WriteJSON(wsRequest{Op: "subscribe", ID: "s1", UserID: "user-1", Type: "click", Window: "1h", Interval: "100ms"})
+	readWS(t, conn, "subscribed")
+
+	conn.WriteJSON(wsRequest{Op: "event", Event: &models.Event{UserID: "user-1", Type: "click", Value: 7}})
+
+	for {
+		msg := readWS(t, conn, "aggregate")
+		if msg.ID != "s1" {
+			t.Fatalf("Expected aggregate for s1, got %+v", msg)
+		}
+		if msg.Data != nil {
+			if msg.Data.TotalValue != 7 {
+				t.Errorf("Expected total 7, got %.2f", msg.Data.TotalValue)
+			}
+			break
+		}
+	}
+
+	conn.WriteJSON(wsRequest{Op: "unsubscribe", ID: "s1"})
+	readWS(t, conn, "unsubscribed")
+
+	conn.WriteJSON(wsRequest{Op: "unsubscribe", ID: "s1"})
+	if msg := readWS(t, conn, "error"); msg.Error != "unknown subscription" {
+		t.Errorf("Unexpected error: %+v", msg)
+	}
+}
+
+func TestHandler_WebSocket_InvalidRequests(t *testing.T) {
+	h := setupHandler()
+	conn, closeFn := dialWS(t, h)
+	defer closeFn()
+
+	conn.WriteMessage(websocket.TextMessage, []byte("{not json"))
+	readWS(t, conn, "error")
+
+	for _, req := range []wsRequest{
+		{Op: "bogus"},
+		{Op: "subscribe"},
+		{Op: "subscribe", ID: "s1", Window: "forever"},
+	} {
+		conn.WriteJSON(req)
+		readWS(t, conn, "error")
+	}
+}
+
+func TestHandler_WebSocket_RateLimit(t *testing.T) {
+	h := setupHandler()
+	conn, closeFn := dialWS(t, h)
+	defer closeFn()
+
+	for i := 0; i < wsRateBurst+10; i++ {
+		conn.WriteJSON(wsRequest{Op: "bogus", Ref: "flood"})
+	}
+
+	if msg := readWS(t, conn, "error"); msg.Error == "" {
+		t.Fatal("Expected error message")
+	}
+	for {
+		msg := readWS(t, conn, "error")
+		if msg.Error == "rate limit exceeded" {
+			return
+		}
+	}
+}
+
+func TestHandler_WebSocket_ClosedOnShutdown(t *testing.T) {
+	h := setupHandler()
+	conn, closeFn := dialWS(t, h)
+	defer closeFn()
+
+	h.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected going away close, got %v", err)
+	}
+}
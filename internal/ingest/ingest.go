@@ -0,0 +1,29 @@
+package ingest
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// ErrMissingFields - в событии не указаны обязательные поля
+var ErrMissingFields = errors.New("user_id and type are required")
+
+// Prepare проверяет входящее событие и заполняет ID и timestamp, если они
+// не указаны. Общая точка валидации для всех способов приёма событий.
+func Prepare(event *models.Event) error {
+	if event.UserID == "" || event.Type == "" {
+		return ErrMissingFields
+	}
+
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	return nil
+}
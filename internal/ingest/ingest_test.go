@@ -0,0 +1,33 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestPrepare(t *testing.T) {
+	e := models.Event{UserID: "user-1", Type: "click"}
+	if err := Prepare(&e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.ID == "" || e.Timestamp.IsZero() {
+		t.Errorf("Expected ID and timestamp to be filled, got %+v", e)
+	}
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e = models.Event{ID: "fixed", UserID: "user-1", Type: "click", Timestamp: ts}
+	Prepare(&e)
+	if e.ID != "fixed" || !e.Timestamp.Equal(ts) {
+		t.Errorf("Expected ID and timestamp to be kept, got %+v", e)
+	}
+}
+
+func TestPrepare_MissingFields(t *testing.T) {
+	for _, e := range []models.Event{{Type: "click"}, {UserID: "user-1"}, {}} {
+		if err := Prepare(&e); err != ErrMissingFields {
+			t.Errorf("Expected ErrMissingFields for %+v, got %v", e, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package problem - ответы об ошибках в формате RFC 7807
+// (application/problem+json) с машиночитаемыми кодами
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType - тип содержимого ответа об ошибке
+const ContentType = "application/problem+json"
+
+// TypePrefix - префикс URI типа проблемы; тип - TypePrefix + код
+const TypePrefix = "urn:event-aggregator:problem:"
+
+// Машиночитаемые коды ошибок
+const (
+	CodeInvalidBody      = "invalid_body"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidEvent     = "invalid_event"
+	CodeInvalidQuery     = "invalid_query"
+	CodeSchemaViolation  = "schema_violation"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// FieldError - ошибка одного поля тела или параметра запроса
+type FieldError struct {
+	// Field - путь к полю: user_id, attributes.country, from
+	Field string `json:"field"`
+	// Code - машиночитаемая причина: required, invalid, type, min, max, enum, ...
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem - тело ответа об ошибке
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code - машиночитаемый код ошибки (последний сегмент Type)
+	Code   string       `json:"code"`
+	Errors []FieldError `json:"errors,omitempty"`
+	// Extensions - дополнительные члены объекта проблемы (RFC 7807, 3.2);
+	// стандартные члены они не переопределяют
+	Extensions map[string]any `json:"-"`
+}
+
+// problemJSON - Problem без собственного MarshalJSON
+type problemJSON Problem
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(problemJSON(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+	members := make(map[string]any, len(p.Extensions))
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	var std map[string]json.RawMessage
+	if err := json.Unmarshal(data, &std); err != nil {
+		return nil, err
+	}
+	for k, v := range std {
+		members[k] = v
+	}
+	return json.Marshal(members)
+}
+
+func New(status int, code, detail string, errs ...FieldError) Problem {
+	return Problem{
+		Type:   TypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: errs,
+	}
+}
+
+func (p Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// Write отправляет p в ответ на запрос r; Instance - путь запроса
+func Write(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error - сокращение для Write(w, r, New(status, code, detail, errs...))
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string, errs ...FieldError) {
+	Write(w, r, New(status, code, detail, errs...))
+}
@@ -0,0 +1,65 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/aggregated?from=x", nil)
+	w := httptest.NewRecorder()
+	Error(w, req, http.StatusBadRequest, CodeInvalidParameter, "invalid query parameters",
+		FieldError{Field: "from", Code: "format", Message: "must be an RFC 3339 timestamp"})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ContentType, ct)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if p.Type != TypePrefix+CodeInvalidParameter || p.Code != CodeInvalidParameter {
+		t.Errorf("Unexpected type/code: %s %s", p.Type, p.Code)
+	}
+	if p.Title != "Bad Request" || p.Status != http.StatusBadRequest || p.Instance != "/aggregated" {
+		t.Errorf("Unexpected problem: %+v", p)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "from" {
+		t.Errorf("Expected field error for from, got %+v", p.Errors)
+	}
+}
+
+func TestProblemOmitsEmptyMembers(t *testing.T) {
+	data, _ := json.Marshal(New(http.StatusNotFound, CodeNotFound, ""))
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	for _, key := range []string{"detail", "errors", "instance"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("Expected %s to be omitted, got %s", key, data)
+		}
+	}
+}
+
+func TestProblemExtensions(t *testing.T) {
+	p := New(http.StatusBadRequest, CodeSchemaViolation, "event does not match schema")
+	p.Extensions = map[string]any{"version": 2, "code": "overridden"}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Failed to marshal problem: %v", err)
+	}
+
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	if m["version"] != float64(2) {
+		t.Errorf("Expected version extension, got %s", data)
+	}
+	if m["code"] != CodeSchemaViolation || m["status"] != float64(http.StatusBadRequest) {
+		t.Errorf("Expected standard members to win over extensions, got %s", data)
+	}
+}
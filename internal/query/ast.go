@@ -0,0 +1,246 @@
+// Package query - язык запросов для произвольной агрегации событий:
+// SELECT с агрегатами, WHERE по полям и атрибутам, GROUP BY с разбиением
+// по времени (bucket), HAVING, ORDER BY и LIMIT. Запрос разбирается (Parse),
+// проверяется и планируется (NewPlan) и выполняется по событиям тенанта
+// (Plan.Execute).
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query - разобранный запрос
+type Query struct {
+	Select  []SelectItem
+	Where   Expr
+	GroupBy []Expr
+	Having  Expr
+	OrderBy []OrderItem
+	// Limit - максимальное число строк результата; 0 - не задан
+	Limit int
+}
+
+type SelectItem struct {
+	Expr  Expr
+	Alias string
+}
+
+// Name - имя столбца результата
+func (s SelectItem) Name() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Expr.String()
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// Expr - выражение запроса; String возвращает каноническую запись, по
+// которой одинаковые выражения в SELECT, GROUP BY и ORDER BY сопоставляются
+type Expr interface {
+	String() string
+	pos() int
+}
+
+// Ident - поле события (user_id, type, value, attributes.country, ...) или
+// псевдоним столбца SELECT
+type Ident struct {
+	Name string
+	Pos  int
+}
+
+// Literal - строка или число
+type Literal struct {
+	Value Value
+	Pos   int
+}
+
+// Call - агрегатная функция (count, sum, avg, min, max); Arg == nil - count(*)
+type Call struct {
+	Func string
+	Arg  Expr
+	Pos  int
+}
+
+// Bucket - начало интервала времени шириной Width, в который попадает событие
+type Bucket struct {
+	Width time.Duration
+	Pos   int
+}
+
+// Binary - сравнение (=, !=, <, <=, >, >=) или логическая связка (AND, OR)
+type Binary struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type Not struct {
+	X   Expr
+	Pos int
+}
+
+type In struct {
+	X      Expr
+	List   []Expr
+	Negate bool
+}
+
+// Like - сопоставление с шаблоном: % - любая подстрока, _ - один символ
+type Like struct {
+	X       Expr
+	Pattern string
+	Negate  bool
+}
+
+func (e *Ident) String() string   { return e.Name }
+func (e *Literal) String() string { return e.Value.literal() }
+func (e *Call) String() string {
+	if e.Arg == nil {
+		return e.Func + "(*)"
+	}
+	return e.Func + "(" + e.Arg.String() + ")"
+}
+func (e *Bucket) String() string { return "bucket(" + e.Width.String() + ")" }
+func (e *Binary) String() string {
+	s := e.Left.String() + " " + e.Op + " " + e.Right.String()
+	if e.Op == "AND" || e.Op == "OR" {
+		return "(" + s + ")"
+	}
+	return s
+}
+func (e *Not) String() string { return "NOT " + e.X.String() }
+func (e *In) String() string {
+	items := make([]string, len(e.List))
+	for i, x := range e.List {
+		items[i] = x.String()
+	}
+	op := " IN ("
+	if e.Negate {
+		op = " NOT IN ("
+	}
+	return e.X.String() + op + strings.Join(items, ", ") + ")"
+}
+func (e *Like) String() string {
+	op := " LIKE "
+	if e.Negate {
+		op = " NOT LIKE "
+	}
+	return e.X.String() + op + String(e.Pattern).literal()
+}
+
+func (e *Ident) pos() int   { return e.Pos }
+func (e *Literal) pos() int { return e.Pos }
+func (e *Call) pos() int    { return e.Pos }
+func (e *Bucket) pos() int  { return e.Pos }
+func (e *Binary) pos() int  { return e.Left.pos() }
+func (e *Not) pos() int     { return e.Pos }
+func (e *In) pos() int      { return e.X.pos() }
+func (e *Like) pos() int    { return e.X.pos() }
+
+// Kind - тип значения
+type Kind int
+
+const (
+	KindNull Kind = iota
+	KindString
+	KindNumber
+	KindTime
+	KindBool
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindTime:
+		return "timestamp"
+	case KindBool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// Value - значение поля, литерала или столбца результата
+type Value struct {
+	Kind Kind
+	Str  string
+	Num  float64
+	Time time.Time
+	Bool bool
+}
+
+func String(s string) Value       { return Value{Kind: KindString, Str: s} }
+func Number(n float64) Value      { return Value{Kind: KindNumber, Num: n} }
+func Timestamp(t time.Time) Value { return Value{Kind: KindTime, Time: t} }
+func Bool(b bool) Value           { return Value{Kind: KindBool, Bool: b} }
+
+// Interface - значение для кодирования в JSON; время - в RFC 3339
+func (v Value) Interface() any {
+	switch v.Kind {
+	case KindString:
+		return v.Str
+	case KindNumber:
+		return v.Num
+	case KindTime:
+		return v.Time.Format(time.RFC3339Nano)
+	case KindBool:
+		return v.Bool
+	}
+	return nil
+}
+
+func (v Value) literal() string {
+	switch v.Kind {
+	case KindString:
+		return "'" + strings.ReplaceAll(v.Str, "'", "''") + "'"
+	case KindNumber:
+		return strconv.FormatFloat(v.Num, 'g', -1, 64)
+	case KindTime:
+		return "'" + v.Time.Format(time.RFC3339Nano) + "'"
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	}
+	return "NULL"
+}
+
+// compare сравнивает значения одного типа; NULL меньше любого значения
+func compare(a, b Value) int {
+	if a.Kind != b.Kind {
+		return int(a.Kind) - int(b.Kind)
+	}
+	switch a.Kind {
+	case KindString:
+		return strings.Compare(a.Str, b.Str)
+	case KindNumber:
+		switch {
+		case a.Num < b.Num:
+			return -1
+		case a.Num > b.Num:
+			return 1
+		}
+	case KindTime:
+		return a.Time.Compare(b.Time)
+	case KindBool:
+		switch {
+		case !a.Bool && b.Bool:
+			return -1
+		case a.Bool && !b.Bool:
+			return 1
+		}
+	}
+	return 0
+}
+
+// key - представление значения для ключа группы
+func (v Value) key() string {
+	return fmt.Sprintf("%d:%s", v.Kind, v.literal())
+}
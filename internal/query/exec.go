@@ -0,0 +1,284 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/internal/topk"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// ErrTooManyGroups - группировка даёт больше MaxGroups групп
+var ErrTooManyGroups = fmt.Errorf("query produces more than %d groups", MaxGroups)
+
+// Source - события, по которым выполняется запрос (aggregator.TenantView)
+type Source interface {
+	Scan(filter storage.GroupFilter, fn func(models.Event) bool)
+}
+
+// Result - таблица результата
+type Result struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	// Truncated - строк больше, чем LIMIT
+	Truncated bool  `json:"truncated,omitempty"`
+	Stats     Stats `json:"stats"`
+}
+
+type Stats struct {
+	// Scanned - события, прошедшие фильтр хранилища
+	Scanned int64 `json:"scanned"`
+	// Matched - события, прошедшие весь WHERE
+	Matched int64   `json:"matched"`
+	Groups  int     `json:"groups,omitempty"`
+	Elapsed float64 `json:"elapsed_ms"`
+}
+
+// checkEvery - через сколько событий проверяется отмена ctx
+const checkEvery = 4096
+
+// Execute выполняет план по событиям src
+func (p *Plan) Execute(ctx context.Context, src Source) (*Result, error) {
+	start := time.Now()
+	res := &Result{Columns: make([]string, len(p.columns)), Rows: [][]any{}}
+	for i, c := range p.columns {
+		res.Columns[i] = c.name
+	}
+
+	var out []outRow
+	var err error
+	if p.grouped {
+		out, err = p.executeGrouped(ctx, src, &res.Stats)
+	} else {
+		out, err = p.executeScan(ctx, src, &res.Stats)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) > p.limit {
+		out, res.Truncated = out[:p.limit], true
+	}
+	for _, o := range out {
+		values := make([]any, len(o.values))
+		for i, v := range o.values {
+			values[i] = v.Interface()
+		}
+		res.Rows = append(res.Rows, values)
+	}
+	res.Stats.Elapsed = float64(time.Since(start).Microseconds()) / 1000
+	return res, nil
+}
+
+// outRow - строка результата с ключами сортировки; seq сохраняет порядок
+// событий при равных ключах
+type outRow struct {
+	values []Value
+	keys   []Value
+	seq    int64
+}
+
+func (p *Plan) output(r *row, seq int64) outRow {
+	o := outRow{values: make([]Value, len(p.columns)), keys: make([]Value, len(p.order)), seq: seq}
+	for i, c := range p.columns {
+		o.values[i] = c.eval(r)
+	}
+	for i, k := range p.order {
+		o.keys[i] = k.eval(r)
+	}
+	return o
+}
+
+func (p *Plan) compareRows(a, b outRow) int {
+	for i, k := range p.order {
+		if c := compare(a.keys[i], b.keys[i]); c != 0 {
+			if k.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return int(a.seq - b.seq)
+}
+
+// scan обходит события src, прошедшие WHERE; fn возвращает false, чтобы
+// остановить обход
+func (p *Plan) scan(ctx context.Context, src Source, stats *Stats, fn func(*row) bool) error {
+	var err error
+	r := &row{}
+	src.Scan(p.filter, func(e models.Event) bool {
+		if stats.Scanned%checkEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		stats.Scanned++
+		r.event = &e
+		if p.where != nil && !p.where(r).Bool {
+			return true
+		}
+		stats.Matched++
+		return fn(r)
+	})
+	return err
+}
+
+// executeScan - запрос без агрегатов: строка на каждое событие. С ORDER BY
+// в памяти держатся только limit+1 лучших строк, без него обход
+// останавливается после limit+1 строки.
+func (p *Plan) executeScan(ctx context.Context, src Source, stats *Stats) ([]outRow, error) {
+	if len(p.order) == 0 {
+		var out []outRow
+		err := p.scan(ctx, src, stats, func(r *row) bool {
+			out = append(out, p.output(r, int64(len(out))))
+			return len(out) <= p.limit
+		})
+		return out, err
+	}
+
+	top := topk.New(p.limit+1, func(a, b outRow) bool { return p.compareRows(a, b) > 0 })
+	var seq int64
+	err := p.scan(ctx, src, stats, func(r *row) bool {
+		top.Push(p.output(r, seq))
+		seq++
+		return true
+	})
+	return top.Sorted(), err
+}
+
+type group struct {
+	keys []Value
+	accs []accumulator
+}
+
+// executeGrouped - запрос с агрегатами: события накапливаются по группам
+// GROUP BY, затем к группам применяются HAVING и ORDER BY
+func (p *Plan) executeGrouped(ctx context.Context, src Source, stats *Stats) ([]outRow, error) {
+	groups := make(map[string]*group)
+	var order []*group
+	var key strings.Builder
+	var tooMany bool
+
+	newGroup := func(keys []Value) *group {
+		g := &group{keys: keys, accs: make([]accumulator, len(p.aggs))}
+		order = append(order, g)
+		return g
+	}
+
+	err := p.scan(ctx, src, stats, func(r *row) bool {
+		keys := make([]Value, len(p.dims))
+		key.Reset()
+		for i, d := range p.dims {
+			keys[i] = d.eval(r)
+			key.WriteString(keys[i].key())
+			key.WriteByte(0)
+		}
+		g, ok := groups[key.String()]
+		if !ok {
+			if len(groups) >= MaxGroups {
+				tooMany = true
+				return false
+			}
+			g = newGroup(keys)
+			groups[key.String()] = g
+		}
+		for i, a := range p.aggs {
+			if a.arg == nil {
+				g.accs[i].add(Number(0))
+			} else {
+				g.accs[i].add(a.arg(r))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tooMany {
+		return nil, ErrTooManyGroups
+	}
+	// Агрегаты без GROUP BY дают одну строку и по пустой выборке
+	if len(p.dims) == 0 && len(order) == 0 {
+		newGroup(nil)
+	}
+	stats.Groups = len(order)
+
+	out := make([]outRow, 0, len(order))
+	for i, g := range order {
+		r := &row{keys: g.keys, accs: g.accs}
+		if p.having != nil && !p.having(r).Bool {
+			continue
+		}
+		out = append(out, p.output(r, int64(i)))
+	}
+
+	if len(p.order) > 0 {
+		slices.SortFunc(out, p.compareRows)
+	} else {
+		// По умолчанию - по ключам группы
+		slices.SortFunc(out, func(a, b outRow) int {
+			ga, gb := order[a.seq], order[b.seq]
+			for i := range ga.keys {
+				if c := compare(ga.keys[i], gb.keys[i]); c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+	}
+	return out, nil
+}
+
+// accumulator - состояние одной агрегатной функции в группе
+type accumulator struct {
+	// n - непустые значения аргумента
+	n        int64
+	sum      float64
+	min, max Value
+}
+
+func (a *accumulator) add(v Value) {
+	if v.Kind == KindNull {
+		return
+	}
+	if a.n == 0 || compare(v, a.min) < 0 {
+		a.min = v
+	}
+	if a.n == 0 || compare(v, a.max) > 0 {
+		a.max = v
+	}
+	a.n++
+	a.sum += v.Num
+}
+
+func (a *accumulator) result(fn string) Value {
+	switch fn {
+	case "count":
+		return Number(float64(a.n))
+	case "sum":
+		if a.n > 0 {
+			return Number(a.sum)
+		}
+	case "avg":
+		if a.n > 0 {
+			return Number(a.sum / float64(a.n))
+		}
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	}
+	return Value{}
+}
+
+// IsUserError сообщает, что err - ошибка в самом запросе, а не сбой выполнения
+func IsUserError(err error) bool {
+	var syntaxErr *SyntaxError
+	var planErr *PlanError
+	return errors.As(err, &syntaxErr) || errors.As(err, &planErr) || errors.Is(err, ErrTooManyGroups)
+}
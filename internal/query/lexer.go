@@ -0,0 +1,150 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokString
+	tokNumber
+	tokDuration
+	tokOperator
+	tokComma
+	tokLParen
+	tokRParen
+	tokStar
+)
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"HAVING": true, "ORDER": true, "LIMIT": true, "AS": true, "AND": true,
+	"OR": true, "NOT": true, "IN": true, "LIKE": true, "ASC": true, "DESC": true,
+}
+
+type token struct {
+	kind tokenKind
+	// text - ключевые слова в верхнем регистре, строки - без кавычек
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// SyntaxError - ошибка разбора запроса; Pos - смещение в байтах от начала
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", start})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", start})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", start})
+			i++
+		case c == '*':
+			tokens = append(tokens, token{tokStar, "*", start})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{tokOperator, "=", start})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			i++
+			if i < len(src) && (src[i] == '=' || c == '<' && src[i] == '>') {
+				i++
+			}
+			op := src[start:i]
+			if op == "!" {
+				return nil, &SyntaxError{start, "unexpected '!'"}
+			}
+			if op == "<>" {
+				op = "!="
+			}
+			tokens = append(tokens, token{tokOperator, op, start})
+		case c == '\'':
+			// '' внутри строки - экранированная кавычка
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, &SyntaxError{start, "unterminated string"}
+				}
+				if src[i] == '\'' {
+					if i+1 < len(src) && src[i+1] == '\'' {
+						b.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, token{tokString, b.String(), start})
+		case isDigit(c) || c == '-' && i+1 < len(src) && isDigit(src[i+1]):
+			i++
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			// 15m, 1h30m - длительность
+			if i < len(src) && isLetter(src[i]) {
+				for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+					i++
+				}
+				tokens = append(tokens, token{tokDuration, src[start:i], start})
+				continue
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case isLetter(c) || c == '_':
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i]) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			word := src[start:i]
+			if upper := strings.ToUpper(word); keywords[upper] {
+				tokens = append(tokens, token{tokKeyword, upper, start})
+			} else {
+				tokens = append(tokens, token{tokIdent, word, start})
+			}
+		default:
+			return nil, &SyntaxError{start, fmt.Sprintf("unexpected character %q", rune(c))}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isLetter(c byte) bool { return c < unicode.MaxASCII && unicode.IsLetter(rune(c)) }
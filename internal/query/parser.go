@@ -0,0 +1,340 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse разбирает запрос вида
+//
+//	SELECT user_id, sum(value) AS total
+//	WHERE type = 'purchase' AND timestamp >= '2024-01-01T00:00:00Z'
+//	GROUP BY user_id HAVING total > 100 ORDER BY total DESC LIMIT 10
+//
+// FROM необязателен: единственный источник - события тенанта (FROM events).
+func Parse(src string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// keyword поглощает ключевое слово kw, если оно следующее
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokKeyword && t.text == kw {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.keyword(kw) {
+		return p.errorf(p.peek(), "expected %s, got %s", kw, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %s, got %s", what, t)
+	}
+	return t, nil
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	for {
+		item := SelectItem{}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		item.Expr = expr
+		if p.keyword("AS") {
+			t, err := p.expect(tokIdent, "column alias")
+			if err != nil {
+				return nil, err
+			}
+			item.Alias = t.text
+		}
+		q.Select = append(q.Select, item)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	if p.keyword("FROM") {
+		t, err := p.expect(tokIdent, "events")
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(t.text, "events") {
+			return nil, p.errorf(t, "unknown source %q: only events is supported", t.text)
+		}
+	}
+	if p.keyword("WHERE") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		q.Where = expr
+	}
+	if p.keyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			q.GroupBy = append(q.GroupBy, expr)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.keyword("HAVING") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		q.Having = expr
+	}
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: expr}
+			if p.keyword("DESC") {
+				item.Desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, item)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.keyword("LIMIT") {
+		t, err := p.expect(tokNumber, "row count")
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(t.text)
+		if err != nil || n <= 0 {
+			return nil, p.errorf(t, "LIMIT must be a positive integer")
+		}
+		q.Limit = n
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return q, nil
+}
+
+// parseExpr: or := and {OR and}; and := not {AND not}; not := NOT not | predicate
+func (p *parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if t := p.peek(); t.kind == tokKeyword && t.text == "NOT" {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x, Pos: t.pos}, nil
+	}
+	return p.parsePredicate()
+}
+
+// parsePredicate: operand [op operand | [NOT] IN (list) | [NOT] LIKE 'pattern']
+func (p *parser) parsePredicate() (Expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokOperator {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &Binary{Op: t.text, Left: left, Right: right}, nil
+	}
+
+	negate := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		if _, err := p.expect(tokLParen, "'('"); err != nil {
+			return nil, err
+		}
+		in := &In{X: left, Negate: negate}
+		for {
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, item)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	case p.keyword("LIKE"):
+		t, err := p.expect(tokString, "pattern string")
+		if err != nil {
+			return nil, err
+		}
+		return &Like{X: left, Pattern: t.text, Negate: negate}, nil
+	case negate:
+		return nil, p.errorf(p.peek(), "expected IN or LIKE after NOT, got %s", p.peek())
+	}
+	return left, nil
+}
+
+// parseOperand: '(' expr ')' | string | number | ident | func '(' [arg] ')'
+func (p *parser) parseOperand() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case tokString:
+		return &Literal{Value: String(t.text), Pos: t.pos}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		return &Literal{Value: Number(n), Pos: t.pos}, nil
+	case tokIdent:
+		if p.peek().kind != tokLParen {
+			return &Ident{Name: t.text, Pos: t.pos}, nil
+		}
+		p.next()
+		return p.parseCall(t)
+	}
+	return nil, p.errorf(t, "expected field, literal or function, got %s", t)
+}
+
+func (p *parser) parseCall(name token) (Expr, error) {
+	fn := strings.ToLower(name.text)
+	switch fn {
+	case "bucket":
+		t, err := p.expect(tokDuration, "bucket width like 1h")
+		if err != nil {
+			return nil, err
+		}
+		width, err := time.ParseDuration(t.text)
+		if err != nil || width <= 0 {
+			return nil, p.errorf(t, "invalid bucket width %s", t)
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return &Bucket{Width: width, Pos: name.pos}, nil
+	case "count", "sum", "avg", "min", "max":
+	default:
+		return nil, p.errorf(name, "unknown function %s", name)
+	}
+
+	call := &Call{Func: fn, Pos: name.pos}
+	switch p.peek().kind {
+	case tokStar:
+		p.next()
+	case tokRParen:
+	default:
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		call.Arg = arg
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	if call.Arg == nil && fn != "count" {
+		return nil, p.errorf(name, "%s requires an argument", fn)
+	}
+	return call, nil
+}
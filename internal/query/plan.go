@@ -0,0 +1,616 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Ограничения результата
+const (
+	// DefaultLimit - число строк результата, если LIMIT не задан
+	DefaultLimit = 1000
+	// MaxLimit - наибольший допустимый LIMIT
+	MaxLimit = 10000
+	// MaxGroups - наибольшее число групп, которое держит в памяти выполнение
+	MaxGroups = 100000
+)
+
+// PlanError - запрос разобран, но не может быть выполнен: неизвестное поле,
+// несовместимые типы, столбец вне GROUP BY и т.п.
+type PlanError struct {
+	Pos int
+	Msg string
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+func planErrorf(e Expr, format string, args ...any) error {
+	return &PlanError{Pos: e.pos(), Msg: fmt.Sprintf(format, args...)}
+}
+
+// evalFn вычисляет выражение для строки: события (до группировки) или группы
+type evalFn func(*row) Value
+
+type row struct {
+	event *models.Event
+	keys  []Value
+	accs  []accumulator
+}
+
+// aggregate - агрегатная функция, вычисляемая по каждой группе
+type aggregate struct {
+	name string
+	fn   string
+	// arg - аргумент по событию; nil - count(*)
+	arg evalFn
+}
+
+type column struct {
+	name string
+	eval evalFn
+	kind Kind
+}
+
+type orderKey struct {
+	eval evalFn
+	desc bool
+}
+
+// Plan - проверенный запрос, готовый к выполнению
+type Plan struct {
+	// filter - условия WHERE, переданные хранилищу
+	filter storage.GroupFilter
+	// residual - условия WHERE, проверяемые по каждому событию
+	residual Expr
+	where    evalFn
+
+	grouped bool
+	// dims - выражения GROUP BY, вычисляемые по событию
+	dims    []column
+	aggs    []aggregate
+	columns []column
+	having  evalFn
+	order   []orderKey
+	limit   int
+	query   *Query
+}
+
+// Compile разбирает запрос и строит план его выполнения
+func Compile(src string) (*Plan, error) {
+	q, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlan(q)
+}
+
+// NewPlan проверяет запрос и строит план: часть условий WHERE передаётся
+// хранилищу (тип события, префикс user_id, границы времени), остальное
+// компилируется в проверку каждого события
+func NewPlan(q *Query) (*Plan, error) {
+	p := &Plan{query: q, limit: DefaultLimit}
+	if q.Limit > MaxLimit {
+		return nil, &PlanError{Msg: fmt.Sprintf("LIMIT must be <= %d", MaxLimit)}
+	}
+	if q.Limit > 0 {
+		p.limit = q.Limit
+	}
+
+	if q.Where != nil {
+		if err := p.planWhere(q.Where); err != nil {
+			return nil, err
+		}
+	}
+
+	p.grouped = len(q.GroupBy) > 0 || slices.ContainsFunc(q.Select, func(s SelectItem) bool { return hasAggregate(s.Expr) }) ||
+		q.Having != nil && hasAggregate(q.Having) ||
+		slices.ContainsFunc(q.OrderBy, func(o OrderItem) bool { return hasAggregate(o.Expr) })
+	if q.Having != nil && !p.grouped {
+		return nil, planErrorf(q.Having, "HAVING requires GROUP BY or aggregates")
+	}
+
+	events := &compiler{plan: p}
+	for _, g := range q.GroupBy {
+		switch g.(type) {
+		case *Ident, *Bucket:
+		default:
+			return nil, planErrorf(g, "cannot group by %s", g)
+		}
+		eval, kind, err := events.compile(g)
+		if err != nil {
+			return nil, err
+		}
+		p.dims = append(p.dims, column{name: g.String(), eval: eval, kind: kind})
+	}
+
+	c := events
+	if p.grouped {
+		c = &compiler{plan: p, group: true}
+	}
+	for _, s := range q.Select {
+		eval, kind, err := c.compile(s.Expr)
+		if err != nil {
+			return nil, err
+		}
+		p.columns = append(p.columns, column{name: s.Name(), eval: eval, kind: kind})
+	}
+
+	// В HAVING и ORDER BY можно ссылаться на псевдонимы столбцов SELECT
+	c.aliases = make(map[string]int)
+	for i, s := range q.Select {
+		if s.Alias != "" {
+			c.aliases[s.Alias] = i
+		}
+	}
+	if q.Having != nil {
+		eval, kind, err := c.compile(q.Having)
+		if err != nil {
+			return nil, err
+		}
+		if kind != KindBool {
+			return nil, planErrorf(q.Having, "HAVING must be a condition, got %s", kind)
+		}
+		p.having = eval
+	}
+	for _, o := range q.OrderBy {
+		eval, _, err := c.compile(o.Expr)
+		if err != nil {
+			return nil, err
+		}
+		p.order = append(p.order, orderKey{eval: eval, desc: o.Desc})
+	}
+	return p, nil
+}
+
+// Explain - описание плана для POST /query с "explain": true
+type Explain struct {
+	// Pushdown - условия, которые проверяет хранилище
+	Pushdown Pushdown `json:"pushdown"`
+	// Filter - условия, проверяемые по каждому событию
+	Filter     string   `json:"filter,omitempty"`
+	Mode       string   `json:"mode"`
+	GroupBy    []string `json:"group_by,omitempty"`
+	Aggregates []string `json:"aggregates,omitempty"`
+	Having     string   `json:"having,omitempty"`
+	OrderBy    []string `json:"order_by,omitempty"`
+	Limit      int      `json:"limit"`
+}
+
+type Pushdown struct {
+	Type       string     `json:"type,omitempty"`
+	UserPrefix string     `json:"user_prefix,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+}
+
+func (p *Plan) Explain() Explain {
+	e := Explain{
+		Pushdown: Pushdown{Type: p.filter.EventType, UserPrefix: p.filter.UserPrefix},
+		Mode:     "scan",
+		Limit:    p.limit,
+	}
+	if !p.filter.From.IsZero() {
+		e.Pushdown.From = &p.filter.From
+	}
+	if !p.filter.To.IsZero() {
+		e.Pushdown.To = &p.filter.To
+	}
+	if p.residual != nil {
+		e.Filter = p.residual.String()
+	}
+	if p.grouped {
+		e.Mode = "aggregate"
+	}
+	for _, d := range p.dims {
+		e.GroupBy = append(e.GroupBy, d.name)
+	}
+	for _, a := range p.aggs {
+		e.Aggregates = append(e.Aggregates, a.name)
+	}
+	if p.query.Having != nil {
+		e.Having = p.query.Having.String()
+	}
+	for _, o := range p.query.OrderBy {
+		term := o.Expr.String()
+		if o.Desc {
+			term += " DESC"
+		}
+		e.OrderBy = append(e.OrderBy, term)
+	}
+	return e
+}
+
+// planWhere делит WHERE на условия для хранилища и остаточный фильтр
+func (p *Plan) planWhere(where Expr) error {
+	c := &compiler{plan: p}
+	var residual []Expr
+	for _, cond := range conjuncts(where) {
+		_, kind, err := c.compile(cond)
+		if err != nil {
+			return err
+		}
+		if kind != KindBool {
+			return planErrorf(cond, "WHERE must be a condition, got %s", kind)
+		}
+		if !p.pushDown(cond) {
+			residual = append(residual, cond)
+		}
+	}
+	if len(residual) == 0 {
+		return nil
+	}
+	p.residual = residual[0]
+	for _, cond := range residual[1:] {
+		p.residual = &Binary{Op: "AND", Left: p.residual, Right: cond}
+	}
+	eval, _, err := c.compile(p.residual)
+	if err != nil {
+		return err
+	}
+	p.where = eval
+	return nil
+}
+
+// pushDown переносит условие в фильтр хранилища; false - условие нужно
+// проверять по каждому событию (в том числе если хранилище проверяет его
+// лишь приближённо, как строгие неравенства по времени)
+func (p *Plan) pushDown(cond Expr) bool {
+	switch e := cond.(type) {
+	case *Binary:
+		field, lit, op := fieldLiteral(e)
+		if field == "" {
+			return false
+		}
+		switch {
+		case field == "type" && op == "=" && lit.Kind == KindString && p.filter.EventType == "":
+			p.filter.EventType = lit.Str
+			return true
+		case field == "timestamp":
+			t, ok := toTime(lit)
+			if !ok {
+				return false
+			}
+			switch op {
+			case ">=", ">":
+				if p.filter.From.IsZero() {
+					p.filter.From = t
+					return op == ">="
+				}
+			case "<=", "<":
+				if p.filter.To.IsZero() {
+					p.filter.To = t
+					return op == "<="
+				}
+			}
+		}
+	case *Like:
+		if id, ok := e.X.(*Ident); ok && id.Name == "user_id" && !e.Negate && p.filter.UserPrefix == "" {
+			prefix, rest, _ := strings.Cut(e.Pattern, "%")
+			if rest == "" && strings.HasSuffix(e.Pattern, "%") && !strings.ContainsAny(prefix, "_") {
+				p.filter.UserPrefix = prefix
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldLiteral разбирает сравнение поля с литералом; оператор приводится к
+// виду "поле op литерал"
+func fieldLiteral(e *Binary) (string, Value, string) {
+	flip := map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+	if id, ok := e.Left.(*Ident); ok {
+		if lit, ok := e.Right.(*Literal); ok {
+			return id.Name, lit.Value, e.Op
+		}
+	}
+	if id, ok := e.Right.(*Ident); ok {
+		if lit, ok := e.Left.(*Literal); ok {
+			if op, ok := flip[e.Op]; ok {
+				return id.Name, lit.Value, op
+			}
+		}
+	}
+	return "", Value{}, ""
+}
+
+func conjuncts(e Expr) []Expr {
+	if b, ok := e.(*Binary); ok && b.Op == "AND" {
+		return append(conjuncts(b.Left), conjuncts(b.Right)...)
+	}
+	return []Expr{e}
+}
+
+func hasAggregate(e Expr) bool {
+	switch e := e.(type) {
+	case *Call:
+		return true
+	case *Binary:
+		return hasAggregate(e.Left) || hasAggregate(e.Right)
+	case *Not:
+		return hasAggregate(e.X)
+	case *In:
+		return hasAggregate(e.X)
+	case *Like:
+		return hasAggregate(e.X)
+	}
+	return false
+}
+
+// toTime приводит строковый литерал к метке времени: RFC 3339 или дата
+func toTime(v Value) (time.Time, bool) {
+	if v.Kind != KindString {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, v.Str); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// field - доступ к полю события
+func field(name string) (func(*models.Event) Value, Kind, bool) {
+	switch name {
+	case "id":
+		return func(e *models.Event) Value { return String(e.ID) }, KindString, true
+	case "type":
+		return func(e *models.Event) Value { return String(e.Type) }, KindString, true
+	case "user_id":
+		return func(e *models.Event) Value { return String(e.UserID) }, KindString, true
+	case "unit":
+		return func(e *models.Event) Value { return String(e.Unit) }, KindString, true
+	case "value":
+		return func(e *models.Event) Value { return Number(e.Value) }, KindNumber, true
+	case "timestamp":
+		return func(e *models.Event) Value { return Timestamp(e.Timestamp) }, KindTime, true
+	}
+	if attr, ok := strings.CutPrefix(name, "attributes."); ok && attr != "" {
+		return func(e *models.Event) Value {
+			if v, ok := e.Attributes[attr]; ok {
+				return String(v)
+			}
+			return Value{}
+		}, KindString, true
+	}
+	return nil, KindNull, false
+}
+
+// compiler превращает выражения в evalFn. В режиме group выражения
+// вычисляются по группе: поля - только из GROUP BY, агрегаты - по накопленным
+// значениям; иначе - по отдельному событию.
+type compiler struct {
+	plan    *Plan
+	group   bool
+	aliases map[string]int
+}
+
+func (c *compiler) compile(e Expr) (evalFn, Kind, error) {
+	if id, ok := e.(*Ident); ok {
+		if i, ok := c.aliases[id.Name]; ok {
+			col := c.plan.columns[i]
+			return col.eval, col.kind, nil
+		}
+	}
+	if c.group {
+		switch e.(type) {
+		case *Ident, *Bucket:
+			i := slices.IndexFunc(c.plan.dims, func(d column) bool { return d.name == e.String() })
+			if i < 0 {
+				return nil, KindNull, planErrorf(e, "%s must appear in GROUP BY or be used in an aggregate", e)
+			}
+			return func(r *row) Value { return r.keys[i] }, c.plan.dims[i].kind, nil
+		}
+	}
+
+	switch e := e.(type) {
+	case *Literal:
+		v := e.Value
+		return func(*row) Value { return v }, v.Kind, nil
+	case *Ident:
+		get, kind, ok := field(e.Name)
+		if !ok {
+			return nil, KindNull, planErrorf(e, "unknown field %s", e.Name)
+		}
+		return func(r *row) Value { return get(r.event) }, kind, nil
+	case *Bucket:
+		width := e.Width
+		return func(r *row) Value { return Timestamp(r.event.Timestamp.UTC().Truncate(width)) }, KindTime, nil
+	case *Call:
+		return c.compileCall(e)
+	case *Not:
+		x, kind, err := c.compile(e.X)
+		if err != nil {
+			return nil, KindNull, err
+		}
+		if kind != KindBool {
+			return nil, KindNull, planErrorf(e, "NOT requires a condition, got %s", kind)
+		}
+		return func(r *row) Value { return Bool(!x(r).Bool) }, KindBool, nil
+	case *Binary:
+		return c.compileBinary(e)
+	case *In:
+		return c.compileIn(e)
+	case *Like:
+		return c.compileLike(e)
+	}
+	return nil, KindNull, planErrorf(e, "unsupported expression %s", e)
+}
+
+func (c *compiler) compileCall(e *Call) (evalFn, Kind, error) {
+	if !c.group {
+		return nil, KindNull, planErrorf(e, "aggregate %s is not allowed here", e)
+	}
+	agg := aggregate{name: e.String(), fn: e.Func}
+	kind := KindNumber
+	if e.Arg != nil {
+		if hasAggregate(e.Arg) {
+			return nil, KindNull, planErrorf(e, "aggregates cannot be nested")
+		}
+		arg, argKind, err := (&compiler{plan: c.plan}).compile(e.Arg)
+		if err != nil {
+			return nil, KindNull, err
+		}
+		switch {
+		case e.Func == "min" || e.Func == "max":
+			if argKind != KindNumber && argKind != KindTime && argKind != KindString {
+				return nil, KindNull, planErrorf(e, "%s is not defined for %s", e.Func, argKind)
+			}
+			kind = argKind
+		case e.Func == "sum" || e.Func == "avg":
+			if argKind != KindNumber {
+				return nil, KindNull, planErrorf(e, "%s requires a number, got %s", e.Func, argKind)
+			}
+		}
+		agg.arg = arg
+	}
+
+	i := slices.IndexFunc(c.plan.aggs, func(a aggregate) bool { return a.name == agg.name })
+	if i < 0 {
+		i = len(c.plan.aggs)
+		c.plan.aggs = append(c.plan.aggs, agg)
+	}
+	fn := e.Func
+	return func(r *row) Value { return r.accs[i].result(fn) }, kind, nil
+}
+
+func (c *compiler) compileBinary(e *Binary) (evalFn, Kind, error) {
+	left, lk, err := c.compile(e.Left)
+	if err != nil {
+		return nil, KindNull, err
+	}
+	right, rk, err := c.compile(e.Right)
+	if err != nil {
+		return nil, KindNull, err
+	}
+
+	if e.Op == "AND" || e.Op == "OR" {
+		if lk != KindBool || rk != KindBool {
+			return nil, KindNull, planErrorf(e.Left, "%s requires conditions on both sides", e.Op)
+		}
+		if e.Op == "AND" {
+			return func(r *row) Value { return Bool(left(r).Bool && right(r).Bool) }, KindBool, nil
+		}
+		return func(r *row) Value { return Bool(left(r).Bool || right(r).Bool) }, KindBool, nil
+	}
+
+	left, right, err = coerce(e.Left, left, lk, e.Right, right, rk)
+	if err != nil {
+		return nil, KindNull, err
+	}
+	var test func(int) bool
+	switch e.Op {
+	case "=":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	default:
+		return nil, KindNull, planErrorf(e.Left, "unknown operator %s", e.Op)
+	}
+	return func(r *row) Value {
+		l, rv := left(r), right(r)
+		// Сравнение с отсутствующим значением ложно
+		if l.Kind == KindNull || rv.Kind == KindNull {
+			return Bool(false)
+		}
+		return Bool(test(compare(l, rv)))
+	}, KindBool, nil
+}
+
+// coerce проверяет совместимость типов сравнения; строковый литерал,
+// сравниваемый со временем, разбирается как метка времени
+func coerce(le Expr, left evalFn, lk Kind, re Expr, right evalFn, rk Kind) (evalFn, evalFn, error) {
+	if lk == rk {
+		return left, right, nil
+	}
+	if lk == KindTime && rk == KindString {
+		if lit, ok := re.(*Literal); ok {
+			t, ok := toTime(lit.Value)
+			if !ok {
+				return nil, nil, planErrorf(re, "%s is not a timestamp", lit)
+			}
+			return left, func(*row) Value { return Timestamp(t) }, nil
+		}
+	}
+	if lk == KindString && rk == KindTime {
+		r, l, err := coerce(re, right, rk, le, left, lk)
+		return l, r, err
+	}
+	return nil, nil, planErrorf(le, "cannot compare %s with %s", lk, rk)
+}
+
+func (c *compiler) compileIn(e *In) (evalFn, Kind, error) {
+	x, kind, err := c.compile(e.X)
+	if err != nil {
+		return nil, KindNull, err
+	}
+	set := make(map[string]bool, len(e.List))
+	for _, item := range e.List {
+		lit, ok := item.(*Literal)
+		if !ok {
+			return nil, KindNull, planErrorf(item, "IN list must contain literals")
+		}
+		_, v, err := coerce(e.X, x, kind, lit, func(*row) Value { return lit.Value }, lit.Value.Kind)
+		if err != nil {
+			return nil, KindNull, err
+		}
+		set[v(nil).key()] = true
+	}
+	negate := e.Negate
+	return func(r *row) Value {
+		v := x(r)
+		if v.Kind == KindNull {
+			return Bool(false)
+		}
+		return Bool(set[v.key()] != negate)
+	}, KindBool, nil
+}
+
+func (c *compiler) compileLike(e *Like) (evalFn, Kind, error) {
+	x, kind, err := c.compile(e.X)
+	if err != nil {
+		return nil, KindNull, err
+	}
+	if kind != KindString {
+		return nil, KindNull, planErrorf(e, "LIKE requires a string, got %s", kind)
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range e.Pattern {
+		switch r {
+		case '%':
+			b.WriteString("(?s:.*)")
+		case '_':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	negate := e.Negate
+	return func(r *row) Value {
+		v := x(r)
+		if v.Kind == KindNull {
+			return Bool(false)
+		}
+		return Bool(re.MatchString(v.Str) != negate)
+	}, KindBool, nil
+}
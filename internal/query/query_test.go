@@ -0,0 +1,168 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// events - Source над срезом, с той же семантикой фильтра, что у хранилища
+type events []models.Event
+
+func (s events) Scan(filter storage.GroupFilter, fn func(models.Event) bool) {
+	st := storage.NewInMemoryStorage()
+	for _, e := range s {
+		st.AddEvent(e)
+	}
+	st.Scan("", filter, fn)
+}
+
+var base = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+var testEvents = events{
+	{ID: "1", Type: "purchase", UserID: "user-1", Value: 100, Timestamp: base, Attributes: map[string]string{"country": "DE"}},
+	{ID: "2", Type: "purchase", UserID: "user-1", Value: 50, Timestamp: base.Add(30 * time.Minute), Attributes: map[string]string{"country": "DE"}},
+	{ID: "3", Type: "purchase", UserID: "user-2", Value: 300, Timestamp: base.Add(90 * time.Minute), Attributes: map[string]string{"country": "FR"}},
+	{ID: "4", Type: "purchase", UserID: "bot-1", Value: 1, Timestamp: base},
+	{ID: "5", Type: "view", UserID: "user-1", Value: 1, Timestamp: base},
+}
+
+func run(t *testing.T, src string) *Result {
+	t.Helper()
+	plan, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q) failed: %v", src, err)
+	}
+	res, err := plan.Execute(context.Background(), testEvents)
+	if err != nil {
+		t.Fatalf("Execute(%q) failed: %v", src, err)
+	}
+	return res
+}
+
+func TestExecute_GroupBy(t *testing.T) {
+	res := run(t, `SELECT user_id, count(*) AS n, sum(value) AS total
+		WHERE type = 'purchase' AND user_id LIKE 'user-%'
+		GROUP BY user_id HAVING total > 100 ORDER BY total DESC`)
+
+	if strings.Join(res.Columns, ",") != "user_id,n,total" {
+		t.Errorf("Unexpected columns: %v", res.Columns)
+	}
+	if len(res.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", res.Rows)
+	}
+	if res.Rows[0][0] != "user-2" || res.Rows[0][2] != 300.0 {
+		t.Errorf("Expected user-2 first, got %v", res.Rows[0])
+	}
+	if res.Rows[1][0] != "user-1" || res.Rows[1][1] != 2.0 || res.Rows[1][2] != 150.0 {
+		t.Errorf("Unexpected user-1 row: %v", res.Rows[1])
+	}
+	// type и префикс user_id проверяет хранилище
+	if res.Stats.Scanned != 3 || res.Stats.Matched != 3 {
+		t.Errorf("Unexpected stats: %+v", res.Stats)
+	}
+}
+
+func TestExecute_BucketAndAttributes(t *testing.T) {
+	res := run(t, `SELECT bucket(1h), attributes.country, max(value)
+		FROM events WHERE attributes.country IN ('DE', 'FR') GROUP BY bucket(1h), attributes.country`)
+
+	want := [][]any{
+		{"2024-03-01T10:00:00Z", "DE", 100.0},
+		{"2024-03-01T11:00:00Z", "FR", 300.0},
+	}
+	if len(res.Rows) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, res.Rows)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if res.Rows[i][j] != want[i][j] {
+				t.Errorf("Row %d: expected %v, got %v", i, want[i], res.Rows[i])
+			}
+		}
+	}
+}
+
+func TestExecute_GlobalAggregateAndScan(t *testing.T) {
+	res := run(t, `SELECT count(*), avg(value) WHERE type = 'signup'`)
+	if len(res.Rows) != 1 || res.Rows[0][0] != 0.0 || res.Rows[0][1] != nil {
+		t.Errorf("Expected one row with zero count and null avg, got %v", res.Rows)
+	}
+
+	res = run(t, `SELECT id, value WHERE timestamp >= '2024-03-01T10:00:00Z' AND NOT type = 'view' ORDER BY value DESC LIMIT 2`)
+	if len(res.Rows) != 2 || res.Rows[0][0] != "3" || res.Rows[1][0] != "1" || !res.Truncated {
+		t.Errorf("Unexpected top rows: %+v", res)
+	}
+}
+
+func TestPlan_Pushdown(t *testing.T) {
+	plan, err := Compile(`SELECT count(*) WHERE type = 'purchase' AND user_id LIKE 'user-%'
+		AND timestamp > '2024-03-01' AND timestamp <= '2024-03-02T00:00:00Z' AND value > 10`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	e := plan.Explain()
+	if e.Pushdown.Type != "purchase" || e.Pushdown.UserPrefix != "user-" || e.Pushdown.From == nil || e.Pushdown.To == nil {
+		t.Errorf("Unexpected pushdown: %+v", e.Pushdown)
+	}
+	// Строгое неравенство проверяется и по каждому событию
+	if e.Filter != "(timestamp > '2024-03-01' AND value > 10)" {
+		t.Errorf("Unexpected residual filter: %s", e.Filter)
+	}
+	if e.Mode != "aggregate" || len(e.Aggregates) != 1 {
+		t.Errorf("Unexpected plan: %+v", e)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		plan  bool
+	}{
+		{"SELEC count(*)", 0, false},
+		{"SELECT count(*) WHERE type = 'x", 29, false},
+		{"SELECT median(value)", 7, false},
+		{"SELECT count(*) LIMIT 0", 22, false},
+		{"SELECT user_id, count(*)", 7, true},
+		{"SELECT count(*) WHERE value = 'x'", 22, true},
+		{"SELECT count(*) WHERE country = 'DE'", 22, true},
+		{"SELECT sum(type)", 7, true},
+		{"SELECT id WHERE count(*) > 1", 16, true},
+		{"SELECT id HAVING value > 1", 17, true},
+		{"SELECT count(*) WHERE timestamp > 'yesterday'", 34, true},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.query)
+		var syntaxErr *SyntaxError
+		var planErr *PlanError
+		switch {
+		case err == nil:
+			t.Errorf("%s: expected error", tt.query)
+		case !tt.plan && errors.As(err, &syntaxErr):
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("%s: expected position %d, got %v", tt.query, tt.pos, err)
+			}
+		case tt.plan && errors.As(err, &planErr):
+			if planErr.Pos != tt.pos {
+				t.Errorf("%s: expected position %d, got %v", tt.query, tt.pos, err)
+			}
+		default:
+			t.Errorf("%s: unexpected error %T: %v", tt.query, err, err)
+		}
+	}
+}
+
+func TestExecute_Cancelled(t *testing.T) {
+	plan, _ := Compile("SELECT count(*)")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := plan.Execute(ctx, testEvents); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetHeaders записывает заголовки RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset (draft-ietf-httpapi-ratelimit-headers) и Retry-After для
+// отклонённого запроса. Значения времени - в целых секундах с округлением вверх.
+func SetHeaders(w http.ResponseWriter, d Decision) {
+	if d.Limit == 0 {
+		// ни одно ведро не участвовало в проверке
+		return
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, seconds(d.RetryAfter))))
+	}
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP возвращает IP клиента; trustProxy - доверять первому адресу
+// X-Forwarded-For
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,306 @@
+// Package ratelimit - ограничение частоты приёма событий по API-ключу,
+// IP-адресу клиента и user_id (token bucket)
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Измерения, по которым считаются лимиты
+const (
+	DimensionAPIKey = "api_key"
+	DimensionIP     = "ip"
+	DimensionUserID = "user_id"
+)
+
+const (
+	// idleTTL - через сколько неиспользуемое ведро удаляется
+	idleTTL = 10 * time.Minute
+	// sweepInterval - как часто ищутся неиспользуемые вёдра
+	sweepInterval = time.Minute
+)
+
+// Limit - параметры ведра: Rate событий в секунду, Burst - ёмкость.
+// Rate = 0 отключает ограничение.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+func (l Limit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	// по умолчанию - запас на одну секунду
+	return max(1, int(math.Ceil(l.Rate)))
+}
+
+// Config - лимиты по измерениям; Keys переопределяет лимит для отдельных
+// API-ключей (по ID ключа).
+//
+//	{"api_key": {"rate": 100, "burst": 200}, "ip": {"rate": 50},
+//	 "user_id": {"rate": 10}, "keys": {"3f2a...": {"rate": 1000}}}
+type Config struct {
+	APIKey Limit            `json:"api_key"`
+	IP     Limit            `json:"ip"`
+	UserID Limit            `json:"user_id"`
+	Keys   map[string]Limit `json:"keys,omitempty"`
+	// TrustProxy - брать IP клиента из X-Forwarded-For (сервер за прокси)
+	TrustProxy bool `json:"trust_proxy,omitempty"`
+}
+
+// Enabled сообщает, задан ли хотя бы один лимит
+func (c Config) Enabled() bool {
+	return c.APIKey.enabled() || c.IP.enabled() || c.UserID.enabled() || len(c.Keys) > 0
+}
+
+func (c Config) validate() error {
+	limits := map[string]Limit{DimensionAPIKey: c.APIKey, DimensionIP: c.IP, DimensionUserID: c.UserID}
+	for id, l := range c.Keys {
+		limits["key "+id] = l
+	}
+	for name, l := range limits {
+		if l.Rate < 0 || l.Burst < 0 {
+			return fmt.Errorf("%s: rate and burst must not be negative", name)
+		}
+	}
+	return nil
+}
+
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return cfg, cfg.validate()
+}
+
+// Request - кто отправляет событие; пустые поля не ограничиваются
+type Request struct {
+	APIKey string
+	IP     string
+	UserID string
+}
+
+// Decision - результат проверки. Limit/Remaining/Reset относятся к самому
+// строгому из сработавших вёдер и отдаются клиенту в заголовках RateLimit-*.
+type Decision struct {
+	Allowed   bool
+	Dimension string
+	Limit     int
+	Remaining int
+	// Reset - через сколько ведро наполнится полностью
+	Reset time.Duration
+	// RetryAfter - через сколько можно повторить отклонённый запрос
+	RetryAfter time.Duration
+}
+
+// Stats - счётчики ограничителя
+type Stats struct {
+	Allowed   int64 `json:"allowed"`
+	Throttled int64 `json:"throttled"`
+	// ThrottledBy - отклонённые запросы по измерению, сработавшему первым
+	ThrottledBy map[string]int64 `json:"throttled_by"`
+	// ThrottledKeys - отклонённые запросы по ID API-ключа
+	ThrottledKeys map[string]int64 `json:"throttled_keys,omitempty"`
+	// Buckets - активные вёдра
+	Buckets int `json:"buckets"`
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	limit    Limit
+	lastSeen time.Time
+}
+
+// Limiter - набор вёдер по измерениям. nil *Limiter пропускает все запросы.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	stats     Stats
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		stats: Stats{
+			ThrottledBy:   make(map[string]int64),
+			ThrottledKeys: make(map[string]int64),
+		},
+	}
+}
+
+// TrustProxy сообщает, нужно ли брать IP клиента из X-Forwarded-For
+func (l *Limiter) TrustProxy() bool {
+	return l != nil && l.cfg.TrustProxy
+}
+
+// Allow списывает по одному токену из всех вёдер запроса. Если хотя бы одно
+// ведро пусто, запрос отклоняется и токены не списываются ни из одного.
+func (l *Limiter) Allow(req Request) Decision {
+	return l.allow(req, true, true)
+}
+
+// AllowSender проверяет только вёдра API-ключа и IP - до чтения тела
+// запроса, пока user_id неизвестен. Пропущенный запрос учитывается в Stats
+// после AllowUser.
+func (l *Limiter) AllowSender(req Request) Decision {
+	return l.allow(req, true, false)
+}
+
+// AllowUser проверяет ведро user_id запроса, уже пропущенного AllowSender.
+// Токены ключа и IP при отказе не возвращаются: тело запроса уже прочитано.
+func (l *Limiter) AllowUser(req Request) Decision {
+	return l.allow(req, false, true)
+}
+
+// allow проверяет вёдра отправителя (ключ и IP) и/или пользователя; запрос
+// считается пропущенным после проверки пользователя
+func (l *Limiter) allow(req Request, sender, user bool) Decision {
+	if l == nil {
+		return Decision{Allowed: true}
+	}
+
+	type check struct {
+		dimension string
+		key       string
+		limit     Limit
+	}
+	var checks []check
+	if sender && req.APIKey != "" {
+		limit, ok := l.cfg.Keys[req.APIKey]
+		if !ok {
+			limit = l.cfg.APIKey
+		}
+		checks = append(checks, check{DimensionAPIKey, req.APIKey, limit})
+	}
+	if sender && req.IP != "" {
+		checks = append(checks, check{DimensionIP, req.IP, l.cfg.IP})
+	}
+	if user && req.UserID != "" {
+		checks = append(checks, check{DimensionUserID, req.UserID, l.cfg.UserID})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	decision := Decision{Allowed: true, Remaining: math.MaxInt}
+	reservations := make([]*rate.Reservation, 0, len(checks))
+	for _, c := range checks {
+		if !c.limit.enabled() {
+			continue
+		}
+		b := l.bucket(c.dimension+"\x00"+c.key, c.limit, now)
+		r := b.limiter.ReserveN(now, 1)
+		delay := r.DelayFrom(now)
+		if !r.OK() {
+			delay = time.Duration(math.MaxInt64)
+		}
+
+		if delay > 0 {
+			r.CancelAt(now)
+			if decision.Allowed || delay > decision.RetryAfter {
+				decision = Decision{Dimension: c.dimension, Limit: c.limit.burst(), RetryAfter: delay, Reset: fullIn(b, now)}
+			}
+			continue
+		}
+		reservations = append(reservations, r)
+		if remaining := int(b.limiter.TokensAt(now)); decision.Allowed && remaining < decision.Remaining {
+			decision.Dimension = c.dimension
+			decision.Limit = c.limit.burst()
+			decision.Remaining = remaining
+			decision.Reset = fullIn(b, now)
+		}
+	}
+
+	if !decision.Allowed {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		l.stats.Throttled++
+		l.stats.ThrottledBy[decision.Dimension]++
+		if req.APIKey != "" {
+			l.stats.ThrottledKeys[req.APIKey]++
+		}
+		return decision
+	}
+	if decision.Remaining == math.MaxInt {
+		decision.Remaining = 0
+	}
+	if user {
+		l.stats.Allowed++
+	}
+	return decision
+}
+
+// Stats возвращает копию счётчиков
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.stats
+	s.Buckets = len(l.buckets)
+	s.ThrottledBy = make(map[string]int64, len(l.stats.ThrottledBy))
+	for k, v := range l.stats.ThrottledBy {
+		s.ThrottledBy[k] = v
+	}
+	s.ThrottledKeys = make(map[string]int64, len(l.stats.ThrottledKeys))
+	for k, v := range l.stats.ThrottledKeys {
+		s.ThrottledKeys[k] = v
+	}
+	return s
+}
+
+func (l *Limiter) bucket(key string, limit Limit, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.burst()), limit: limit}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b
+}
+
+// sweep удаляет давно не используемые вёдра; вызывается под l.mu
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// fullIn - время до полного наполнения ведра
+func fullIn(b *bucket, now time.Time) time.Duration {
+	missing := float64(b.limiter.Burst()) - b.limiter.TokensAt(now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.limit.Rate * float64(time.Second))
+}
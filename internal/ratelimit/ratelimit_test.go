@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(cfg Config) (*Limiter, *time.Time) {
+	l := New(cfg)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	l, now := newTestLimiter(Config{UserID: Limit{Rate: 1, Burst: 2}})
+
+	for i := 0; i < 2; i++ {
+		if d := l.Allow(Request{UserID: "u1"}); !d.Allowed || d.Remaining != 1-i {
+			t.Fatalf("request %d: unexpected decision %+v", i, d)
+		}
+	}
+	d := l.Allow(Request{UserID: "u1"})
+	if d.Allowed || d.Dimension != DimensionUserID || d.RetryAfter != time.Second || d.Limit != 2 {
+		t.Errorf("Unexpected decision: %+v", d)
+	}
+	// Другой пользователь не затронут
+	if d := l.Allow(Request{UserID: "u2"}); !d.Allowed {
+		t.Errorf("Expected u2 to be allowed: %+v", d)
+	}
+
+	*now = now.Add(time.Second)
+	if d := l.Allow(Request{UserID: "u1"}); !d.Allowed {
+		t.Errorf("Expected token to be refilled: %+v", d)
+	}
+}
+
+func TestLimiter_AllDimensionsAndOverrides(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		APIKey: Limit{Rate: 1, Burst: 1},
+		IP:     Limit{Rate: 10, Burst: 2},
+		Keys:   map[string]Limit{"vip": {Rate: 100, Burst: 100}},
+	})
+
+	if d := l.Allow(Request{APIKey: "k1", IP: "10.0.0.1"}); !d.Allowed || d.Dimension != DimensionAPIKey || d.Remaining != 0 {
+		t.Errorf("Unexpected decision: %+v", d)
+	}
+	if d := l.Allow(Request{APIKey: "k1", IP: "10.0.0.1"}); d.Allowed || d.Dimension != DimensionAPIKey {
+		t.Errorf("Expected api key throttling: %+v", d)
+	}
+
+	// Отклонённый запрос не списывает токены из других вёдер: у IP остался один
+	if d := l.Allow(Request{APIKey: "vip", IP: "10.0.0.1"}); !d.Allowed {
+		t.Errorf("Expected vip key to be allowed: %+v", d)
+	}
+	if d := l.Allow(Request{APIKey: "vip", IP: "10.0.0.1"}); d.Allowed || d.Dimension != DimensionIP {
+		t.Errorf("Expected ip throttling: %+v", d)
+	}
+
+	s := l.Stats()
+	if s.Allowed != 2 || s.Throttled != 2 || s.ThrottledBy[DimensionIP] != 1 || s.ThrottledKeys["k1"] != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestLimiter_SenderThenUser(t *testing.T) {
+	l, _ := newTestLimiter(Config{IP: Limit{Rate: 1, Burst: 2}, UserID: Limit{Rate: 1, Burst: 1}})
+	req := Request{APIKey: "k1", IP: "10.0.0.1", UserID: "u1"}
+
+	if d := l.AllowSender(req); !d.Allowed || d.Dimension != DimensionIP || d.Remaining != 1 {
+		t.Errorf("Unexpected sender decision: %+v", d)
+	}
+	if d := l.AllowUser(req); !d.Allowed || d.Dimension != DimensionUserID {
+		t.Errorf("Unexpected user decision: %+v", d)
+	}
+	// user_id исчерпан, но токен IP уже списан
+	l.AllowSender(req)
+	if d := l.AllowUser(req); d.Allowed || d.Dimension != DimensionUserID {
+		t.Errorf("Expected user_id throttling: %+v", d)
+	}
+	if d := l.AllowSender(req); d.Allowed || d.Dimension != DimensionIP {
+		t.Errorf("Expected ip throttling: %+v", d)
+	}
+
+	s := l.Stats()
+	if s.Allowed != 1 || s.Throttled != 2 || s.ThrottledBy[DimensionUserID] != 1 || s.ThrottledKeys["k1"] != 2 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
+
+func TestLimiter_SweepIdleBuckets(t *testing.T) {
+	l, now := newTestLimiter(Config{IP: Limit{Rate: 1}})
+	l.Allow(Request{IP: "10.0.0.1"})
+	*now = now.Add(idleTTL + sweepInterval)
+	l.Allow(Request{IP: "10.0.0.2"})
+	if s := l.Stats(); s.Buckets != 1 {
+		t.Errorf("Expected idle bucket to be removed, got %d buckets", s.Buckets)
+	}
+}
+
+func TestSetHeadersAndClientIP(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetHeaders(w, Decision{Limit: 10, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 100 * time.Millisecond})
+	h := w.Header()
+	if h.Get("RateLimit-Limit") != "10" || h.Get("RateLimit-Remaining") != "0" ||
+		h.Get("RateLimit-Reset") != "2" || h.Get("Retry-After") != "1" {
+		t.Errorf("Unexpected headers: %v", h)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/events", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.5, 10.0.0.1")
+	if ip := ClientIP(r, false); ip != "192.0.2.1" {
+		t.Errorf("Expected remote address, got %s", ip)
+	}
+	if ip := ClientIP(r, true); ip != "203.0.113.5" {
+		t.Errorf("Expected forwarded address, got %s", ip)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	os.WriteFile(path, []byte(`{"ip":{"rate":5},"keys":{"k1":{"rate":-1}}}`), 0o644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("Expected error for negative rate")
+	}
+}
@@ -0,0 +1,199 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var (
+	ErrSchemaNotFound  = errors.New("schema not found")
+	ErrVersionNotFound = errors.New("schema version not found")
+)
+
+// Registry хранит версии схем по типам событий; действует последняя версия.
+// Если задан файл, изменения сохраняются в него.
+type Registry struct {
+	mu       sync.RWMutex
+	path     string
+	versions map[string][]Schema
+	now      func() time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{versions: make(map[string][]Schema), now: time.Now}
+}
+
+// LoadRegistry читает схемы из JSON-файла (массив всех версий). Отсутствующий
+// файл - пустой реестр; он будет создан при первом изменении.
+func LoadRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	r.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas []Schema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	sort.SliceStable(schemas, func(i, j int) bool { return schemas[i].Version < schemas[j].Version })
+	for _, s := range schemas {
+		if err := s.compile(); err != nil {
+			return nil, fmt.Errorf("%s: schema %s v%d: %w", path, s.EventType, s.Version, err)
+		}
+		r.versions[s.EventType] = append(r.versions[s.EventType], s)
+	}
+	return r, nil
+}
+
+// Put сохраняет новую версию схемы своего типа и делает её действующей
+func (r *Registry) Put(s Schema) (Schema, error) {
+	s.Attributes = maps.Clone(s.Attributes)
+	if err := s.compile(); err != nil {
+		return Schema{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev := r.versions[s.EventType]
+	s.Version = 1
+	if len(prev) > 0 {
+		s.Version = prev[len(prev)-1].Version + 1
+	}
+	s.CreatedAt = r.now().UTC()
+
+	r.versions[s.EventType] = append(prev, s)
+	if err := r.save(); err != nil {
+		r.versions[s.EventType] = prev
+		return Schema{}, err
+	}
+	return s, nil
+}
+
+// Get возвращает действующую схему типа
+func (r *Registry) Get(eventType string) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.versions[eventType]
+	if len(versions) == 0 {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Version возвращает конкретную версию схемы
+func (r *Registry) Version(eventType string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions, ok := r.versions[eventType]
+	if !ok {
+		return Schema{}, ErrSchemaNotFound
+	}
+	for _, s := range versions {
+		if s.Version == version {
+			return s, nil
+		}
+	}
+	return Schema{}, ErrVersionNotFound
+}
+
+// Versions возвращает все версии схемы типа от старых к новым
+func (r *Registry) Versions(eventType string) ([]Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions, ok := r.versions[eventType]
+	if !ok {
+		return nil, ErrSchemaNotFound
+	}
+	return append([]Schema(nil), versions...), nil
+}
+
+// List возвращает действующие схемы всех типов, упорядоченные по типу
+func (r *Registry) List() []Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]Schema, 0, len(r.versions))
+	for _, versions := range r.versions {
+		result = append(result, versions[len(versions)-1])
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EventType < result[j].EventType })
+	return result
+}
+
+// Delete удаляет все версии схемы типа; события этого типа больше не проверяются
+func (r *Registry) Delete(eventType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, ok := r.versions[eventType]
+	if !ok {
+		return ErrSchemaNotFound
+	}
+	delete(r.versions, eventType)
+	if err := r.save(); err != nil {
+		r.versions[eventType] = prev
+		return err
+	}
+	return nil
+}
+
+// Validate проверяет событие по действующей схеме его типа. События типов
+// без схемы принимаются без проверки. nil *Registry ничего не проверяет.
+func (r *Registry) Validate(event models.Event) error {
+	if r == nil {
+		return nil
+	}
+	s, err := r.Get(event.Type)
+	if err != nil {
+		return nil
+	}
+	return s.Validate(event, r.now())
+}
+
+// save атомарно перезаписывает файл схем; вызывается под r.mu
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	var all []Schema
+	for _, versions := range r.versions {
+		all = append(all, versions...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].EventType != all[j].EventType {
+			return all[i].EventType < all[j].EventType
+		}
+		return all[i].Version < all[j].Version
+	})
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".schemas-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,197 @@
+// Package schema - реестр схем событий: для каждого типа события задаются
+// обязательные атрибуты, диапазон значения, допустимые единицы измерения и
+// допустимое отклонение timestamp. Схемы версионируются.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Duration - time.Duration в JSON в виде строки ("24h")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"24h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Attribute - ограничения одного атрибута события
+type Attribute struct {
+	Required bool `json:"required,omitempty"`
+	// Values - допустимые значения (пусто - любые)
+	Values []string `json:"values,omitempty"`
+	// Pattern - регулярное выражение, которому должно полностью соответствовать значение
+	Pattern string `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Schema - схема типа события. Version и CreatedAt назначает реестр.
+type Schema struct {
+	EventType string `json:"event_type"`
+	Version   int    `json:"version"`
+	// Description - произвольное описание версии
+	Description string               `json:"description,omitempty"`
+	Attributes  map[string]Attribute `json:"attributes,omitempty"`
+	// AdditionalAttributes - разрешены ли атрибуты, не описанные в Attributes
+	// (по умолчанию разрешены)
+	AdditionalAttributes *bool `json:"additional_attributes,omitempty"`
+	// MinValue и MaxValue - допустимый диапазон value (включительно)
+	MinValue *float64 `json:"min_value,omitempty"`
+	MaxValue *float64 `json:"max_value,omitempty"`
+	// Units - допустимые единицы измерения; если заданы, unit обязателен
+	Units []string `json:"units,omitempty"`
+	// MaxPast и MaxFuture - насколько timestamp может отставать от времени
+	// приёма или опережать его
+	MaxPast   Duration  `json:"max_past,omitempty"`
+	MaxFuture Duration  `json:"max_future,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// compile проверяет схему и готовит регулярные выражения
+func (s *Schema) compile() error {
+	if s.EventType == "" {
+		return errors.New("event_type is required")
+	}
+	if s.MinValue != nil && s.MaxValue != nil && *s.MinValue > *s.MaxValue {
+		return errors.New("min_value must not exceed max_value")
+	}
+	if s.MaxPast < 0 || s.MaxFuture < 0 {
+		return errors.New("max_past and max_future must not be negative")
+	}
+	for name, a := range s.Attributes {
+		if name == "" {
+			return errors.New("attribute name must not be empty")
+		}
+		if a.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + a.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("attribute %s: invalid pattern: %w", name, err)
+			}
+			a.re = re
+			s.Attributes[name] = a
+		}
+	}
+	return nil
+}
+
+// FieldError - ошибка проверки одного поля события
+type FieldError struct {
+	// Field - поле события: value, unit, timestamp или attributes.<name>
+	Field string `json:"field"`
+	// Code - машиночитаемый код: required, min, max, enum, pattern, unknown, skew
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError - событие не соответствует схеме своего типа
+type ValidationError struct {
+	EventType string       `json:"event_type"`
+	Version   int          `json:"version"`
+	Errors    []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return fmt.Sprintf("event does not match schema %s v%d: %s", e.EventType, e.Version, strings.Join(msgs, "; "))
+}
+
+// IsValidation сообщает, вызвана ли ошибка несоответствием схеме
+func IsValidation(err error) bool {
+	var verr *ValidationError
+	return errors.As(err, &verr)
+}
+
+// Validate проверяет событие; now - время приёма для проверки timestamp
+func (s *Schema) Validate(event models.Event, now time.Time) error {
+	var errs []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.MinValue != nil && event.Value < *s.MinValue {
+		add("value", "min", "must be >= %g", *s.MinValue)
+	}
+	if s.MaxValue != nil && event.Value > *s.MaxValue {
+		add("value", "max", "must be <= %g", *s.MaxValue)
+	}
+
+	if len(s.Units) > 0 {
+		switch {
+		case event.Unit == "":
+			add("unit", "required", "is required, one of %s", strings.Join(s.Units, ", "))
+		case !slices.Contains(s.Units, event.Unit):
+			add("unit", "enum", "%q is not one of %s", event.Unit, strings.Join(s.Units, ", "))
+		}
+	}
+
+	if s.MaxPast > 0 && event.Timestamp.Before(now.Add(-time.Duration(s.MaxPast))) {
+		add("timestamp", "skew", "is more than %v in the past", time.Duration(s.MaxPast))
+	}
+	if s.MaxFuture > 0 && event.Timestamp.After(now.Add(time.Duration(s.MaxFuture))) {
+		add("timestamp", "skew", "is more than %v in the future", time.Duration(s.MaxFuture))
+	}
+
+	names := make([]string, 0, len(s.Attributes))
+	for name := range s.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := s.Attributes[name]
+		field := "attributes." + name
+		v, ok := event.Attributes[name]
+		switch {
+		case !ok:
+			if a.Required {
+				add(field, "required", "is required")
+			}
+		case len(a.Values) > 0 && !slices.Contains(a.Values, v):
+			add(field, "enum", "%q is not one of %s", v, strings.Join(a.Values, ", "))
+		case a.re != nil && !a.re.MatchString(v):
+			add(field, "pattern", "%q does not match %s", v, a.Pattern)
+		}
+	}
+
+	if s.AdditionalAttributes != nil && !*s.AdditionalAttributes {
+		var unknown []string
+		for name := range event.Attributes {
+			if _, ok := s.Attributes[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			add("attributes."+name, "unknown", "is not allowed by the schema")
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{EventType: s.EventType, Version: s.Version, Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func purchaseSchema(t *testing.T) Schema {
+	t.Helper()
+	var s Schema
+	err := json.Unmarshal([]byte(`{
+		"event_type": "purchase",
+		"attributes": {
+			"country": {"required": true, "pattern": "[A-Z]{2}"},
+			"platform": {"values": ["ios", "android", "web"]}
+		},
+		"additional_attributes": false,
+		"min_value": 0,
+		"max_value": 10000,
+		"units": ["USD", "EUR"],
+		"max_past": "24h",
+		"max_future": "5m"
+	}`), &s)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return s
+}
+
+func TestSchema_Validate(t *testing.T) {
+	s := purchaseSchema(t)
+	if err := s.compile(); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+
+	valid := models.Event{Type: "purchase", UserID: "u1", Value: 10, Unit: "USD", Timestamp: now,
+		Attributes: map[string]string{"country": "RU", "platform": "ios"}}
+	if err := s.Validate(valid, now); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := models.Event{Type: "purchase", UserID: "u1", Value: -1, Unit: "GBP", Timestamp: now.Add(-48 * time.Hour),
+		Attributes: map[string]string{"country": "russia", "platform": "tv", "debug": "1"}}
+	err := s.Validate(invalid, now)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, fe := range verr.Errors {
+		got[fe.Field] = fe.Code
+	}
+	want := map[string]string{
+		"value": "min", "unit": "enum", "timestamp": "skew",
+		"attributes.country": "pattern", "attributes.platform": "enum", "attributes.debug": "unknown",
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("Expected %s error for %s, got %q (all: %+v)", code, field, got[field], verr.Errors)
+		}
+	}
+
+	missing := models.Event{Type: "purchase", UserID: "u1", Value: 1, Timestamp: now.Add(time.Hour)}
+	if err := s.Validate(missing, now); !errors.As(err, &verr) || len(verr.Errors) != 3 {
+		t.Errorf("Expected unit, country and future skew errors, got %v", err)
+	}
+}
+
+func TestRegistry_VersionsAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	r, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+
+	s := purchaseSchema(t)
+	v1, err := r.Put(s)
+	if err != nil || v1.Version != 1 {
+		t.Fatalf("Unexpected first version: %+v, %v", v1, err)
+	}
+	limit := 50.0
+	s.MaxValue = &limit
+	if v2, _ := r.Put(s); v2.Version != 2 {
+		t.Errorf("Expected version 2, got %d", v2.Version)
+	}
+	if _, err := r.Put(Schema{EventType: "bad", Attributes: map[string]Attribute{"a": {Pattern: "("}}}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+
+	r, err = LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	r.now = func() time.Time { return now }
+	event := models.Event{Type: "purchase", UserID: "u1", Value: 100, Unit: "USD", Timestamp: now,
+		Attributes: map[string]string{"country": "RU"}}
+	if err := r.Validate(event); !IsValidation(err) {
+		t.Errorf("Expected v2 max_value to apply after reload, got %v", err)
+	}
+	if old, err := r.Version("purchase", 1); err != nil || old.Validate(event, now) != nil {
+		t.Errorf("Expected v1 to accept the event, got %v", err)
+	}
+	if versions, _ := r.Versions("purchase"); len(versions) != 2 {
+		t.Errorf("Expected 2 versions, got %d", len(versions))
+	}
+
+	if err := r.Validate(models.Event{Type: "click", UserID: "u1"}); err != nil {
+		t.Errorf("Expected events without schema to pass, got %v", err)
+	}
+	if err := r.Delete("purchase"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := r.Get("purchase"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+	}
+}
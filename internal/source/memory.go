@@ -0,0 +1,142 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrAlreadyAcknowledged - повторный Ack/Nack одного сообщения
+var ErrAlreadyAcknowledged = errors.New("message already acknowledged")
+
+// MemoryQueue - очередь в памяти процесса; эталонная реализация Source.
+// Nack возвращает сообщение в конец очереди.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	queue    []*memoryMessage
+	inFlight int
+	closed   bool
+	// notify получает сигнал при появлении сообщений или закрытии
+	notify chan struct{}
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{notify: make(chan struct{}, 1)}
+}
+
+// Publish добавляет сообщение в очередь
+func (q *MemoryQueue) Publish(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.queue = append(q.queue, &memoryMessage{queue: q, data: data})
+	q.signal()
+	return nil
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context) (Message, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if len(q.queue) > 0 {
+			msg := q.queue[0]
+			q.queue = q.queue[1:]
+			q.inFlight++
+			msg.deliveries++
+			msg.done = false
+			if len(q.queue) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return msg, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Len возвращает число сообщений, ожидающих доставки
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+// InFlight возвращает число доставленных, но ещё не подтверждённых сообщений
+func (q *MemoryQueue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inFlight
+}
+
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+	return nil
+}
+
+// signal будит ожидающий Receive; вызывается под q.mu
+func (q *MemoryQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+type memoryMessage struct {
+	queue      *MemoryQueue
+	data       []byte
+	deliveries int
+	done       bool
+}
+
+func (m *memoryMessage) Data() []byte {
+	return m.data
+}
+
+// Deliveries возвращает номер доставки сообщения (1 - первая)
+func (m *memoryMessage) Deliveries() int {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	return m.deliveries
+}
+
+func (m *memoryMessage) Ack() error {
+	q := m.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if m.done {
+		return ErrAlreadyAcknowledged
+	}
+	m.done = true
+	q.inFlight--
+	return nil
+}
+
+func (m *memoryMessage) Nack() error {
+	q := m.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if m.done {
+		return ErrAlreadyAcknowledged
+	}
+	m.done = true
+	q.inFlight--
+	if !q.closed {
+		q.queue = append(q.queue, m)
+		q.signal()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Тела подтверждений в протоколе JetStream
+var (
+	ackBody  = []byte("+ACK")
+	nackBody = []byte("-NAK")
+)
+
+// NATSConfig - параметры подключения к NATS
+type NATSConfig struct {
+	URL     string `json:"url"`
+	Subject string `json:"subject"`
+	// Queue - группа очереди: сообщение получает один из экземпляров агрегатора
+	Queue string `json:"queue,omitempty"`
+	// PendingLimit - максимум сообщений в буфере подписки (по умолчанию 65536)
+	PendingLimit int `json:"pending_limit,omitempty"`
+}
+
+// NATSSource читает сообщения из subject NATS. Подтверждения отправляются
+// ответом на reply-subject сообщения ("+ACK" / "-NAK"), как принято для
+// push-консьюмеров JetStream; при доставке в push-консьюмер JetStream это
+// даёт доставку "как минимум один раз". Сообщения core NATS без reply-subject
+// подтверждать некуда - для них Ack и Nack ничего не делают.
+type NATSSource struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// DialNATS подключается к серверу и подписывается на cfg.Subject
+func DialNATS(cfg NATSConfig, opts ...nats.Option) (*NATSSource, error) {
+	if cfg.Subject == "" {
+		return nil, errors.New("nats subject is required")
+	}
+
+	nc, err := nats.Connect(cfg.URL, append([]nats.Option{nats.Name("event-aggregator")}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+
+	var sub *nats.Subscription
+	if cfg.Queue != "" {
+		sub, err = nc.QueueSubscribeSync(cfg.Subject, cfg.Queue)
+	} else {
+		sub, err = nc.SubscribeSync(cfg.Subject)
+	}
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats subscribe: %w", err)
+	}
+
+	limit := cfg.PendingLimit
+	if limit == 0 {
+		limit = 65536
+	}
+	sub.SetPendingLimits(limit, -1)
+
+	return &NATSSource{conn: nc, sub: sub}, nil
+}
+
+func (s *NATSSource) Receive(ctx context.Context) (Message, error) {
+	msg, err := s.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		if errors.Is(err, nats.ErrBadSubscription) || errors.Is(err, nats.ErrConnectionClosed) {
+			return nil, ErrClosed
+		}
+		return nil, err
+	}
+	return &natsMessage{msg: msg}, nil
+}
+
+// Close отписывается и закрывает соединение; неподтверждённые сообщения
+// JetStream доставит повторно после истечения AckWait
+func (s *NATSSource) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+type natsMessage struct {
+	msg *nats.Msg
+}
+
+func (m *natsMessage) Data() []byte {
+	return m.msg.Data
+}
+
+func (m *natsMessage) Ack() error {
+	return m.respond(ackBody)
+}
+
+func (m *natsMessage) Nack() error {
+	return m.respond(nackBody)
+}
+
+func (m *natsMessage) respond(body []byte) error {
+	if m.msg.Reply == "" {
+		return nil
+	}
+	return m.msg.Respond(body)
+}
@@ -0,0 +1,228 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const standInAckPrefix = "$JS.ACK.standin."
+
+// natsStandIn - минимальный сервер протокола NATS для тестов: принимает одного
+// клиента, доставляет сообщения с reply-subject в стиле JetStream и повторно
+// отправляет сообщение, на которое ответили "-NAK".
+type natsStandIn struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	w       *bufio.Writer
+	sids    map[string]string
+	pending map[int][]byte
+	subject map[int]string
+	nextID  int
+	acks    int
+	naks    int
+}
+
+func newNATSStandIn(t *testing.T) *natsStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := &natsStandIn{
+		ln:      ln,
+		sids:    make(map[string]string),
+		pending: make(map[int][]byte),
+		subject: make(map[int]string),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *natsStandIn) URL() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+func (s *natsStandIn) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.w = bufio.NewWriter(conn)
+	fmt.Fprintf(s.w, "INFO {\"server_id\":\"standin\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+	s.w.Flush()
+	s.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			s.write("PONG\r\n")
+		case "SUB":
+			s.mu.Lock()
+			s.sids[fields[1]] = fields[len(fields)-1]
+			s.mu.Unlock()
+		case "PUB":
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.handlePub(fields[1], string(payload[:n]))
+		}
+	}
+}
+
+func (s *natsStandIn) handlePub(subject, body string) {
+	if !strings.HasPrefix(subject, standInAckPrefix) {
+		return
+	}
+	id, _ := strconv.Atoi(strings.TrimPrefix(subject, standInAckPrefix))
+
+	s.mu.Lock()
+	data, ok := s.pending[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	subj := s.subject[id]
+	if body == "+ACK" {
+		s.acks++
+		delete(s.pending, id)
+		delete(s.subject, id)
+		s.mu.Unlock()
+		return
+	}
+	s.naks++
+	s.mu.Unlock()
+	s.send(subj, id, data)
+}
+
+func (s *natsStandIn) write(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.WriteString(data)
+	s.w.Flush()
+}
+
+// Publish доставляет сообщение подписчику subject
+func (s *natsStandIn) Publish(subject string, data []byte) {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = data
+	s.subject[id] = subject
+	s.mu.Unlock()
+	s.send(subject, id, data)
+}
+
+func (s *natsStandIn) send(subject string, id int, data []byte) {
+	s.mu.Lock()
+	sid := s.sids[subject]
+	s.mu.Unlock()
+	s.write(fmt.Sprintf("MSG %s %s %s%d %d\r\n%s\r\n", subject, sid, standInAckPrefix, id, len(data), data))
+}
+
+func (s *natsStandIn) subscribed(subject string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sids[subject] != ""
+}
+
+func (s *natsStandIn) counts() (acks, naks, pending int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acks, s.naks, len(s.pending)
+}
+
+func dialStandIn(t *testing.T, s *natsStandIn, subject string) *NATSSource {
+	t.Helper()
+	src, err := DialNATS(NATSConfig{URL: s.URL(), Subject: subject})
+	if err != nil {
+		t.Fatalf("DialNATS failed: %v", err)
+	}
+	t.Cleanup(func() { src.Close() })
+	src.conn.Flush()
+	waitFor(t, "subscription", func() bool { return s.subscribed(subject) })
+	return src
+}
+
+func TestNATSSource_AckNack(t *testing.T) {
+	standIn := newNATSStandIn(t)
+	src := dialStandIn(t, standIn, "events")
+
+	standIn.Publish("events", []byte("payload"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msg, err := src.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	msg.Nack()
+
+	msg, err = src.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive after nack failed: %v", err)
+	}
+	if string(msg.Data()) != "payload" {
+		t.Errorf("Expected redelivered payload, got %q", msg.Data())
+	}
+	msg.Ack()
+
+	waitFor(t, "ack", func() bool { acks, _, _ := standIn.counts(); return acks == 1 })
+	if _, naks, pending := standIn.counts(); naks != 1 || pending != 0 {
+		t.Errorf("Expected 1 nak and nothing pending, got naks=%d pending=%d", naks, pending)
+	}
+}
+
+func TestConsumer_NATS(t *testing.T) {
+	agg := setupAggregator(t)
+	standIn := newNATSStandIn(t)
+	src := dialStandIn(t, standIn, "events.in")
+
+	c := NewConsumer(agg, src, "nats")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	standIn.Publish("events.in", []byte(`{"type":"purchase","user_id":"u1","value":10}`))
+	standIn.Publish("events.in", []byte(`{"broken"`))
+	standIn.Publish("events.in", []byte(`{"type":"purchase","user_id":"u1","value":5}`))
+
+	waitFor(t, "acks", func() bool { acks, _, _ := standIn.counts(); return acks == 3 })
+	if s := c.Stats(); s.Accepted != 2 || s.Rejected != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+	waitFor(t, "aggregate", func() bool {
+		data := agg.GetAggregatedData("u1", "purchase", time.Time{}, time.Time{})
+		return data != nil && data.TotalValue == 15
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+}
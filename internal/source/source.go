@@ -0,0 +1,143 @@
+// Package source - приём событий из брокеров сообщений с подтверждениями.
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// ErrClosed - источник закрыт
+var ErrClosed = errors.New("source closed")
+
+// Message - сообщение из источника. Каждое полученное сообщение должно быть
+// подтверждено (Ack) или возвращено на повторную доставку (Nack) ровно один раз.
+type Message interface {
+	Data() []byte
+	Ack() error
+	Nack() error
+}
+
+// Source - источник сообщений (очередь, брокер)
+type Source interface {
+	// Receive блокирует до следующего сообщения, отмены ctx или закрытия источника
+	Receive(ctx context.Context) (Message, error)
+	Close() error
+}
+
+// ConsumerStats - счётчики работы Consumer
+type ConsumerStats struct {
+	Received uint64 `json:"received"`
+	Accepted uint64 `json:"accepted"`
+	// Rejected - сообщения, которые не удалось разобрать или не прошедшие валидацию;
+	// подтверждаются, чтобы не доставляться бесконечно
+	Rejected uint64 `json:"rejected"`
+	// Nacked - сообщения, возвращённые на повторную доставку
+	Nacked uint64 `json:"nacked"`
+}
+
+// Consumer читает события (JSON models.Event) из источника и передаёт их агрегатору.
+// Сообщение подтверждается только после того, как агрегатор принял событие, иначе
+// возвращается в источник - доставка "как минимум один раз".
+type Consumer struct {
+	aggregator  *aggregator.Aggregator
+	source      Source
+	name        string
+	deadLetters *deadletter.Store
+
+	received, accepted atomic.Uint64
+	rejected, nacked   atomic.Uint64
+}
+
+func NewConsumer(agg *aggregator.Aggregator, src Source, name string) *Consumer {
+	return &Consumer{aggregator: agg, source: src, name: name}
+}
+
+// SetDeadLetters включает сохранение отклонённых сообщений
+func (c *Consumer) SetDeadLetters(dl *deadletter.Store) {
+	c.deadLetters = dl
+}
+
+// Run обрабатывает сообщения до отмены ctx или закрытия источника
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		msg, err := c.source.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		c.received.Add(1)
+		c.handle(msg)
+	}
+}
+
+// Stats возвращает текущие значения счётчиков
+func (c *Consumer) Stats() ConsumerStats {
+	return ConsumerStats{
+		Received: c.received.Load(),
+		Accepted: c.accepted.Load(),
+		Rejected: c.rejected.Load(),
+		Nacked:   c.nacked.Load(),
+	}
+}
+
+func (c *Consumer) handle(msg Message) {
+	var event models.Event
+	err := json.Unmarshal(msg.Data(), &event)
+	if err == nil {
+		err = ingest.Prepare(&event)
+	}
+	if err != nil {
+		// Повторная доставка не исправит некорректное сообщение
+		log.Printf("source %s: rejected message: %v", c.name, err)
+		c.rejected.Add(1)
+		c.deadLetters.Add(c.name, event.Tenant, deadletter.KindRejected, err, msg.Data())
+		c.ack(msg)
+		return
+	}
+
+	err = c.aggregator.ProcessEvent(event)
+	if schema.IsValidation(err) {
+		log.Printf("source %s: rejected message: %v", c.name, err)
+		c.rejected.Add(1)
+		c.deadLetters.AddEvent(c.name, deadletter.KindRejected, err, event)
+		c.ack(msg)
+		return
+	}
+	if errors.Is(err, tenant.ErrQuotaExceeded) {
+		// Повторная доставка сразу же упрётся в ту же квоту: событие сохраняется
+		// в dead-letter для ручного replay
+		c.rejected.Add(1)
+		c.deadLetters.AddEvent(c.name, deadletter.KindFailed, err, event)
+		c.ack(msg)
+		return
+	}
+	if err != nil {
+		log.Printf("source %s: %v, message will be redelivered", c.name, err)
+		c.nacked.Add(1)
+		if err := msg.Nack(); err != nil {
+			log.Printf("source %s: nack failed: %v", c.name, err)
+		}
+		return
+	}
+
+	c.accepted.Add(1)
+	c.ack(msg)
+}
+
+func (c *Consumer) ack(msg Message) {
+	if err := msg.Ack(); err != nil {
+		log.Printf("source %s: ack failed: %v", c.name, err)
+	}
+}
@@ -0,0 +1,105 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+)
+
+func setupAggregator(t *testing.T) *aggregator.Aggregator {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+	return agg
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestMemoryQueue_AckNack(t *testing.T) {
+	q := NewMemoryQueue()
+	q.Publish([]byte("a"))
+	q.Publish([]byte("b"))
+
+	ctx := context.Background()
+	m1, _ := q.Receive(ctx)
+	if string(m1.Data()) != "a" || q.InFlight() != 1 {
+		t.Fatalf("Unexpected state: data=%s in_flight=%d", m1.Data(), q.InFlight())
+	}
+	if err := m1.Nack(); err != nil {
+		t.Fatalf("Nack failed: %v", err)
+	}
+	if err := m1.Ack(); !errors.Is(err, ErrAlreadyAcknowledged) {
+		t.Errorf("Expected ErrAlreadyAcknowledged, got %v", err)
+	}
+
+	// Возвращённое сообщение доставляется после уже ожидающих
+	m2, _ := q.Receive(ctx)
+	m3, _ := q.Receive(ctx)
+	if string(m2.Data()) != "b" || string(m3.Data()) != "a" {
+		t.Errorf("Unexpected order: %s, %s", m2.Data(), m3.Data())
+	}
+	if d := m3.(*memoryMessage).Deliveries(); d != 2 {
+		t.Errorf("Expected second delivery, got %d", d)
+	}
+	m2.Ack()
+	m3.Ack()
+	if q.Len() != 0 || q.InFlight() != 0 {
+		t.Errorf("Expected empty queue, got len=%d in_flight=%d", q.Len(), q.InFlight())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline error, got %v", err)
+	}
+
+	q.Close()
+	if _, err := q.Receive(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestConsumer_MemoryQueue(t *testing.T) {
+	agg := setupAggregator(t)
+	q := NewMemoryQueue()
+	c := NewConsumer(agg, q, "memory")
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	q.Publish([]byte(`{"type":"click","user_id":"u1","value":2}`))
+	q.Publish([]byte(`not json`))
+	q.Publish([]byte(`{"type":"click"}`))
+	q.Publish([]byte(`{"type":"click","user_id":"u1","value":3}`))
+
+	waitFor(t, "messages", func() bool { return c.Stats().Received == 4 && q.InFlight() == 0 })
+	if s := c.Stats(); s.Accepted != 2 || s.Rejected != 2 || s.Nacked != 0 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+
+	waitFor(t, "aggregate", func() bool {
+		data := agg.GetAggregatedData("u1", "click", time.Time{}, time.Time{})
+		return data != nil && data.TotalValue == 5
+	})
+
+	q.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+)
+
+const maxPacketSize = 65535
+
+// Stats - счётчики работы listener
+type Stats struct {
+	// Packets - UDP-датаграммы и строки TCP
+	Packets uint64 `json:"packets"`
+	Lines   uint64 `json:"lines"`
+	Events  uint64 `json:"events"`
+	// ParseErrors - строки, которые не удалось разобрать
+	ParseErrors uint64 `json:"parse_errors"`
+	// Rejected - события, не прошедшие валидацию или не принятые агрегатором
+	Rejected uint64 `json:"rejected"`
+	// Dropped - метрики без подходящего правила при DropUnmapped
+	Dropped uint64 `json:"dropped"`
+	// BadPackets - пакеты, в которых была хотя бы одна ошибка
+	BadPackets uint64 `json:"bad_packets"`
+}
+
+// Listener принимает метрики StatsD по UDP и TCP и передаёт их агрегатору как события
+type Listener struct {
+	aggregator  *aggregator.Aggregator
+	config      Config
+	deadLetters *deadletter.Store
+
+	packets, lines, events atomic.Uint64
+	parseErrors, rejected  atomic.Uint64
+	dropped, badPackets    atomic.Uint64
+
+	mu      sync.Mutex
+	closers map[io.Closer]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+func NewListener(agg *aggregator.Aggregator, cfg Config) *Listener {
+	return &Listener{
+		aggregator: agg,
+		config:     cfg,
+		closers:    make(map[io.Closer]struct{}),
+	}
+}
+
+// SetDeadLetters включает сохранение строк, которые не удалось разобрать или принять
+func (l *Listener) SetDeadLetters(dl *deadletter.Store) {
+	l.deadLetters = dl
+}
+
+// ListenUDP начинает приём датаграмм на addr и возвращает фактический адрес
+func (l *Listener) ListenUDP(addr string) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !l.track(conn) {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("statsd udp read error: %v", err)
+				}
+				return
+			}
+			l.handlePacket(buf[:n])
+		}
+	}()
+
+	log.Printf("StatsD UDP listener on %s", conn.LocalAddr())
+	return conn.LocalAddr(), nil
+}
+
+// ListenTCP начинает приём строк по TCP на addr и возвращает фактический адрес
+func (l *Listener) ListenTCP(addr string) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if !l.track(ln) {
+		ln.Close()
+		return nil, net.ErrClosed
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Printf("statsd tcp accept error: %v", err)
+				}
+				return
+			}
+			if !l.track(conn) {
+				conn.Close()
+				return
+			}
+
+			l.wg.Add(1)
+			go func() {
+				defer l.wg.Done()
+				defer l.untrack(conn)
+				scanner := bufio.NewScanner(conn)
+				scanner.Buffer(make([]byte, 4096), maxPacketSize)
+				for scanner.Scan() {
+					l.handlePacket(scanner.Bytes())
+				}
+			}()
+		}
+	}()
+
+	log.Printf("StatsD TCP listener on %s", ln.Addr())
+	return ln.Addr(), nil
+}
+
+// Close останавливает приём и дожидается завершения обработчиков
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	for c := range l.closers {
+		c.Close()
+	}
+	l.closers = nil
+	l.mu.Unlock()
+
+	l.wg.Wait()
+	return nil
+}
+
+// Stats возвращает текущие значения счётчиков
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Packets:     l.packets.Load(),
+		Lines:       l.lines.Load(),
+		Events:      l.events.Load(),
+		ParseErrors: l.parseErrors.Load(),
+		Rejected:    l.rejected.Load(),
+		Dropped:     l.dropped.Load(),
+		BadPackets:  l.badPackets.Load(),
+	}
+}
+
+// handlePacket обрабатывает пакет из одной или нескольких строк
+func (l *Listener) handlePacket(data []byte) {
+	l.packets.Add(1)
+
+	bad := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		l.lines.Add(1)
+		if !l.handleLine(string(line)) {
+			bad = true
+		}
+	}
+
+	if bad {
+		l.badPackets.Add(1)
+	}
+}
+
+func (l *Listener) handleLine(line string) bool {
+	m, err := ParseLine(line)
+	if err != nil {
+		l.parseErrors.Add(1)
+		l.deadLetters.Add("statsd", "", deadletter.KindRejected, err, []byte(line))
+		return false
+	}
+
+	event, ok := l.config.ToEvent(m)
+	if !ok {
+		l.dropped.Add(1)
+		return true
+	}
+
+	if err := ingest.Prepare(&event); err != nil {
+		l.rejected.Add(1)
+		l.deadLetters.Add("statsd", "", deadletter.KindRejected, err, []byte(line))
+		return false
+	}
+	if err := l.aggregator.ProcessEvent(event); err != nil {
+		kind := deadletter.KindFailed
+		if schema.IsValidation(err) {
+			kind = deadletter.KindRejected
+		}
+		l.rejected.Add(1)
+		l.deadLetters.AddEvent("statsd", kind, err, event)
+		return false
+	}
+
+	l.events.Add(1)
+	return true
+}
+
+func (l *Listener) track(c io.Closer) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.closers[c] = struct{}{}
+	return true
+}
+
+func (l *Listener) untrack(c io.Closer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closers != nil {
+		delete(l.closers, c)
+	}
+	c.Close()
+}
@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+const (
+	defaultUserIDTag = "user_id"
+	defaultUserID    = "statsd"
+)
+
+// Mapping сопоставляет метрики событиям. Match - имя метрики или шаблон
+// в синтаксисе path.Match, например "checkout.*".
+type Mapping struct {
+	Match string `json:"match"`
+	// EventType - тип события; по умолчанию имя метрики
+	EventType string `json:"event_type,omitempty"`
+	// UserIDTag - тег, из которого берётся user_id (по умолчанию "user_id")
+	UserIDTag string `json:"user_id_tag,omitempty"`
+	// UserID - user_id, если тега нет
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Config - правила преобразования метрик; применяется первое подходящее правило
+type Config struct {
+	Mappings []Mapping `json:"mappings"`
+	// DefaultUserID - user_id для метрик без тега и без user_id в правиле
+	DefaultUserID string `json:"default_user_id,omitempty"`
+	// DropUnmapped - отбрасывать метрики, не подходящие ни под одно правило
+	DropUnmapped bool `json:"drop_unmapped,omitempty"`
+}
+
+// LoadConfig читает правила из JSON-файла
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	for _, m := range cfg.Mappings {
+		if _, err := path.Match(m.Match, ""); err != nil {
+			return cfg, fmt.Errorf("invalid match pattern %q: %w", m.Match, err)
+		}
+	}
+	return cfg, nil
+}
+
+// ToEvent преобразует метрику в событие. ok == false - метрика отброшена
+// (DropUnmapped и ни одно правило не подошло).
+func (c Config) ToEvent(m Metric) (event models.Event, ok bool) {
+	var rule Mapping
+	matched := false
+	for _, mapping := range c.Mappings {
+		if match, _ := path.Match(mapping.Match, m.Name); match {
+			rule, matched = mapping, true
+			break
+		}
+	}
+	if !matched && c.DropUnmapped {
+		return event, false
+	}
+
+	userTag := rule.UserIDTag
+	if userTag == "" {
+		userTag = defaultUserIDTag
+	}
+
+	event.Type = m.Name
+	if rule.EventType != "" {
+		event.Type = rule.EventType
+	}
+
+	switch {
+	case m.Tags[userTag] != "":
+		event.UserID = m.Tags[userTag]
+	case rule.UserID != "":
+		event.UserID = rule.UserID
+	case c.DefaultUserID != "":
+		event.UserID = c.DefaultUserID
+	default:
+		event.UserID = defaultUserID
+	}
+
+	event.Value = m.Value
+	if m.Type == Counter {
+		// Счётчик с частотой сэмплирования восстанавливаем до полного значения
+		event.Value = m.Value / m.SampleRate
+	}
+
+	event.Attributes = map[string]string{
+		"statsd_metric": m.Name,
+		"statsd_type":   m.Type,
+	}
+	for k, v := range m.Tags {
+		if k != userTag {
+			event.Attributes[k] = v
+		}
+	}
+	return event, true
+}
@@ -0,0 +1,88 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Типы метрик StatsD
+const (
+	Counter   = "c"
+	Gauge     = "g"
+	Timer     = "ms"
+	Histogram = "h"
+	Distrib   = "d"
+)
+
+// Metric - одна разобранная строка StatsD/DogStatsD
+type Metric struct {
+	Name       string
+	Value      float64
+	Type       string
+	SampleRate float64
+	Tags       map[string]string
+}
+
+// ParseLine разбирает строку вида
+//
+//	name:value|type[|@sample_rate][|#tag1:value1,tag2]
+//
+// Поддерживаются счётчики, gauge, таймеры, гистограммы и distribution.
+func ParseLine(line string) (Metric, error) {
+	m := Metric{SampleRate: 1}
+
+	nameValue, rest, ok := strings.Cut(line, "|")
+	if !ok {
+		return m, fmt.Errorf("missing metric type in %q", line)
+	}
+	name, value, ok := strings.Cut(nameValue, ":")
+	if !ok || name == "" {
+		return m, fmt.Errorf("missing metric name or value in %q", line)
+	}
+	m.Name = name
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return m, fmt.Errorf("invalid value %q", value)
+	}
+	m.Value = v
+
+	sections := strings.Split(rest, "|")
+	m.Type = sections[0]
+	switch m.Type {
+	case Counter, Gauge, Timer, Histogram, Distrib:
+	default:
+		return m, fmt.Errorf("unsupported metric type %q", m.Type)
+	}
+
+	for _, section := range sections[1:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("invalid sample rate %q", section)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			m.Tags = parseTags(section[1:])
+		default:
+			// Прочие расширения DogStatsD (c:container, T timestamp) игнорируем
+		}
+	}
+
+	return m, nil
+}
+
+// parseTags разбирает теги "k1:v1,k2"; тег без значения получает пустую строку
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		tags[k] = v
+	}
+	return tags
+}
@@ -0,0 +1,178 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	m, err := ParseLine("checkout.amount:12.5|ms|@0.5|#user_id:u1,region:eu,canary")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Name != "checkout.amount" || m.Value != 12.5 || m.Type != Timer || m.SampleRate != 0.5 {
+		t.Errorf("Unexpected metric: %+v", m)
+	}
+	if m.Tags["user_id"] != "u1" || m.Tags["region"] != "eu" {
+		t.Errorf("Unexpected tags: %+v", m.Tags)
+	}
+	if _, ok := m.Tags["canary"]; !ok {
+		t.Error("Expected value-less tag to be present")
+	}
+
+	for _, line := range []string{
+		"no_type:1",
+		":1|c",
+		"name:abc|c",
+		"name:1|s",
+		"name:1|c|@2",
+	} {
+		if _, err := ParseLine(line); err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func TestConfig_ToEvent(t *testing.T) {
+	cfg := Config{
+		Mappings: []Mapping{
+			{Match: "checkout.*", EventType: "purchase", UserIDTag: "customer"},
+			{Match: "login", UserID: "auth-service"},
+		},
+	}
+
+	e, ok := cfg.ToEvent(Metric{Name: "checkout.eu", Value: 3, Type: Counter, SampleRate: 0.1,
+		Tags: map[string]string{"customer": "c42", "region": "eu"}})
+	if !ok {
+		t.Fatal("Expected metric to be mapped")
+	}
+	if e.Type != "purchase" || e.UserID != "c42" || e.Value != 30 {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+	if e.Attributes["region"] != "eu" || e.Attributes["statsd_type"] != Counter {
+		t.Errorf("Unexpected attributes: %+v", e.Attributes)
+	}
+	if _, ok := e.Attributes["customer"]; ok {
+		t.Error("User tag should not be copied to attributes")
+	}
+
+	e, _ = cfg.ToEvent(Metric{Name: "login", Value: 1, Type: Counter, SampleRate: 1})
+	if e.UserID != "auth-service" || e.Type != "login" {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+
+	e, _ = cfg.ToEvent(Metric{Name: "other", Value: 7, Type: Gauge, SampleRate: 0.5})
+	if e.UserID != defaultUserID || e.Value != 7 {
+		t.Errorf("Expected default user and unscaled gauge, got %+v", e)
+	}
+
+	cfg.DropUnmapped = true
+	if _, ok := cfg.ToEvent(Metric{Name: "other", Type: Gauge, SampleRate: 1}); ok {
+		t.Error("Expected unmapped metric to be dropped")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{"mappings":[{"match":"api.*","event_type":"request"}],"drop_unmapped":true}`), 0o644)
+
+	cfg, err := LoadConfig(good)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Mappings) != 1 || !cfg.DropUnmapped {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"mappings":[{"match":"[a"}]}`), 0o644)
+	if _, err := LoadConfig(bad); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func setupListener(t *testing.T, cfg Config) (*Listener, *aggregator.Aggregator) {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+
+	l := NewListener(agg, cfg)
+	t.Cleanup(func() { l.Close() })
+	return l, agg
+}
+
+func waitForStats(t *testing.T, l *Listener, cond func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s := l.Stats(); cond(s) {
+			return s
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Stats condition not met: %+v", l.Stats())
+	return Stats{}
+}
+
+func TestListener_UDP(t *testing.T) {
+	l, agg := setupListener(t, Config{})
+
+	addr, err := l.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("clicks:1|c|#user_id:u1\nclicks:2|c|#user_id:u1\ngarbage"))
+	conn.Write([]byte("latency:15|ms|#user_id:u1"))
+
+	s := waitForStats(t, l, func(s Stats) bool { return s.Packets == 2 })
+	if s.Lines != 4 || s.Events != 3 || s.ParseErrors != 1 || s.BadPackets != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	data := agg.GetAggregatedData("u1", "clicks", time.Time{}, time.Time{})
+	if data == nil || data.Count != 2 || data.TotalValue != 3 {
+		t.Errorf("Unexpected aggregate: %+v", data)
+	}
+}
+
+func TestListener_TCP(t *testing.T) {
+	l, agg := setupListener(t, Config{})
+
+	addr, err := l.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenTCP failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Write([]byte("queue.depth:42|g|#user_id:worker-1\n"))
+	conn.Close()
+
+	waitForStats(t, l, func(s Stats) bool { return s.Events == 1 })
+
+	time.Sleep(100 * time.Millisecond)
+	data := agg.GetAggregatedData("worker-1", "queue.depth", time.Time{}, time.Time{})
+	if data == nil || data.MaxValue != 42 {
+		t.Errorf("Unexpected aggregate: %+v", data)
+	}
+}
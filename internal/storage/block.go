@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"encoding/binary"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// BlockSize - число событий в блоке ColumnarStorage
+const BlockSize = 4096
+
+// dictionary - словарь строк тенанта: user_id, типы, единицы и атрибуты
+// хранятся в столбцах кодами. Код 0 - пустая строка.
+type dictionary struct {
+	codes map[string]uint32
+	strs  []string
+}
+
+func newDictionary() *dictionary {
+	return &dictionary{codes: map[string]uint32{"": 0}, strs: []string{""}}
+}
+
+func (d *dictionary) code(s string) uint32 {
+	if c, ok := d.codes[s]; ok {
+		return c
+	}
+	c := uint32(len(d.strs))
+	d.codes[s] = c
+	d.strs = append(d.strs, s)
+	return c
+}
+
+// lookup возвращает код строки, не добавляя её в словарь
+func (d *dictionary) lookup(s string) (uint32, bool) {
+	c, ok := d.codes[s]
+	return c, ok
+}
+
+// block - столбцы событий тенанта в порядке приёма. Блок дополняется, пока
+// не наберёт BlockSize событий, после чего запечатывается (seal) и больше
+// не меняется.
+type block struct {
+	n            int
+	minTS, maxTS int64
+	// types - коды типов событий блока по возрастанию, для пропуска блоков
+	types []uint32
+	// ids - ID событий подряд, idEnds - конец ID каждого события
+	ids    []byte
+	idEnds []uint32
+	users  []uint32
+	typs   []uint32
+	units  []uint32
+	// ts - разности timestamp (нс) соседних событий в varint
+	ts     []byte
+	lastTS int64
+	// seqs - разности порядковых номеров приёма в uvarint
+	seqs    []byte
+	lastSeq uint64
+	// values - значения в varint, пока все значения блока целые, иначе
+	// float64 по 8 байт
+	values    []byte
+	intValues bool
+	// attrs - у каждого события число атрибутов и пары кодов (имя,
+	// значение) в uvarint, по возрастанию имени
+	attrs []byte
+}
+
+func newBlock() *block {
+	return &block{intValues: true}
+}
+
+func (b *block) full() bool {
+	return b.n >= BlockSize
+}
+
+func (b *block) append(d *dictionary, e *models.Event, seq uint64) {
+	ts := e.Timestamp.UnixNano()
+	if b.n == 0 || ts < b.minTS {
+		b.minTS = ts
+	}
+	if b.n == 0 || ts > b.maxTS {
+		b.maxTS = ts
+	}
+	b.ts = binary.AppendVarint(b.ts, ts-b.lastTS)
+	b.lastTS = ts
+	b.seqs = binary.AppendUvarint(b.seqs, seq-b.lastSeq)
+	b.lastSeq = seq
+
+	b.ids = append(b.ids, e.ID...)
+	b.idEnds = append(b.idEnds, uint32(len(b.ids)))
+	b.users = append(b.users, d.code(e.UserID))
+	typ := d.code(e.Type)
+	b.typs = append(b.typs, typ)
+	if i, ok := slices.BinarySearch(b.types, typ); !ok {
+		b.types = slices.Insert(b.types, i, typ)
+	}
+	b.units = append(b.units, d.code(e.Unit))
+	b.appendValue(e.Value)
+
+	b.attrs = binary.AppendUvarint(b.attrs, uint64(len(e.Attributes)))
+	for _, k := range slices.Sorted(maps.Keys(e.Attributes)) {
+		b.attrs = binary.AppendUvarint(b.attrs, uint64(d.code(k)))
+		b.attrs = binary.AppendUvarint(b.attrs, uint64(d.code(e.Attributes[k])))
+	}
+	b.n++
+}
+
+// isInt сообщает, что значение без потерь хранится целым
+func isInt(v float64) bool {
+	return v == math.Trunc(v) && math.Abs(v) < 1<<53 && !(v == 0 && math.Signbit(v))
+}
+
+func (b *block) appendValue(v float64) {
+	if b.intValues && !isInt(v) {
+		// Первое дробное значение: блок переходит на float64
+		values := make([]byte, 0, 8*(b.n+1))
+		for off := 0; off < len(b.values); {
+			x, k := binary.Varint(b.values[off:])
+			off += k
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(float64(x)))
+		}
+		b.values, b.intValues = values, false
+	}
+	if b.intValues {
+		b.values = binary.AppendVarint(b.values, int64(v))
+	} else {
+		b.values = binary.LittleEndian.AppendUint64(b.values, math.Float64bits(v))
+	}
+}
+
+// seal возвращает запечатанную копию блока без запаса ёмкости столбцов
+func (b *block) seal() *block {
+	sealed := *b
+	sealed.types = slices.Clone(b.types)
+	sealed.ids = slices.Clone(b.ids)
+	sealed.idEnds = slices.Clone(b.idEnds)
+	sealed.users = slices.Clone(b.users)
+	sealed.typs = slices.Clone(b.typs)
+	sealed.units = slices.Clone(b.units)
+	sealed.ts = slices.Clone(b.ts)
+	sealed.seqs = slices.Clone(b.seqs)
+	sealed.values = slices.Clone(b.values)
+	sealed.attrs = slices.Clone(b.attrs)
+	return &sealed
+}
+
+func (b *block) id(i int) []byte {
+	start := uint32(0)
+	if i > 0 {
+		start = b.idEnds[i-1]
+	}
+	return b.ids[start:b.idEnds[i]]
+}
+
+// row - событие блока с декодированными числовыми столбцами; строковые
+// столбцы читаются из блока по индексу i
+type row struct {
+	i     int
+	ts    int64
+	seq   uint64
+	value float64
+	// attrs - закодированные атрибуты события
+	attrs []byte
+}
+
+// blockReader последовательно декодирует события блока
+type blockReader struct {
+	b                              *block
+	row                            row
+	tsOff, seqOff, valOff, attrOff int
+}
+
+func newBlockReader(b *block) *blockReader {
+	return &blockReader{b: b, row: row{i: -1}}
+}
+
+func (r *blockReader) next() bool {
+	b := r.b
+	if r.row.i+1 >= b.n {
+		return false
+	}
+	r.row.i++
+
+	delta, k := binary.Varint(b.ts[r.tsOff:])
+	r.tsOff += k
+	r.row.ts += delta
+	seqDelta, k := binary.Uvarint(b.seqs[r.seqOff:])
+	r.seqOff += k
+	r.row.seq += seqDelta
+
+	if b.intValues {
+		x, k := binary.Varint(b.values[r.valOff:])
+		r.valOff += k
+		r.row.value = float64(x)
+	} else {
+		r.row.value = math.Float64frombits(binary.LittleEndian.Uint64(b.values[r.valOff:]))
+		r.valOff += 8
+	}
+
+	start := r.attrOff
+	count, k := binary.Uvarint(b.attrs[r.attrOff:])
+	r.attrOff += k
+	for j := uint64(0); j < 2*count; j++ {
+		_, k = binary.Uvarint(b.attrs[r.attrOff:])
+		r.attrOff += k
+	}
+	r.row.attrs = b.attrs[start:r.attrOff]
+	return true
+}
+
+// attrCode возвращает код значения атрибута key в закодированных атрибутах
+func attrCode(attrs []byte, key uint32) (uint32, bool) {
+	count, off := binary.Uvarint(attrs)
+	for j := uint64(0); j < count; j++ {
+		k, n := binary.Uvarint(attrs[off:])
+		off += n
+		v, n := binary.Uvarint(attrs[off:])
+		off += n
+		if uint32(k) == key {
+			return uint32(v), true
+		}
+	}
+	return 0, false
+}
+
+// event собирает событие тенанта из строки блока
+func (b *block) event(d *dictionary, tenant string, r *row) models.Event {
+	e := models.Event{
+		ID:        string(b.id(r.i)),
+		Tenant:    tenant,
+		Type:      d.strs[b.typs[r.i]],
+		UserID:    d.strs[b.users[r.i]],
+		Value:     r.value,
+		Unit:      d.strs[b.units[r.i]],
+		Timestamp: time.Unix(0, r.ts).UTC(),
+	}
+	count, off := binary.Uvarint(r.attrs)
+	if count > 0 {
+		e.Attributes = make(map[string]string, count)
+		for j := uint64(0); j < count; j++ {
+			k, n := binary.Uvarint(r.attrs[off:])
+			off += n
+			v, n := binary.Uvarint(r.attrs[off:])
+			off += n
+			e.Attributes[d.strs[k]] = d.strs[v]
+		}
+	}
+	return e
+}
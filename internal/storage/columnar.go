@@ -0,0 +1,657 @@
+package storage
+
+import (
+	"hash/maphash"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/topk"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// ColumnarStorage - хранилище сырых событий в столбцах. События тенанта
+// лежат блоками по BlockSize: строки (user_id, тип, единица, атрибуты)
+// заменены кодами словаря тенанта, timestamp - разностями соседних
+// значений, значения упакованы. Полные блоки неизменяемы; по границам
+// времени и набору типов блоки пропускаются целиком.
+//
+// Запросы декодируют столбцы на лету, поэтому медленнее InMemoryStorage,
+// зато событие занимает в несколько раз меньше памяти. GetEvent находит
+// строку по хешу ID без хранения самих строк ID. Timestamp возвращаются
+// в UTC.
+//
+// Удаление по времени отбрасывает блоки целиком и перекодирует только
+// блоки, пересекающие границу; словарь тенанта пересобирается, когда
+// удалено больше половины событий, закодированных с ним.
+type ColumnarStorage struct {
+	mu      sync.RWMutex
+	tenants map[string]*columns
+	seq     uint64
+}
+
+// idSeed - seed хешей ID в columns.byID
+var idSeed = maphash.MakeSeed()
+
+// columns - события одного тенанта
+type columns struct {
+	dict   *dictionary
+	blocks []*block
+	count  int64
+	// encoded - события, закодированные с dict (включая удалённые)
+	encoded int64
+	// byID - порядковый номер приёма последнего события по 64-битному хешу
+	// его ID; при совпадении хешей разных ID GetEvent перебирает столбцы ID
+	byID map[uint64]uint64
+	// repeated - хеши, встреченные больше одного раза: при удалении
+	// последнего такого события byID ищет предыдущее
+	repeated map[uint64]struct{}
+}
+
+func newColumns() *columns {
+	return &columns{dict: newDictionary(), byID: make(map[uint64]uint64), repeated: make(map[uint64]struct{})}
+}
+
+func NewColumnarStorage() *ColumnarStorage {
+	return &ColumnarStorage{tenants: make(map[string]*columns)}
+}
+
+func (c *columns) add(e *models.Event, seq uint64) {
+	if len(c.blocks) == 0 || c.blocks[len(c.blocks)-1].full() {
+		c.blocks = append(c.blocks, newBlock())
+	}
+	last := len(c.blocks) - 1
+	h := maphash.String(idSeed, e.ID)
+	if _, ok := c.byID[h]; ok {
+		c.repeated[h] = struct{}{}
+	}
+	c.byID[h] = seq
+	c.blocks[last].append(c.dict, e, seq)
+	if c.blocks[last].full() {
+		c.blocks[last] = c.blocks[last].seal()
+	}
+	c.count++
+	c.encoded++
+}
+
+func (s *ColumnarStorage) AddEvent(event models.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.tenants[event.Tenant]
+	if c == nil {
+		c = newColumns()
+		s.tenants[event.Tenant] = c
+	}
+	s.seq++
+	c.add(&event, s.seq)
+}
+
+// columnFilter - отбор событий тенанта; пустые поля не ограничивают выборку
+type columnFilter struct {
+	userID     string
+	eventType  string
+	userPrefix string
+	from, to   time.Time
+	// afterSeq - только события, принятые после события с этим номером
+	afterSeq uint64
+}
+
+func groupColumnFilter(f GroupFilter) columnFilter {
+	return columnFilter{eventType: f.EventType, userPrefix: f.UserPrefix, from: f.From, to: f.To}
+}
+
+// each вызывает fn для событий, прошедших f, в порядке приёма, пока fn
+// возвращает true
+func (c *columns) each(f columnFilter, fn func(b *block, r *row) bool) {
+	var user, typ uint32
+	var ok bool
+	if f.userID != "" {
+		if user, ok = c.dict.lookup(f.userID); !ok {
+			return
+		}
+	}
+	if f.eventType != "" {
+		if typ, ok = c.dict.lookup(f.eventType); !ok {
+			return
+		}
+	}
+	// prefix - совпадение кода словаря с префиксом: 0 - не проверено, 1 - да, -1 - нет
+	var prefix []int8
+	if f.userPrefix != "" {
+		prefix = make([]int8, len(c.dict.strs))
+	}
+	matchPrefix := func(code uint32) bool {
+		if prefix[code] == 0 {
+			prefix[code] = -1
+			if strings.HasPrefix(c.dict.strs[code], f.userPrefix) {
+				prefix[code] = 1
+			}
+		}
+		return prefix[code] == 1
+	}
+	from, to := int64(0), int64(0)
+	if !f.from.IsZero() {
+		from = f.from.UnixNano()
+	}
+	if !f.to.IsZero() {
+		to = f.to.UnixNano()
+	}
+
+	for _, b := range c.blocks {
+		if (!f.from.IsZero() && b.maxTS < from) || (!f.to.IsZero() && b.minTS > to) || b.lastSeq <= f.afterSeq {
+			continue
+		}
+		if f.eventType != "" {
+			if _, found := slices.BinarySearch(b.types, typ); !found {
+				continue
+			}
+		}
+		r := newBlockReader(b)
+		for r.next() {
+			i := r.row.i
+			if (f.userID != "" && b.users[i] != user) ||
+				(f.eventType != "" && b.typs[i] != typ) ||
+				(prefix != nil && !matchPrefix(b.users[i])) ||
+				(!f.from.IsZero() && r.row.ts < from) ||
+				(!f.to.IsZero() && r.row.ts > to) ||
+				r.row.seq <= f.afterSeq {
+				continue
+			}
+			if !fn(b, &r.row) {
+				return
+			}
+		}
+	}
+}
+
+func (s *ColumnarStorage) GetAggregated(tenant, userID, eventType string, from, to time.Time) *models.AggregatedData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.tenants[tenant]
+	if c == nil {
+		return nil
+	}
+	var a accumulator
+	c.each(columnFilter{userID: userID, eventType: eventType, from: from, to: to}, func(b *block, r *row) bool {
+		a.addValue(r.value, time.Unix(0, r.ts).UTC())
+		return true
+	})
+	if a.data.Count == 0 {
+		return nil
+	}
+
+	agg := a.data
+	agg.Tenant, agg.UserID, agg.EventType = tenant, userID, eventType
+	agg.AvgValue = agg.TotalValue / float64(agg.Count)
+	return &agg
+}
+
+func (s *ColumnarStorage) GetAllAggregated(tenant string) []models.AggregatedData {
+	return s.GetGroupedAggregated(tenant, GroupFilter{})
+}
+
+func (s *ColumnarStorage) GetGroupedAggregated(tenant string, filter GroupFilter) []models.AggregatedData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.tenants[tenant]
+	if c == nil {
+		return make([]models.AggregatedData, 0)
+	}
+	type key struct{ user, typ uint32 }
+	accs := make(map[key]*accumulator)
+	c.each(groupColumnFilter(filter), func(b *block, r *row) bool {
+		k := key{b.users[r.i], b.typs[r.i]}
+		a := accs[k]
+		if a == nil {
+			a = &accumulator{}
+			accs[k] = a
+		}
+		a.addValue(r.value, time.Unix(0, r.ts).UTC())
+		return true
+	})
+
+	result := make([]models.AggregatedData, 0, len(accs))
+	for k, a := range accs {
+		agg := a.data
+		agg.Tenant, agg.UserID, agg.EventType = tenant, c.dict.strs[k.user], c.dict.strs[k.typ]
+		agg.AvgValue = agg.TotalValue / float64(agg.Count)
+		result = append(result, agg)
+	}
+	return result
+}
+
+func (s *ColumnarStorage) Rollup(tenant string, by Dimension, filter GroupFilter) []Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Group, 0)
+	c := s.tenants[tenant]
+	if c == nil {
+		return result
+	}
+	// value - код значения измерения в строке блока
+	var value func(b *block, r *row) (uint32, bool)
+	switch by {
+	case DimensionUser:
+		value = func(b *block, r *row) (uint32, bool) { return b.users[r.i], true }
+	case DimensionType:
+		value = func(b *block, r *row) (uint32, bool) { return b.typs[r.i], true }
+	default:
+		name, ok := c.dict.lookup(strings.TrimPrefix(string(by), attributePrefix))
+		if !ok {
+			return result
+		}
+		value = func(b *block, r *row) (uint32, bool) { return attrCode(r.attrs, name) }
+	}
+
+	accs := make(map[uint32]*accumulator)
+	c.each(groupColumnFilter(filter), func(b *block, r *row) bool {
+		code, ok := value(b, r)
+		if !ok {
+			return true
+		}
+		a := accs[code]
+		if a == nil {
+			a = &accumulator{}
+			accs[code] = a
+		}
+		a.addValue(r.value, time.Unix(0, r.ts).UTC())
+		return true
+	})
+
+	for code, a := range accs {
+		key := c.dict.strs[code]
+		g := Group{Key: key, AggregatedData: a.data}
+		g.Tenant, g.EventType = tenant, filter.EventType
+		switch by {
+		case DimensionUser:
+			g.UserID = key
+		case DimensionType:
+			g.EventType = key
+		}
+		g.AvgValue = g.TotalValue / float64(g.Count)
+		result = append(result, g)
+	}
+	return result
+}
+
+// Scan обходит события в порядке приёма
+func (s *ColumnarStorage) Scan(tenant string, filter GroupFilter, fn func(models.Event) bool) {
+	f := groupColumnFilter(filter)
+	for {
+		events, done := s.scanChunk(tenant, f)
+		for _, e := range events {
+			if !fn(e.event) {
+				return
+			}
+		}
+		if done {
+			return
+		}
+		f.afterSeq = events[len(events)-1].seq
+	}
+}
+
+// seqEvent - событие с порядковым номером приёма
+type seqEvent struct {
+	event models.Event
+	seq   uint64
+}
+
+// scanChunk декодирует до scanChunk событий, прошедших f; done - событий
+// после них нет
+func (s *ColumnarStorage) scanChunk(tenant string, f columnFilter) (events []seqEvent, done bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.tenants[tenant]
+	if c == nil {
+		return nil, true
+	}
+	done = true
+	c.each(f, func(b *block, r *row) bool {
+		if len(events) == scanChunk {
+			done = false
+			return false
+		}
+		events = append(events, seqEvent{b.event(c.dict, tenant, r), r.seq})
+		return true
+	})
+	return events, done
+}
+
+func (s *ColumnarStorage) GetEvent(tenant, id string) (models.Event, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.tenants[tenant]
+	if c == nil {
+		return models.Event{}, false
+	}
+	seq, ok := c.byID[maphash.String(idSeed, id)]
+	if !ok {
+		return models.Event{}, false
+	}
+	if b, r, ok := c.find(seq); ok && string(b.id(r.i)) == id {
+		return b.event(c.dict, tenant, r), true
+	}
+
+	// Совпадение хешей разных ID; при повторе ID - последнее принятое событие
+	for bi := len(c.blocks) - 1; bi >= 0; bi-- {
+		b := c.blocks[bi]
+		for i := b.n - 1; i >= 0; i-- {
+			if string(b.id(i)) == id {
+				return c.event(tenant, b, i), true
+			}
+		}
+	}
+	return models.Event{}, false
+}
+
+// find возвращает блок и строку события с порядковым номером seq; блоки
+// упорядочены по номерам приёма
+func (c *columns) find(seq uint64) (*block, *row, bool) {
+	bi := sort.Search(len(c.blocks), func(i int) bool { return c.blocks[i].lastSeq >= seq })
+	if bi == len(c.blocks) {
+		return nil, nil, false
+	}
+	r := newBlockReader(c.blocks[bi])
+	for r.next() {
+		if r.row.seq == seq {
+			return r.b, &r.row, true
+		}
+	}
+	return nil, nil, false
+}
+
+// event декодирует событие блока b со строкой i
+func (c *columns) event(tenant string, b *block, i int) models.Event {
+	r := newBlockReader(b)
+	for r.row.i < i && r.next() {
+	}
+	return b.event(c.dict, tenant, &r.row)
+}
+
+func (s *ColumnarStorage) SearchEvents(tenant string, q EventQuery) (EventPage, error) {
+	var after *eventCursor
+	if q.Cursor != "" {
+		c, err := parseEventCursor(q.Cursor)
+		if err != nil {
+			return EventPage{}, err
+		}
+		after = &c
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := EventPage{Events: []models.Event{}}
+	c := s.tenants[tenant]
+	if c == nil {
+		return page, nil
+	}
+	// Атрибуты запроса в кодах словаря
+	attrs := make(map[uint32]uint32, len(q.Attributes))
+	for k, v := range q.Attributes {
+		kc, ok1 := c.dict.lookup(k)
+		vc, ok2 := c.dict.lookup(v)
+		if !ok1 || !ok2 {
+			return page, nil
+		}
+		attrs[kc] = vc
+	}
+
+	type found struct {
+		b      *block
+		r      row
+		cursor eventCursor
+	}
+	// before - a раньше b в порядке выдачи
+	before := func(a, b found) bool {
+		c := b.cursor.compare(a.cursor.ts, a.cursor.seq)
+		if q.Asc {
+			return c < 0
+		}
+		return c > 0
+	}
+	var all []found
+	var top *topk.Top[found]
+	if q.Limit > 0 {
+		// Лучшие limit+1: лишнее событие означает следующую страницу
+		top = topk.New(q.Limit+1, func(a, b found) bool { return before(b, a) })
+	}
+
+	c.each(columnFilter{userID: q.UserID, eventType: q.EventType, from: q.From, to: q.To}, func(b *block, r *row) bool {
+		if (q.MinValue != nil && r.value < *q.MinValue) || (q.MaxValue != nil && r.value > *q.MaxValue) {
+			return true
+		}
+		for k, v := range attrs {
+			if code, ok := attrCode(r.attrs, k); !ok || code != v {
+				return true
+			}
+		}
+		f := found{b: b, r: *r, cursor: eventCursor{ts: time.Unix(0, r.ts), seq: r.seq}}
+		if after != nil {
+			cmp := after.compare(f.cursor.ts, f.cursor.seq)
+			if (q.Asc && cmp <= 0) || (!q.Asc && cmp >= 0) {
+				return true
+			}
+		}
+		if top != nil {
+			top.Push(f)
+		} else {
+			all = append(all, f)
+		}
+		return true
+	})
+	if top != nil {
+		all = top.Sorted()
+	} else {
+		slices.SortFunc(all, func(a, b found) int {
+			if before(a, b) {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	if q.Limit > 0 && len(all) > q.Limit {
+		all = all[:q.Limit]
+		page.NextCursor = all[len(all)-1].cursor.String()
+	}
+	for _, f := range all {
+		page.Events = append(page.Events, f.b.event(c.dict, tenant, &f.r))
+	}
+	return page, nil
+}
+
+// Snapshot возвращает события всех тенантов в порядке приёма
+func (s *ColumnarStorage) Snapshot() []models.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([][]models.Event, 0, len(s.tenants))
+	seqs := make([][]uint64, 0, len(s.tenants))
+	for tenant, c := range s.tenants {
+		list, seqList := c.snapshot(tenant)
+		events, seqs = append(events, list), append(seqs, seqList)
+	}
+	return mergeBySeq(events, seqs)
+}
+
+func (c *columns) snapshot(tenant string) ([]models.Event, []uint64) {
+	events := make([]models.Event, 0, c.count)
+	seqs := make([]uint64, 0, c.count)
+	c.each(columnFilter{}, func(b *block, r *row) bool {
+		events = append(events, b.event(c.dict, tenant, r))
+		seqs = append(seqs, r.seq)
+		return true
+	})
+	return events, seqs
+}
+
+func (s *ColumnarStorage) Purge() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, c := range s.tenants {
+		n += int(c.count)
+	}
+	s.tenants = make(map[string]*columns)
+	return n
+}
+
+// Delete отбрасывает блоки, все события которых старше before, и
+// перекодирует только блоки, пересекающие границу. Когда удалено больше
+// половины событий, закодированных со словарём, оставшиеся события
+// перекодируются с новым словарём, чтобы не хранить строки удалённых.
+func (s *ColumnarStorage) Delete(tenant string, before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.tenants[tenant]
+	if c == nil {
+		return 0
+	}
+	if before.IsZero() {
+		delete(s.tenants, tenant)
+		return int(c.count)
+	}
+	n := c.deleteBefore(tenant, before.UnixNano())
+	switch {
+	case c.count == 0:
+		delete(s.tenants, tenant)
+	case c.count < c.encoded/2:
+		s.tenants[tenant] = c.reencode(tenant)
+	}
+	return n
+}
+
+// deleteBefore удаляет события с timestamp раньше cutoff (нс) и возвращает
+// их число
+func (c *columns) deleteBefore(tenant string, cutoff int64) int {
+	// lost - хеши повторяющихся ID, чьё последнее событие удалено
+	lost := make(map[uint64]struct{})
+	unlink := func(b *block, r *row) {
+		h := maphash.Bytes(idSeed, b.id(r.i))
+		if c.byID[h] != r.seq {
+			return
+		}
+		delete(c.byID, h)
+		if _, ok := c.repeated[h]; ok {
+			lost[h] = struct{}{}
+		}
+	}
+
+	n := 0
+	kept := c.blocks[:0]
+	for i, b := range c.blocks {
+		switch {
+		case b.minTS >= cutoff:
+			kept = append(kept, b)
+			continue
+		case b.maxTS < cutoff:
+			for r := newBlockReader(b); r.next(); {
+				unlink(b, &r.row)
+			}
+			n += b.n
+			continue
+		}
+		// Блок пересекает границу: оставшиеся события - в новый блок
+		rest := newBlock()
+		for r := newBlockReader(b); r.next(); {
+			if r.row.ts < cutoff {
+				unlink(b, &r.row)
+				n++
+				continue
+			}
+			e := b.event(c.dict, tenant, &r.row)
+			rest.append(c.dict, &e, r.row.seq)
+		}
+		if i < len(c.blocks)-1 {
+			// Дописывается только последний блок
+			rest = rest.seal()
+		}
+		kept = append(kept, rest)
+	}
+	clear(c.blocks[len(kept):])
+	c.blocks = kept
+	c.count -= int64(n)
+
+	if len(lost) > 0 {
+		// Более ранние события с теми же ID могли остаться
+		for _, b := range c.blocks {
+			for r := newBlockReader(b); r.next(); {
+				h := maphash.Bytes(idSeed, b.id(r.row.i))
+				if _, ok := lost[h]; ok {
+					c.byID[h] = r.row.seq
+				}
+			}
+		}
+	}
+	return n
+}
+
+// reencode возвращает события тенанта в новых блоках с новым словарём
+func (c *columns) reencode(tenant string) *columns {
+	kept := newColumns()
+	c.each(columnFilter{}, func(b *block, r *row) bool {
+		e := b.event(c.dict, tenant, r)
+		kept.add(&e, r.seq)
+		return true
+	})
+	return kept
+}
+
+func (s *ColumnarStorage) Count(tenant string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if c := s.tenants[tenant]; c != nil {
+		return c.count
+	}
+	return 0
+}
+
+func (s *ColumnarStorage) Stats() []TenantStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TenantStats, 0, len(s.tenants))
+	for tenant, c := range s.tenants {
+		st := TenantStats{Tenant: tenant, Events: c.count}
+		// Отметки кодов словаря, встреченных как user_id и как тип
+		users := make([]bool, len(c.dict.strs))
+		types := make([]bool, len(c.dict.strs))
+		for i, b := range c.blocks {
+			for _, u := range b.users {
+				if !users[u] {
+					users[u] = true
+					st.Users++
+				}
+			}
+			for _, t := range b.types {
+				if !types[t] {
+					types[t] = true
+					st.EventTypes++
+				}
+			}
+			oldest, newest := time.Unix(0, b.minTS).UTC(), time.Unix(0, b.maxTS).UTC()
+			if i == 0 || oldest.Before(st.Oldest) {
+				st.Oldest = oldest
+			}
+			if i == 0 || newest.After(st.Newest) {
+				st.Newest = newest
+			}
+		}
+		result = append(result, st)
+	}
+	slices.SortFunc(result, func(a, b TenantStats) int { return strings.Compare(a.Tenant, b.Tenant) })
+	return result
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Движки хранилища для Factory
+const (
+	// EngineMemory - ShardedStorage над InMemoryStorage
+	EngineMemory = "memory"
+	// EngineColumnar - ColumnarStorage, компактнее, но медленнее на запросах
+	EngineColumnar = "columnar"
+	// EngineSQLite - SQLiteStorage в файле path
+	EngineSQLite = "sqlite"
+)
+
+// Merger - хранилище, которое при замене результатом replay не заменяется,
+// а дописывает в себя восстановленные события (рабочая база SQLite)
+type Merger interface {
+	// Merge добавляет события src, ID которых нет у их тенанта, и
+	// возвращает их количество
+	Merge(src Storage) (int64, error)
+}
+
+// Factory возвращает рабочее хранилище движка engine ("" - EngineMemory) и
+// конструктор хранилищ, в которые replay загружает архив. Для EngineSQLite
+// рабочая база открывается по пути path, а архив загружается во временную
+// базу рядом с ней (см. openTempSQLite); оставшиеся от прошлых запусков
+// временные базы удаляются.
+func Factory(engine, path string) (Storage, func() (Storage, error), error) {
+	switch engine {
+	case "", EngineMemory:
+		return NewShardedStorage(DefaultShards), func() (Storage, error) { return NewShardedStorage(DefaultShards), nil }, nil
+	case EngineColumnar:
+		return NewColumnarStorage(), func() (Storage, error) { return NewColumnarStorage(), nil }, nil
+	case EngineSQLite:
+		if path == "" {
+			return nil, nil, errors.New("sqlite storage requires a database path")
+		}
+		db, err := OpenSQLite(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		removeTempSQLite(path)
+		return db, func() (Storage, error) { return openTempSQLite(path) }, nil
+	}
+	return nil, nil, fmt.Errorf("unknown storage engine %q: want %s, %s or %s", engine, EngineMemory, EngineColumnar, EngineSQLite)
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// ErrInvalidCursor - курсор поиска событий повреждён
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EventQuery - поиск сырых событий тенанта; пустые поля не ограничивают
+// выборку, границы времени и значения включаются
+type EventQuery struct {
+	UserID    string
+	EventType string
+	From      time.Time
+	To        time.Time
+	// Attributes - атрибуты, которые должны совпадать точно
+	Attributes map[string]string
+	MinValue   *float64
+	MaxValue   *float64
+	// Asc - от старых к новым по timestamp (при равенстве - в порядке
+	// приёма); по умолчанию - от новых
+	Asc bool
+	// Limit - размер страницы; <= 0 - все события
+	Limit int
+	// Cursor - NextCursor предыдущей страницы
+	Cursor string
+}
+
+func (q EventQuery) match(e models.Event) bool {
+	if (q.UserID != "" && e.UserID != q.UserID) ||
+		(q.EventType != "" && e.Type != q.EventType) ||
+		(!q.From.IsZero() && e.Timestamp.Before(q.From)) ||
+		(!q.To.IsZero() && e.Timestamp.After(q.To)) ||
+		(q.MinValue != nil && e.Value < *q.MinValue) ||
+		(q.MaxValue != nil && e.Value > *q.MaxValue) {
+		return false
+	}
+	for k, v := range q.Attributes {
+		if e.Attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// EventPage - страница результатов поиска
+type EventPage struct {
+	Events []models.Event `json:"events"`
+	// NextCursor - курсор следующей страницы; пустой на последней
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (s *InMemoryStorage) GetEvent(tenant, id string) (models.Event, bool) {
+	e, _, ok := s.lookup(tenant, id)
+	return e, ok
+}
+
+// lookup возвращает событие по ID и его порядковый номер
+func (s *InMemoryStorage) lookup(tenant, id string) (models.Event, uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pos, ok := s.index.byID[eventKey{tenant, id}]
+	if !ok {
+		return models.Event{}, 0, false
+	}
+	return s.events[pos], s.seqs[pos], true
+}
+
+// eventCursor - позиция последнего события страницы в порядке
+// (timestamp, порядковый номер приёма)
+type eventCursor struct {
+	ts  time.Time
+	seq uint64
+}
+
+func (c eventCursor) String() string {
+	return strconv.FormatInt(c.ts.Unix(), 36) + "." +
+		strconv.FormatInt(int64(c.ts.Nanosecond()), 36) + "." +
+		strconv.FormatUint(c.seq, 36)
+}
+
+func parseEventCursor(s string) (eventCursor, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return eventCursor{}, ErrInvalidCursor
+	}
+	sec, err1 := strconv.ParseInt(parts[0], 36, 64)
+	nsec, err2 := strconv.ParseInt(parts[1], 36, 64)
+	seq, err3 := strconv.ParseUint(parts[2], 36, 64)
+	if err1 != nil || err2 != nil || err3 != nil || nsec < 0 || nsec >= int64(time.Second) {
+		return eventCursor{}, ErrInvalidCursor
+	}
+	return eventCursor{ts: time.Unix(sec, nsec), seq: seq}, nil
+}
+
+// compare сравнивает позицию события с курсором
+func (c eventCursor) compare(ts time.Time, seq uint64) int {
+	if r := ts.Compare(c.ts); r != 0 {
+		return r
+	}
+	switch {
+	case seq < c.seq:
+		return -1
+	case seq > c.seq:
+		return 1
+	}
+	return 0
+}
+
+func (s *InMemoryStorage) SearchEvents(tenant string, q EventQuery) (EventPage, error) {
+	var after *eventCursor
+	if q.Cursor != "" {
+		c, err := parseEventCursor(q.Cursor)
+		if err != nil {
+			return EventPage{}, err
+		}
+		after = &c
+	}
+
+	page := EventPage{Events: []models.Event{}}
+	events, cursors, more := s.search(tenant, q, after)
+	page.Events = append(page.Events, events...)
+	if more {
+		page.NextCursor = cursors[len(cursors)-1].String()
+	}
+	return page, nil
+}
+
+// search возвращает до q.Limit событий после курсора after (nil - с начала)
+// вместе с их курсорами; more сообщает, что за ними есть ещё события
+func (s *InMemoryStorage) search(tenant string, q EventQuery, after *eventCursor) (events []models.Event, cursors []eventCursor, more bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := s.candidates(tenant, q.UserID, q.EventType, q.From, q.To)
+	n := len(candidates)
+	cmp := func(i int) int {
+		pos := candidates[i]
+		return after.compare(s.events[pos].Timestamp, s.seqs[pos])
+	}
+
+	// Начало страницы: первый кандидат после курсора в порядке обхода
+	start, step := 0, 1
+	if !q.Asc {
+		start, step = n-1, -1
+	}
+	switch {
+	case after != nil && q.Asc:
+		start = sort.Search(n, func(i int) bool { return cmp(i) > 0 })
+	case after != nil:
+		start = sort.Search(n, func(i int) bool { return cmp(i) >= 0 }) - 1
+	}
+
+	for i := start; i >= 0 && i < n; i += step {
+		pos := candidates[i]
+		e := s.events[pos]
+		if !q.match(e) {
+			continue
+		}
+		if q.Limit > 0 && len(events) == q.Limit {
+			return events, cursors, true
+		}
+		events = append(events, e)
+		cursors = append(cursors, eventCursor{ts: e.Timestamp, seq: s.seqs[pos]})
+	}
+	return events, cursors, false
+}
+
+// snapshot возвращает копию событий и их порядковых номеров в порядке приёма
+func (s *InMemoryStorage) snapshot() ([]models.Event, []uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.dead == 0 {
+		return slices.Clone(s.events), slices.Clone(s.seqs)
+	}
+	events := make([]models.Event, 0, len(s.events)-s.dead)
+	seqs := make([]uint64, 0, len(s.events)-s.dead)
+	for i, seq := range s.seqs {
+		if seq != 0 {
+			events = append(events, s.events[i])
+			seqs = append(seqs, seq)
+		}
+	}
+	return events, seqs
+}
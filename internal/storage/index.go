@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// eventIndex - индексы InMemoryStorage. Списки позиций событий тенанта,
+// пользователя и типа упорядочены по timestamp, при равенстве - по порядку
+// приёма, поэтому выборка за интервал времени - два бинарных поиска по
+// самому короткому подходящему списку. byID указывает на последнее событие
+// с данным ID, olderIDs - позиции более ранних событий с тем же ID (только
+// для повторяющихся ID), в порядке приёма.
+//
+// Удаление по времени отрезает префиксы списков; позиции событий при этом
+// не меняются до уплотнения (compact).
+type eventIndex struct {
+	byID     map[eventKey]int
+	olderIDs map[eventKey][]int
+	byTenant map[string][]int
+	byUser   map[eventKey][]int
+	byType   map[eventKey][]int
+}
+
+// eventKey - значение поля в пределах тенанта
+type eventKey struct {
+	tenant string
+	value  string
+}
+
+func newEventIndex() eventIndex {
+	return eventIndex{
+		byID:     make(map[eventKey]int),
+		olderIDs: make(map[eventKey][]int),
+		byTenant: make(map[string][]int),
+		byUser:   make(map[eventKey][]int),
+		byType:   make(map[eventKey][]int),
+	}
+}
+
+// indexEvent добавляет в индекс событие с позицией pos
+func (s *InMemoryStorage) indexEvent(pos int) {
+	e := &s.events[pos]
+	user, typ := eventKey{e.Tenant, e.UserID}, eventKey{e.Tenant, e.Type}
+	id := eventKey{e.Tenant, e.ID}
+	if prev, ok := s.index.byID[id]; ok {
+		s.index.olderIDs[id] = append(s.index.olderIDs[id], prev)
+	}
+	s.index.byID[id] = pos
+	s.index.byTenant[e.Tenant] = s.insert(s.index.byTenant[e.Tenant], pos)
+	s.index.byUser[user] = s.insert(s.index.byUser[user], pos)
+	s.index.byType[typ] = s.insert(s.index.byType[typ], pos)
+}
+
+// insert вставляет позицию только что принятого события в список. События
+// обычно приходят по порядку времени, и вставка сводится к добавлению в конец.
+func (s *InMemoryStorage) insert(list []int, pos int) []int {
+	ts := s.events[pos].Timestamp
+	if len(list) == 0 || !ts.Before(s.events[list[len(list)-1]].Timestamp) {
+		return append(list, pos)
+	}
+	i := sort.Search(len(list), func(i int) bool { return s.events[list[i]].Timestamp.After(ts) })
+	return slices.Insert(list, i, pos)
+}
+
+// indexBefore - число событий списка с timestamp раньше before
+func (s *InMemoryStorage) indexBefore(list []int, before time.Time) int {
+	return sort.Search(len(list), func(i int) bool { return !s.events[list[i]].Timestamp.Before(before) })
+}
+
+// trimBefore отрезает от списка события с timestamp раньше before (нулевое
+// before - все события)
+func (s *InMemoryStorage) trimBefore(list []int, before time.Time) []int {
+	if before.IsZero() {
+		return nil
+	}
+	return list[s.indexBefore(list, before):]
+}
+
+// unlinkIDs убирает из byID и olderIDs позиции удалённых событий с ID из
+// ids; byID переходит на последнее оставшееся событие с тем же ID
+func (s *InMemoryStorage) unlinkIDs(ids map[eventKey]struct{}) {
+	for k := range ids {
+		older := slices.DeleteFunc(s.index.olderIDs[k], func(pos int) bool { return s.seqs[pos] == 0 })
+		if pos, ok := s.index.byID[k]; ok && s.seqs[pos] == 0 {
+			if len(older) == 0 {
+				delete(s.index.byID, k)
+			} else {
+				s.index.byID[k], older = older[len(older)-1], older[:len(older)-1]
+			}
+		}
+		if len(older) == 0 {
+			delete(s.index.olderIDs, k)
+		} else {
+			s.index.olderIDs[k] = older
+		}
+	}
+}
+
+// dropEmpty удаляет из индекса опустевшие списки
+func (s *InMemoryStorage) dropEmpty(tenant string, users, types map[eventKey]struct{}) {
+	if len(s.index.byTenant[tenant]) == 0 {
+		delete(s.index.byTenant, tenant)
+	}
+	for k := range users {
+		if len(s.index.byUser[k]) == 0 {
+			delete(s.index.byUser, k)
+		}
+	}
+	for k := range types {
+		if len(s.index.byType[k]) == 0 {
+			delete(s.index.byType, k)
+		}
+	}
+}
+
+// compact убирает позиции удалённых событий и пересчитывает позиции в
+// индексе, сохраняя порядок списков
+func (s *InMemoryStorage) compact() {
+	remap := make([]int, len(s.events))
+	n := 0
+	for i := range s.events {
+		if s.seqs[i] == 0 {
+			continue
+		}
+		remap[i] = n
+		s.events[n], s.seqs[n] = s.events[i], s.seqs[i]
+		n++
+	}
+	clear(s.events[n:])
+	s.events, s.seqs = s.events[:n], s.seqs[:n]
+	s.dead = 0
+
+	// Новые списки не удерживают отрезанные префиксы старых
+	move := func(list []int) []int {
+		moved := make([]int, len(list))
+		for i, pos := range list {
+			moved[i] = remap[pos]
+		}
+		return moved
+	}
+	for k, list := range s.index.byTenant {
+		s.index.byTenant[k] = move(list)
+	}
+	for k, list := range s.index.byUser {
+		s.index.byUser[k] = move(list)
+	}
+	for k, list := range s.index.byType {
+		s.index.byType[k] = move(list)
+	}
+	for k, pos := range s.index.byID {
+		s.index.byID[k] = remap[pos]
+	}
+	for k, list := range s.index.olderIDs {
+		s.index.olderIDs[k] = move(list)
+	}
+}
+
+// candidates возвращает самый короткий список позиций, содержащий все
+// события тенанта с данными user_id и типом (пустые - любые), сужённый до
+// интервала [from, to]
+func (s *InMemoryStorage) candidates(tenant, userID, eventType string, from, to time.Time) []int {
+	list := s.index.byTenant[tenant]
+	if userID != "" {
+		list = s.index.byUser[eventKey{tenant, userID}]
+	}
+	if eventType != "" {
+		if byType := s.index.byType[eventKey{tenant, eventType}]; userID == "" || len(byType) < len(list) {
+			list = byType
+		}
+	}
+
+	lo, hi := 0, len(list)
+	if !from.IsZero() {
+		lo = sort.Search(len(list), func(i int) bool { return !s.events[list[i]].Timestamp.Before(from) })
+	}
+	if !to.IsZero() {
+		hi = sort.Search(len(list), func(i int) bool { return s.events[list[i]].Timestamp.After(to) })
+	}
+	if lo >= hi {
+		return nil
+	}
+	return list[lo:hi]
+}
+
+// each вызывает fn для событий тенанта, прошедших filter, в порядке времени,
+// пока fn возвращает true
+func (s *InMemoryStorage) each(tenant string, filter GroupFilter, fn func(e *models.Event) bool) {
+	for _, pos := range s.candidates(tenant, "", filter.EventType, filter.From, filter.To) {
+		e := &s.events[pos]
+		if filter.match(*e) && !fn(e) {
+			return
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Dimension - измерение, по значениям которого группируются события:
+// user_id, type или attributes.<имя>
+type Dimension string
+
+const (
+	DimensionUser Dimension = "user_id"
+	DimensionType Dimension = "type"
+
+	attributePrefix = "attributes."
+)
+
+// ParseDimension проверяет имя измерения
+func ParseDimension(s string) (Dimension, error) {
+	switch d := Dimension(s); {
+	case d == DimensionUser, d == DimensionType:
+		return d, nil
+	case strings.HasPrefix(s, attributePrefix) && len(s) > len(attributePrefix):
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown dimension %q: want user_id, type or attributes.<name>", s)
+}
+
+// Value возвращает значение измерения события; false - у события нет
+// такого атрибута
+func (d Dimension) Value(e models.Event) (string, bool) {
+	switch d {
+	case DimensionUser:
+		return e.UserID, true
+	case DimensionType:
+		return e.Type, true
+	}
+	v, ok := e.Attributes[strings.TrimPrefix(string(d), attributePrefix)]
+	return v, ok
+}
+
+// Group - агрегат событий с одним значением измерения
+type Group struct {
+	Key string `json:"key"`
+	models.AggregatedData
+}
+
+// accumulator накапливает агрегат по одному событию, не храня сами события
+type accumulator struct {
+	data models.AggregatedData
+}
+
+func (a *accumulator) add(e models.Event) {
+	a.addValue(e.Value, e.Timestamp)
+}
+
+func (a *accumulator) addValue(value float64, ts time.Time) {
+	d := &a.data
+	if d.Count == 0 {
+		d.MinValue, d.MaxValue = value, value
+		d.StartTime, d.EndTime = ts, ts
+	}
+	d.Count++
+	d.TotalValue += value
+	d.MinValue = min(d.MinValue, value)
+	d.MaxValue = max(d.MaxValue, value)
+	if ts.Before(d.StartTime) {
+		d.StartTime = ts
+	}
+	if ts.After(d.EndTime) {
+		d.EndTime = ts
+	}
+}
+
+// merge добавляет к агрегату готовый агрегат другой части событий
+func (a *accumulator) merge(d models.AggregatedData) {
+	if d.Count == 0 {
+		return
+	}
+	if a.data.Count == 0 {
+		a.data = d
+		return
+	}
+	a.data.Count += d.Count
+	a.data.TotalValue += d.TotalValue
+	a.data.MinValue = min(a.data.MinValue, d.MinValue)
+	a.data.MaxValue = max(a.data.MaxValue, d.MaxValue)
+	if d.StartTime.Before(a.data.StartTime) {
+		a.data.StartTime = d.StartTime
+	}
+	if d.EndTime.After(a.data.EndTime) {
+		a.data.EndTime = d.EndTime
+	}
+}
+
+func (s *InMemoryStorage) Rollup(tenant string, by Dimension, filter GroupFilter) []Group {
+	// user_id и type без границ времени сворачиваются из агрегатов групп
+	// (user_id, type), которые поддерживаются при приёме, без обхода событий
+	if (by == DimensionUser || by == DimensionType) && filter.From.IsZero() && filter.To.IsZero() {
+		return rollupTotals(tenant, by, filter, s.currentRollups().groups[tenant])
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	accs := make(map[string]*accumulator)
+	s.each(tenant, filter, func(e *models.Event) bool {
+		key, ok := by.Value(*e)
+		if !ok {
+			return true
+		}
+		a := accs[key]
+		if a == nil {
+			a = &accumulator{}
+			accs[key] = a
+		}
+		a.add(*e)
+		return true
+	})
+	return rollupGroups(tenant, by, filter, accs)
+}
+
+// rollupTotals сворачивает агрегаты пар (user_id, type) тенанта по
+// измерению user_id или type
+func rollupTotals(tenant string, by Dimension, filter GroupFilter, totals []models.AggregatedData) []Group {
+	accs := make(map[string]*accumulator)
+	for _, d := range totals {
+		if (filter.EventType != "" && d.EventType != filter.EventType) || !strings.HasPrefix(d.UserID, filter.UserPrefix) {
+			continue
+		}
+		key := d.UserID
+		if by == DimensionType {
+			key = d.EventType
+		}
+		a := accs[key]
+		if a == nil {
+			a = &accumulator{}
+			accs[key] = a
+		}
+		a.merge(d)
+	}
+	return rollupGroups(tenant, by, filter, accs)
+}
+
+// rollupGroups собирает результат Rollup из агрегатов по значениям измерения
+func rollupGroups(tenant string, by Dimension, filter GroupFilter, accs map[string]*accumulator) []Group {
+	result := make([]Group, 0, len(accs))
+	for key, a := range accs {
+		g := Group{Key: key, AggregatedData: a.data}
+		g.Tenant, g.UserID, g.EventType = tenant, "", filter.EventType
+		switch by {
+		case DimensionUser:
+			g.UserID = key
+		case DimensionType:
+			g.EventType = key
+		}
+		g.AvgValue = g.TotalValue / float64(g.Count)
+		result = append(result, g)
+	}
+	return result
+}
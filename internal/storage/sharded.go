@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// DefaultShards - число шардов ShardedStorage по умолчанию
+const DefaultShards = 16
+
+// ShardedStorage - хранилище из нескольких InMemoryStorage (шардов), у
+// каждого своя блокировка. Шард события выбирается по хешу тенанта и
+// user_id: приём события блокирует только свой шард, а каждая группа
+// (user_id, type) целиком лежит в одном шарде. Запросы по всем событиям
+// держат блокировку чтения одного шарда за раз, поэтому не останавливают
+// приём в остальных.
+type ShardedStorage struct {
+	shards []*InMemoryStorage
+	seed   maphash.Seed
+	// seq - общий счётчик порядковых номеров шардов
+	seq atomic.Uint64
+}
+
+// NewShardedStorage создаёт хранилище из n шардов (n <= 0 - DefaultShards)
+func NewShardedStorage(n int) *ShardedStorage {
+	if n <= 0 {
+		n = DefaultShards
+	}
+	s := &ShardedStorage{shards: make([]*InMemoryStorage, n), seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		s.shards[i] = newInMemoryStorage(&s.seq)
+	}
+	return s
+}
+
+func (s *ShardedStorage) shard(tenant, userID string) *InMemoryStorage {
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	h.WriteString(tenant)
+	h.WriteByte(0)
+	h.WriteString(userID)
+	return s.shards[h.Sum64()%uint64(len(s.shards))]
+}
+
+func (s *ShardedStorage) AddEvent(event models.Event) {
+	s.shard(event.Tenant, event.UserID).AddEvent(event)
+}
+
+func (s *ShardedStorage) GetAggregated(tenant, userID, eventType string, from, to time.Time) *models.AggregatedData {
+	if userID != "" {
+		return s.shard(tenant, userID).GetAggregated(tenant, userID, eventType, from, to)
+	}
+
+	var a accumulator
+	for _, sh := range s.shards {
+		if d := sh.GetAggregated(tenant, userID, eventType, from, to); d != nil {
+			a.merge(*d)
+		}
+	}
+	if a.data.Count == 0 {
+		return nil
+	}
+	agg := a.data
+	agg.AvgValue = agg.TotalValue / float64(agg.Count)
+	return &agg
+}
+
+func (s *ShardedStorage) GetAllAggregated(tenant string) []models.AggregatedData {
+	return s.GetGroupedAggregated(tenant, GroupFilter{})
+}
+
+func (s *ShardedStorage) GetGroupedAggregated(tenant string, filter GroupFilter) []models.AggregatedData {
+	result := make([]models.AggregatedData, 0)
+	for _, sh := range s.shards {
+		result = append(result, sh.GetGroupedAggregated(tenant, filter)...)
+	}
+	return result
+}
+
+func (s *ShardedStorage) Rollup(tenant string, by Dimension, filter GroupFilter) []Group {
+	if by == DimensionUser {
+		result := make([]Group, 0)
+		for _, sh := range s.shards {
+			result = append(result, sh.Rollup(tenant, by, filter)...)
+		}
+		return result
+	}
+
+	// Остальные измерения встречаются в нескольких шардах
+	groups := make(map[string]*Group)
+	var order []string
+	for _, sh := range s.shards {
+		for _, g := range sh.Rollup(tenant, by, filter) {
+			merged, ok := groups[g.Key]
+			if !ok {
+				groups[g.Key] = &g
+				order = append(order, g.Key)
+				continue
+			}
+			a := accumulator{data: merged.AggregatedData}
+			a.merge(g.AggregatedData)
+			merged.AggregatedData = a.data
+			merged.AvgValue = merged.TotalValue / float64(merged.Count)
+		}
+	}
+	result := make([]Group, 0, len(order))
+	for _, key := range order {
+		result = append(result, *groups[key])
+	}
+	return result
+}
+
+// Scan обходит шарды по очереди, в каждом - в порядке времени
+func (s *ShardedStorage) Scan(tenant string, filter GroupFilter, fn func(models.Event) bool) {
+	stopped := false
+	for _, sh := range s.shards {
+		sh.Scan(tenant, filter, func(e models.Event) bool {
+			stopped = !fn(e)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+func (s *ShardedStorage) GetEvent(tenant, id string) (models.Event, bool) {
+	var found models.Event
+	var last uint64
+	ok := false
+	for _, sh := range s.shards {
+		// При повторе ID - последнее принятое событие
+		if e, seq, exists := sh.lookup(tenant, id); exists && (!ok || seq > last) {
+			found, last, ok = e, seq, true
+		}
+	}
+	return found, ok
+}
+
+func (s *ShardedStorage) SearchEvents(tenant string, q EventQuery) (EventPage, error) {
+	if q.UserID != "" {
+		return s.shard(tenant, q.UserID).SearchEvents(tenant, q)
+	}
+
+	var after *eventCursor
+	if q.Cursor != "" {
+		c, err := parseEventCursor(q.Cursor)
+		if err != nil {
+			return EventPage{}, err
+		}
+		after = &c
+	}
+
+	// Страница каждого шарда - кандидаты общей страницы
+	type found struct {
+		event  models.Event
+		cursor eventCursor
+	}
+	var all []found
+	more := false
+	for _, sh := range s.shards {
+		events, cursors, shardMore := sh.search(tenant, q, after)
+		for i := range events {
+			all = append(all, found{events[i], cursors[i]})
+		}
+		more = more || shardMore
+	}
+	slices.SortFunc(all, func(a, b found) int {
+		c := b.cursor.compare(a.cursor.ts, a.cursor.seq)
+		if q.Asc {
+			return c
+		}
+		return -c
+	})
+
+	page := EventPage{Events: []models.Event{}}
+	if q.Limit > 0 && len(all) > q.Limit {
+		all, more = all[:q.Limit], true
+	}
+	for _, f := range all {
+		page.Events = append(page.Events, f.event)
+	}
+	if more && len(all) > 0 {
+		page.NextCursor = all[len(all)-1].cursor.String()
+	}
+	return page, nil
+}
+
+// Snapshot возвращает события всех шардов в порядке приёма
+func (s *ShardedStorage) Snapshot() []models.Event {
+	events := make([][]models.Event, len(s.shards))
+	seqs := make([][]uint64, len(s.shards))
+	for i, sh := range s.shards {
+		events[i], seqs[i] = sh.snapshot()
+	}
+	return mergeBySeq(events, seqs)
+}
+
+// mergeBySeq сливает списки событий в порядке приёма; каждый список уже
+// упорядочен по своим порядковым номерам seqs
+func mergeBySeq(events [][]models.Event, seqs [][]uint64) []models.Event {
+	n := 0
+	for _, list := range events {
+		n += len(list)
+	}
+	result := make([]models.Event, 0, n)
+	for len(result) < n {
+		next := -1
+		for i := range seqs {
+			if len(seqs[i]) > 0 && (next < 0 || seqs[i][0] < seqs[next][0]) {
+				next = i
+			}
+		}
+		result = append(result, events[next][0])
+		events[next], seqs[next] = events[next][1:], seqs[next][1:]
+	}
+	return result
+}
+
+func (s *ShardedStorage) Purge() int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.Purge()
+	}
+	return n
+}
+
+func (s *ShardedStorage) Delete(tenant string, before time.Time) int {
+	n := 0
+	for _, sh := range s.shards {
+		n += sh.Delete(tenant, before)
+	}
+	return n
+}
+
+func (s *ShardedStorage) Count(tenant string) int64 {
+	var n int64
+	for _, sh := range s.shards {
+		n += sh.Count(tenant)
+	}
+	return n
+}
+
+func (s *ShardedStorage) Stats() []TenantStats {
+	byTenant := make(map[string]*statsAcc)
+	for _, sh := range s.shards {
+		sh.collectStats(byTenant)
+	}
+	return finishStats(byTenant)
+}
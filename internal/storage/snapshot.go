@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// groupKey - пара (user_id, type) в пределах тенанта
+type groupKey struct {
+	tenant    string
+	userID    string
+	eventType string
+}
+
+// rollupSnapshot - неизменяемые агрегаты по парам (user_id, type) всех
+// тенантов на момент version хранилища
+type rollupSnapshot struct {
+	version uint64
+	groups  map[string][]models.AggregatedData
+}
+
+// covers сообщает, что снимок учитывает все изменения до version
+func (snap *rollupSnapshot) covers(version uint64) bool {
+	return snap != nil && snap.version >= version
+}
+
+// addTotal учитывает событие в текущих агрегатах; вызывается под
+// блокировкой записи
+func (s *InMemoryStorage) addTotal(e *models.Event) {
+	k := groupKey{e.Tenant, e.UserID, e.Type}
+	a := s.totals[k]
+	if a == nil {
+		a = &accumulator{}
+		s.totals[k] = a
+	}
+	a.add(*e)
+	s.version.Add(1)
+}
+
+// recomputeTotal пересчитывает агрегат группы по оставшимся событиям
+// пользователя после удаления; вызывается под блокировкой записи
+func (s *InMemoryStorage) recomputeTotal(k groupKey) {
+	var a accumulator
+	for _, pos := range s.index.byUser[eventKey{k.tenant, k.userID}] {
+		if e := &s.events[pos]; e.Type == k.eventType {
+			a.add(*e)
+		}
+	}
+	if a.data.Count == 0 {
+		delete(s.totals, k)
+		return
+	}
+	s.totals[k] = &a
+}
+
+// currentRollups возвращает снимок агрегатов, учитывающий все изменения,
+// завершённые до вызова. Пока хранилище не меняется, снимок читается без
+// блокировок. Иначе один из читателей строит новый снимок по текущим
+// агрегатам групп, а не по событиям; читатели, ждавшие его, берут готовый
+// снимок, если он построен после начала их вызова.
+func (s *InMemoryStorage) currentRollups() *rollupSnapshot {
+	version := s.version.Load()
+	if snap := s.rollups.Load(); snap.covers(version) {
+		return snap
+	}
+	s.building.Lock()
+	defer s.building.Unlock()
+	if snap := s.rollups.Load(); snap.covers(version) {
+		return snap
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// version меняется только под блокировкой записи
+	snap := &rollupSnapshot{version: s.version.Load(), groups: make(map[string][]models.AggregatedData)}
+	for k, a := range s.totals {
+		agg := a.data
+		agg.Tenant, agg.UserID, agg.EventType = k.tenant, k.userID, k.eventType
+		agg.AvgValue = agg.TotalValue / float64(agg.Count)
+		snap.groups[k.tenant] = append(snap.groups[k.tenant], agg)
+	}
+	s.rollups.Store(snap)
+	return snap
+}
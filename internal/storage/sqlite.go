@@ -0,0 +1,706 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+	_ "modernc.org/sqlite"
+)
+
+// BatchStorage - хранилище, которому выгоднее сохранять события пачками;
+// агрегатор передаёт ему события, накопившиеся в очереди, одним вызовом
+type BatchStorage interface {
+	Storage
+	AddEvents(events []models.Event)
+}
+
+// migrations - схема базы SQLiteStorage: i-я миграция переводит базу из
+// версии i в i+1 (версия хранится в PRAGMA user_version). Применённые
+// миграции не меняются, изменения схемы добавляются в конец.
+var migrations = []string{
+	`CREATE TABLE events (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant     TEXT    NOT NULL,
+		id         TEXT    NOT NULL,
+		type       TEXT    NOT NULL,
+		user_id    TEXT    NOT NULL,
+		value      REAL    NOT NULL,
+		unit       TEXT    NOT NULL DEFAULT '',
+		ts         INTEGER NOT NULL,
+		attributes TEXT
+	);
+	CREATE INDEX events_tenant_ts ON events (tenant, ts);
+	CREATE INDEX events_tenant_user_ts ON events (tenant, user_id, ts);
+	CREATE INDEX events_tenant_type_ts ON events (tenant, type, ts);
+	CREATE INDEX events_tenant_id ON events (tenant, id);`,
+
+	// ts хранится в наносекундах Unix; представление - для просмотра базы
+	// сторонними инструментами
+	`CREATE VIEW events_readable AS
+	SELECT seq, tenant, id, type, user_id, value, unit,
+		strftime('%Y-%m-%dT%H:%M:%fZ', ts / 1e9, 'unixepoch') AS timestamp,
+		attributes
+	FROM events;`,
+}
+
+// SQLiteStorage - хранилище во встроенной базе SQLite (без cgo). Фильтры и
+// агрегаты выполняются в SQL по индексам (tenant, ts), (tenant, user_id, ts)
+// и (tenant, type, ts); события переживают перезапуск, и базу можно
+// открыть любым клиентом SQLite.
+//
+// Методы Storage не возвращают ошибок: ошибки базы пишутся в лог, а запрос
+// возвращает пустой результат. Пачки событий, не записанные и после
+// повторов, передаются обработчику OnWriteFailure и учитываются в
+// WriteStats. Timestamp возвращаются в UTC.
+type SQLiteStorage struct {
+	db   *sql.DB
+	path string
+	// temp - файл базы удаляется при Close
+	temp bool
+
+	onFailure     func(events []models.Event, err error)
+	batches       atomic.Uint64
+	retries       atomic.Uint64
+	failedBatches atomic.Uint64
+	failedEvents  atomic.Uint64
+}
+
+// WriteStats - счётчики записи событий в SQLiteStorage
+type WriteStats struct {
+	Batches uint64 `json:"batches"`
+	Retries uint64 `json:"retries"`
+	// FailedBatches и FailedEvents - пачки и события, не записанные после
+	// всех повторов
+	FailedBatches uint64 `json:"failed_batches"`
+	FailedEvents  uint64 `json:"failed_events"`
+}
+
+// insertAttempts - попыток записи пачки; между попытками пауза
+// insertBackoff, удваиваемая каждый раз
+const (
+	insertAttempts = 3
+	insertBackoff  = 50 * time.Millisecond
+)
+
+// tempSQLitePattern - суффикс временных баз replay рядом с рабочей базой
+const tempSQLitePattern = ".replay-*.db"
+
+// OpenSQLite открывает (создаёт) базу по пути path и применяет миграции;
+// ":memory:" - база в памяти
+func OpenSQLite(path string) (*SQLiteStorage, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// У каждого соединения была бы своя база
+		db.SetMaxOpenConns(1)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return &SQLiteStorage{db: db, path: path}, nil
+}
+
+// openTempSQLite создаёт пустую базу рядом с базой path (в том же каталоге,
+// а значит и на том же диске); файл удаляется при Close
+func openTempSQLite(path string) (*SQLiteStorage, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+tempSQLitePattern)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	s, err := OpenSQLite(f.Name())
+	if err != nil {
+		removeSQLite(f.Name())
+		return nil, err
+	}
+	s.temp = true
+	return s, nil
+}
+
+// removeTempSQLite удаляет временные базы replay, оставшиеся после
+// аварийной остановки
+func removeTempSQLite(path string) {
+	files, _ := filepath.Glob(path + tempSQLitePattern)
+	for _, file := range files {
+		removeSQLite(file)
+	}
+}
+
+// removeSQLite удаляет файл базы вместе с журналом WAL
+func removeSQLite(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than supported %d", version, len(migrations))
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close закрывает базу; временная база replay удаляется
+func (s *SQLiteStorage) Close() error {
+	err := s.db.Close()
+	if s.temp {
+		removeSQLite(s.path)
+	}
+	return err
+}
+
+// OnWriteFailure задаёт обработчик пачек, не записанных после всех
+// повторов (например, запись в dead-letter); вызывается до приёма событий
+func (s *SQLiteStorage) OnWriteFailure(fn func(events []models.Event, err error)) {
+	s.onFailure = fn
+}
+
+// WriteStats возвращает счётчики записи
+func (s *SQLiteStorage) WriteStats() WriteStats {
+	return WriteStats{
+		Batches:       s.batches.Load(),
+		Retries:       s.retries.Load(),
+		FailedBatches: s.failedBatches.Load(),
+		FailedEvents:  s.failedEvents.Load(),
+	}
+}
+
+func (s *SQLiteStorage) logError(op string, err error) {
+	log.Printf("SQLite storage: %s: %v", op, err)
+}
+
+func (s *SQLiteStorage) AddEvent(event models.Event) {
+	s.AddEvents([]models.Event{event})
+}
+
+// AddEvents сохраняет события одной транзакцией. Клиенту приём уже
+// подтверждён, поэтому неудавшаяся транзакция повторяется, а пачка, не
+// записанная и после повторов, передаётся обработчику OnWriteFailure.
+func (s *SQLiteStorage) AddEvents(events []models.Event) {
+	s.batches.Add(1)
+	var err error
+	for attempt := 0; attempt < insertAttempts; attempt++ {
+		if attempt > 0 {
+			s.retries.Add(1)
+			time.Sleep(insertBackoff << (attempt - 1))
+		}
+		if err = s.insert(events); err == nil {
+			return
+		}
+	}
+	s.failedBatches.Add(1)
+	s.failedEvents.Add(uint64(len(events)))
+	s.logError(fmt.Sprintf("insert %d events", len(events)), err)
+	if s.onFailure != nil {
+		s.onFailure(events, err)
+	}
+}
+
+// Merge дописывает события src, которых нет в базе (по тенанту и ID), в
+// порядке их приёма. База SQLite в файле подключается через ATTACH и
+// копируется одним запросом, события остальных хранилищ вставляются по
+// одному в транзакции.
+func (s *SQLiteStorage) Merge(src Storage) (int64, error) {
+	if db, ok := src.(*SQLiteStorage); ok && db.path != ":memory:" {
+		return s.mergeFile(db.path)
+	}
+	return s.mergeEvents(src.Snapshot())
+}
+
+func (s *SQLiteStorage) mergeFile(path string) (int64, error) {
+	ctx := context.Background()
+	// ATTACH действует только в своём соединении
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS merged", path); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE merged")
+
+	res, err := conn.ExecContext(ctx, `INSERT INTO main.events (tenant, id, type, user_id, value, unit, ts, attributes)
+		SELECT m.tenant, m.id, m.type, m.user_id, m.value, m.unit, m.ts, m.attributes FROM merged.events m
+		WHERE NOT EXISTS (SELECT 1 FROM main.events e WHERE e.tenant = m.tenant AND e.id = m.id)
+		ORDER BY m.seq`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStorage) mergeEvents(events []models.Event) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (tenant, id, type, user_id, value, unit, ts, attributes)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM events WHERE tenant = ? AND id = ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	var n int64
+	for _, e := range events {
+		attrs, err := attributesValue(e.Attributes)
+		if err != nil {
+			return 0, err
+		}
+		res, err := stmt.Exec(e.Tenant, e.ID, e.Type, e.UserID, e.Value, e.Unit, e.Timestamp.UnixNano(), attrs, e.Tenant, e.ID)
+		if err != nil {
+			return 0, err
+		}
+		added, _ := res.RowsAffected()
+		n += added
+	}
+	return n, tx.Commit()
+}
+
+// attributesValue - столбец attributes: JSON или NULL без атрибутов
+func attributesValue(attrs map[string]string) (any, error) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (s *SQLiteStorage) insert(events []models.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (tenant, id, type, user_id, value, unit, ts, attributes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range events {
+		attrs, err := attributesValue(e.Attributes)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(e.Tenant, e.ID, e.Type, e.UserID, e.Value, e.Unit, e.Timestamp.UnixNano(), attrs); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlWhere - условия WHERE с аргументами
+type sqlWhere struct {
+	clauses []string
+	args    []any
+}
+
+func (w *sqlWhere) add(clause string, args ...any) {
+	w.clauses = append(w.clauses, clause)
+	w.args = append(w.args, args...)
+}
+
+func (w *sqlWhere) String() string {
+	return " WHERE " + strings.Join(w.clauses, " AND ")
+}
+
+// eventsWhere - отбор событий тенанта; пустые поля не ограничивают выборку
+func eventsWhere(tenant, userID, eventType, userPrefix string, from, to time.Time) *sqlWhere {
+	w := &sqlWhere{}
+	w.add("tenant = ?", tenant)
+	if userID != "" {
+		w.add("user_id = ?", userID)
+	}
+	if eventType != "" {
+		w.add("type = ?", eventType)
+	}
+	if userPrefix != "" {
+		// Диапазон вместо LIKE, чтобы работал индекс
+		w.add("user_id >= ?", userPrefix)
+		if end := prefixEnd(userPrefix); end != "" {
+			w.add("user_id < ?", end)
+		}
+	}
+	if !from.IsZero() {
+		w.add("ts >= ?", from.UnixNano())
+	}
+	if !to.IsZero() {
+		w.add("ts <= ?", to.UnixNano())
+	}
+	return w
+}
+
+// prefixEnd - наименьшая строка, большая всех строк с префиксом p; "" -
+// такой строки нет
+func prefixEnd(p string) string {
+	b := []byte(p)
+	for len(b) > 0 && b[len(b)-1] == 0xff {
+		b = b[:len(b)-1]
+	}
+	if len(b) == 0 {
+		return ""
+	}
+	b[len(b)-1]++
+	return string(b)
+}
+
+// jsonPath - путь атрибута name для json_extract
+func jsonPath(name string) string {
+	return `$."` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
+
+const aggregateColumns = "COUNT(*), TOTAL(value), MIN(value), MAX(value), MIN(ts), MAX(ts)"
+
+// scanAggregate читает строку с ключами группы keys и столбцами aggregateColumns
+func scanAggregate(row interface{ Scan(...any) error }, d *models.AggregatedData, keys ...any) error {
+	var start, end int64
+	if err := row.Scan(append(keys, &d.Count, &d.TotalValue, &d.MinValue, &d.MaxValue, &start, &end)...); err != nil {
+		return err
+	}
+	d.StartTime, d.EndTime = time.Unix(0, start).UTC(), time.Unix(0, end).UTC()
+	d.AvgValue = d.TotalValue / float64(d.Count)
+	return nil
+}
+
+func (s *SQLiteStorage) GetAggregated(tenant, userID, eventType string, from, to time.Time) *models.AggregatedData {
+	w := eventsWhere(tenant, userID, eventType, "", from, to)
+	row := s.db.QueryRow("SELECT "+aggregateColumns+" FROM events"+w.String()+" HAVING COUNT(*) > 0", w.args...)
+
+	agg := &models.AggregatedData{Tenant: tenant, UserID: userID, EventType: eventType}
+	if err := scanAggregate(row, agg); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logError("aggregate", err)
+		}
+		return nil
+	}
+	return agg
+}
+
+func (s *SQLiteStorage) GetAllAggregated(tenant string) []models.AggregatedData {
+	return s.GetGroupedAggregated(tenant, GroupFilter{})
+}
+
+func (s *SQLiteStorage) GetGroupedAggregated(tenant string, filter GroupFilter) []models.AggregatedData {
+	w := eventsWhere(tenant, "", filter.EventType, filter.UserPrefix, filter.From, filter.To)
+	result := make([]models.AggregatedData, 0)
+	rows, err := s.db.Query("SELECT user_id, type, "+aggregateColumns+" FROM events"+w.String()+" GROUP BY user_id, type", w.args...)
+	if err != nil {
+		s.logError("group", err)
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		agg := models.AggregatedData{Tenant: tenant}
+		if err := scanAggregate(rows, &agg, &agg.UserID, &agg.EventType); err != nil {
+			s.logError("group", err)
+			return result
+		}
+		result = append(result, agg)
+	}
+	if err := rows.Err(); err != nil {
+		s.logError("group", err)
+	}
+	return result
+}
+
+func (s *SQLiteStorage) Rollup(tenant string, by Dimension, filter GroupFilter) []Group {
+	dim, args := "user_id", []any(nil)
+	switch by {
+	case DimensionUser:
+	case DimensionType:
+		dim = "type"
+	default:
+		dim, args = "json_extract(attributes, ?)", []any{jsonPath(strings.TrimPrefix(string(by), attributePrefix))}
+	}
+	w := eventsWhere(tenant, "", filter.EventType, filter.UserPrefix, filter.From, filter.To)
+	query := "SELECT " + dim + " AS dim, " + aggregateColumns + " FROM events" + w.String() + " GROUP BY dim HAVING dim IS NOT NULL"
+
+	result := make([]Group, 0)
+	rows, err := s.db.Query(query, append(args, w.args...)...)
+	if err != nil {
+		s.logError("rollup", err)
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g Group
+		if err := scanAggregate(rows, &g.AggregatedData, &g.Key); err != nil {
+			s.logError("rollup", err)
+			return result
+		}
+		g.Tenant, g.EventType = tenant, filter.EventType
+		switch by {
+		case DimensionUser:
+			g.UserID = g.Key
+		case DimensionType:
+			g.EventType = g.Key
+		}
+		result = append(result, g)
+	}
+	if err := rows.Err(); err != nil {
+		s.logError("rollup", err)
+	}
+	return result
+}
+
+const eventColumns = "seq, id, type, user_id, value, unit, ts, attributes"
+
+// scanEvent читает строку со столбцами eventColumns и следующими за ними
+// столбцами в extra
+func scanEvent(row interface{ Scan(...any) error }, tenant string, extra ...any) (models.Event, uint64, error) {
+	e := models.Event{Tenant: tenant}
+	var seq uint64
+	var ts int64
+	var attrs sql.NullString
+	if err := row.Scan(append([]any{&seq, &e.ID, &e.Type, &e.UserID, &e.Value, &e.Unit, &ts, &attrs}, extra...)...); err != nil {
+		return e, 0, err
+	}
+	e.Timestamp = time.Unix(0, ts).UTC()
+	if attrs.Valid {
+		if err := json.Unmarshal([]byte(attrs.String), &e.Attributes); err != nil {
+			return e, 0, err
+		}
+	}
+	return e, seq, nil
+}
+
+// events вызывает fn для событий тенанта, выбранных запросом, пока fn
+// возвращает true
+func (s *SQLiteStorage) events(op, tenant, query string, args []any, fn func(e models.Event, seq uint64) bool) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.logError(op, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, seq, err := scanEvent(rows, tenant)
+		if err != nil {
+			s.logError(op, err)
+			return
+		}
+		if !fn(e, seq) {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.logError(op, err)
+	}
+}
+
+// Scan обходит события в порядке времени. Порции читаются отдельными
+// запросами, чтобы fn не удерживал соединение с базой.
+func (s *SQLiteStorage) Scan(tenant string, filter GroupFilter, fn func(models.Event) bool) {
+	var after *eventCursor
+	for {
+		w := eventsWhere(tenant, "", filter.EventType, filter.UserPrefix, filter.From, filter.To)
+		if after != nil {
+			ts := after.ts.UnixNano()
+			w.add("(ts > ? OR (ts = ? AND seq > ?))", ts, ts, after.seq)
+		}
+		var events []models.Event
+		var last eventCursor
+		s.events("scan", tenant, fmt.Sprintf("SELECT %s FROM events%s ORDER BY ts, seq LIMIT %d", eventColumns, w.String(), scanChunk), w.args,
+			func(e models.Event, seq uint64) bool {
+				events = append(events, e)
+				last = eventCursor{ts: e.Timestamp, seq: seq}
+				return true
+			})
+		for _, e := range events {
+			if !fn(e) {
+				return
+			}
+		}
+		if len(events) < scanChunk {
+			return
+		}
+		after = &last
+	}
+}
+
+func (s *SQLiteStorage) GetEvent(tenant, id string) (models.Event, bool) {
+	row := s.db.QueryRow("SELECT "+eventColumns+" FROM events WHERE tenant = ? AND id = ? ORDER BY seq DESC LIMIT 1", tenant, id)
+	e, _, err := scanEvent(row, tenant)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logError("get event", err)
+		}
+		return models.Event{}, false
+	}
+	return e, true
+}
+
+func (s *SQLiteStorage) SearchEvents(tenant string, q EventQuery) (EventPage, error) {
+	w := eventsWhere(tenant, q.UserID, q.EventType, "", q.From, q.To)
+	for _, k := range slices.Sorted(maps.Keys(q.Attributes)) {
+		w.add("json_extract(attributes, ?) = ?", jsonPath(k), q.Attributes[k])
+	}
+	if q.MinValue != nil {
+		w.add("value >= ?", *q.MinValue)
+	}
+	if q.MaxValue != nil {
+		w.add("value <= ?", *q.MaxValue)
+	}
+	if q.Cursor != "" {
+		after, err := parseEventCursor(q.Cursor)
+		if err != nil {
+			return EventPage{}, err
+		}
+		ts := after.ts.UnixNano()
+		if q.Asc {
+			w.add("(ts > ? OR (ts = ? AND seq > ?))", ts, ts, after.seq)
+		} else {
+			w.add("(ts < ? OR (ts = ? AND seq < ?))", ts, ts, after.seq)
+		}
+	}
+	query := "SELECT " + eventColumns + " FROM events" + w.String() + " ORDER BY ts DESC, seq DESC"
+	if q.Asc {
+		query = "SELECT " + eventColumns + " FROM events" + w.String() + " ORDER BY ts, seq"
+	}
+	if q.Limit > 0 {
+		// Лишнее событие означает следующую страницу
+		query += fmt.Sprintf(" LIMIT %d", q.Limit+1)
+	}
+
+	page := EventPage{Events: []models.Event{}}
+	var last eventCursor
+	s.events("search", tenant, query, w.args, func(e models.Event, seq uint64) bool {
+		if q.Limit > 0 && len(page.Events) == q.Limit {
+			page.NextCursor = last.String()
+			return false
+		}
+		page.Events = append(page.Events, e)
+		last = eventCursor{ts: e.Timestamp, seq: seq}
+		return true
+	})
+	return page, nil
+}
+
+// Snapshot возвращает события всех тенантов в порядке приёма
+func (s *SQLiteStorage) Snapshot() []models.Event {
+	result := make([]models.Event, 0)
+	rows, err := s.db.Query("SELECT " + eventColumns + ", tenant FROM events ORDER BY seq")
+	if err != nil {
+		s.logError("snapshot", err)
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tenant string
+		e, _, err := scanEvent(rows, "", &tenant)
+		if err != nil {
+			s.logError("snapshot", err)
+			return result
+		}
+		e.Tenant = tenant
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		s.logError("snapshot", err)
+	}
+	return result
+}
+
+func (s *SQLiteStorage) exec(op, query string, args ...any) int {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		s.logError(op, err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
+
+func (s *SQLiteStorage) Purge() int {
+	return s.exec("purge", "DELETE FROM events")
+}
+
+func (s *SQLiteStorage) Delete(tenant string, before time.Time) int {
+	if before.IsZero() {
+		return s.exec("delete", "DELETE FROM events WHERE tenant = ?", tenant)
+	}
+	return s.exec("delete", "DELETE FROM events WHERE tenant = ? AND ts < ?", tenant, before.UnixNano())
+}
+
+func (s *SQLiteStorage) Count(tenant string) int64 {
+	var n int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM events WHERE tenant = ?", tenant).Scan(&n); err != nil {
+		s.logError("count", err)
+	}
+	return n
+}
+
+func (s *SQLiteStorage) Stats() []TenantStats {
+	result := make([]TenantStats, 0)
+	rows, err := s.db.Query(`SELECT tenant, COUNT(*), COUNT(DISTINCT user_id), COUNT(DISTINCT type), MIN(ts), MAX(ts)
+		FROM events GROUP BY tenant ORDER BY tenant`)
+	if err != nil {
+		s.logError("stats", err)
+		return result
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st TenantStats
+		var oldest, newest int64
+		if err := rows.Scan(&st.Tenant, &st.Events, &st.Users, &st.EventTypes, &oldest, &newest); err != nil {
+			s.logError("stats", err)
+			return result
+		}
+		st.Oldest, st.Newest = time.Unix(0, oldest).UTC(), time.Unix(0, newest).UTC()
+		result = append(result, st)
+	}
+	if err := rows.Err(); err != nil {
+		s.logError("stats", err)
+	}
+	return result
+}
@@ -1,109 +1,363 @@
 package storage
 
 import (
+    "sort"
+    "strings"
     "sync"
+    "sync/atomic"
     "time"
 
     "github.com/bashkirian/event-aggregator/pkg/models"
 )
 
+// Storage хранит события всех тенантов; запросы агрегатов видят только
+// события указанного тенанта
 type Storage interface {
     AddEvent(event models.Event)
-    GetAggregated(userID, eventType string, from, to time.Time) *models.AggregatedData
-    GetAllAggregated() []models.AggregatedData
+    GetAggregated(tenant, userID, eventType string, from, to time.Time) *models.AggregatedData
+    GetAllAggregated(tenant string) []models.AggregatedData
+    // GetGroupedAggregated возвращает агрегаты по парам (user_id, type) только
+    // по событиям, прошедшим filter
+    GetGroupedAggregated(tenant string, filter GroupFilter) []models.AggregatedData
+    // Rollup возвращает агрегаты событий, прошедших filter, по значениям
+    // измерения by; события без значения измерения пропускаются
+    Rollup(tenant string, by Dimension, filter GroupFilter) []Group
+    // Scan вызывает fn для событий тенанта, прошедших filter, пока fn
+    // возвращает true; порядок обхода зависит от реализации. События
+    // читаются порциями по scanChunk, fn вызывается вне блокировки
+    // хранилища: события, добавленные или удалённые во время обхода, могут
+    // как попасть в него, так и нет.
+    Scan(tenant string, filter GroupFilter, fn func(models.Event) bool)
+    // GetEvent возвращает событие тенанта по ID
+    GetEvent(tenant, id string) (models.Event, bool)
+    // SearchEvents возвращает страницу сырых событий тенанта, прошедших q
+    SearchEvents(tenant string, q EventQuery) (EventPage, error)
+    // Snapshot возвращает копию всех сырых событий
+    Snapshot() []models.Event
+    // Purge удаляет все события и возвращает их количество
+    Purge() int
+    // Delete удаляет события тенанта с timestamp раньше before (нулевое before -
+    // все события тенанта) и возвращает их количество
+    Delete(tenant string, before time.Time) int
+    // Count возвращает количество хранимых событий тенанта
+    Count(tenant string) int64
+    // Stats возвращает объём данных по тенантам
+    Stats() []TenantStats
+}
+
+// TenantStats - объём хранимых данных тенанта
+type TenantStats struct {
+    Tenant     string    `json:"tenant"`
+    Events     int64     `json:"events"`
+    Users      int       `json:"users"`
+    EventTypes int       `json:"event_types"`
+    Oldest     time.Time `json:"oldest"`
+    Newest     time.Time `json:"newest"`
+}
+
+// GroupFilter - отбор событий для GetGroupedAggregated; пустые поля не
+// ограничивают выборку, границы времени включаются
+type GroupFilter struct {
+    EventType  string
+    UserPrefix string
+    From       time.Time
+    To         time.Time
+}
+
+func (f GroupFilter) match(e models.Event) bool {
+    return (f.EventType == "" || e.Type == f.EventType) &&
+        strings.HasPrefix(e.UserID, f.UserPrefix) &&
+        (f.From.IsZero() || !e.Timestamp.Before(f.From)) &&
+        (f.To.IsZero() || !e.Timestamp.After(f.To))
 }
 
 type InMemoryStorage struct {
     mu     sync.RWMutex
     events []models.Event
+    // seqs - порядковые номера приёма событий (параллельно events); не
+    // меняются при удалении, поэтому служат курсором поиска. Счётчик seq
+    // общий у шардов ShardedStorage. Номер 0 - событие удалено, его позиция
+    // освобождается при уплотнении (см. compact).
+    seqs  []uint64
+    seq   *atomic.Uint64
+    dead  int
+    index eventIndex
+    // counts - количество событий по тенантам (для проверки квот без обхода)
+    counts map[string]int64
+    // totals - текущие агрегаты по группам; rollups - их неизменяемый
+    // снимок на момент version (см. snapshot.go); building - снимок строит
+    // один читатель
+    totals   map[groupKey]*accumulator
+    version  atomic.Uint64
+    rollups  atomic.Pointer[rollupSnapshot]
+    building sync.Mutex
 }
 
 func NewInMemoryStorage() *InMemoryStorage {
+    return newInMemoryStorage(new(atomic.Uint64))
+}
+
+func newInMemoryStorage(seq *atomic.Uint64) *InMemoryStorage {
     return &InMemoryStorage{
         events: make([]models.Event, 0),
+        seq:    seq,
+        index:  newEventIndex(),
+        counts: make(map[string]int64),
+        totals: make(map[groupKey]*accumulator),
     }
 }
 
 func (s *InMemoryStorage) AddEvent(event models.Event) {
     s.mu.Lock()
     defer s.mu.Unlock()
+    s.seqs = append(s.seqs, s.seq.Add(1))
     s.events = append(s.events, event)
+    s.indexEvent(len(s.events) - 1)
+    s.addTotal(&event)
+    s.counts[event.Tenant]++
 }
 
-func (s *InMemoryStorage) GetAggregated(userID, eventType string, from, to time.Time) *models.AggregatedData {
+func (s *InMemoryStorage) GetAggregated(tenant, userID, eventType string, from, to time.Time) *models.AggregatedData {
     s.mu.RLock()
     defer s.mu.RUnlock()
 
-    var filtered []models.Event
-    for _, e := range s.events {
-        if (userID == "" || e.UserID == userID) &&
-            (eventType == "" || e.Type == eventType) &&
-            (from.IsZero() || e.Timestamp.After(from) || e.Timestamp.Equal(from)) &&
-            (to.IsZero() || e.Timestamp.Before(to) || e.Timestamp.Equal(to)) {
-            filtered = append(filtered, e)
+    var a accumulator
+    for _, pos := range s.candidates(tenant, userID, eventType, from, to) {
+        e := &s.events[pos]
+        if (userID == "" || e.UserID == userID) && (eventType == "" || e.Type == eventType) {
+            a.add(*e)
         }
     }
-
-    if len(filtered) == 0 {
+    if a.data.Count == 0 {
         return nil
     }
 
-    return aggregate(filtered, userID, eventType)
+    agg := a.data
+    agg.Tenant, agg.UserID, agg.EventType = tenant, userID, eventType
+    agg.AvgValue = agg.TotalValue / float64(agg.Count)
+    return &agg
+}
+
+func (s *InMemoryStorage) GetAllAggregated(tenant string) []models.AggregatedData {
+    return s.GetGroupedAggregated(tenant, GroupFilter{})
 }
 
-func (s *InMemoryStorage) GetAllAggregated() []models.AggregatedData {
+func (s *InMemoryStorage) GetGroupedAggregated(tenant string, filter GroupFilter) []models.AggregatedData {
+    // Без фильтра - из снимка, без блокировки
+    if filter == (GroupFilter{}) {
+        groups := s.currentRollups().groups[tenant]
+        return append(make([]models.AggregatedData, 0, len(groups)), groups...)
+    }
+
     s.mu.RLock()
     defer s.mu.RUnlock()
 
     // Группируем по userID и eventType
-    groups := make(map[string][]models.Event)
-    for _, e := range s.events {
-        key := e.UserID + ":" + e.Type
-        groups[key] = append(groups[key], e)
+    type key struct{ userID, eventType string }
+    accs := make(map[key]*accumulator)
+    s.each(tenant, filter, func(e *models.Event) bool {
+        k := key{e.UserID, e.Type}
+        a := accs[k]
+        if a == nil {
+            a = &accumulator{}
+            accs[k] = a
+        }
+        a.add(*e)
+        return true
+    })
+
+    result := make([]models.AggregatedData, 0, len(accs))
+    for k, a := range accs {
+        agg := a.data
+        agg.Tenant, agg.UserID, agg.EventType = tenant, k.userID, k.eventType
+        agg.AvgValue = agg.TotalValue / float64(agg.Count)
+        result = append(result, agg)
     }
 
-    result := make([]models.AggregatedData, 0, len(groups))
-    for _, events := range groups {
-        if len(events) > 0 {
-            agg := aggregate(events, events[0].UserID, events[0].Type)
-            result = append(result, *agg)
+    return result
+}
+
+// scanChunk - сколько событий Scan копирует за одно взятие блокировки
+const scanChunk = 1024
+
+// Scan обходит события в порядке времени, при равенстве - в порядке приёма
+func (s *InMemoryStorage) Scan(tenant string, filter GroupFilter, fn func(models.Event) bool) {
+    var after *eventCursor
+    for {
+        events, last, done := s.scanChunk(tenant, filter, after)
+        for _, e := range events {
+            if !fn(e) {
+                return
+            }
+        }
+        if done {
+            return
         }
+        after = &last
     }
+}
 
-    return result
+// scanChunk копирует до scanChunk событий после курсора after (nil - с
+// начала); done - событий после них нет
+func (s *InMemoryStorage) scanChunk(tenant string, filter GroupFilter, after *eventCursor) (events []models.Event, last eventCursor, done bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    candidates := s.candidates(tenant, "", filter.EventType, filter.From, filter.To)
+    if after != nil {
+        candidates = candidates[sort.Search(len(candidates), func(i int) bool {
+            pos := candidates[i]
+            return after.compare(s.events[pos].Timestamp, s.seqs[pos]) > 0
+        }):]
+    }
+    for _, pos := range candidates {
+        e := &s.events[pos]
+        if !filter.match(*e) {
+            continue
+        }
+        if len(events) == scanChunk {
+            return events, last, false
+        }
+        events = append(events, *e)
+        last = eventCursor{ts: e.Timestamp, seq: s.seqs[pos]}
+    }
+    return events, last, true
 }
 
-func aggregate(events []models.Event, userID, eventType string) *models.AggregatedData {
-    if len(events) == 0 {
-        return nil
+func (s *InMemoryStorage) Snapshot() []models.Event {
+    events, _ := s.snapshot()
+    return events
+}
+
+func (s *InMemoryStorage) Purge() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    n := len(s.events) - s.dead
+    s.events = make([]models.Event, 0)
+    s.seqs = nil
+    s.dead = 0
+    s.index = newEventIndex()
+    s.counts = make(map[string]int64)
+    s.totals = make(map[groupKey]*accumulator)
+    s.version.Add(1)
+    return n
+}
+
+// Delete удаляет из индексов префиксы списков, упорядоченных по времени,
+// и пересчитывает агрегаты только затронутых групп. Позиции удалённых
+// событий освобождаются уплотнением, когда их становится больше половины.
+func (s *InMemoryStorage) Delete(tenant string, before time.Time) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    list := s.index.byTenant[tenant]
+    n := len(list)
+    if !before.IsZero() {
+        n = s.indexBefore(list, before)
+    }
+    if n == 0 {
+        return 0
     }
+    removed := list[:n]
 
-    agg := &models.AggregatedData{
-        UserID:    userID,
-        EventType: eventType,
-        Count:     int64(len(events)),
-        MinValue:  events[0].Value,
-        MaxValue:  events[0].Value,
-        StartTime: events[0].Timestamp,
-        EndTime:   events[0].Timestamp,
+    users := make(map[eventKey]struct{})
+    types := make(map[eventKey]struct{})
+    groups := make(map[groupKey]struct{})
+    ids := make(map[eventKey]struct{})
+    for _, pos := range removed {
+        e := &s.events[pos]
+        users[eventKey{tenant, e.UserID}] = struct{}{}
+        types[eventKey{tenant, e.Type}] = struct{}{}
+        groups[groupKey{tenant, e.UserID, e.Type}] = struct{}{}
+        ids[eventKey{tenant, e.ID}] = struct{}{}
     }
+    s.index.byTenant[tenant] = list[n:]
+    for k := range users {
+        s.index.byUser[k] = s.trimBefore(s.index.byUser[k], before)
+    }
+    for k := range types {
+        s.index.byType[k] = s.trimBefore(s.index.byType[k], before)
+    }
+    s.dropEmpty(tenant, users, types)
+
+    for _, pos := range removed {
+        // Удалённые события не удерживаются в памяти до уплотнения
+        s.events[pos] = models.Event{}
+        s.seqs[pos] = 0
+    }
+    s.dead += n
+    s.unlinkIDs(ids)
+    for k := range groups {
+        s.recomputeTotal(k)
+    }
+    s.version.Add(1)
 
-    for _, e := range events {
-        agg.TotalValue += e.Value
-        if e.Value < agg.MinValue {
-            agg.MinValue = e.Value
+    if s.counts[tenant] -= int64(n); s.counts[tenant] == 0 {
+        delete(s.counts, tenant)
+    }
+    if s.dead > len(s.events)/2 {
+        s.compact()
+    }
+    return n
+}
+
+func (s *InMemoryStorage) Count(tenant string) int64 {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.counts[tenant]
+}
+
+func (s *InMemoryStorage) Stats() []TenantStats {
+    byTenant := make(map[string]*statsAcc)
+    s.collectStats(byTenant)
+    return finishStats(byTenant)
+}
+
+// statsAcc - TenantStats в процессе подсчёта
+type statsAcc struct {
+    stats TenantStats
+    users map[string]struct{}
+    types map[string]struct{}
+}
+
+// collectStats добавляет события хранилища к статистике byTenant
+func (s *InMemoryStorage) collectStats(byTenant map[string]*statsAcc) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    for i, e := range s.events {
+        if s.seqs[i] == 0 {
+            continue
         }
-        if e.Value > agg.MaxValue {
-            agg.MaxValue = e.Value
+        a, ok := byTenant[e.Tenant]
+        if !ok {
+            a = &statsAcc{
+                stats: TenantStats{Tenant: e.Tenant, Oldest: e.Timestamp, Newest: e.Timestamp},
+                users: make(map[string]struct{}),
+                types: make(map[string]struct{}),
+            }
+            byTenant[e.Tenant] = a
         }
-        if e.Timestamp.Before(agg.StartTime) {
-            agg.StartTime = e.Timestamp
+        a.stats.Events++
+        a.users[e.UserID] = struct{}{}
+        a.types[e.Type] = struct{}{}
+        if e.Timestamp.Before(a.stats.Oldest) {
+            a.stats.Oldest = e.Timestamp
         }
-        if e.Timestamp.After(agg.EndTime) {
-            agg.EndTime = e.Timestamp
+        if e.Timestamp.After(a.stats.Newest) {
+            a.stats.Newest = e.Timestamp
         }
     }
+}
 
-    agg.AvgValue = agg.TotalValue / float64(agg.Count)
-    return agg
+func finishStats(byTenant map[string]*statsAcc) []TenantStats {
+    result := make([]TenantStats, 0, len(byTenant))
+    for _, a := range byTenant {
+        a.stats.Users = len(a.users)
+        a.stats.EventTypes = len(a.types)
+        result = append(result, a.stats)
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Tenant < result[j].Tenant })
+    return result
 }
@@ -1,10 +1,20 @@
 package storage
 
 import (
+    "fmt"
+    "hash/maphash"
+    "os"
+    "path/filepath"
+    "runtime"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
     "testing"
     "time"
 
     "github.com/bashkirian/event-aggregator/pkg/models"
+    "github.com/google/uuid"
 )
 
 func TestInMemoryStorage_AddEvent(t *testing.T) {
@@ -39,7 +49,7 @@ func TestInMemoryStorage_GetAggregated(t *testing.T) {
         s.AddEvent(e)
     }
     
-    agg := s.GetAggregated("user-1", "click", time.Time{}, time.Time{})
+    agg := s.GetAggregated("", "user-1", "click", time.Time{}, time.Time{})
     
     if agg == nil {
         t.Fatal("Expected aggregated data, got nil")
@@ -81,7 +91,7 @@ func TestInMemoryStorage_GetAggregated_WithFilters(t *testing.T) {
     }
     
     // Фильтр по user и type
-    agg := s.GetAggregated("user-1", "click", time.Time{}, time.Time{})
+    agg := s.GetAggregated("", "user-1", "click", time.Time{}, time.Time{})
     
     if agg == nil {
         t.Fatal("Expected aggregated data, got nil")
@@ -111,7 +121,7 @@ func TestInMemoryStorage_GetAllAggregated(t *testing.T) {
         s.AddEvent(e)
     }
     
-    results := s.GetAllAggregated()
+    results := s.GetAllAggregated("")
     
     // Ожидаем 3 группы: user-1:click, user-1:view, user-2:click
     if len(results) != 3 {
@@ -119,6 +129,373 @@ func TestInMemoryStorage_GetAllAggregated(t *testing.T) {
     }
 }
 
+func TestInMemoryStorage_GetGroupedAggregated(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    s.AddEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 10, Timestamp: now})
+    s.AddEvent(models.Event{ID: "2", Type: "click", UserID: "user-1", Value: 20, Timestamp: now.Add(-time.Hour)})
+    s.AddEvent(models.Event{ID: "3", Type: "view", UserID: "user-2", Value: 30, Timestamp: now})
+    s.AddEvent(models.Event{ID: "4", Type: "click", UserID: "admin", Value: 40, Timestamp: now})
+
+    results := s.GetGroupedAggregated("", GroupFilter{EventType: "click", UserPrefix: "user-", From: now.Add(-time.Minute), To: now})
+    if len(results) != 1 || results[0].UserID != "user-1" || results[0].Count != 1 || results[0].TotalValue != 10 {
+        t.Errorf("Unexpected filtered aggregates: %+v", results)
+    }
+    if results := s.GetGroupedAggregated("", GroupFilter{UserPrefix: "user-"}); len(results) != 2 {
+        t.Errorf("Expected 2 aggregations for prefix user-, got %d", len(results))
+    }
+}
+
+func TestInMemoryStorage_Rollup(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    s.AddEvent(models.Event{ID: "1", Type: "purchase", UserID: "user-1", Value: 10, Timestamp: now, Attributes: map[string]string{"country": "DE"}})
+    s.AddEvent(models.Event{ID: "2", Type: "purchase", UserID: "user-2", Value: 30, Timestamp: now, Attributes: map[string]string{"country": "DE"}})
+    s.AddEvent(models.Event{ID: "3", Type: "purchase", UserID: "user-1", Value: 5, Timestamp: now})
+    s.AddEvent(models.Event{ID: "4", Type: "view", UserID: "user-1", Value: 1, Timestamp: now})
+
+    groups := s.Rollup("", DimensionUser, GroupFilter{EventType: "purchase"})
+    if len(groups) != 2 {
+        t.Fatalf("Expected 2 users, got %+v", groups)
+    }
+    for _, g := range groups {
+        if g.Key == "user-1" && (g.Count != 2 || g.TotalValue != 15 || g.AvgValue != 7.5 || g.MinValue != 5 || g.UserID != "user-1") {
+            t.Errorf("Unexpected user-1 rollup: %+v", g)
+        }
+    }
+
+    country, err := ParseDimension("attributes.country")
+    if err != nil {
+        t.Fatalf("ParseDimension failed: %v", err)
+    }
+    if groups := s.Rollup("", country, GroupFilter{}); len(groups) != 1 || groups[0].Key != "DE" || groups[0].TotalValue != 40 {
+        t.Errorf("Expected events without country to be skipped, got %+v", groups)
+    }
+    if _, err := ParseDimension("attributes."); err == nil {
+        t.Error("Expected error for empty attribute name")
+    }
+}
+
+func TestInMemoryStorage_RollupFromTotals(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+    for i := 0; i < 100; i++ {
+        s.AddEvent(models.Event{ID: strconv.Itoa(i), Type: []string{"click", "view", "buy"}[i%3], UserID: "user-" + strconv.Itoa(i%7), Value: float64(i % 11), Timestamp: now.Add(time.Duration(i%13) * time.Second)})
+    }
+
+    // Без границ времени агрегаты берутся из групп; с границей - обходом событий
+    all := GroupFilter{To: now.Add(time.Hour)}
+    for _, by := range []Dimension{DimensionUser, DimensionType} {
+        for _, f := range []GroupFilter{{}, {EventType: "view"}, {UserPrefix: "user-1"}} {
+            scanned := f
+            scanned.To = all.To
+            if a, b := sortedRollup(s.Rollup("", by, scanned)), sortedRollup(s.Rollup("", by, f)); a != b {
+                t.Errorf("Expected rollup by %s %+v %s, got %s", by, f, a, b)
+            }
+        }
+    }
+}
+
+func TestInMemoryStorage_Scan(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+    for i, typ := range []string{"click", "view", "click", "click"} {
+        s.AddEvent(models.Event{ID: string(rune('1' + i)), Type: typ, UserID: "user-1", Timestamp: now})
+    }
+    s.AddEvent(models.Event{ID: "9", Tenant: "acme", Type: "click", UserID: "user-1", Timestamp: now})
+
+    var ids []string
+    s.Scan("", GroupFilter{EventType: "click"}, func(e models.Event) bool {
+        ids = append(ids, e.ID)
+        return len(ids) < 2
+    })
+    if len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+        t.Errorf("Expected scan to stop after 1 and 3, got %v", ids)
+    }
+}
+
+func TestStorage_ScanOutsideLock(t *testing.T) {
+    sqlite, err := OpenSQLite(":memory:")
+    if err != nil {
+        t.Fatalf("OpenSQLite failed: %v", err)
+    }
+    defer sqlite.Close()
+
+    for name, s := range map[string]Storage{
+        "memory":   NewInMemoryStorage(),
+        "sharded":  NewShardedStorage(4),
+        "columnar": NewColumnarStorage(),
+        "sqlite":   sqlite,
+    } {
+        base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+        n := 2*scanChunk + 100
+        for i := 0; i < n; i++ {
+            s.AddEvent(models.Event{ID: strconv.Itoa(i), Type: "click", UserID: "user-" + strconv.Itoa(i%5), Timestamp: base.Add(time.Duration(i) * time.Millisecond)})
+        }
+
+        // fn вызывается без блокировки: приём внутри обхода не блокируется
+        seen := make(map[string]bool)
+        s.Scan("", GroupFilter{EventType: "click"}, func(e models.Event) bool {
+            seen[e.ID] = true
+            s.AddEvent(models.Event{ID: "v" + e.ID, Type: "view", UserID: e.UserID, Timestamp: e.Timestamp})
+            return true
+        })
+        if len(seen) != n {
+            t.Errorf("%s: Expected %d events, got %d", name, n, len(seen))
+        }
+    }
+}
+
+func TestInMemoryStorage_SearchEvents(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+    for i := 0; i < 10; i++ {
+        typ := "click"
+        if i%2 == 1 {
+            typ = "view"
+        }
+        s.AddEvent(models.Event{
+            ID: fmt.Sprintf("e%d", i), Type: typ, UserID: fmt.Sprintf("user-%d", i%3), Value: float64(i), Timestamp: now,
+            Attributes: map[string]string{"country": []string{"DE", "FR"}[i%2]},
+        })
+    }
+    s.AddEvent(models.Event{ID: "e0", Tenant: "acme", Type: "click", UserID: "user-0", Timestamp: now})
+
+    if e, ok := s.GetEvent("", "e7"); !ok || e.Value != 7 {
+        t.Errorf("Expected e7, got %+v %v", e, ok)
+    }
+    if e, ok := s.GetEvent("acme", "e0"); !ok || e.Tenant != "acme" {
+        t.Errorf("Expected acme's e0, got %+v %v", e, ok)
+    }
+    if _, ok := s.GetEvent("acme", "e7"); ok {
+        t.Error("Expected e7 to be invisible to acme")
+    }
+
+    // Постранично, от новых к старым
+    var ids []string
+    q := EventQuery{EventType: "click", Limit: 2}
+    for {
+        page, err := s.SearchEvents("", q)
+        if err != nil {
+            t.Fatalf("SearchEvents failed: %v", err)
+        }
+        for _, e := range page.Events {
+            ids = append(ids, e.ID)
+        }
+        if page.NextCursor == "" {
+            break
+        }
+        q.Cursor = page.NextCursor
+    }
+    if strings.Join(ids, ",") != "e8,e6,e4,e2,e0" {
+        t.Errorf("Unexpected click events: %v", ids)
+    }
+
+    min, max := 2.0, 8.0
+    page, _ := s.SearchEvents("", EventQuery{UserID: "user-1", MinValue: &min, MaxValue: &max, Asc: true, Attributes: map[string]string{"country": "FR"}})
+    if len(page.Events) != 1 || page.Events[0].ID != "e7" {
+        t.Errorf("Expected only e7, got %+v", page.Events)
+    }
+
+    // После удаления индекс перестраивается, курсор остаётся действительным
+    first, _ := s.SearchEvents("", EventQuery{Asc: true, Limit: 3})
+    s.Delete("acme", time.Time{})
+    s.AddEvent(models.Event{ID: "e10", Type: "click", UserID: "user-1", Timestamp: now})
+    rest, _ := s.SearchEvents("", EventQuery{Asc: true, Cursor: first.NextCursor, UserID: "user-1"})
+    if len(rest.Events) != 3 || rest.Events[0].ID != "e4" || rest.Events[2].ID != "e10" {
+        t.Errorf("Unexpected events after cursor: %+v", rest.Events)
+    }
+    if _, err := s.SearchEvents("", EventQuery{Cursor: "!"}); err != ErrInvalidCursor {
+        t.Errorf("Expected ErrInvalidCursor, got %v", err)
+    }
+}
+
+func TestInMemoryStorage_IndexOutOfOrder(t *testing.T) {
+    s := NewInMemoryStorage()
+    base := time.Now()
+    // События приходят не по порядку времени
+    for i, offset := range []int{5, 1, 9, 3, 7, 3} {
+        s.AddEvent(models.Event{
+            ID:        strconv.Itoa(i),
+            Type:      "click",
+            UserID:    "user-" + strconv.Itoa(i%2),
+            Value:     float64(offset),
+            Timestamp: base.Add(time.Duration(offset) * time.Second),
+        })
+    }
+
+    agg := s.GetAggregated("", "user-1", "", base.Add(3*time.Second), base.Add(7*time.Second))
+    if agg == nil || agg.Count != 2 || agg.MinValue != 3 || agg.MaxValue != 3 {
+        t.Errorf("Expected 2 events of user-1 at 3s, got %+v", agg)
+    }
+
+    page, _ := s.SearchEvents("", EventQuery{Asc: true})
+    var ids []string
+    for _, e := range page.Events {
+        ids = append(ids, e.ID)
+    }
+    if got := strings.Join(ids, ","); got != "1,3,5,0,4,2" {
+        t.Errorf("Expected time order 1,3,5,0,4,2, got %s", got)
+    }
+
+    s.Delete("", base.Add(4*time.Second))
+    var scanned []string
+    s.Scan("", GroupFilter{From: base.Add(6 * time.Second)}, func(e models.Event) bool {
+        scanned = append(scanned, e.ID)
+        return true
+    })
+    if got := strings.Join(scanned, ","); got != "4,2" {
+        t.Errorf("Expected 4,2 after delete, got %s", got)
+    }
+}
+
+func TestInMemoryStorage_DeleteDuplicateID(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    // Повторная доставка "dup" пришла позже, но со старым timestamp
+    s.AddEvent(models.Event{ID: "dup", Type: "click", UserID: "user-1", Value: 1, Timestamp: now})
+    s.AddEvent(models.Event{ID: "dup", Type: "click", UserID: "user-1", Value: 2, Timestamp: now.Add(-2 * time.Hour)})
+    // "old" - ранний дубликат удаляется, последний остаётся
+    s.AddEvent(models.Event{ID: "old", Type: "click", UserID: "user-1", Value: 3, Timestamp: now.Add(-2 * time.Hour)})
+    s.AddEvent(models.Event{ID: "old", Type: "click", UserID: "user-1", Value: 4, Timestamp: now})
+
+    if n := s.Delete("", now.Add(-time.Hour)); n != 2 {
+        t.Fatalf("Expected 2 deleted events, got %d", n)
+    }
+    if e, ok := s.GetEvent("", "dup"); !ok || e.Value != 1 {
+        t.Errorf("Expected surviving duplicate of dup, got %+v, %v", e, ok)
+    }
+    if e, ok := s.GetEvent("", "old"); !ok || e.Value != 4 {
+        t.Errorf("Expected latest event of old, got %+v, %v", e, ok)
+    }
+
+    // После уплотнения позиции пересчитаны
+    s.compact()
+    if e, ok := s.GetEvent("", "dup"); !ok || e.Value != 1 {
+        t.Errorf("Expected dup after compaction, got %+v, %v", e, ok)
+    }
+    s.Delete("", time.Time{})
+    if _, ok := s.GetEvent("", "dup"); ok {
+        t.Error("Expected dup to be gone after deleting all events")
+    }
+}
+
+func TestInMemoryStorage_DeleteIncremental(t *testing.T) {
+    s := NewInMemoryStorage()
+    base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    var all []models.Event
+    for i := 0; i < 600; i++ {
+        e := models.Event{
+            ID:        strconv.Itoa(i % 550),
+            Tenant:    []string{"", "acme", "acme"}[i%3],
+            Type:      []string{"click", "view"}[i%2],
+            UserID:    "user-" + strconv.Itoa(i%7),
+            Value:     float64(i % 13),
+            Timestamp: base.Add(time.Duration(i*37%600) * time.Second),
+        }
+        all = append(all, e)
+        s.AddEvent(e)
+    }
+
+    // Удаления по шагам; удаление всех событий acme уплотняет позиции
+    compacted := false
+    for _, cut := range []int{100, 250, 400, 590, 0} {
+        var before time.Time
+        if cut > 0 {
+            before = base.Add(time.Duration(cut) * time.Second)
+        }
+        want := NewInMemoryStorage()
+        for _, e := range all {
+            if e.Tenant != "acme" || (!before.IsZero() && !e.Timestamp.Before(before)) {
+                want.AddEvent(e)
+            }
+        }
+        n := len(s.events)
+        s.Delete("acme", before)
+        compacted = compacted || len(s.events) < n
+
+        for _, tenant := range []string{"", "acme"} {
+            if a, b := sortedGroups(want.GetAllAggregated(tenant)), sortedGroups(s.GetAllAggregated(tenant)); a != b {
+                t.Errorf("Cut %v: expected groups %s, got %s", cut, a, b)
+            }
+            to := base.Add(time.Hour)
+            if a, b := sortedRollup(want.Rollup(tenant, DimensionType, GroupFilter{To: to})), sortedRollup(s.Rollup(tenant, DimensionType, GroupFilter{To: to})); a != b {
+                t.Errorf("Cut %v: expected rollup %s, got %s", cut, a, b)
+            }
+            a, _ := want.SearchEvents(tenant, EventQuery{UserID: "user-3", Asc: true})
+            b, _ := s.SearchEvents(tenant, EventQuery{UserID: "user-3", Asc: true})
+            if eventIDs(a.Events) != eventIDs(b.Events) {
+                t.Errorf("Cut %v: expected events %s, got %s", cut, eventIDs(a.Events), eventIDs(b.Events))
+            }
+        }
+        if a, b := fmt.Sprint(want.Stats()), fmt.Sprint(s.Stats()); a != b {
+            t.Errorf("Cut %v: expected stats %s, got %s", cut, a, b)
+        }
+        if a, b := eventIDs(want.Snapshot()), eventIDs(s.Snapshot()); a != b {
+            t.Errorf("Cut %v: expected snapshot %s, got %s", cut, a, b)
+        }
+        if _, ok := s.GetEvent("", "3"); !ok {
+            t.Errorf("Cut %v: expected event 3 of default tenant to be kept", cut)
+        }
+    }
+    if !compacted || len(s.events)-s.dead != 200 {
+        t.Errorf("Expected compaction and 200 events, got %d (%d removed)", len(s.events), s.dead)
+    }
+}
+
+func TestInMemoryStorage_TenantIsolation(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    s.AddEvent(models.Event{ID: "1", Tenant: "acme", Type: "click", UserID: "user-1", Value: 10, Timestamp: now})
+    s.AddEvent(models.Event{ID: "2", Tenant: "globex", Type: "click", UserID: "user-1", Value: 20, Timestamp: now})
+    s.AddEvent(models.Event{ID: "3", Type: "click", UserID: "user-1", Value: 40, Timestamp: now})
+
+    agg := s.GetAggregated("acme", "user-1", "click", time.Time{}, time.Time{})
+    if agg == nil || agg.Count != 1 || agg.TotalValue != 10 || agg.Tenant != "acme" {
+        t.Errorf("Unexpected acme aggregate: %+v", agg)
+    }
+    if agg := s.GetAggregated("", "", "", time.Time{}, time.Time{}); agg == nil || agg.TotalValue != 40 {
+        t.Errorf("Unexpected default tenant aggregate: %+v", agg)
+    }
+    if all := s.GetAllAggregated("globex"); len(all) != 1 || all[0].TotalValue != 20 {
+        t.Errorf("Unexpected globex aggregates: %+v", all)
+    }
+    if agg := s.GetAggregated("initech", "user-1", "", time.Time{}, time.Time{}); agg != nil {
+        t.Errorf("Expected no data for unknown tenant, got %+v", agg)
+    }
+}
+
+func TestInMemoryStorage_DeleteAndStats(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    s.AddEvent(models.Event{ID: "1", Tenant: "acme", Type: "click", UserID: "user-1", Value: 1, Timestamp: now.Add(-48 * time.Hour)})
+    s.AddEvent(models.Event{ID: "2", Tenant: "acme", Type: "view", UserID: "user-2", Value: 2, Timestamp: now})
+    s.AddEvent(models.Event{ID: "3", Tenant: "globex", Type: "click", UserID: "user-1", Value: 3, Timestamp: now.Add(-48 * time.Hour)})
+
+    stats := s.Stats()
+    if len(stats) != 2 || stats[0].Tenant != "acme" || stats[0].Events != 2 || stats[0].Users != 2 || stats[0].EventTypes != 2 {
+        t.Errorf("Unexpected stats: %+v", stats)
+    }
+
+    if n := s.Delete("acme", now.Add(-24*time.Hour)); n != 1 {
+        t.Errorf("Expected 1 deleted event, got %d", n)
+    }
+    if s.Count("acme") != 1 || s.Count("globex") != 1 {
+        t.Errorf("Unexpected counts: acme=%d globex=%d", s.Count("acme"), s.Count("globex"))
+    }
+    if n := s.Delete("globex", time.Time{}); n != 1 || s.Count("globex") != 0 {
+        t.Errorf("Expected all globex events deleted, got %d", n)
+    }
+    if len(s.Snapshot()) != 1 {
+        t.Errorf("Expected 1 remaining event, got %d", len(s.Snapshot()))
+    }
+}
+
 func TestInMemoryStorage_Concurrency(t *testing.T) {
     s := NewInMemoryStorage()
     now := time.Now()
@@ -150,3 +527,720 @@ func TestInMemoryStorage_Concurrency(t *testing.T) {
         t.Errorf("Expected 1000 events, got %d", len(s.events))
     }
 }
+
+func TestInMemoryStorage_SnapshotAndPurge(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    s.AddEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 10, Timestamp: now})
+    s.AddEvent(models.Event{ID: "2", Type: "view", UserID: "user-2", Value: 20, Timestamp: now})
+
+    snapshot := s.Snapshot()
+    if len(snapshot) != 2 {
+        t.Fatalf("Expected 2 events in snapshot, got %d", len(snapshot))
+    }
+
+    // Снимок не должен зависеть от последующих изменений
+    if n := s.Purge(); n != 2 {
+        t.Errorf("Expected 2 purged events, got %d", n)
+    }
+    if len(snapshot) != 2 || snapshot[0].ID != "1" {
+        t.Error("Snapshot changed after purge")
+    }
+    if len(s.GetAllAggregated("")) != 0 {
+        t.Error("Expected empty storage after purge")
+    }
+}
+
+func TestInMemoryStorage_RollupSnapshot(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+    s.AddEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 10, Timestamp: now})
+
+    first := s.GetAllAggregated("")
+    if len(first) != 1 || first[0].Count != 1 {
+        t.Fatalf("Expected 1 group with 1 event, got %+v", first)
+    }
+    // Результат - копия, снимок не меняется вызывающим
+    first[0].Count = 100
+    if again := s.GetAllAggregated(""); again[0].Count != 1 {
+        t.Errorf("Expected snapshot to be immutable, got count %d", again[0].Count)
+    }
+
+    s.AddEvent(models.Event{ID: "2", Type: "click", UserID: "user-1", Value: 20, Timestamp: now.Add(time.Second)})
+    if all := s.GetAllAggregated(""); all[0].Count != 2 || all[0].AvgValue != 15 {
+        t.Errorf("Expected snapshot refreshed after AddEvent, got %+v", all[0])
+    }
+
+    s.Delete("", now.Add(time.Millisecond))
+    if all := s.GetAllAggregated(""); all[0].Count != 1 || all[0].MinValue != 20 {
+        t.Errorf("Expected snapshot refreshed after Delete, got %+v", all[0])
+    }
+}
+
+func TestInMemoryStorage_RollupSnapshotReadAfterWrite(t *testing.T) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    // Каждый писатель сразу видит своё событие в снимке, даже когда снимок
+    // строит другой читатель
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func(id int) {
+            defer wg.Done()
+            user := "user-" + strconv.Itoa(id)
+            for j := 1; j <= 100; j++ {
+                s.AddEvent(models.Event{ID: strconv.Itoa(id*1000 + j), Type: "click", UserID: user, Value: 1, Timestamp: now})
+                var count int64
+                for _, g := range s.GetAllAggregated("") {
+                    if g.UserID == user {
+                        count = g.Count
+                    }
+                }
+                if count != int64(j) {
+                    t.Errorf("Expected %d events of %s, got %d", j, user, count)
+                    return
+                }
+            }
+        }(i)
+    }
+    wg.Wait()
+}
+
+func TestShardedStorage_MatchesInMemory(t *testing.T) {
+    checkMatchesInMemory(t, NewShardedStorage(4), 200)
+}
+
+func TestColumnarStorage_MatchesInMemory(t *testing.T) {
+    // Больше двух блоков, чтобы проверить запечатывание и пропуск блоков
+    checkMatchesInMemory(t, NewColumnarStorage(), 2*BlockSize+200)
+}
+
+func TestColumnarStorage_GetEvent(t *testing.T) {
+    s := NewColumnarStorage()
+    base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    n := 2*BlockSize + 10
+    for i := 0; i < n; i++ {
+        s.AddEvent(models.Event{ID: "id-" + strconv.Itoa(i), Type: "click", UserID: "user-1", Value: float64(i), Timestamp: base.Add(time.Duration(i) * time.Second)})
+    }
+    // При повторе ID - последнее принятое событие
+    s.AddEvent(models.Event{ID: "id-5", Type: "click", UserID: "user-2", Value: -1, Timestamp: base})
+
+    for _, id := range []string{"id-0", "id-" + strconv.Itoa(BlockSize), "id-" + strconv.Itoa(n-1)} {
+        if e, ok := s.GetEvent("", id); !ok || e.ID != id {
+            t.Errorf("Expected event %s, got %+v", id, e)
+        }
+    }
+    if e, ok := s.GetEvent("", "id-5"); !ok || e.Value != -1 || e.UserID != "user-2" {
+        t.Errorf("Expected latest id-5, got %+v", e)
+    }
+    if _, ok := s.GetEvent("", "id-missing"); ok {
+        t.Error("Expected missing event")
+    }
+
+    // Совпадение хешей: строка по хешу не та, событие находится перебором
+    c := s.tenants[""]
+    c.byID[maphash.String(idSeed, "id-7")] = c.byID[maphash.String(idSeed, "id-8")]
+    if e, ok := s.GetEvent("", "id-7"); !ok || e.Value != 7 {
+        t.Errorf("Expected id-7 after hash collision, got %+v", e)
+    }
+
+    s.Delete("", base.Add(time.Duration(BlockSize)*time.Second))
+    if _, ok := s.GetEvent("", "id-10"); ok {
+        t.Error("Expected deleted event to be missing")
+    }
+    if e, ok := s.GetEvent("", "id-"+strconv.Itoa(n-1)); !ok || e.Value != float64(n-1) {
+        t.Errorf("Expected last event after delete, got %+v", e)
+    }
+}
+
+func TestColumnarStorage_DeleteBlocks(t *testing.T) {
+    s := NewColumnarStorage()
+    base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    n := 3 * BlockSize
+    for i := 0; i < n; i++ {
+        s.AddEvent(models.Event{ID: "id-" + strconv.Itoa(i), Type: "click", UserID: "user-" + strconv.Itoa(i), Value: 1, Timestamp: base.Add(time.Duration(i) * time.Second)})
+    }
+    // Повтор последнего ID доставлен позже со старым timestamp (в новом блоке)
+    s.AddEvent(models.Event{ID: "id-" + strconv.Itoa(n-1), Type: "click", UserID: "user-x", Value: 2, Timestamp: base})
+    c := s.tenants[""]
+    dict, third := c.dict, c.blocks[2]
+
+    // Первый блок и блок с повтором отбрасываются, второй перекодируется,
+    // третий не меняется
+    if d := s.Delete("", base.Add(time.Duration(BlockSize+10)*time.Second)); d != BlockSize+11 {
+        t.Fatalf("Expected %d deleted events, got %d", BlockSize+11, d)
+    }
+    if len(c.blocks) != 2 || c.blocks[0].n != BlockSize-10 || c.blocks[1] != third {
+        t.Errorf("Expected only the straddling blocks to be re-encoded, got %d blocks", len(c.blocks))
+    }
+    if s.tenants[""].dict != dict {
+        t.Error("Expected dictionary to be kept")
+    }
+    if _, ok := s.GetEvent("", "id-5"); ok {
+        t.Error("Expected deleted event to be missing")
+    }
+    for _, id := range []int{BlockSize + 10, 2*BlockSize + 1} {
+        if e, ok := s.GetEvent("", "id-"+strconv.Itoa(id)); !ok || e.UserID != "user-"+strconv.Itoa(id) {
+            t.Errorf("Expected event id-%d, got %+v, %v", id, e, ok)
+        }
+    }
+    // Удалено последнее событие с повторным ID: находится предыдущее
+    if e, ok := s.GetEvent("", "id-"+strconv.Itoa(n-1)); !ok || e.Value != 1 {
+        t.Errorf("Expected surviving duplicate, got %+v, %v", e, ok)
+    }
+    s.AddEvent(models.Event{ID: "new", Type: "click", UserID: "user-1", Value: 1, Timestamp: base.Add(time.Duration(n) * time.Second)})
+    if e, ok := s.GetEvent("", "new"); !ok || e.UserID != "user-1" {
+        t.Errorf("Expected event added after delete, got %+v, %v", e, ok)
+    }
+
+    // Удалено больше половины закодированных событий - новый словарь
+    s.Delete("", base.Add(time.Duration(2*BlockSize+BlockSize/2)*time.Second))
+    if c := s.tenants[""]; c.dict == dict || c.count != BlockSize/2+1 || len(c.dict.strs) > BlockSize {
+        t.Errorf("Expected re-encoded tenant with %d events, got %d events and %d strings", BlockSize/2+1, c.count, len(c.dict.strs))
+    }
+    if e, ok := s.GetEvent("", "id-"+strconv.Itoa(n-1)); !ok || e.Value != 1 {
+        t.Errorf("Expected id-%d after re-encoding, got %+v, %v", n-1, e, ok)
+    }
+}
+
+func TestSQLiteStorage_MatchesInMemory(t *testing.T) {
+    s, err := OpenSQLite(filepath.Join(t.TempDir(), "events.db"))
+    if err != nil {
+        t.Fatalf("OpenSQLite failed: %v", err)
+    }
+    defer s.Close()
+    checkMatchesInMemory(t, s, 500)
+}
+
+func TestSQLiteStorage_WriteFailure(t *testing.T) {
+    s, err := OpenSQLite(filepath.Join(t.TempDir(), "events.db"))
+    if err != nil {
+        t.Fatalf("OpenSQLite failed: %v", err)
+    }
+    var failed []models.Event
+    s.OnWriteFailure(func(events []models.Event, err error) {
+        failed = append(failed, events...)
+    })
+
+    s.AddEvents([]models.Event{{ID: "1", Type: "click", UserID: "user-1", Timestamp: time.Now()}})
+    s.Close()
+    s.AddEvents([]models.Event{{ID: "2", Type: "click", UserID: "user-1", Timestamp: time.Now()}})
+
+    if len(failed) != 1 || failed[0].ID != "2" {
+        t.Errorf("Expected failed batch with event 2, got %+v", failed)
+    }
+    want := WriteStats{Batches: 2, Retries: insertAttempts - 1, FailedBatches: 1, FailedEvents: 1}
+    if st := s.WriteStats(); st != want {
+        t.Errorf("Expected %+v, got %+v", want, st)
+    }
+}
+
+func TestSQLiteStorage_Merge(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "events.db")
+    // Временная база от прошлого запуска удаляется
+    os.WriteFile(path+".replay-stale.db", []byte("x"), 0o644)
+
+    live, newStorage, err := Factory(EngineSQLite, path)
+    if err != nil {
+        t.Fatalf("Factory failed: %v", err)
+    }
+    defer live.(*SQLiteStorage).Close()
+    if _, err := os.Stat(path + ".replay-stale.db"); !os.IsNotExist(err) {
+        t.Errorf("Expected stale replay database to be removed, got %v", err)
+    }
+
+    now := time.Now()
+    live.AddEvent(models.Event{ID: "1", Type: "click", UserID: "user-1", Value: 1, Timestamp: now})
+    replica, err := newStorage()
+    if err != nil {
+        t.Fatalf("newStorage failed: %v", err)
+    }
+    temps, _ := filepath.Glob(path + ".replay-*.db")
+    if len(temps) != 1 {
+        t.Fatalf("Expected replay database next to %s, got %v", path, temps)
+    }
+    for _, id := range []string{"1", "2", "3"} {
+        replica.AddEvent(models.Event{ID: id, Type: "click", UserID: "user-1", Value: 10, Timestamp: now, Attributes: map[string]string{"k": id}})
+    }
+    replica.AddEvent(models.Event{ID: "1", Tenant: "acme", Type: "click", UserID: "user-1", Value: 10, Timestamp: now})
+
+    n, err := live.(Merger).Merge(replica)
+    if err != nil || n != 3 {
+        t.Errorf("Expected 3 merged events, got %d, %v", n, err)
+    }
+    if e, ok := live.GetEvent("", "1"); !ok || e.Value != 1 {
+        t.Errorf("Expected live event 1 to be kept, got %+v", e)
+    }
+    if e, ok := live.GetEvent("", "3"); !ok || e.Attributes["k"] != "3" {
+        t.Errorf("Expected merged event 3, got %+v", e)
+    }
+    replica.(*SQLiteStorage).Close()
+    if _, err := os.Stat(temps[0]); !os.IsNotExist(err) {
+        t.Errorf("Expected replay database to be removed on Close, got %v", err)
+    }
+
+    // Хранилище не в файле - по событиям
+    mem := NewInMemoryStorage()
+    mem.AddEvent(models.Event{ID: "3", Type: "click", UserID: "user-1", Timestamp: now})
+    mem.AddEvent(models.Event{ID: "4", Type: "click", UserID: "user-1", Timestamp: now})
+    if n, err := live.(Merger).Merge(mem); err != nil || n != 1 || live.Count("") != 4 {
+        t.Errorf("Expected 1 merged event and 4 total, got %d (%d), %v", n, live.Count(""), err)
+    }
+}
+
+func TestSQLiteStorage_PersistsAndMigrates(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "events.db")
+    s, err := OpenSQLite(path)
+    if err != nil {
+        t.Fatalf("OpenSQLite failed: %v", err)
+    }
+    ts := time.Date(2024, 5, 1, 12, 0, 0, 500000000, time.UTC)
+    s.AddEvents([]models.Event{
+        {ID: "1", Type: "click", UserID: "user-1", Value: 1.5, Timestamp: ts, Attributes: map[string]string{"country": "DE"}},
+        {ID: "2", Type: "view", UserID: "user-2", Value: 2, Timestamp: ts},
+    })
+    s.Close()
+
+    // Повторное открытие не применяет миграции заново и видит события
+    s, err = OpenSQLite(path)
+    if err != nil {
+        t.Fatalf("Reopen failed: %v", err)
+    }
+    defer s.Close()
+    if n := s.Count(""); n != 2 {
+        t.Errorf("Expected 2 persisted events, got %d", n)
+    }
+    var version int
+    if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != len(migrations) {
+        t.Errorf("Expected schema version %d, got %d (%v)", len(migrations), version, err)
+    }
+    var timestamp string
+    if err := s.db.QueryRow("SELECT timestamp FROM events_readable WHERE id = '1'").Scan(&timestamp); err != nil || timestamp != "2024-05-01T12:00:00.500Z" {
+        t.Errorf("Expected readable timestamp, got %q (%v)", timestamp, err)
+    }
+    if e, ok := s.GetEvent("", "1"); !ok || e.Attributes["country"] != "DE" || !e.Timestamp.Equal(ts) {
+        t.Errorf("Expected event 1 restored, got %+v", e)
+    }
+
+    if _, err := s.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations)+1)); err != nil {
+        t.Fatalf("Failed to bump version: %v", err)
+    }
+    s.Close()
+    if _, err := OpenSQLite(path); err == nil {
+        t.Error("Expected error for schema newer than supported")
+    }
+}
+
+// checkMatchesInMemory проверяет, что s отвечает на запросы так же, как
+// InMemoryStorage с теми же n событиями
+func checkMatchesInMemory(t *testing.T, s Storage, n int) {
+    t.Helper()
+    single := NewInMemoryStorage()
+    base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+    types := []string{"click", "view"}
+    for i := 0; i < n; i++ {
+        e := models.Event{
+            ID:        strconv.Itoa(i),
+            Tenant:    []string{"", "acme"}[i%2],
+            Type:      types[i%3%2],
+            UserID:    "user-" + strconv.Itoa(i%7),
+            Value:     float64(i % 13),
+            Timestamp: base.Add(time.Duration(i%500) * time.Second),
+        }
+        if i%5 == 0 {
+            e.Value += 0.25
+            e.Unit = "ms"
+        }
+        if i%4 != 0 {
+            e.Attributes = map[string]string{"country": []string{"RU", "US", "DE"}[i%3]}
+        }
+        single.AddEvent(e)
+        s.AddEvent(e)
+    }
+    from, to := base.Add(100*time.Second), base.Add(300*time.Second)
+
+    if a, b := single.GetAggregated("", "", "click", from, to), s.GetAggregated("", "", "click", from, to); fmt.Sprint(*a) != fmt.Sprint(*b) {
+        t.Errorf("Expected %+v, got %+v", *a, *b)
+    }
+    if a, b := single.GetAggregated("acme", "user-3", "", time.Time{}, to), s.GetAggregated("acme", "user-3", "", time.Time{}, to); fmt.Sprint(*a) != fmt.Sprint(*b) {
+        t.Errorf("Expected %+v, got %+v", *a, *b)
+    }
+    if a, b := sortedGroups(single.GetGroupedAggregated("acme", GroupFilter{From: from, UserPrefix: "user-1"})), sortedGroups(s.GetGroupedAggregated("acme", GroupFilter{From: from, UserPrefix: "user-1"})); a != b {
+        t.Errorf("Expected groups %s, got %s", a, b)
+    }
+    if a, b := sortedGroups(single.GetAllAggregated("")), sortedGroups(s.GetAllAggregated("")); a != b {
+        t.Errorf("Expected all groups %s, got %s", a, b)
+    }
+    country, _ := ParseDimension("attributes.country")
+    for _, by := range []Dimension{DimensionUser, DimensionType, country} {
+        if a, b := sortedRollup(single.Rollup("", by, GroupFilter{To: to})), sortedRollup(s.Rollup("", by, GroupFilter{To: to})); a != b {
+            t.Errorf("Expected rollup by %s %s, got %s", by, a, b)
+        }
+    }
+    if a, b := fmt.Sprint(single.Stats()), fmt.Sprint(s.Stats()); a != b {
+        t.Errorf("Expected stats %s, got %s", a, b)
+    }
+
+    // Постраничный поиск совпадает с поиском одной страницей в InMemoryStorage
+    minValue := 3.0
+    for _, query := range []EventQuery{
+        {EventType: "view"},
+        {From: from, To: to, Attributes: map[string]string{"country": "US"}, MinValue: &minValue},
+    } {
+        for _, asc := range []bool{true, false} {
+            var got []models.Event
+            q := query
+            q.Asc, q.Limit = asc, 7
+            for {
+                page, err := s.SearchEvents("", q)
+                if err != nil {
+                    t.Fatalf("Unexpected error: %v", err)
+                }
+                got = append(got, page.Events...)
+                if page.NextCursor == "" {
+                    break
+                }
+                q.Cursor = page.NextCursor
+            }
+            q.Limit, q.Cursor = 0, ""
+            want, _ := single.SearchEvents("", q)
+            if eventIDs(want.Events) != eventIDs(got) {
+                t.Errorf("Expected search order %s, got %s", eventIDs(want.Events), eventIDs(got))
+            }
+        }
+    }
+
+    if a, b := fmt.Sprint(single.Snapshot()), fmt.Sprint(s.Snapshot()); a != b {
+        t.Errorf("Expected snapshot in ingestion order %s, got %s", a, b)
+    }
+    if e, ok := s.GetEvent("acme", "41"); !ok || e.UserID != "user-6" {
+        t.Errorf("Expected event 41 of user-6, got %+v, %v", e, ok)
+    }
+    if a, b := single.Delete("", from), s.Delete("", from); a != b || fmt.Sprint(single.Snapshot()) != fmt.Sprint(s.Snapshot()) {
+        t.Errorf("Expected %d events deleted before %v, got %d", a, from, b)
+    }
+    if d := s.Delete("acme", time.Time{}); d != n/2 || s.Count("acme") != 0 {
+        t.Errorf("Expected %d acme events deleted, got %d", n/2, d)
+    }
+}
+
+func sortedGroups(groups []models.AggregatedData) string {
+    items := make([]string, len(groups))
+    for i, g := range groups {
+        items[i] = fmt.Sprintf("%+v", g)
+    }
+    slices.Sort(items)
+    return strings.Join(items, "\n")
+}
+
+func sortedRollup(groups []Group) string {
+    items := make([]string, len(groups))
+    for i, g := range groups {
+        items[i] = fmt.Sprintf("%+v", g)
+    }
+    slices.Sort(items)
+    return strings.Join(items, "\n")
+}
+
+func eventIDs(events []models.Event) string {
+    ids := make([]string, len(events))
+    for i, e := range events {
+        ids[i] = e.ID
+    }
+    return strings.Join(ids, ",")
+}
+
+// TestShardedStorage_Concurrency - приём и запросы одновременно; имеет
+// смысл с -race
+func TestShardedStorage_Concurrency(t *testing.T) {
+    s := NewShardedStorage(4)
+    now := time.Now()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(2)
+        go func(id int) {
+            defer wg.Done()
+            for j := 0; j < 200; j++ {
+                s.AddEvent(models.Event{
+                    ID:        strconv.Itoa(id*1000 + j),
+                    Type:      "click",
+                    UserID:    "user-" + strconv.Itoa(j%10),
+                    Value:     float64(j),
+                    Timestamp: now.Add(time.Duration(j) * time.Millisecond),
+                })
+            }
+        }(i)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 50; j++ {
+                s.GetAllAggregated("")
+                s.GetAggregated("", "", "click", now, time.Time{})
+                s.SearchEvents("", EventQuery{Limit: 10})
+            }
+        }()
+    }
+    wg.Wait()
+
+    if n := s.Count(""); n != 1600 {
+        t.Errorf("Expected 1600 events, got %d", n)
+    }
+    var total int64
+    for _, g := range s.GetAllAggregated("") {
+        total += g.Count
+    }
+    if total != 1600 {
+        t.Errorf("Expected 1600 events in aggregates, got %d", total)
+    }
+}
+
+// fillStorage заполняет хранилище n событиями по users пользователям и 3 типам
+func fillStorage(s Storage, n, users int) time.Time {
+    types := []string{"click", "view", "purchase"}
+    start := time.Now()
+    for i := 0; i < n; i++ {
+        s.AddEvent(models.Event{
+            ID:        uuid.New().String(),
+            Type:      types[i%len(types)],
+            UserID:    "user-" + strconv.Itoa(i%users),
+            Value:     float64(i % 100),
+            Timestamp: start.Add(time.Duration(i) * time.Millisecond),
+        })
+    }
+    return start
+}
+
+func BenchmarkInMemoryStorage_AddEvent(b *testing.B) {
+    s := NewInMemoryStorage()
+    now := time.Now()
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.AddEvent(models.Event{ID: "e", Type: "click", UserID: "user-1", Value: 1, Timestamp: now})
+    }
+}
+
+func BenchmarkColumnarStorage_GetEvent(b *testing.B) {
+    s := NewColumnarStorage()
+    fillStorage(s, 100000, 1000)
+    var ids []string
+    s.Scan("", GroupFilter{}, func(e models.Event) bool {
+        ids = append(ids, e.ID)
+        return true
+    })
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.GetEvent("", ids[i%len(ids)])
+    }
+}
+
+func BenchmarkInMemoryStorage_GetAggregated(b *testing.B) {
+    s := NewInMemoryStorage()
+    start := fillStorage(s, 100000, 1000)
+    from, to := start.Add(10*time.Second), start.Add(20*time.Second)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.GetAggregated("", "user-42", "click", from, to)
+    }
+}
+
+func BenchmarkInMemoryStorage_GetAllAggregated(b *testing.B) {
+    s := NewInMemoryStorage()
+    fillStorage(s, 100000, 1000)
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.GetAllAggregated("")
+    }
+}
+
+// BenchmarkInMemoryStorage_GetAllAggregatedUnderIngest - чтения агрегатов
+// при непрерывном приёме: одновременные читатели ждут одну пересборку
+// снимка, а не строят каждый свою
+func BenchmarkInMemoryStorage_GetAllAggregatedUnderIngest(b *testing.B) {
+    s := NewInMemoryStorage()
+    start := fillStorage(s, 100000, 1000)
+
+    stop := make(chan struct{})
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for i := 0; ; i++ {
+            select {
+            case <-stop:
+                return
+            default:
+            }
+            s.AddEvent(models.Event{ID: "e", Type: "view", UserID: "user-" + strconv.Itoa(i%1000), Value: 1, Timestamp: start})
+        }
+    }()
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        s.GetAllAggregated("")
+    }
+    b.StopTimer()
+    close(stop)
+    <-done
+}
+
+// benchEvents - размер хранилища для BenchmarkInMemoryStorage_RangeQuery;
+// переопределяется переменной окружения BENCH_EVENTS
+func benchEvents(b *testing.B) int {
+    if testing.Short() {
+        b.Skip("skipping large storage benchmark in short mode")
+    }
+    if n, err := strconv.Atoi(os.Getenv("BENCH_EVENTS")); err == nil && n > 0 {
+        return n
+    }
+    return 10000000
+}
+
+// scanAggregated - агрегат полным перебором событий, как без индексов
+func scanAggregated(s *InMemoryStorage, userID, eventType string, from, to time.Time) int64 {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    var count int64
+    for _, e := range s.events {
+        if e.UserID == userID && e.Type == eventType &&
+            !e.Timestamp.Before(from) && !e.Timestamp.After(to) {
+            count++
+        }
+    }
+    return count
+}
+
+// BenchmarkInMemoryStorage_RangeQuery сравнивает запросы за интервал по
+// индексам с полным перебором:
+//
+//    go test ./internal/storage -run '^$' -bench RangeQuery -benchtime 10x
+func BenchmarkInMemoryStorage_RangeQuery(b *testing.B) {
+    n := benchEvents(b)
+    s := NewInMemoryStorage()
+    start := fillStorage(s, n, 10000)
+    // Десятая часть всего интервала, в середине
+    span := time.Duration(n) * time.Millisecond
+    from := start.Add(span / 2)
+    to := from.Add(span / 10)
+
+    b.Run("scan", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            scanAggregated(s, "user-42", "click", from, to)
+        }
+    })
+    b.Run("user", func(b *testing.B) {
+        for i := 0; i < b.N; i++ {
+            s.GetAggregated("", "user-42", "click", from, to)
+        }
+    })
+    b.Run("type", func(b *testing.B) {
+        filter := GroupFilter{EventType: "purchase", From: from, To: to}
+        for i := 0; i < b.N; i++ {
+            s.Rollup("", DimensionType, filter)
+        }
+    })
+    b.Run("search", func(b *testing.B) {
+        q := EventQuery{EventType: "view", From: from, To: to, Limit: 100}
+        for i := 0; i < b.N; i++ {
+            s.SearchEvents("", q)
+        }
+    })
+}
+
+// benchmarkIngestUnderLoad измеряет AddEvent, пока в фоне непрерывно
+// выполняются запросы по всем событиям тенанта
+func benchmarkIngestUnderLoad(b *testing.B, s Storage) {
+    start := time.Now()
+    for i := 0; i < 100000; i++ {
+        s.AddEvent(models.Event{
+            ID:        strconv.Itoa(i),
+            Type:      "click",
+            UserID:    "user-" + strconv.Itoa(i%1000),
+            Value:     float64(i % 100),
+            Timestamp: start.Add(time.Duration(i) * time.Millisecond),
+        })
+    }
+
+    stop := make(chan struct{})
+    var wg sync.WaitGroup
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                s.GetGroupedAggregated("", GroupFilter{UserPrefix: "user-"})
+                s.GetAllAggregated("")
+            }
+        }()
+    }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    b.RunParallel(func(pb *testing.PB) {
+        i := 0
+        for pb.Next() {
+            s.AddEvent(models.Event{ID: "e", Type: "view", UserID: "user-" + strconv.Itoa(i%1000), Value: 1, Timestamp: start})
+            i++
+        }
+    })
+    b.StopTimer()
+    close(stop)
+    wg.Wait()
+}
+
+// BenchmarkStorage_IngestUnderQueryLoad сравнивает задержку приёма под
+// нагрузкой запросами у одного хранилища и у шардированного:
+//
+//    go test ./internal/storage -run '^$' -bench IngestUnderQueryLoad -cpu 1,4
+func BenchmarkStorage_IngestUnderQueryLoad(b *testing.B) {
+    b.Run("single", func(b *testing.B) { benchmarkIngestUnderLoad(b, NewInMemoryStorage()) })
+    b.Run("sharded", func(b *testing.B) { benchmarkIngestUnderLoad(b, NewShardedStorage(DefaultShards)) })
+}
+
+// heapInUse - занятая куча после сборки мусора
+func heapInUse() uint64 {
+    var m runtime.MemStats
+    runtime.GC()
+    runtime.ReadMemStats(&m)
+    return m.HeapAlloc
+}
+
+// BenchmarkStorage_MemoryPerEvent сравнивает память на событие у движков
+// хранилища:
+//
+//    go test ./internal/storage -run '^$' -bench MemoryPerEvent -benchtime 1x
+func BenchmarkStorage_MemoryPerEvent(b *testing.B) {
+    const n = 1000000
+    engines := map[string]func() Storage{
+        "memory":   func() Storage { return NewInMemoryStorage() },
+        "columnar": func() Storage { return NewColumnarStorage() },
+    }
+    for _, name := range []string{"memory", "columnar"} {
+        b.Run(name, func(b *testing.B) {
+            var perEvent float64
+            for i := 0; i < b.N; i++ {
+                before := heapInUse()
+                s := engines[name]()
+                fillStorage(s, n, 10000)
+                perEvent = float64(heapInUse()-before) / n
+                runtime.KeepAlive(s)
+            }
+            b.ReportMetric(perEvent, "bytes/event")
+        })
+    }
+}
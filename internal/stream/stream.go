@@ -0,0 +1,197 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+var (
+	// ErrClosed возвращается при подписке на закрытый hub
+	ErrClosed = errors.New("stream hub is closed")
+	// ErrSlowConsumer - подписчик не успевал читать и был отключён
+	ErrSlowConsumer = errors.New("slow consumer disconnected")
+)
+
+// Filter отбирает события для подписчика; пустые поля не фильтруют, кроме
+// Tenant: подписчик видит только события своего тенанта
+type Filter struct {
+	Tenant     string
+	UserID     string
+	Type       string
+	Attributes map[string]string
+}
+
+func (f Filter) Match(e models.Event) bool {
+	if e.Tenant != f.Tenant {
+		return false
+	}
+	if f.UserID != "" && e.UserID != f.UserID {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	for k, v := range f.Attributes {
+		if e.Attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Message - событие с порядковым номером в потоке
+type Message struct {
+	Seq   uint64
+	Event models.Event
+}
+
+// Hub раздаёт принятые события подписчикам и хранит последние
+// historySize сообщений для возобновления потока по Last-Event-ID
+type Hub struct {
+	mu          sync.Mutex
+	seq         uint64
+	history     []Message // кольцевой буфер, start - индекс самого старого
+	start       int
+	historySize int
+	bufferSize  int
+	subs        map[*Subscription]struct{}
+	closed      bool
+	done        chan struct{}
+}
+
+func NewHub(historySize, bufferSize int) *Hub {
+	return &Hub{
+		history:     make([]Message, 0, historySize),
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subs:        make(map[*Subscription]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Publish присваивает событию номер и рассылает его подписчикам.
+// Не блокируется: подписчики с переполненным буфером отключаются.
+func (h *Hub) Publish(e models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.seq++
+	msg := Message{Seq: h.seq, Event: e}
+	if h.historySize > 0 {
+		if len(h.history) < h.historySize {
+			h.history = append(h.history, msg)
+		} else {
+			h.history[h.start] = msg
+			h.start = (h.start + 1) % h.historySize
+		}
+	}
+
+	for sub := range h.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			h.removeLocked(sub, ErrSlowConsumer)
+		}
+	}
+}
+
+// Subscribe регистрирует подписчика. Возвращает также сообщения из истории
+// с номером больше afterSeq, подходящие под фильтр (afterSeq = 0 - без истории).
+func (h *Hub) Subscribe(f Filter, afterSeq uint64) (*Subscription, []Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, ErrClosed
+	}
+
+	var backlog []Message
+	if afterSeq > 0 {
+		for i := range h.history {
+			msg := h.history[(h.start+i)%len(h.history)]
+			if msg.Seq > afterSeq && f.Match(msg.Event) {
+				backlog = append(backlog, msg)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		hub:    h,
+		filter: f,
+		ch:     make(chan Message, h.bufferSize),
+		done:   make(chan struct{}),
+	}
+	h.subs[sub] = struct{}{}
+	return sub, backlog, nil
+}
+
+// Done закрывается при закрытии hub
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Close отключает всех подписчиков; последующие Publish игнорируются
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		h.removeLocked(sub, ErrClosed)
+	}
+	close(h.done)
+}
+
+func (h *Hub) removeLocked(sub *Subscription, err error) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+// Subscription - подписка на поток событий
+type Subscription struct {
+	hub    *Hub
+	filter Filter
+	ch     chan Message
+	done   chan struct{}
+	err    error
+}
+
+// C возвращает канал сообщений подписки
+func (s *Subscription) C() <-chan Message {
+	return s.ch
+}
+
+// Done закрывается, когда подписка завершена (Close, закрытие hub или медленный читатель)
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err возвращает причину завершения подписки после закрытия Done
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close отписывается от hub
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.removeLocked(s, nil)
+}
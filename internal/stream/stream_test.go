@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func TestFilter_Match(t *testing.T) {
+	e := models.Event{UserID: "user-1", Type: "click", Attributes: map[string]string{"country": "RU"}}
+
+	cases := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{UserID: "user-1", Type: "click"}, true},
+		{Filter{UserID: "user-2"}, false},
+		{Filter{Attributes: map[string]string{"country": "RU"}}, true},
+		{Filter{Attributes: map[string]string{"country": "US"}}, false},
+		{Filter{Tenant: "acme"}, false},
+	}
+
+	for i, c := range cases {
+		if got := c.filter.Match(e); got != c.want {
+			t.Errorf("case %d: expected %v, got %v", i, c.want, got)
+		}
+	}
+}
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	h := NewHub(10, 10)
+
+	sub, backlog, err := h.Subscribe(Filter{Type: "click"}, 0)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if len(backlog) != 0 {
+		t.Errorf("Expected empty backlog, got %d", len(backlog))
+	}
+
+	h.Publish(models.Event{ID: "1", Type: "view"})
+	h.Publish(models.Event{ID: "2", Type: "click"})
+
+	select {
+	case msg := <-sub.C():
+		if msg.Event.ID != "2" || msg.Seq != 2 {
+			t.Errorf("Unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected message")
+	}
+}
+
+func TestHub_ResumeFromHistory(t *testing.T) {
+	h := NewHub(3, 10)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		h.Publish(models.Event{ID: id})
+	}
+
+	// В истории остались только 3, 4, 5
+	_, backlog, err := h.Subscribe(Filter{}, 1)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if len(backlog) != 3 || backlog[0].Event.ID != "3" || backlog[2].Event.ID != "5" {
+		t.Errorf("Unexpected backlog: %+v", backlog)
+	}
+
+	_, backlog, _ = h.Subscribe(Filter{}, 4)
+	if len(backlog) != 1 || backlog[0].Seq != 5 {
+		t.Errorf("Expected only seq 5, got %+v", backlog)
+	}
+}
+
+func TestHub_SlowConsumer(t *testing.T) {
+	h := NewHub(0, 1)
+	sub, _, _ := h.Subscribe(Filter{}, 0)
+
+	h.Publish(models.Event{ID: "1"})
+	h.Publish(models.Event{ID: "2"})
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected slow consumer to be disconnected")
+	}
+	if sub.Err() != ErrSlowConsumer {
+		t.Errorf("Expected ErrSlowConsumer, got %v", sub.Err())
+	}
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub(10, 10)
+	sub, _, _ := h.Subscribe(Filter{}, 0)
+
+	h.Close()
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected subscription to be closed")
+	}
+	if _, _, err := h.Subscribe(Filter{}, 0); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	// Publish после закрытия не должен паниковать
+	h.Publish(models.Event{ID: "1"})
+}
@@ -0,0 +1,82 @@
+package tail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fingerprintSize - сколько первых байт файла используется для его опознания
+const fingerprintSize = 256
+
+// Position - сохранённая позиция чтения файла. Fingerprint - хэш уже прочитанного
+// начала файла: если после перезапуска он не совпадает, файл был заменён
+// (ротация, пересоздание) и читается с начала.
+type Position struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// fingerprint считает хэш первых min(n, fingerprintSize) байт файла
+func fingerprint(f *os.File, n int64) (string, error) {
+	if n > fingerprintSize {
+		n = fingerprintSize
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func loadPositions(filename string) (map[string]Position, error) {
+	positions := make(map[string]Position)
+	if filename == "" {
+		return positions, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return positions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// savePositions атомарно записывает позиции (через временный файл и rename)
+func savePositions(filename string, positions map[string]Position) error {
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
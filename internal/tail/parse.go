@@ -0,0 +1,103 @@
+package tail
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Форматы файлов
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// formatFor возвращает формат файла: явно заданный или по расширению (.csv - CSV, иначе NDJSON)
+func formatFor(path, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatNDJSON
+}
+
+func parseNDJSON(line string) (models.Event, error) {
+	var event models.Event
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// parseCSVHeader разбирает строку заголовка CSV-файла
+func parseCSVHeader(line string) ([]string, error) {
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	return header, nil
+}
+
+// parseCSV разбирает строку CSV по заголовку. Колонки id, type, user_id, value
+// и timestamp (RFC 3339) заполняют поля события, остальные непустые - атрибуты.
+// Поля с переводом строки внутри кавычек не поддерживаются.
+func parseCSV(header []string, line string) (models.Event, error) {
+	var event models.Event
+
+	r := csv.NewReader(strings.NewReader(line))
+	r.FieldsPerRecord = len(header)
+	record, err := r.Read()
+	if err != nil {
+		return event, err
+	}
+
+	for i, name := range header {
+		v := strings.TrimSpace(record[i])
+		switch name {
+		case "id":
+			event.ID = v
+		case "type":
+			event.Type = v
+		case "user_id":
+			event.UserID = v
+		case "value":
+			if v == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return event, fmt.Errorf("invalid value %q", v)
+			}
+			event.Value = f
+		case "timestamp":
+			if v == "" {
+				continue
+			}
+			ts, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return event, fmt.Errorf("invalid timestamp %q", v)
+			}
+			event.Timestamp = ts
+		default:
+			if v == "" {
+				continue
+			}
+			if event.Attributes == nil {
+				event.Attributes = make(map[string]string)
+			}
+			event.Attributes[name] = v
+		}
+	}
+	return event, nil
+}
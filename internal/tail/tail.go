@@ -0,0 +1,493 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/ingest"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+	"github.com/google/uuid"
+)
+
+// lineNamespace - пространство имён UUID (v5) событий строк без id
+var lineNamespace = uuid.MustParse("3b8c5e0a-7f4d-4f57-9a39-6d2f0c1e8b42")
+
+// Config - параметры источника. Path - файл или каталог; для каталога читаются
+// все файлы, подходящие под Pattern.
+type Config struct {
+	Path string `json:"path"`
+	// Pattern - шаблон имён файлов в каталоге (filepath.Match), по умолчанию "*"
+	Pattern string `json:"pattern,omitempty"`
+	// Format - ndjson или csv; по умолчанию определяется по расширению файла
+	Format string `json:"format,omitempty"`
+	// OffsetsFile - файл с позициями чтения; без него позиции не переживают перезапуск
+	OffsetsFile string `json:"offsets_file,omitempty"`
+	// QuarantineFile - NDJSON-файл для строк, которые не удалось разобрать
+	QuarantineFile string `json:"quarantine_file,omitempty"`
+	// PollInterval - период проверки файлов, по умолчанию 1s
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+}
+
+// Stats - счётчики работы источника
+type Stats struct {
+	Files     int64  `json:"files"`
+	Lines     uint64 `json:"lines"`
+	Events    uint64 `json:"events"`
+	Malformed uint64 `json:"malformed"`
+	// Rotations - обнаруженные ротации и усечения файлов
+	Rotations uint64 `json:"rotations"`
+}
+
+// QuarantineRecord - запись о строке, не прошедшей разбор или валидацию
+type QuarantineRecord struct {
+	Time   time.Time `json:"time"`
+	File   string    `json:"file"`
+	Offset int64     `json:"offset"`
+	// ID - ID события строки без своего id; при повторной отправке строки
+	// его стоит сохранить, чтобы повтор можно было отбросить
+	ID    string `json:"id,omitempty"`
+	Line  string `json:"line"`
+	Error string `json:"error"`
+}
+
+// Tailer читает события из файлов по мере их дозаписи и передаёт их агрегатору.
+// Позиция сохраняется только после того, как событие принято агрегатором,
+// поэтому после сбоя строки могут быть прочитаны повторно, но не потеряны.
+type Tailer struct {
+	aggregator *aggregator.Aggregator
+	config     Config
+
+	files     map[string]*tailedFile
+	positions map[string]Position
+	dirty     bool
+
+	quarantine *os.File
+
+	numFiles                 atomic.Int64
+	lines, events, malformed atomic.Uint64
+	rotations                atomic.Uint64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type tailedFile struct {
+	path   string
+	f      *os.File
+	info   os.FileInfo
+	format string
+	offset int64
+	header []string
+	// fingerprint считается по первым fpLen байтам файла
+	fingerprint string
+	fpLen       int64
+	// head - первые байты файла (до fingerprintSize) для ID строк
+	head []byte
+}
+
+func NewTailer(agg *aggregator.Aggregator, cfg Config) *Tailer {
+	if cfg.Pattern == "" {
+		cfg.Pattern = "*"
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Second
+	}
+	return &Tailer{
+		aggregator: agg,
+		config:     cfg,
+		files:      make(map[string]*tailedFile),
+	}
+}
+
+// Start загружает сохранённые позиции и запускает периодическое чтение файлов
+func (t *Tailer) Start(ctx context.Context) error {
+	positions, err := loadPositions(t.config.OffsetsFile)
+	if err != nil {
+		return err
+	}
+	t.positions = positions
+
+	if t.config.QuarantineFile != "" {
+		q, err := os.OpenFile(t.config.QuarantineFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		t.quarantine = q
+	}
+
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.config.PollInterval)
+		defer ticker.Stop()
+		for {
+			t.poll()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Printf("Tailing %s (pattern %q)", t.config.Path, t.config.Pattern)
+	return nil
+}
+
+// Close останавливает чтение, сохраняет позиции и закрывает файлы
+func (t *Tailer) Close() error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+	t.wg.Wait()
+
+	for _, tf := range t.files {
+		tf.f.Close()
+	}
+	t.files = map[string]*tailedFile{}
+	err := t.savePositions()
+	if t.quarantine != nil {
+		err = errors.Join(err, t.quarantine.Close())
+	}
+	return err
+}
+
+// Stats возвращает текущие значения счётчиков
+func (t *Tailer) Stats() Stats {
+	return Stats{
+		Files:     t.numFiles.Load(),
+		Lines:     t.lines.Load(),
+		Events:    t.events.Load(),
+		Malformed: t.malformed.Load(),
+		Rotations: t.rotations.Load(),
+	}
+}
+
+// poll - один проход: обнаружение новых, переименованных и усечённых файлов
+// и чтение дописанных строк
+func (t *Tailer) poll() {
+	current := t.list()
+
+	// Файлы, которые по прежнему пути теперь не найти: переименованы или заменены
+	for path, tf := range t.files {
+		info, ok := current[path]
+		if ok && os.SameFile(info, tf.info) {
+			if info.Size() < tf.offset {
+				log.Printf("File %s truncated, reading from start", path)
+				t.rotations.Add(1)
+				tf.reset()
+				t.positions[path] = Position{}
+				t.dirty = true
+			}
+			tf.info = info
+			continue
+		}
+
+		if newPath, ok := t.findMoved(tf, current); ok {
+			delete(t.files, path)
+			delete(t.positions, path)
+			tf.path = newPath
+			tf.info = current[newPath]
+			t.files[newPath] = tf
+			t.positions[newPath] = Position{Offset: tf.offset, Fingerprint: tf.fingerprint}
+			t.dirty = true
+			continue
+		}
+
+		// Ротация: дочитываем старый файл до конца и отпускаем его
+		t.read(tf, true)
+		tf.f.Close()
+		delete(t.files, path)
+		delete(t.positions, path)
+		t.dirty = true
+		t.rotations.Add(1)
+	}
+
+	// Сначала дочитываем старые файлы, затем открываем новые (в порядке имён)
+	paths := make([]string, 0, len(current))
+	for path := range current {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		tf, ok := t.files[path]
+		if !ok {
+			var err error
+			if tf, err = t.open(path, current[path]); err != nil {
+				log.Printf("tail: open %s: %v", path, err)
+				continue
+			}
+			t.files[path] = tf
+		}
+		t.read(tf, false)
+	}
+	t.numFiles.Store(int64(len(t.files)))
+
+	if t.dirty {
+		if err := t.savePositions(); err != nil {
+			log.Printf("tail: save offsets: %v", err)
+		}
+	}
+}
+
+// list возвращает отслеживаемые обычные файлы
+func (t *Tailer) list() map[string]os.FileInfo {
+	result := make(map[string]os.FileInfo)
+
+	info, err := os.Stat(t.config.Path)
+	if err != nil {
+		return result
+	}
+	if !info.IsDir() {
+		result[t.config.Path] = info
+		return result
+	}
+
+	entries, err := os.ReadDir(t.config.Path)
+	if err != nil {
+		log.Printf("tail: read dir %s: %v", t.config.Path, err)
+		return result
+	}
+	for _, e := range entries {
+		if match, _ := filepath.Match(t.config.Pattern, e.Name()); !match || !e.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(t.config.Path, e.Name())
+		if t.isOwnFile(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			result[path] = info
+		}
+	}
+	return result
+}
+
+// isOwnFile - файлы позиций и карантина, если они лежат в том же каталоге
+func (t *Tailer) isOwnFile(path string) bool {
+	for _, own := range []string{t.config.OffsetsFile, t.config.QuarantineFile} {
+		if own != "" && filepath.Clean(own) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return t.config.OffsetsFile != "" &&
+		strings.HasPrefix(filepath.Base(path), filepath.Base(t.config.OffsetsFile)+".tmp")
+}
+
+func (t *Tailer) findMoved(tf *tailedFile, current map[string]os.FileInfo) (string, bool) {
+	for path, info := range current {
+		if _, tracked := t.files[path]; !tracked && os.SameFile(info, tf.info) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// open открывает файл и восстанавливает позицию, если файл не был заменён
+func (t *Tailer) open(path string, info os.FileInfo) (*tailedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tf := &tailedFile{
+		path:   path,
+		f:      f,
+		info:   info,
+		format: formatFor(path, t.config.Format),
+	}
+
+	pos, ok := t.positions[path]
+	if !ok || pos.Offset > info.Size() {
+		return tf, nil
+	}
+	fp, err := fingerprint(f, pos.Offset)
+	if err != nil || fp != pos.Fingerprint {
+		log.Printf("File %s was replaced since last run, reading from start", path)
+		return tf, nil
+	}
+	tf.offset = pos.Offset
+	tf.fingerprint = fp
+	tf.fpLen = min(pos.Offset, fingerprintSize)
+
+	if tf.format == FormatCSV && tf.offset > 0 {
+		line, err := bufio.NewReader(io.NewSectionReader(f, 0, tf.offset)).ReadString('\n')
+		if err != nil {
+			return tf, nil
+		}
+		if tf.header, err = parseCSVHeader(strings.TrimRight(line, "\r\n")); err != nil {
+			tf.header = nil
+		}
+	}
+	return tf, nil
+}
+
+// read обрабатывает полные строки от текущей позиции. drain - файл больше не
+// будет дописываться, поэтому последняя строка без перевода строки тоже читается.
+func (t *Tailer) read(tf *tailedFile, drain bool) {
+	if _, err := tf.f.Seek(tf.offset, io.SeekStart); err != nil {
+		log.Printf("tail: seek %s: %v", tf.path, err)
+		return
+	}
+
+	start := tf.offset
+	r := bufio.NewReader(tf.f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !(drain && errors.Is(err, io.EOF) && line != "") {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("tail: read %s: %v", tf.path, err)
+			}
+			break
+		}
+		if !t.handleLine(tf, line) {
+			break
+		}
+		tf.offset += int64(len(line))
+	}
+
+	if tf.offset == start {
+		return
+	}
+	if tf.fpLen < fingerprintSize {
+		if fp, err := fingerprint(tf.f, tf.offset); err == nil {
+			tf.fingerprint = fp
+			tf.fpLen = min(tf.offset, fingerprintSize)
+		}
+	}
+	t.positions[tf.path] = Position{Offset: tf.offset, Fingerprint: tf.fingerprint}
+	t.dirty = true
+}
+
+// handleLine разбирает строку и передаёт событие агрегатору. false - агрегатор
+// не принял событие; строка будет прочитана снова при следующей проверке.
+func (t *Tailer) handleLine(tf *tailedFile, raw string) bool {
+	line := strings.TrimRight(raw, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	t.lines.Add(1)
+
+	if tf.format == FormatCSV && tf.header == nil {
+		header, err := parseCSVHeader(line)
+		if err != nil {
+			t.quarantineLine(tf, "", line, err)
+			return true
+		}
+		tf.header = header
+		return true
+	}
+
+	id, err := tf.lineID(raw)
+	if err != nil {
+		log.Printf("tail: %s: %v", tf.path, err)
+		return false
+	}
+	event, err := t.parse(tf, line)
+	if err == nil {
+		if event.ID == "" {
+			event.ID = id
+		}
+		err = ingest.Prepare(&event)
+	}
+	if err != nil {
+		t.quarantineLine(tf, id, line, err)
+		return true
+	}
+
+	if err := t.aggregator.ProcessEvent(event); err != nil {
+		if schema.IsValidation(err) {
+			// Повторная попытка не исправит событие
+			t.quarantineLine(tf, id, line, err)
+			return true
+		}
+		log.Printf("tail: %s: %v", tf.path, err)
+		return false
+	}
+	t.events.Add(1)
+	return true
+}
+
+func (t *Tailer) parse(tf *tailedFile, line string) (models.Event, error) {
+	if tf.format == FormatCSV {
+		return parseCSV(tf.header, line)
+	}
+	return parseNDJSON(line)
+}
+
+// lineID - ID события строки raw, начинающейся с текущей позиции, если в
+// строке нет своего id. ID зависит только от начала файла, позиции и самой
+// строки, поэтому строка, прочитанная повторно (после перезапуска со старой
+// позиции или повторной попытки), получает тот же ID.
+func (tf *tailedFile) lineID(raw string) (string, error) {
+	end := min(tf.offset+int64(len(raw)), fingerprintSize)
+	if int64(len(tf.head)) < end {
+		head := make([]byte, end)
+		if _, err := tf.f.ReadAt(head, 0); err != nil {
+			return "", err
+		}
+		tf.head = head
+	}
+	h := sha256.New()
+	h.Write(tf.head[:end])
+	binary.Write(h, binary.BigEndian, tf.offset)
+	h.Write([]byte(raw))
+	return uuid.NewSHA1(lineNamespace, h.Sum(nil)).String(), nil
+}
+
+func (t *Tailer) quarantineLine(tf *tailedFile, id, line string, cause error) {
+	t.malformed.Add(1)
+	if t.quarantine == nil {
+		log.Printf("tail: malformed line at %s:%d: %v", tf.path, tf.offset, cause)
+		return
+	}
+
+	data, _ := json.Marshal(QuarantineRecord{
+		Time:   time.Now(),
+		File:   tf.path,
+		Offset: tf.offset,
+		ID:     id,
+		Line:   line,
+		Error:  cause.Error(),
+	})
+	if _, err := t.quarantine.Write(append(data, '\n')); err != nil {
+		log.Printf("tail: write quarantine: %v", err)
+	}
+}
+
+func (t *Tailer) savePositions() error {
+	if t.config.OffsetsFile == "" || t.positions == nil {
+		return nil
+	}
+	if err := savePositions(t.config.OffsetsFile, t.positions); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// reset начинает чтение файла заново (после усечения)
+func (tf *tailedFile) reset() {
+	tf.offset = 0
+	tf.header = nil
+	tf.fingerprint = ""
+	tf.fpLen = 0
+	tf.head = nil
+}
@@ -0,0 +1,237 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+func setupAggregator(t *testing.T) *aggregator.Aggregator {
+	t.Helper()
+	agg := aggregator.New(storage.NewInMemoryStorage(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	agg.Start(ctx)
+	return agg
+}
+
+// newTailer создаёт Tailer без фонового цикла: тесты вызывают poll сами
+func newTailer(t *testing.T, agg *aggregator.Aggregator, cfg Config) *Tailer {
+	t.Helper()
+	tl := NewTailer(agg, cfg)
+	positions, err := loadPositions(cfg.OffsetsFile)
+	if err != nil {
+		t.Fatalf("loadPositions failed: %v", err)
+	}
+	tl.positions = positions
+	return tl
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	f.WriteString(data)
+}
+
+func waitForCount(t *testing.T, agg *aggregator.Aggregator, userID string, count int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if data := agg.GetAggregatedData(userID, "", time.Time{}, time.Time{}); data != nil && data.Count == count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events for %s, got %+v", count, userID, agg.GetAggregatedData(userID, "", time.Time{}, time.Time{}))
+}
+
+func TestParseCSV(t *testing.T) {
+	header, _ := parseCSVHeader("type,user_id,value,timestamp,region")
+	e, err := parseCSV(header, `click,u1,2.5,2024-01-01T00:00:00Z,"eu, west"`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.Type != "click" || e.UserID != "u1" || e.Value != 2.5 || e.Attributes["region"] != "eu, west" {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+
+	for _, line := range []string{"click,u1", "click,u1,abc,,", "click,u1,1,yesterday,"} {
+		if _, err := parseCSV(header, line); err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func TestTailer_NDJSONPartialAndMalformed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	quarantine := filepath.Join(dir, "quarantine.ndjson")
+	agg := setupAggregator(t)
+
+	q, _ := os.Create(quarantine)
+	tl := newTailer(t, agg, Config{Path: path})
+	tl.quarantine = q
+	defer q.Close()
+
+	appendFile(t, path, `{"type":"click","user_id":"u1","value":1}`+"\n"+
+		"not json\n"+
+		`{"type":"click","value":1}`+"\n"+
+		`{"type":"click","user_id":"u1",`)
+	tl.poll()
+	waitForCount(t, agg, "u1", 1)
+
+	appendFile(t, path, `"value":2}`+"\n")
+	tl.poll()
+	waitForCount(t, agg, "u1", 2)
+
+	s := tl.Stats()
+	if s.Events != 2 || s.Malformed != 2 || s.Files != 1 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+
+	f, _ := os.Open(quarantine)
+	defer f.Close()
+	var records []QuarantineRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r QuarantineRecord
+		json.Unmarshal(scanner.Bytes(), &r)
+		records = append(records, r)
+	}
+	if len(records) != 2 || records[0].Line != "not json" || records[1].Error == "" {
+		t.Errorf("Unexpected quarantine records: %+v", records)
+	}
+}
+
+func TestTailer_ResumeFromOffsets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	offsets := filepath.Join(dir, "offsets.json")
+	agg := setupAggregator(t)
+
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`+"\n")
+	tl := newTailer(t, agg, Config{Path: path, OffsetsFile: offsets})
+	tl.poll()
+	waitForCount(t, agg, "u1", 1)
+
+	// "Перезапуск": новый Tailer с тем же файлом позиций читает только новые строки
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`+"\n")
+	tl = newTailer(t, agg, Config{Path: path, OffsetsFile: offsets})
+	tl.poll()
+	waitForCount(t, agg, "u1", 2)
+	if s := tl.Stats(); s.Events != 1 {
+		t.Errorf("Expected 1 new event after resume, got %+v", s)
+	}
+
+	// Файл заменён другим: позиция не подходит, чтение с начала
+	os.Remove(path)
+	appendFile(t, path, `{"type":"view","user_id":"u2"}`+"\n"+`{"type":"view","user_id":"u2"}`+"\n")
+	tl = newTailer(t, agg, Config{Path: path, OffsetsFile: offsets})
+	tl.poll()
+	waitForCount(t, agg, "u2", 2)
+}
+
+func TestTailer_DeterministicIDs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`+"\n"+
+		`{"type":"click","user_id":"u1"}`+"\n"+
+		`{"id":"own","type":"click","user_id":"u1"}`+"\n")
+
+	// Повторное чтение тех же строк (например, со старой позиции после
+	// перезапуска) даёт те же ID
+	ids := func() []string {
+		agg := setupAggregator(t)
+		newTailer(t, agg, Config{Path: path}).poll()
+		waitForCount(t, agg, "u1", 3)
+		var ids []string
+		agg.Tenant("").Scan(storage.GroupFilter{}, func(e models.Event) bool {
+			ids = append(ids, e.ID)
+			return true
+		})
+		sort.Strings(ids)
+		return ids
+	}
+	first, second := ids(), ids()
+	if !slices.Equal(first, second) {
+		t.Errorf("Expected the same IDs on re-read, got %v and %v", first, second)
+	}
+	if len(first) != 3 || first[0] == first[1] || !slices.Contains(first, "own") {
+		t.Errorf("Expected distinct IDs for identical lines and the own id kept, got %v", first)
+	}
+}
+
+func TestTailer_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.ndjson")
+	agg := setupAggregator(t)
+	tl := newTailer(t, agg, Config{Path: path})
+
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`+"\n")
+	tl.poll()
+	waitForCount(t, agg, "u1", 1)
+
+	// Запись после последней проверки попадает в уже переименованный файл
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`)
+	os.Rename(path, path+".1")
+	appendFile(t, path, `{"type":"click","user_id":"u1"}`+"\n")
+	tl.poll()
+	waitForCount(t, agg, "u1", 3)
+
+	// Усечение файла
+	os.Truncate(path, 0)
+	appendFile(t, path, `{"type":"x","user_id":"u2"}`+"\n")
+	tl.poll()
+	waitForCount(t, agg, "u2", 1)
+
+	if s := tl.Stats(); s.Rotations != 2 {
+		t.Errorf("Expected 2 rotations, got %+v", s)
+	}
+}
+
+func TestTailer_DirectoryCSV(t *testing.T) {
+	dir := t.TempDir()
+	offsets := filepath.Join(dir, "offsets.json")
+	agg := setupAggregator(t)
+
+	appendFile(t, filepath.Join(dir, "a.csv"), "type,user_id,value\nclick,u1,1\n")
+	appendFile(t, filepath.Join(dir, "b.csv"), "user_id,type\nu1,view\n")
+	appendFile(t, filepath.Join(dir, "ignored.txt"), "garbage\n")
+
+	tl := NewTailer(agg, Config{Path: dir, Pattern: "*.csv", OffsetsFile: offsets, PollInterval: 10 * time.Millisecond})
+	if err := tl.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	waitForCount(t, agg, "u1", 2)
+	if err := tl.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// После перезапуска заголовок CSV восстанавливается из начала файла
+	appendFile(t, filepath.Join(dir, "b.csv"), "u1,view\n")
+	tl = NewTailer(agg, Config{Path: dir, Pattern: "*.csv", OffsetsFile: offsets, PollInterval: 10 * time.Millisecond})
+	tl.Start(context.Background())
+	defer tl.Close()
+	waitForCount(t, agg, "u1", 3)
+
+	if data := agg.GetAggregatedData("u1", "view", time.Time{}, time.Time{}); data == nil || data.Count != 2 {
+		t.Errorf("Unexpected view aggregate: %+v", data)
+	}
+	if s := tl.Stats(); s.Files != 2 || s.Malformed != 0 {
+		t.Errorf("Unexpected stats: %+v", s)
+	}
+}
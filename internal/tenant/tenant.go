@@ -0,0 +1,257 @@
+// Package tenant - политики тенантов: срок хранения событий и квоты
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded - событие отклонено квотой тенанта
+var ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+// Duration - time.Duration в JSON в виде строки ("720h")
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"720h\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Policy - ограничения тенанта; нулевые значения не ограничивают
+type Policy struct {
+	// Retention - события старше (по timestamp) удаляются
+	Retention Duration `json:"retention,omitempty"`
+	// MaxEvents - максимум хранимых событий
+	MaxEvents int64 `json:"max_events,omitempty"`
+	// MaxEventsPerDay - максимум принятых событий за сутки (UTC)
+	MaxEventsPerDay int64 `json:"max_events_per_day,omitempty"`
+}
+
+func (p Policy) Validate() error {
+	if p.Retention < 0 || p.MaxEvents < 0 || p.MaxEventsPerDay < 0 {
+		return errors.New("policy limits must not be negative")
+	}
+	return nil
+}
+
+// Config - политика по умолчанию и переопределения для отдельных тенантов.
+//
+//	{"default": {"retention": "720h"}, "tenants": {"acme": {"max_events": 1000000}}}
+type Config struct {
+	Default Policy            `json:"default"`
+	Tenants map[string]Policy `json:"tenants,omitempty"`
+}
+
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	if err := cfg.Default.Validate(); err != nil {
+		return cfg, fmt.Errorf("default policy: %w", err)
+	}
+	for name, p := range cfg.Tenants {
+		if err := p.Validate(); err != nil {
+			return cfg, fmt.Errorf("tenant %q: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Usage - счётчики приёма событий тенанта
+type Usage struct {
+	// AcceptedToday - события, принятые с начала текущих суток (UTC)
+	AcceptedToday int64 `json:"accepted_today"`
+	// Accepted и Rejected - с момента запуска
+	Accepted int64 `json:"accepted"`
+	Rejected int64 `json:"rejected"`
+}
+
+type usage struct {
+	Usage
+	day time.Time
+}
+
+// Manager хранит политики тенантов и проверяет квоты при приёме событий.
+// Если задан файл, изменения политик сохраняются в него.
+type Manager struct {
+	mu       sync.Mutex
+	path     string
+	policies map[string]Policy
+	fallback Policy
+	usage    map[string]*usage
+	now      func() time.Time
+}
+
+func NewManager(cfg Config) *Manager {
+	m := &Manager{
+		policies: make(map[string]Policy, len(cfg.Tenants)),
+		fallback: cfg.Default,
+		usage:    make(map[string]*usage),
+		now:      time.Now,
+	}
+	for name, p := range cfg.Tenants {
+		m.policies[name] = p
+	}
+	return m
+}
+
+// LoadManager читает политики из файла конфигурации (см. Config).
+// Отсутствующий файл - политики без ограничений; он будет создан при первом
+// изменении политики.
+func LoadManager(path string) (*Manager, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	m := NewManager(cfg)
+	m.path = path
+	return m, nil
+}
+
+// Policy возвращает политику тенанта (или политику по умолчанию)
+func (m *Manager) Policy(tenant string) Policy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.policies[tenant]; ok {
+		return p
+	}
+	return m.fallback
+}
+
+// SetPolicy задаёт политику тенанта и сохраняет политики в файл
+func (m *Manager) SetPolicy(tenant string, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, existed := m.policies[tenant]
+	m.policies[tenant] = p
+	if err := m.save(); err != nil {
+		if existed {
+			m.policies[tenant] = old
+		} else {
+			delete(m.policies, tenant)
+		}
+		return err
+	}
+	return nil
+}
+
+// Policies возвращает переопределённые политики по тенантам
+func (m *Manager) Policies() map[string]Policy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[string]Policy, len(m.policies))
+	for name, p := range m.policies {
+		result[name] = p
+	}
+	return result
+}
+
+// Admit проверяет квоты тенанта перед приёмом события; stored - сколько
+// событий тенанта уже хранится. При успехе событие учитывается в суточном лимите.
+func (m *Manager) Admit(tenant string, stored int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.policies[tenant]
+	if !ok {
+		p = m.fallback
+	}
+	u := m.usageLocked(tenant)
+
+	switch {
+	case p.MaxEvents > 0 && stored >= p.MaxEvents:
+		u.Rejected++
+		return fmt.Errorf("%w: %d stored events (max %d)", ErrQuotaExceeded, stored, p.MaxEvents)
+	case p.MaxEventsPerDay > 0 && u.AcceptedToday >= p.MaxEventsPerDay:
+		u.Rejected++
+		return fmt.Errorf("%w: %d events today (max %d)", ErrQuotaExceeded, u.AcceptedToday, p.MaxEventsPerDay)
+	}
+	u.AcceptedToday++
+	u.Accepted++
+	return nil
+}
+
+// Release возвращает в суточный лимит событие, допущенное Admit, но так и
+// не принятое (например, очередь агрегатора переполнена)
+func (m *Manager) Release(tenant string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.usageLocked(tenant)
+	if u.AcceptedToday > 0 {
+		u.AcceptedToday--
+	}
+	if u.Accepted > 0 {
+		u.Accepted--
+	}
+}
+
+// Usage возвращает счётчики тенанта
+func (m *Manager) Usage(tenant string) Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usageLocked(tenant).Usage
+}
+
+func (m *Manager) usageLocked(tenant string) *usage {
+	day := m.now().UTC().Truncate(24 * time.Hour)
+	u, ok := m.usage[tenant]
+	if !ok {
+		u = &usage{day: day}
+		m.usage[tenant] = u
+	}
+	if !u.day.Equal(day) {
+		u.day = day
+		u.AcceptedToday = 0
+	}
+	return u
+}
+
+// save атомарно перезаписывает файл политик; вызывается под m.mu
+func (m *Manager) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(Config{Default: m.fallback, Tenants: m.policies}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ".tenants-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
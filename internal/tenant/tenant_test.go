@@ -0,0 +1,114 @@
+package tenant
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager_Admit(t *testing.T) {
+	m := NewManager(Config{
+		Default: Policy{MaxEvents: 2},
+		Tenants: map[string]Policy{"acme": {MaxEventsPerDay: 2}},
+	})
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	// Политика по умолчанию ограничивает хранимые события
+	if err := m.Admit("globex", 1); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := m.Admit("globex", 2); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// Суточный лимит acme сбрасывается в полночь UTC
+	for i := 0; i < 2; i++ {
+		if err := m.Admit("acme", 100); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := m.Admit("acme", 100); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if u := m.Usage("acme"); u.AcceptedToday != 2 || u.Accepted != 2 || u.Rejected != 1 {
+		t.Errorf("Unexpected usage: %+v", u)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := m.Admit("acme", 100); err != nil {
+		t.Errorf("Expected daily quota to reset, got %v", err)
+	}
+	if u := m.Usage("acme"); u.AcceptedToday != 1 || u.Accepted != 3 {
+		t.Errorf("Unexpected usage after reset: %+v", u)
+	}
+
+	if err := m.SetPolicy("acme", Policy{MaxEvents: -1}); err == nil {
+		t.Error("Expected error for negative limit")
+	}
+}
+
+func TestManager_Release(t *testing.T) {
+	m := NewManager(Config{Default: Policy{MaxEventsPerDay: 1}})
+
+	if err := m.Admit("acme", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Событие не попало в очередь - квота возвращается
+	m.Release("acme")
+	if u := m.Usage("acme"); u.AcceptedToday != 0 || u.Accepted != 0 {
+		t.Errorf("Unexpected usage after release: %+v", u)
+	}
+	if err := m.Admit("acme", 0); err != nil {
+		t.Errorf("Expected quota to be released, got %v", err)
+	}
+}
+
+func TestLoadManager_PersistsPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+
+	m, err := LoadManager(path)
+	if err != nil {
+		t.Fatalf("LoadManager failed: %v", err)
+	}
+	if err := m.SetPolicy("acme", Policy{MaxEvents: 10, Retention: Duration(time.Hour)}); err != nil {
+		t.Fatalf("SetPolicy failed: %v", err)
+	}
+
+	reloaded, err := LoadManager(path)
+	if err != nil {
+		t.Fatalf("LoadManager failed: %v", err)
+	}
+	if p := reloaded.Policy("acme"); p.MaxEvents != 10 || time.Duration(p.Retention) != time.Hour {
+		t.Errorf("Unexpected policy after reload: %+v", p)
+	}
+
+	// Ошибка записи откатывает изменение
+	m.path = filepath.Join(path, "missing", "tenants.json")
+	if err := m.SetPolicy("globex", Policy{MaxEvents: 1}); err == nil {
+		t.Error("Expected save error")
+	}
+	if _, ok := m.Policies()["globex"]; ok {
+		t.Error("Expected policy to be rolled back")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	os.WriteFile(path, []byte(`{"default":{"retention":"720h"},"tenants":{"acme":{"max_events":10}}}`), 0o644)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if time.Duration(cfg.Default.Retention) != 720*time.Hour || cfg.Tenants["acme"].MaxEvents != 10 {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	os.WriteFile(path, []byte(`{"default":{"retention":"forever"}}`), 0o644)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
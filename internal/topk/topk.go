@@ -0,0 +1,62 @@
+// Package topk - отбор k наибольших элементов за один проход
+package topk
+
+import (
+	"container/heap"
+	"slices"
+)
+
+// Top хранит k наибольших из добавленных элементов в min-куче: добавление -
+// O(log k), память - O(k) независимо от числа элементов
+type Top[T any] struct {
+	h minHeap[T]
+}
+
+// New создаёт отбор k элементов; less(a, b) - a меньше b
+func New[T any](k int, less func(a, b T) bool) *Top[T] {
+	return &Top[T]{h: minHeap[T]{k: k, less: less}}
+}
+
+// Push добавляет элемент, вытесняя наименьший, если отобрано уже k
+func (t *Top[T]) Push(v T) {
+	switch {
+	case t.h.k <= 0:
+	case len(t.h.items) < t.h.k:
+		heap.Push(&t.h, v)
+	case t.h.less(t.h.items[0], v):
+		t.h.items[0] = v
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// Sorted возвращает отобранные элементы от наибольшего к наименьшему
+func (t *Top[T]) Sorted() []T {
+	result := make([]T, len(t.h.items))
+	copy(result, t.h.items)
+	slices.SortFunc(result, func(a, b T) int {
+		switch {
+		case t.h.less(b, a):
+			return -1
+		case t.h.less(a, b):
+			return 1
+		}
+		return 0
+	})
+	return result
+}
+
+type minHeap[T any] struct {
+	k     int
+	items []T
+	less  func(a, b T) bool
+}
+
+func (h minHeap[T]) Len() int           { return len(h.items) }
+func (h minHeap[T]) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h minHeap[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *minHeap[T]) Push(x any)        { h.items = append(h.items, x.(T)) }
+func (h *minHeap[T]) Pop() any {
+	v := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return v
+}
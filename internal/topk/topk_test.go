@@ -0,0 +1,34 @@
+package topk
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestTop(t *testing.T) {
+	values := rand.Perm(1000)
+	top := New(5, func(a, b int) bool { return a < b })
+	for _, v := range values {
+		top.Push(v)
+	}
+	if got, want := top.Sorted(), []int{999, 998, 997, 996, 995}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestTop_FewerThanK(t *testing.T) {
+	top := New(10, func(a, b int) bool { return a < b })
+	for _, v := range []int{3, 1, 2} {
+		top.Push(v)
+	}
+	if got := top.Sorted(); !slices.Equal(got, []int{3, 2, 1}) {
+		t.Errorf("Expected [3 2 1], got %v", got)
+	}
+
+	empty := New(0, func(a, b int) bool { return a < b })
+	empty.Push(1)
+	if got := empty.Sorted(); len(got) != 0 {
+		t.Errorf("Expected nothing for k=0, got %v", got)
+	}
+}
@@ -0,0 +1,832 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: eventaggregator/v1/events.proto
+
+package eventpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Event - событие; поля совпадают с JSON-событием HTTP API
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id - пустой ID заменяется сгенерированным
+	Id     string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type   string  `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	UserId string  `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Value  float64 `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
+	// unit - единица измерения value (ms, bytes, USD и т.п.)
+	Unit string `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+	// timestamp - время события; без него - время приёма
+	Timestamp  *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Attributes map[string]string      `protobuf:"bytes,7,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// tenant - владелец события; при приёме задаётся по API-ключу
+	Tenant        string `protobuf:"bytes,8,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Event) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Event) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+func (x *Event) GetTenant() string {
+	if x != nil {
+		return x.Tenant
+	}
+	return ""
+}
+
+type AggregatedData struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tenant        string                 `protobuf:"bytes,1,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	EventType     string                 `protobuf:"bytes,3,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	Count         int64                  `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	TotalValue    float64                `protobuf:"fixed64,5,opt,name=total_value,json=totalValue,proto3" json:"total_value,omitempty"`
+	AvgValue      float64                `protobuf:"fixed64,6,opt,name=avg_value,json=avgValue,proto3" json:"avg_value,omitempty"`
+	MinValue      float64                `protobuf:"fixed64,7,opt,name=min_value,json=minValue,proto3" json:"min_value,omitempty"`
+	MaxValue      float64                `protobuf:"fixed64,8,opt,name=max_value,json=maxValue,proto3" json:"max_value,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregatedData) Reset() {
+	*x = AggregatedData{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregatedData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregatedData) ProtoMessage() {}
+
+func (x *AggregatedData) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregatedData.ProtoReflect.Descriptor instead.
+func (*AggregatedData) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AggregatedData) GetTenant() string {
+	if x != nil {
+		return x.Tenant
+	}
+	return ""
+}
+
+func (x *AggregatedData) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *AggregatedData) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *AggregatedData) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *AggregatedData) GetTotalValue() float64 {
+	if x != nil {
+		return x.TotalValue
+	}
+	return 0
+}
+
+func (x *AggregatedData) GetAvgValue() float64 {
+	if x != nil {
+		return x.AvgValue
+	}
+	return 0
+}
+
+func (x *AggregatedData) GetMinValue() float64 {
+	if x != nil {
+		return x.MinValue
+	}
+	return 0
+}
+
+func (x *AggregatedData) GetMaxValue() float64 {
+	if x != nil {
+		return x.MaxValue
+	}
+	return 0
+}
+
+func (x *AggregatedData) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *AggregatedData) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+type SendEventRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         *Event                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendEventRequest) Reset() {
+	*x = SendEventRequest{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendEventRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendEventRequest) ProtoMessage() {}
+
+func (x *SendEventRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendEventRequest.ProtoReflect.Descriptor instead.
+func (*SendEventRequest) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SendEventRequest) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+type SendEventResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendEventResponse) Reset() {
+	*x = SendEventResponse{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendEventResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendEventResponse) ProtoMessage() {}
+
+func (x *SendEventResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendEventResponse.ProtoReflect.Descriptor instead.
+func (*SendEventResponse) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SendEventResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SendEventResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+// EventError - ошибка приёма события с его порядковым номером в потоке
+type EventError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int64                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventError) Reset() {
+	*x = EventError{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventError) ProtoMessage() {}
+
+func (x *EventError) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventError.ProtoReflect.Descriptor instead.
+func (*EventError) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EventError) GetIndex() int64 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *EventError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type SendEventsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Accepted int64                  `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected int64                  `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	// errors - ошибки первых 100 отклонённых событий; остальные учтены только
+	// в rejected
+	Errors        []*EventError `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendEventsResponse) Reset() {
+	*x = SendEventsResponse{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendEventsResponse) ProtoMessage() {}
+
+func (x *SendEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendEventsResponse.ProtoReflect.Descriptor instead.
+func (*SendEventsResponse) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SendEventsResponse) GetAccepted() int64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *SendEventsResponse) GetRejected() int64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *SendEventsResponse) GetErrors() []*EventError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type QueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	From          *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryRequest) Reset() {
+	*x = QueryRequest{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryRequest) ProtoMessage() {}
+
+func (x *QueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryRequest.ProtoReflect.Descriptor instead.
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *QueryRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *QueryRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *QueryRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type QueryResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// data не задано, если под фильтры не попало ни одного события
+	Data          *AggregatedData `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryResponse) Reset() {
+	*x = QueryResponse{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryResponse) ProtoMessage() {}
+
+func (x *QueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryResponse.ProtoReflect.Descriptor instead.
+func (*QueryResponse) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *QueryResponse) GetData() *AggregatedData {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Attributes    map[string]string      `protobuf:"bytes,3,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SubscribeRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+type StreamEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Event         *Event                 `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEvent) Reset() {
+	*x = StreamEvent{}
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEvent) ProtoMessage() {}
+
+func (x *StreamEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_eventaggregator_v1_events_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEvent.ProtoReflect.Descriptor instead.
+func (*StreamEvent) Descriptor() ([]byte, []int) {
+	return file_eventaggregator_v1_events_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StreamEvent) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StreamEvent) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+var File_eventaggregator_v1_events_proto protoreflect.FileDescriptor
+
+const file_eventaggregator_v1_events_proto_rawDesc = "" +
+	"\n" +
+	"\x1feventaggregator/v1/events.proto\x12\x12eventaggregator.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xca\x02\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x05 \x01(\tR\x04unit\x128\n" +
+	"\ttimestamp\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12I\n" +
+	"\n" +
+	"attributes\x18\a \x03(\v2).eventaggregator.v1.Event.AttributesEntryR\n" +
+	"attributes\x12\x16\n" +
+	"\x06tenant\x18\b \x01(\tR\x06tenant\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xe0\x02\n" +
+	"\x0eAggregatedData\x12\x16\n" +
+	"\x06tenant\x18\x01 \x01(\tR\x06tenant\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x03 \x01(\tR\teventType\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x03R\x05count\x12\x1f\n" +
+	"\vtotal_value\x18\x05 \x01(\x01R\n" +
+	"totalValue\x12\x1b\n" +
+	"\tavg_value\x18\x06 \x01(\x01R\bavgValue\x12\x1b\n" +
+	"\tmin_value\x18\a \x01(\x01R\bminValue\x12\x1b\n" +
+	"\tmax_value\x18\b \x01(\x01R\bmaxValue\x129\n" +
+	"\n" +
+	"start_time\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\"C\n" +
+	"\x10SendEventRequest\x12/\n" +
+	"\x05event\x18\x01 \x01(\v2\x19.eventaggregator.v1.EventR\x05event\";\n" +
+	"\x11SendEventResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"8\n" +
+	"\n" +
+	"EventError\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x03R\x05index\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x84\x01\n" +
+	"\x12SendEventsResponse\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x03R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x03R\brejected\x126\n" +
+	"\x06errors\x18\x03 \x03(\v2\x1e.eventaggregator.v1.EventErrorR\x06errors\"\x97\x01\n" +
+	"\fQueryRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12.\n" +
+	"\x04from\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\"G\n" +
+	"\rQueryResponse\x126\n" +
+	"\x04data\x18\x01 \x01(\v2\".eventaggregator.v1.AggregatedDataR\x04data\"\xd4\x01\n" +
+	"\x10SubscribeRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12T\n" +
+	"\n" +
+	"attributes\x18\x03 \x03(\v24.eventaggregator.v1.SubscribeRequest.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"P\n" +
+	"\vStreamEvent\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12/\n" +
+	"\x05event\x18\x02 \x01(\v2\x19.eventaggregator.v1.EventR\x05event2\xea\x02\n" +
+	"\fEventService\x12X\n" +
+	"\tSendEvent\x12$.eventaggregator.v1.SendEventRequest\x1a%.eventaggregator.v1.SendEventResponse\x12\\\n" +
+	"\n" +
+	"SendEvents\x12$.eventaggregator.v1.SendEventRequest\x1a&.eventaggregator.v1.SendEventsResponse(\x01\x12L\n" +
+	"\x05Query\x12 .eventaggregator.v1.QueryRequest\x1a!.eventaggregator.v1.QueryResponse\x12T\n" +
+	"\tSubscribe\x12$.eventaggregator.v1.SubscribeRequest\x1a\x1f.eventaggregator.v1.StreamEvent0\x01B4Z2github.com/bashkirian/event-aggregator/pkg/eventpbb\x06proto3"
+
+var (
+	file_eventaggregator_v1_events_proto_rawDescOnce sync.Once
+	file_eventaggregator_v1_events_proto_rawDescData []byte
+)
+
+func file_eventaggregator_v1_events_proto_rawDescGZIP() []byte {
+	file_eventaggregator_v1_events_proto_rawDescOnce.Do(func() {
+		file_eventaggregator_v1_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_eventaggregator_v1_events_proto_rawDesc), len(file_eventaggregator_v1_events_proto_rawDesc)))
+	})
+	return file_eventaggregator_v1_events_proto_rawDescData
+}
+
+var file_eventaggregator_v1_events_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_eventaggregator_v1_events_proto_goTypes = []any{
+	(*Event)(nil),                 // 0: eventaggregator.v1.Event
+	(*AggregatedData)(nil),        // 1: eventaggregator.v1.AggregatedData
+	(*SendEventRequest)(nil),      // 2: eventaggregator.v1.SendEventRequest
+	(*SendEventResponse)(nil),     // 3: eventaggregator.v1.SendEventResponse
+	(*EventError)(nil),            // 4: eventaggregator.v1.EventError
+	(*SendEventsResponse)(nil),    // 5: eventaggregator.v1.SendEventsResponse
+	(*QueryRequest)(nil),          // 6: eventaggregator.v1.QueryRequest
+	(*QueryResponse)(nil),         // 7: eventaggregator.v1.QueryResponse
+	(*SubscribeRequest)(nil),      // 8: eventaggregator.v1.SubscribeRequest
+	(*StreamEvent)(nil),           // 9: eventaggregator.v1.StreamEvent
+	nil,                           // 10: eventaggregator.v1.Event.AttributesEntry
+	nil,                           // 11: eventaggregator.v1.SubscribeRequest.AttributesEntry
+	(*timestamppb.Timestamp)(nil), // 12: google.protobuf.Timestamp
+}
+var file_eventaggregator_v1_events_proto_depIdxs = []int32{
+	12, // 0: eventaggregator.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	10, // 1: eventaggregator.v1.Event.attributes:type_name -> eventaggregator.v1.Event.AttributesEntry
+	12, // 2: eventaggregator.v1.AggregatedData.start_time:type_name -> google.protobuf.Timestamp
+	12, // 3: eventaggregator.v1.AggregatedData.end_time:type_name -> google.protobuf.Timestamp
+	0,  // 4: eventaggregator.v1.SendEventRequest.event:type_name -> eventaggregator.v1.Event
+	4,  // 5: eventaggregator.v1.SendEventsResponse.errors:type_name -> eventaggregator.v1.EventError
+	12, // 6: eventaggregator.v1.QueryRequest.from:type_name -> google.protobuf.Timestamp
+	12, // 7: eventaggregator.v1.QueryRequest.to:type_name -> google.protobuf.Timestamp
+	1,  // 8: eventaggregator.v1.QueryResponse.data:type_name -> eventaggregator.v1.AggregatedData
+	11, // 9: eventaggregator.v1.SubscribeRequest.attributes:type_name -> eventaggregator.v1.SubscribeRequest.AttributesEntry
+	0,  // 10: eventaggregator.v1.StreamEvent.event:type_name -> eventaggregator.v1.Event
+	2,  // 11: eventaggregator.v1.EventService.SendEvent:input_type -> eventaggregator.v1.SendEventRequest
+	2,  // 12: eventaggregator.v1.EventService.SendEvents:input_type -> eventaggregator.v1.SendEventRequest
+	6,  // 13: eventaggregator.v1.EventService.Query:input_type -> eventaggregator.v1.QueryRequest
+	8,  // 14: eventaggregator.v1.EventService.Subscribe:input_type -> eventaggregator.v1.SubscribeRequest
+	3,  // 15: eventaggregator.v1.EventService.SendEvent:output_type -> eventaggregator.v1.SendEventResponse
+	5,  // 16: eventaggregator.v1.EventService.SendEvents:output_type -> eventaggregator.v1.SendEventsResponse
+	7,  // 17: eventaggregator.v1.EventService.Query:output_type -> eventaggregator.v1.QueryResponse
+	9,  // 18: eventaggregator.v1.EventService.Subscribe:output_type -> eventaggregator.v1.StreamEvent
+	15, // [15:19] is the sub-list for method output_type
+	11, // [11:15] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_eventaggregator_v1_events_proto_init() }
+func file_eventaggregator_v1_events_proto_init() {
+	if File_eventaggregator_v1_events_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_eventaggregator_v1_events_proto_rawDesc), len(file_eventaggregator_v1_events_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_eventaggregator_v1_events_proto_goTypes,
+		DependencyIndexes: file_eventaggregator_v1_events_proto_depIdxs,
+		MessageInfos:      file_eventaggregator_v1_events_proto_msgTypes,
+	}.Build()
+	File_eventaggregator_v1_events_proto = out.File
+	file_eventaggregator_v1_events_proto_goTypes = nil
+	file_eventaggregator_v1_events_proto_depIdxs = nil
+}
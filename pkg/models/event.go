@@ -5,14 +5,21 @@ import "time"
 // Event представляет входящее событие
 type Event struct {
     ID        string    `json:"id"`
+    // Tenant - владелец события; задаётся по API-ключу, "" - тенант по умолчанию
+    Tenant    string    `json:"tenant,omitempty"`
     Type      string    `json:"type"`
     UserID    string    `json:"user_id"`
     Value     float64   `json:"value"`
+    // Unit - единица измерения value (ms, bytes, USD и т.п.)
+    Unit      string    `json:"unit,omitempty"`
     Timestamp time.Time `json:"timestamp"`
+    // Attributes - произвольные метки события (страна, платформа и т.п.)
+    Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // AggregatedData результат агрегации
 type AggregatedData struct {
+    Tenant     string    `json:"tenant,omitempty"`
     UserID     string    `json:"user_id"`
     EventType  string    `json:"event_type"`
     Count      int64     `json:"count"`
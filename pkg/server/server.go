@@ -3,31 +3,275 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path/filepath"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/bashkirian/event-aggregator/internal/aggregator"
+	"github.com/bashkirian/event-aggregator/internal/alert"
+	"github.com/bashkirian/event-aggregator/internal/archive"
+	"github.com/bashkirian/event-aggregator/internal/auth"
+	"github.com/bashkirian/event-aggregator/internal/deadletter"
+	"github.com/bashkirian/event-aggregator/internal/grpcapi"
 	"github.com/bashkirian/event-aggregator/internal/handler"
+	"github.com/bashkirian/event-aggregator/internal/ratelimit"
+	"github.com/bashkirian/event-aggregator/internal/schema"
+	"github.com/bashkirian/event-aggregator/internal/source"
+	"github.com/bashkirian/event-aggregator/internal/statsd"
 	"github.com/bashkirian/event-aggregator/internal/storage"
+	"github.com/bashkirian/event-aggregator/internal/tail"
+	"github.com/bashkirian/event-aggregator/internal/tenant"
+	"github.com/bashkirian/event-aggregator/pkg/models"
+)
+
+// Config - параметры сервера. Пустые значения отключают соответствующий
+// компонент (кроме Port).
+type Config struct {
+	// Port - порт HTTP API
+	Port string
+	// GRPCPort - порт gRPC-сервиса приёма событий
+	GRPCPort string
+	// StatsDAddr и StatsDTCPAddr - адреса приёма метрик StatsD по UDP и TCP
+	StatsDAddr    string
+	StatsDTCPAddr string
+	// StatsD - правила преобразования метрик StatsD в события
+	StatsD statsd.Config
+	// Tail - чтение событий из файла или каталога (включается при Tail.Path != "")
+	Tail tail.Config
+	// Sources - внешние источники сообщений (брокеры) по именам; сервер читает
+	// их до Shutdown и закрывает при остановке
+	Sources map[string]source.Source
+	// DeadLetterMaxEntries и DeadLetterMaxAge - ограничения хранения отклонённых
+	// событий (по умолчанию 10000 записей и 7 дней)
+	DeadLetterMaxEntries int
+	DeadLetterMaxAge     time.Duration
+	// ArchivePath - NDJSON-журнал всех принятых событий для последующего replay
+	ArchivePath string
+	// ReplayDir - каталог архивов, доступных для replay (по умолчанию каталог ArchivePath)
+	ReplayDir string
+	// Tenants - срок хранения и квоты тенантов (см. tenant.LoadManager); nil -
+	// без ограничений
+	Tenants *tenant.Manager
+	// RateLimit - лимиты частоты приёма событий по API-ключу, IP и user_id
+	// (по умолчанию без ограничений)
+	RateLimit ratelimit.Config
+	// Schemas - реестр схем типов событий; nil - пустой реестр в памяти
+	Schemas *schema.Registry
+	// Storage - рабочее хранилище событий (см. storage.Factory); nil -
+	// storage.EngineMemory
+	Storage storage.Storage
+	// NewStorage - конструктор хранилищ, в которые replay загружает архив;
+	// nil - storage.EngineMemory
+	NewStorage func() (storage.Storage, error)
+	// APIKeys включает аутентификацию HTTP и gRPC API по ключам; nil - API открыт.
+	// Ключ определяет права (ingest, query, admin) и тенант запроса.
+	APIKeys *auth.KeyStore
+}
+
+const (
+	defaultDeadLetterMaxEntries = 10000
+	defaultDeadLetterMaxAge     = 7 * 24 * time.Hour
 )
 
 type Server struct {
 	httpServer *http.Server
 	aggregator *aggregator.Aggregator
+	alerts     *alert.Engine
+	grpcServer *grpcapi.Server
+	grpcAddr   string
+	statsd     *statsd.Listener
+	tailer     *tail.Tailer
+	consumers  map[string]*source.Consumer
+	archive    *archive.Writer
+	cfg        Config
+
+	// ctx живёт до Shutdown и останавливает фоновые компоненты (агрегатор и т.п.)
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewServer(port string) *Server {
+	return NewServerWithConfig(Config{Port: port})
+}
+
+func NewServerWithConfig(cfg Config) *Server {
+	port := cfg.Port
 	// Инициализация компонентов (как в main.go)
-	store := storage.NewInMemoryStorage()
+	store := cfg.Storage
+	if store == nil {
+		store = storage.NewShardedStorage(storage.DefaultShards)
+	}
 	agg := aggregator.New(store, 1000)
+	tenants := cfg.Tenants
+	if tenants == nil {
+		tenants = tenant.NewManager(tenant.Config{})
+	}
+	agg.SetTenants(tenants)
+	if cfg.Schemas == nil {
+		cfg.Schemas = schema.NewRegistry()
+	}
+	agg.SetSchemas(cfg.Schemas)
+	schemas := handler.NewSchemasHandler(cfg.Schemas)
 	h := handler.New(agg)
+	tenantsHandler := handler.NewTenantsHandler(agg, tenants)
+
+	if cfg.DeadLetterMaxEntries == 0 {
+		cfg.DeadLetterMaxEntries = defaultDeadLetterMaxEntries
+	}
+	if cfg.DeadLetterMaxAge == 0 {
+		cfg.DeadLetterMaxAge = defaultDeadLetterMaxAge
+	}
+	deadLetters := deadletter.NewStore(cfg.DeadLetterMaxEntries, cfg.DeadLetterMaxAge)
+	h.SetDeadLetters(deadLetters)
+	db, _ := store.(*storage.SQLiteStorage)
+	if db != nil {
+		// Приём уже подтверждён клиенту: незаписанные события можно повторить из dead-letter
+		db.OnWriteFailure(func(events []models.Event, err error) {
+			for _, e := range events {
+				deadLetters.AddEvent("storage", deadletter.KindFailed, err, e)
+			}
+		})
+	}
+
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled() {
+		limiter = ratelimit.New(cfg.RateLimit)
+		h.SetRateLimiter(limiter)
+	}
+	dlq := handler.NewDeadLettersHandler(deadLetters, agg)
+
+	alerts := alert.NewEngine(agg, alert.NewDispatcher(alert.DispatcherConfig{}), 1000)
+	agg.OnEvent(alerts.Observe)
+	rules := handler.NewRulesHandler(alerts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var authn *auth.Authenticator
+	if cfg.APIKeys != nil {
+		authn = auth.NewAuthenticator(cfg.APIKeys)
+	}
+	ingest := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeIngest, h) }
+	query := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeQuery, h) }
+	admin := func(h http.HandlerFunc) http.HandlerFunc { return authn.Require(auth.ScopeAdmin, h) }
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/events", h.HandlePostEvent)
-	mux.HandleFunc("/aggregated", h.HandleGetAggregated)
-	mux.HandleFunc("/aggregated/all", h.HandleGetAllAggregated)
+	// POST /events - приём, GET /events - поиск; права у них разные
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			query(h.HandleSearchEvents)(w, r)
+			return
+		}
+		ingest(h.HandlePostEvent)(w, r)
+	})
+	mux.HandleFunc("/events/{id}", query(h.HandleGetEvent))
+	mux.HandleFunc("/aggregated", query(h.HandleGetAggregated))
+	mux.HandleFunc("/aggregated/all", query(h.HandleGetAllAggregated))
+	mux.HandleFunc("/aggregated/top", query(h.HandleGetTop))
+	mux.HandleFunc("/aggregated/compare", query(h.HandleCompareAggregated))
+	mux.HandleFunc("/query", query(h.HandleQuery))
 	mux.HandleFunc("/health", h.HandleHealth)
+	mux.HandleFunc("/", handler.NotFound)
+	mux.HandleFunc("/stats", query(tenantsHandler.HandleOwnStats))
+	// Браузерные EventSource и WebSocket передают ключ в параметре api_key
+	mux.HandleFunc("/stream", authn.RequireStream(auth.ScopeQuery, h.HandleStream))
+	mux.HandleFunc("/ws", authn.RequireStream(auth.ScopeQuery, h.HandleWebSocket))
+	mux.HandleFunc("/admin/snapshot", admin(h.HandleSnapshot))
+	mux.HandleFunc("/admin/purge", admin(h.HandlePurge))
+	mux.HandleFunc("/admin/schemas", admin(schemas.HandleSchemas))
+	mux.HandleFunc("/admin/schemas/{type}", admin(schemas.HandleSchema))
+	mux.HandleFunc("/admin/schemas/{type}/versions", admin(schemas.HandleVersions))
+	mux.HandleFunc("/admin/schemas/{type}/versions/{version}", admin(schemas.HandleVersion))
+	mux.HandleFunc("/admin/schemas/{type}/validate", admin(schemas.HandleValidate))
+	mux.HandleFunc("/admin/tenants", admin(tenantsHandler.HandleTenants))
+	mux.HandleFunc("/admin/tenants/{tenant}", admin(tenantsHandler.HandleTenant))
+	mux.HandleFunc("/admin/deadletters", admin(dlq.HandleList))
+	mux.HandleFunc("/admin/deadletters/{id}", admin(dlq.HandleEntry))
+	mux.HandleFunc("/admin/deadletters/{id}/replay", admin(dlq.HandleReplay))
+	mux.HandleFunc("/admin/deadletters/replay", admin(dlq.HandleReplayAll))
+	mux.HandleFunc("/admin/deadletters/purge", admin(dlq.HandlePurge))
+	mux.HandleFunc("/rules", admin(rules.HandleRules))
+	mux.HandleFunc("/rules/{id}", admin(rules.HandleRule))
+	mux.HandleFunc("/deliveries", admin(rules.HandleDeliveries))
+	if cfg.APIKeys != nil {
+		keys := handler.NewKeysHandler(cfg.APIKeys)
+		mux.HandleFunc("/admin/keys", admin(keys.HandleKeys))
+		mux.HandleFunc("/admin/keys/{id}", admin(keys.HandleKey))
+	}
+
+	if limiter != nil {
+		mux.HandleFunc("/admin/ratelimit", admin(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(limiter.Stats())
+		}))
+	}
+
+	if db != nil {
+		mux.HandleFunc("/admin/storage", admin(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(db.WriteStats())
+		}))
+	}
+
+	var statsdListener *statsd.Listener
+	if cfg.StatsDAddr != "" || cfg.StatsDTCPAddr != "" {
+		statsdListener = statsd.NewListener(agg, cfg.StatsD)
+		statsdListener.SetDeadLetters(deadLetters)
+		mux.HandleFunc("/admin/statsd", admin(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(statsdListener.Stats())
+		}))
+	}
+
+	if cfg.ArchivePath != "" || cfg.ReplayDir != "" {
+		dir, file := cfg.ReplayDir, ""
+		if cfg.ArchivePath != "" {
+			if dir == "" {
+				dir = filepath.Dir(cfg.ArchivePath)
+			}
+			file, _ = filepath.Rel(dir, cfg.ArchivePath)
+		}
+		replayer := archive.NewReplayer(agg, dir, file)
+		if cfg.NewStorage != nil {
+			replayer.SetNewStorage(cfg.NewStorage)
+		}
+		replay := handler.NewReplayHandler(ctx, replayer)
+		mux.HandleFunc("/admin/replay", admin(replay.HandleReplay))
+		mux.HandleFunc("/admin/replay/{id}", admin(replay.HandleJob))
+		mux.HandleFunc("/admin/replay/{id}/swap", admin(replay.HandleSwap))
+		mux.HandleFunc("/admin/replay/{id}/aggregated", admin(replay.HandleAggregated))
+	}
+
+	var tailer *tail.Tailer
+	if cfg.Tail.Path != "" {
+		tailer = tail.NewTailer(agg, cfg.Tail)
+		mux.HandleFunc("/admin/tail", admin(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tailer.Stats())
+		}))
+	}
+
+	consumers := make(map[string]*source.Consumer)
+	for name, src := range cfg.Sources {
+		consumers[name] = source.NewConsumer(agg, src, name)
+		consumers[name].SetDeadLetters(deadLetters)
+	}
+	if len(consumers) > 0 {
+		mux.HandleFunc("/admin/sources", admin(func(w http.ResponseWriter, r *http.Request) {
+			stats := make(map[string]source.ConsumerStats, len(consumers))
+			for name, c := range consumers {
+				stats[name] = c.Stats()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(stats)
+		}))
+	}
 
 	httpServer := &http.Server{
 		Addr:         ":" + port,
@@ -36,28 +280,129 @@ func NewServer(port string) *Server {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Shutdown не дожидается закрытия долгих SSE-соединений сам
+	httpServer.RegisterOnShutdown(h.Close)
 
-	return &Server{
+	srv := &Server{
 		httpServer: httpServer,
 		aggregator: agg,
+		alerts:     alerts,
+		statsd:     statsdListener,
+		tailer:     tailer,
+		consumers:  consumers,
+		cfg:        cfg,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	if cfg.GRPCPort != "" {
+		var opts []grpc.ServerOption
+		if cfg.APIKeys != nil {
+			opts = grpcapi.WithAPIKeys(cfg.APIKeys)
+		}
+		srv.grpcServer = grpcapi.NewServer(agg, opts...)
+		srv.grpcServer.SetDeadLetters(deadLetters)
+		srv.grpcServer.SetRateLimiter(limiter)
+		srv.grpcAddr = ":" + cfg.GRPCPort
 	}
+	return srv
 }
 
 func (s *Server) Start() error {
-	s.aggregator.Start(context.Background())
+	if err := s.startBackground(); err != nil {
+		return err
+	}
 	log.Printf("Server starting on %s", s.httpServer.Addr)
 	return s.httpServer.ListenAndServe()
 }
 
+// Serve запускает сервер на уже открытом listener (например, на случайном порту)
+func (s *Server) Serve(ln net.Listener) error {
+	if err := s.startBackground(); err != nil {
+		return err
+	}
+	log.Printf("Server starting on %s", ln.Addr())
+	return s.httpServer.Serve(ln)
+}
+
+// startBackground запускает агрегатор и дополнительные listeners
+func (s *Server) startBackground() error {
+	if s.cfg.ArchivePath != "" {
+		w, err := archive.OpenWriter(s.cfg.ArchivePath)
+		if err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		s.archive = w
+		s.aggregator.OnEvent(w.Write)
+	}
+	s.aggregator.Start(s.ctx)
+	s.alerts.Start(s.ctx)
+
+	if s.grpcServer != nil {
+		ln, err := net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("grpc listen: %w", err)
+		}
+		go func() {
+			if err := s.grpcServer.Serve(ln); err != nil {
+				log.Printf("gRPC server stopped: %v", err)
+			}
+		}()
+	}
+
+	if s.cfg.StatsDAddr != "" {
+		if _, err := s.statsd.ListenUDP(s.cfg.StatsDAddr); err != nil {
+			return fmt.Errorf("statsd udp listen: %w", err)
+		}
+	}
+	if s.cfg.StatsDTCPAddr != "" {
+		if _, err := s.statsd.ListenTCP(s.cfg.StatsDTCPAddr); err != nil {
+			return fmt.Errorf("statsd tcp listen: %w", err)
+		}
+	}
+	if s.tailer != nil {
+		if err := s.tailer.Start(s.ctx); err != nil {
+			return fmt.Errorf("tail: %w", err)
+		}
+	}
+	for name, c := range s.consumers {
+		go func() {
+			if err := c.Run(s.ctx); err != nil {
+				log.Printf("Source %s stopped: %v", name, err)
+			}
+		}()
+	}
+	return nil
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	var errs []error
+	if s.grpcServer != nil {
+		errs = append(errs, s.grpcServer.Shutdown(ctx))
+	}
+	if s.statsd != nil {
+		errs = append(errs, s.statsd.Close())
+	}
+	if s.tailer != nil {
+		errs = append(errs, s.tailer.Close())
+	}
+	for _, src := range s.cfg.Sources {
+		errs = append(errs, src.Close())
+	}
+	errs = append(errs, s.httpServer.Shutdown(ctx))
+	s.cancel()
+	errs = append(errs, s.aggregator.Close())
+	if s.archive != nil {
+		errs = append(errs, s.archive.Close())
+	}
+	return errors.Join(errs...)
 }
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		uri := auth.RedactURL(r.URL)
+		log.Printf("%s %s", r.Method, uri)
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s - completed in %v", r.Method, r.URL.Path, time.Since(start))
+		log.Printf("%s %s - completed in %v", r.Method, uri, time.Since(start))
 	})
 }
@@ -8,6 +8,10 @@ import (
 	"time"
 	"context"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/bashkirian/event-aggregator/pkg/eventpb"
 	"github.com/bashkirian/event-aggregator/pkg/server" // Импортируем main для запуска сервера
 	"github.com/bashkirian/event-aggregator/pkg/models"
 )
@@ -15,6 +19,24 @@ import (
 // Тестовый сервер и клиент
 var serverURL = "http://localhost:8080"
 
+// waitForServer ждёт, пока сервер начнёт принимать соединения
+func waitForServer(t *testing.T) {
+	t.Helper()
+	// Отдельный транспорт без keep-alive, чтобы не оставлять соединений,
+	// которых Shutdown будет дожидаться
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(serverURL + "/health")
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Server did not start in time")
+}
+
 func TestEventAggregationFlow(t *testing.T) {
 	// 1. Запускаем сервер в фоне
 	srv := server.NewServer("8080")
@@ -23,6 +45,7 @@ func TestEventAggregationFlow(t *testing.T) {
 			t.Errorf("Server failed: %v", err)
 		}
 	}()
+	waitForServer(t)
 
 	// 2. Отправляем событие через API
 	event := models.Event{
@@ -92,6 +115,8 @@ func TestHealthCheck(t *testing.T) {
 			t.Errorf("Server failed: %v", err)
 		}
 	}()
+	waitForServer(t)
+
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Get(serverURL + "/health")
 	if err != nil {
@@ -118,3 +143,72 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("Shutdown failed: %v", err)
 	}
 }
+
+func TestShutdownClosesStreams(t *testing.T) {
+	srv := server.NewServer("8080")
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Errorf("Server failed: %v", err)
+		}
+	}()
+	waitForServer(t)
+
+	resp, err := http.Get(serverURL + "/stream")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Открытый поток не должен задерживать остановку сервера
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestGRPCIngestion(t *testing.T) {
+	srv := server.NewServerWithConfig(server.Config{Port: "8080", GRPCPort: "9090"})
+	go func() {
+		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
+			t.Errorf("Server failed: %v", err)
+		}
+	}()
+	waitForServer(t)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient("localhost:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer conn.Close()
+
+	// Событие, принятое по gRPC, должно быть видно через HTTP API
+	c := eventpb.NewEventServiceClient(conn)
+	_, err = c.SendEvent(context.Background(), &eventpb.SendEventRequest{
+		Event: &eventpb.Event{Type: "purchase", UserId: "grpc-user", Value: 42},
+	})
+	if err != nil {
+		t.Fatalf("SendEvent failed: %v", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	resp, err := http.Get(serverURL + "/aggregated?user_id=grpc-user&type=purchase")
+	if err != nil {
+		t.Fatalf("Failed to get aggregated data: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var aggData models.AggregatedData
+	json.NewDecoder(resp.Body).Decode(&aggData)
+	if aggData.Count != 1 || aggData.TotalValue != 42 {
+		t.Errorf("Unexpected aggregate: %+v", aggData)
+	}
+}